@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/servercfg"
@@ -23,11 +27,11 @@ const (
 	google_provider_name   = "google"
 	azure_ad_provider_name = "azure-ad"
 	github_provider_name   = "github"
+	oidc_provider_name     = "oidc"
 	verify_user            = "verifyuser"
 	auth_key               = "netmaker_auth"
 )
 
-var oauth_state_string = "netmaker-oauth-state" // should be set randomly each provider login
 var auth_provider *oauth2.Config
 
 func getCurrentAuthFunctions() map[string]interface{} {
@@ -40,6 +44,8 @@ func getCurrentAuthFunctions() map[string]interface{} {
 		return azure_ad_functions
 	case github_provider_name:
 		return github_functions
+	case oidc_provider_name:
+		return oidc_functions
 	default:
 		return nil
 	}
@@ -53,7 +59,7 @@ func InitializeAuthProvider() string {
 	}
 	var _, err = fetchPassValue(logic.RandomString(64))
 	if err != nil {
-		logic.Log(err.Error(), 0)
+		logger.New(logger.API).Error("could not initialize the OAuth secret", err)
 		return ""
 	}
 	var currentFrontendURL = servercfg.GetFrontendURL()
@@ -64,13 +70,20 @@ func InitializeAuthProvider() string {
 	var serverConn = servercfg.GetAPIHost()
 	if strings.Contains(serverConn, "localhost") || strings.Contains(serverConn, "127.0.0.1") {
 		serverConn = "http://" + serverConn
-		logic.Log("localhost OAuth detected, proceeding with insecure http redirect: "+serverConn+")", 1)
+		logger.New(logger.API).With("redirect", serverConn).Log(logger.Verbose, "localhost OAuth detected, proceeding with insecure http redirect")
 	} else {
 		serverConn = "https://" + serverConn
-		logic.Log("external OAuth detected, proceeding with https redirect: ("+serverConn+")", 1)
+		logger.New(logger.API).With("redirect", serverConn).Log(logger.Verbose, "external OAuth detected, proceeding with https redirect")
 	}
 
 	functions[init_provider].(func(string, string, string))(serverConn+"/api/oauth/callback", authInfo[1], authInfo[2])
+	logic.RegisterJob(logic.Job{
+		Name:        "oauthstates",
+		Description: "removes the states of OAuth logins which were never completed",
+		Interval:    func() time.Duration { return oauth_state_ttl },
+		LeaderOnly:  true,
+		Run:         purgeExpiredOAuthStates,
+	})
 	return authInfo[0]
 }
 
@@ -78,7 +91,7 @@ func InitializeAuthProvider() string {
 func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	if auth_provider == nil {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprintln(w, oauthNotConfigured)
+		fmt.Fprint(w, oauthNotConfigured)
 		return
 	}
 	var functions = getCurrentAuthFunctions()
@@ -92,12 +105,12 @@ func HandleAuthCallback(w http.ResponseWriter, r *http.Request) {
 func HandleAuthLogin(w http.ResponseWriter, r *http.Request) {
 	if auth_provider == nil {
 		var referer = r.Header.Get("referer")
-		if referer != "" {
+		if referer != "" && isValidRedirect(referer) {
 			http.Redirect(w, r, referer+"?oauth=callback-error", http.StatusTemporaryRedirect)
 			return
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprintln(w, oauthNotConfigured)
+		fmt.Fprint(w, oauthNotConfigured)
 		return
 	}
 	var functions = getCurrentAuthFunctions()
@@ -119,10 +132,71 @@ func IsOauthUser(user *models.User) error {
 
 // == private methods ==
 
+// getLoginRedirect - completes an OAuth login, returns the frontend url carrying the user's jwt,
+// or only a TOTP token when the user has to provide a second factor like at the password login
+func getLoginRedirect(redirect string, username string) (string, error) {
+	var user, err = logic.GetUser(username)
+	if err != nil {
+		return "", err
+	}
+	if totpEnabled := logic.IsTOTPEnabled(username); totpEnabled || logic.IsTOTPRequired(&user) {
+		totpToken, err := logic.CreateTOTPToken(username)
+		if err != nil {
+			return "", err
+		}
+		return redirect + "?" + url.Values{
+			"totptoken":  {totpToken},
+			"totpenroll": {strconv.FormatBool(!totpEnabled)},
+			"user":       {username},
+		}.Encode(), nil
+	}
+	newPass, err := fetchPassValue("")
+	if err != nil {
+		return "", err
+	}
+	// send a netmaker jwt token
+	jwt, err := logic.VerifyAuthRequest(models.UserAuthParams{
+		UserName: username,
+		Password: newPass,
+	})
+	if err != nil {
+		return "", err
+	}
+	return redirect + "?" + url.Values{"login": {jwt}, "user": {username}}.Encode(), nil
+}
+
+// syncUser - makes sure an OAuth user exists and, when group mappings are configured,
+// re-evaluates the user's networks and admin status from their identity provider groups
+func syncUser(username string, groups []string) error {
+	var user, err = logic.GetUser(username)
+	if err != nil { // user must not exist, so try to make one
+		if err = addUser(username); err != nil {
+			return err
+		}
+		if user, err = logic.GetUser(username); err != nil {
+			return err
+		}
+	}
+	if len(servercfg.GetGroupMappings()) == 0 { // permissions are managed by an admin
+		return nil
+	}
+	if err = IsOauthUser(&user); err != nil {
+		return fmt.Errorf("user %s exists and is not an OAuth user", username)
+	}
+	var networks, isAdmin = logic.GetGroupAccess(groups)
+	if err = logic.SetUserAccess(username, networks, isAdmin); err != nil {
+		return err
+	}
+	logger.New(logger.API).With("user", username).With("admin", isAdmin).With("networks", strings.Join(networks, ",")).
+		Log(logger.Verbose, "applied group mappings")
+	return nil
+}
+
 func addUser(email string) error {
 	var hasAdmin, err = logic.HasAdmin()
 	if err != nil {
-		logic.Log("error checking for existence of admin user during OAuth login for "+email+", user not added", 1)
+		logger.New(logger.API).With("user", email).With("error", err.Error()).
+			Log(logger.Verbose, "error checking for existence of admin user during OAuth login, user not added")
 		return err
 	} // generate random password to adapt to current model
 	var newPass, fetchErr = fetchPassValue("")
@@ -135,17 +209,17 @@ func addUser(email string) error {
 	}
 	if !hasAdmin { // must be first attempt, create an admin
 		if newUser, err = logic.CreateAdmin(newUser); err != nil {
-			logic.Log("error creating admin from user, "+email+", user not added", 1)
+			logger.New(logger.API).With("user", email).With("error", err.Error()).Log(logger.Verbose, "error creating admin from user, user not added")
 		} else {
-			logic.Log("admin created from user, "+email+", was first user added", 0)
+			logger.New(logger.API).With("user", email).Log(logger.Info, "admin created from user, was first user added")
 		}
 	} else { // otherwise add to db as admin..?
 		// TODO: add ability to add users with preemptive permissions
 		newUser.IsAdmin = false
 		if newUser, err = logic.CreateUser(newUser); err != nil {
-			logic.Log("error creating user, "+email+", user not added", 1)
+			logger.New(logger.API).With("user", email).With("error", err.Error()).Log(logger.Verbose, "error creating user, user not added")
 		} else {
-			logic.Log("user created from, "+email+"", 0)
+			logger.New(logger.API).With("user", email).Log(logger.Info, "user created from OAuth login")
 		}
 	}
 	return nil
@@ -176,7 +250,7 @@ func fetchPassValue(newValue string) (string, error) {
 
 	var b64CurrentValue, b64Err = base64.StdEncoding.DecodeString(newValueHolder.Value)
 	if b64Err != nil {
-		logic.Log("could not decode pass", 0)
+		logger.New(logger.API).Error("could not decode pass", b64Err)
 		return "", nil
 	}
 	return string(b64CurrentValue), nil
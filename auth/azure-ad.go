@@ -7,8 +7,7 @@ import (
 	"net/http"
 	"os"
 
-	"github.com/gravitl/netmaker/logic"
-	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/servercfg"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/microsoft"
@@ -23,8 +22,9 @@ var azure_ad_functions = map[string]interface{}{
 }
 
 type azureOauthUser struct {
-	UserPrincipalName string `json:"userPrincipalName" bson:"userPrincipalName"`
-	AccessToken       string `json:"accesstoken" bson:"accesstoken"`
+	UserPrincipalName string   `json:"userPrincipalName" bson:"userPrincipalName"`
+	AccessToken       string   `json:"accesstoken" bson:"accesstoken"`
+	Groups            []string `json:"-" bson:"-"`
 }
 
 // == handle azure ad authentication here ==
@@ -37,10 +37,12 @@ func initAzureAD(redirectURL string, clientID string, clientSecret string) {
 		Scopes:       []string{"User.Read"},
 		Endpoint:     microsoft.AzureADEndpoint(os.Getenv("AZURE_TENANT")),
 	}
+	if len(servercfg.GetGroupMappings()) > 0 { // needed to read group memberships
+		auth_provider.Scopes = append(auth_provider.Scopes, "GroupMember.Read.All")
+	}
 }
 
 func handleAzureLogin(w http.ResponseWriter, r *http.Request) {
-	oauth_state_string = logic.RandomString(16)
 	if auth_provider == nil && servercfg.GetFrontendURL() != "" {
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
@@ -48,49 +50,46 @@ func handleAzureLogin(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "%s", []byte("no frontend URL was provided and an OAuth login was attempted\nplease reconfigure server to use OAuth or use basic credentials"))
 		return
 	}
-	var url = auth_provider.AuthCodeURL(oauth_state_string)
+	var url, err = getAuthCodeURL(w, r, true, false)
+	if err != nil {
+		logger.New(logger.API).With("provider", "azure").With("error", err.Error()).Log(logger.Verbose, "could not start login")
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 func handleAzureCallback(w http.ResponseWriter, r *http.Request) {
 
-	var content, err = getAzureUserInfo(r.FormValue("state"), r.FormValue("code"))
+	var state, err = consumeOAuthState(w, r)
 	if err != nil {
-		logic.Log("error when getting user info from azure: "+err.Error(), 1)
+		logger.New(logger.API).With("provider", "azure").With("error", err.Error()).Log(logger.Verbose, "rejected callback")
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	_, err = logic.GetUser(content.UserPrincipalName)
-	if err != nil { // user must not exists, so try to make one
-		if err = addUser(content.UserPrincipalName); err != nil {
-			return
-		}
-	}
-	var newPass, fetchErr = fetchPassValue("")
-	if fetchErr != nil {
+	content, err := getAzureUserInfo(state, r.FormValue("code"))
+	if err != nil {
+		logger.New(logger.API).With("provider", "azure").With("error", err.Error()).Log(logger.Verbose, "could not get user info")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	// send a netmaker jwt token
-	var authRequest = models.UserAuthParams{
-		UserName: content.UserPrincipalName,
-		Password: newPass,
+	if err = syncUser(content.UserPrincipalName, content.Groups); err != nil {
+		logger.New(logger.API).With("provider", "azure").With("user", content.UserPrincipalName).With("error", err.Error()).Log(logger.Verbose, "could not sync user")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
 	}
-
-	var jwt, jwtErr = logic.VerifyAuthRequest(authRequest)
-	if jwtErr != nil {
-		logic.Log("could not parse jwt for user "+authRequest.UserName, 1)
+	var loginURL, loginErr = getLoginRedirect(state.getRedirect(), content.UserPrincipalName)
+	if loginErr != nil {
+		logger.New(logger.API).With("provider", "azure").With("user", content.UserPrincipalName).With("error", loginErr.Error()).Log(logger.Verbose, "could not complete login")
 		return
 	}
 
-	logic.Log("completed azure OAuth sigin in for "+content.UserPrincipalName, 1)
-	http.Redirect(w, r, servercfg.GetFrontendURL()+"?login="+jwt+"&user="+content.UserPrincipalName, http.StatusPermanentRedirect)
+	logger.New(logger.API).With("provider", "azure").With("user", content.UserPrincipalName).Log(logger.Verbose, "completed OAuth sign in")
+	http.Redirect(w, r, loginURL, http.StatusPermanentRedirect)
 }
 
-func getAzureUserInfo(state string, code string) (*azureOauthUser, error) {
-	if state != oauth_state_string {
-		return nil, fmt.Errorf("invalid oauth state")
-	}
-	var token, err = auth_provider.Exchange(oauth2.NoContext, code)
+func getAzureUserInfo(state *oauthState, code string) (*azureOauthUser, error) {
+	var token, err = auth_provider.Exchange(oauth2.NoContext, code, state.getExchangeOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
 	}
@@ -117,10 +116,53 @@ func getAzureUserInfo(state string, code string) (*azureOauthUser, error) {
 	if err = json.Unmarshal(contents, userInfo); err != nil {
 		return nil, fmt.Errorf("failed parsing email from response data: %s", err.Error())
 	}
+	if len(servercfg.GetGroupMappings()) > 0 {
+		if userInfo.Groups, err = getAzureGroups(token.AccessToken); err != nil {
+			return nil, err
+		}
+	}
 	userInfo.AccessToken = string(data)
 	return userInfo, nil
 }
 
+// getAzureGroups - gets the ids of the groups an azure user is a member of
+// display names are left out, they are not unique and may be changed by the owners of a group
+func getAzureGroups(accessToken string) ([]string, error) {
+	var groups []string
+	var url = "https://graph.microsoft.com/v1.0/me/memberOf?$select=id"
+	for url != "" {
+		var httpReq, reqErr = http.NewRequest("GET", url, nil)
+		if reqErr != nil {
+			return nil, fmt.Errorf("failed to create request to azure")
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+		response, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting group memberships: %s", err.Error())
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, fmt.Errorf("failed getting group memberships: status %d", response.StatusCode)
+		}
+		var page struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing group memberships: %s", err.Error())
+		}
+		for _, group := range page.Value {
+			groups = append(groups, group.ID)
+		}
+		url = page.NextLink
+	}
+	return groups, nil
+}
+
 func verifyAzureUser(token *oauth2.Token) bool {
 	return token.Valid()
 }
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
-	"github.com/gravitl/netmaker/logic"
-	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/servercfg"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
@@ -22,8 +22,9 @@ var github_functions = map[string]interface{}{
 }
 
 type githubOauthUser struct {
-	Login       string `json:"login" bson:"login"`
-	AccessToken string `json:"accesstoken" bson:"accesstoken"`
+	Login       string   `json:"login" bson:"login"`
+	AccessToken string   `json:"accesstoken" bson:"accesstoken"`
+	Groups      []string `json:"-" bson:"-"`
 }
 
 // == handle github authentication here ==
@@ -36,10 +37,12 @@ func initGithub(redirectURL string, clientID string, clientSecret string) {
 		Scopes:       []string{},
 		Endpoint:     github.Endpoint,
 	}
+	if len(servercfg.GetGroupMappings()) > 0 { // needed to read org and team memberships
+		auth_provider.Scopes = append(auth_provider.Scopes, "read:org")
+	}
 }
 
 func handleGithubLogin(w http.ResponseWriter, r *http.Request) {
-	oauth_state_string = logic.RandomString(16)
 	if auth_provider == nil && servercfg.GetFrontendURL() != "" {
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?error=callback-error", http.StatusTemporaryRedirect)
 		return
@@ -47,49 +50,46 @@ func handleGithubLogin(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "%s", []byte("no frontend URL was provided and an OAuth login was attempted\nplease reconfigure server to use OAuth or use basic credentials"))
 		return
 	}
-	var url = auth_provider.AuthCodeURL(oauth_state_string)
+	var url, err = getAuthCodeURL(w, r, false, false) // GitHub does not support PKCE
+	if err != nil {
+		logger.New(logger.API).With("provider", "github").With("error", err.Error()).Log(logger.Verbose, "could not start login")
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 func handleGithubCallback(w http.ResponseWriter, r *http.Request) {
 
-	var content, err = getGithubUserInfo(r.URL.Query().Get("state"), r.URL.Query().Get("code"))
+	var state, err = consumeOAuthState(w, r)
 	if err != nil {
-		logic.Log("error when getting user info from github: "+err.Error(), 1)
+		logger.New(logger.API).With("provider", "github").With("error", err.Error()).Log(logger.Verbose, "rejected callback")
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	_, err = logic.GetUser(content.Login)
-	if err != nil { // user must not exist, so try to make one
-		if err = addUser(content.Login); err != nil {
-			return
-		}
-	}
-	var newPass, fetchErr = fetchPassValue("")
-	if fetchErr != nil {
+	content, err := getGithubUserInfo(state, r.URL.Query().Get("code"))
+	if err != nil {
+		logger.New(logger.API).With("provider", "github").With("error", err.Error()).Log(logger.Verbose, "could not get user info")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	// send a netmaker jwt token
-	var authRequest = models.UserAuthParams{
-		UserName: content.Login,
-		Password: newPass,
+	if err = syncUser(content.Login, content.Groups); err != nil {
+		logger.New(logger.API).With("provider", "github").With("user", content.Login).With("error", err.Error()).Log(logger.Verbose, "could not sync user")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
 	}
-
-	var jwt, jwtErr = logic.VerifyAuthRequest(authRequest)
-	if jwtErr != nil {
-		logic.Log("could not parse jwt for user "+authRequest.UserName, 1)
+	var loginURL, loginErr = getLoginRedirect(state.getRedirect(), content.Login)
+	if loginErr != nil {
+		logger.New(logger.API).With("provider", "github").With("user", content.Login).With("error", loginErr.Error()).Log(logger.Verbose, "could not complete login")
 		return
 	}
 
-	logic.Log("completed github OAuth sigin in for "+content.Login, 1)
-	http.Redirect(w, r, servercfg.GetFrontendURL()+"?login="+jwt+"&user="+content.Login, http.StatusPermanentRedirect)
+	logger.New(logger.API).With("provider", "github").With("user", content.Login).Log(logger.Verbose, "completed OAuth sign in")
+	http.Redirect(w, r, loginURL, http.StatusPermanentRedirect)
 }
 
-func getGithubUserInfo(state string, code string) (*githubOauthUser, error) {
-	if state != oauth_state_string {
-		return nil, fmt.Errorf("invalid OAuth state")
-	}
-	var token, err = auth_provider.Exchange(oauth2.NoContext, code)
+func getGithubUserInfo(state *oauthState, code string) (*githubOauthUser, error) {
+	var token, err = auth_provider.Exchange(oauth2.NoContext, code, state.getExchangeOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
 	}
@@ -120,10 +120,98 @@ func getGithubUserInfo(state string, code string) (*githubOauthUser, error) {
 	if err = json.Unmarshal(contents, userInfo); err != nil {
 		return nil, fmt.Errorf("failed parsing email from response data: %s", err.Error())
 	}
+	if len(servercfg.GetGroupMappings()) > 0 {
+		if userInfo.Groups, err = getGithubGroups(token.AccessToken); err != nil {
+			return nil, err
+		}
+	}
 	userInfo.AccessToken = string(data)
 	return userInfo, nil
 }
 
+// getGithubGroups - gets the orgs ("org") and teams ("org/team") a GitHub user belongs to
+func getGithubGroups(accessToken string) ([]string, error) {
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	if err := getGithubList("https://api.github.com/user/orgs?per_page=100", accessToken, &orgs); err != nil {
+		return nil, err
+	}
+	var teams []struct {
+		Slug         string `json:"slug"`
+		Organization struct {
+			Login string `json:"login"`
+		} `json:"organization"`
+	}
+	if err := getGithubList("https://api.github.com/user/teams?per_page=100", accessToken, &teams); err != nil {
+		return nil, err
+	}
+	var groups []string
+	for _, org := range orgs {
+		groups = append(groups, org.Login)
+	}
+	for _, team := range teams {
+		groups = append(groups, team.Organization.Login+"/"+team.Slug)
+	}
+	return groups, nil
+}
+
+// getGithubList - gets every page of a GitHub list into result, following the next links of the Link header
+func getGithubList(url string, accessToken string, result interface{}) error {
+	var items []json.RawMessage
+	for url != "" {
+		var page []json.RawMessage
+		next, err := getGithubResource(url, accessToken, &page)
+		if err != nil {
+			return err
+		}
+		items = append(items, page...)
+		url = next
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// getGithubResource - gets a GitHub resource into result, returns the url of the next page of a list if there is one
+func getGithubResource(url string, accessToken string, result interface{}) (string, error) {
+	var httpReq, reqErr = http.NewRequest("GET", url, nil)
+	if reqErr != nil {
+		return "", fmt.Errorf("failed to create request to GitHub")
+	}
+	httpReq.Header.Set("Authorization", "token "+accessToken)
+	response, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed getting %s: %s", url, err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed getting %s: status %d", url, response.StatusCode)
+	}
+	if err = json.NewDecoder(response.Body).Decode(result); err != nil {
+		return "", fmt.Errorf("failed parsing response from %s: %s", url, err.Error())
+	}
+	return githubNextPage(response.Header.Get("Link")), nil
+}
+
+// githubNextPage - gets the url marked rel="next" in a Link header, empty on the last page
+func githubNextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		var fields = strings.Split(part, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		for _, param := range fields[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(fields[0]), "<>")
+			}
+		}
+	}
+	return ""
+}
+
 func verifyGithubUser(token *oauth2.Token) bool {
 	return token.Valid()
 }
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGithubList(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		if r.URL.Query().Get("page") == "2" {
+			w.Header().Set("Link", `<`+server.URL+`/user/orgs?page=1>; rel="prev", <`+server.URL+`/user/orgs?page=1>; rel="first"`)
+			w.Write([]byte(`[{"login": "third"}]`))
+			return
+		}
+		w.Header().Set("Link", `<`+server.URL+`/user/orgs?page=2>; rel="next", <`+server.URL+`/user/orgs?page=2>; rel="last"`)
+		w.Write([]byte(`[{"login": "first"}, {"login": "second"}]`))
+	}))
+	defer server.Close()
+
+	var orgs []struct {
+		Login string `json:"login"`
+	}
+	assert.Nil(t, getGithubList(server.URL+"/user/orgs", "secret", &orgs))
+	var logins []string
+	for _, org := range orgs {
+		logins = append(logins, org.Login)
+	}
+	assert.Equal(t, []string{"first", "second", "third"}, logins)
+	assert.Equal(t, "", githubNextPage(""))
+}
@@ -6,8 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"github.com/gravitl/netmaker/logic"
-	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/servercfg"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -22,8 +21,9 @@ var google_functions = map[string]interface{}{
 }
 
 type googleOauthUser struct {
-	Email       string `json:"email" bson:"email"`
-	AccessToken string `json:"accesstoken" bson:"accesstoken"`
+	Email       string   `json:"email" bson:"email"`
+	AccessToken string   `json:"accesstoken" bson:"accesstoken"`
+	Groups      []string `json:"-" bson:"-"` // google does not expose group membership to OAuth clients
 }
 
 // == handle google authentication here ==
@@ -39,7 +39,6 @@ func initGoogle(redirectURL string, clientID string, clientSecret string) {
 }
 
 func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	oauth_state_string = logic.RandomString(16)
 	if auth_provider == nil && servercfg.GetFrontendURL() != "" {
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
@@ -47,49 +46,46 @@ func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "%s", []byte("no frontend URL was provided and an OAuth login was attempted\nplease reconfigure server to use OAuth or use basic credentials"))
 		return
 	}
-	var url = auth_provider.AuthCodeURL(oauth_state_string)
+	var url, err = getAuthCodeURL(w, r, true, false)
+	if err != nil {
+		logger.New(logger.API).With("provider", "google").With("error", err.Error()).Log(logger.Verbose, "could not start login")
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
 
-	var content, err = getGoogleUserInfo(r.FormValue("state"), r.FormValue("code"))
+	var state, err = consumeOAuthState(w, r)
 	if err != nil {
-		logic.Log("error when getting user info from google: "+err.Error(), 1)
+		logger.New(logger.API).With("provider", "google").With("error", err.Error()).Log(logger.Verbose, "rejected callback")
 		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	_, err = logic.GetUser(content.Email)
-	if err != nil { // user must not exists, so try to make one
-		if err = addUser(content.Email); err != nil {
-			return
-		}
-	}
-	var newPass, fetchErr = fetchPassValue("")
-	if fetchErr != nil {
+	content, err := getGoogleUserInfo(state, r.FormValue("code"))
+	if err != nil {
+		logger.New(logger.API).With("provider", "google").With("error", err.Error()).Log(logger.Verbose, "could not get user info")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
 		return
 	}
-	// send a netmaker jwt token
-	var authRequest = models.UserAuthParams{
-		UserName: content.Email,
-		Password: newPass,
+	if err = syncUser(content.Email, content.Groups); err != nil {
+		logger.New(logger.API).With("provider", "google").With("user", content.Email).With("error", err.Error()).Log(logger.Verbose, "could not sync user")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
 	}
-
-	var jwt, jwtErr = logic.VerifyAuthRequest(authRequest)
-	if jwtErr != nil {
-		logic.Log("could not parse jwt for user "+authRequest.UserName, 1)
+	var loginURL, loginErr = getLoginRedirect(state.getRedirect(), content.Email)
+	if loginErr != nil {
+		logger.New(logger.API).With("provider", "google").With("user", content.Email).With("error", loginErr.Error()).Log(logger.Verbose, "could not complete login")
 		return
 	}
 
-	logic.Log("completed google OAuth sigin in for "+content.Email, 1)
-	http.Redirect(w, r, servercfg.GetFrontendURL()+"?login="+jwt+"&user="+content.Email, http.StatusPermanentRedirect)
+	logger.New(logger.API).With("provider", "google").With("user", content.Email).Log(logger.Verbose, "completed OAuth sign in")
+	http.Redirect(w, r, loginURL, http.StatusPermanentRedirect)
 }
 
-func getGoogleUserInfo(state string, code string) (*googleOauthUser, error) {
-	if state != oauth_state_string {
-		return nil, fmt.Errorf("invalid OAuth state")
-	}
-	var token, err = auth_provider.Exchange(oauth2.NoContext, code)
+func getGoogleUserInfo(state *oauthState, code string) (*googleOauthUser, error) {
+	var token, err = auth_provider.Exchange(oauth2.NoContext, code, state.getExchangeOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
 	}
@@ -0,0 +1,404 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/servercfg"
+	"golang.org/x/oauth2"
+)
+
+var oidc_functions = map[string]interface{}{
+	init_provider:   initOIDC,
+	get_user_info:   getOIDCUserInfo,
+	handle_callback: handleOIDCCallback,
+	handle_login:    handleOIDCLogin,
+	verify_user:     verifyOIDCUser,
+}
+
+// how often the signing keys may be re-fetched when an unknown key id is seen
+const oidc_key_refresh_interval = time.Minute
+
+type oidcUser struct {
+	Username    string   `json:"username" bson:"username"`
+	AccessToken string   `json:"accesstoken" bson:"accesstoken"`
+	Groups      []string `json:"-" bson:"-"`
+}
+
+// oidcDiscovery - the parts of the provider's discovery document used by netmaker
+type oidcDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+type oidcJSONWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var oidc_discovery *oidcDiscovery
+var oidc_keys = map[string]interface{}{}
+var oidc_keys_fetched time.Time
+var oidc_keys_mutex sync.Mutex
+
+// == handle generic OpenID Connect authentication here ==
+
+func initOIDC(redirectURL string, clientID string, clientSecret string) {
+	var issuer = servercfg.GetOIDCIssuer()
+	if issuer == "" {
+		logger.New(logger.API).With("provider", "oidc").Log(logger.Info, "no OIDC issuer was provided, OIDC provider not initialized")
+		return
+	}
+	var discovery, err = fetchOIDCDiscovery(issuer)
+	if err != nil {
+		logger.New(logger.API).With("provider", "oidc").With("issuer", issuer).Error("failed to discover OIDC provider", err)
+		return
+	}
+	oidc_discovery = discovery
+	oidc_keys_mutex.Lock()
+	oidc_keys = map[string]interface{}{}
+	oidc_keys_fetched = time.Time{}
+	oidc_keys_mutex.Unlock()
+	if err = refreshOIDCKeys(); err != nil { // keys are fetched again on the first login
+		logger.New(logger.API).With("provider", "oidc").With("jwks", discovery.JWKSURI).With("error", err.Error()).Log(logger.Verbose, "failed to fetch OIDC signing keys")
+	}
+	auth_provider = &oauth2.Config{
+		RedirectURL:  redirectURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       servercfg.GetOIDCScopes(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+	}
+}
+
+func handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if auth_provider == nil && servercfg.GetFrontendURL() != "" {
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	} else if auth_provider == nil {
+		fmt.Fprintf(w, "%s", []byte("no frontend URL was provided and an OAuth login was attempted\nplease reconfigure server to use OAuth or use basic credentials"))
+		return
+	}
+	var url, err = getAuthCodeURL(w, r, oidcSupportsPKCE(), true)
+	if err != nil {
+		logger.New(logger.API).With("provider", "oidc").With("error", err.Error()).Log(logger.Verbose, "could not start login")
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+func handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+
+	var state, err = consumeOAuthState(w, r)
+	if err != nil {
+		logger.New(logger.API).With("provider", "oidc").With("error", err.Error()).Log(logger.Verbose, "rejected callback")
+		http.Redirect(w, r, servercfg.GetFrontendURL()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
+	content, err := getOIDCUserInfo(state, r.FormValue("code"))
+	if err != nil {
+		logger.New(logger.API).With("provider", "oidc").With("error", err.Error()).Log(logger.Verbose, "could not get user info")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
+	if err = syncUser(content.Username, content.Groups); err != nil {
+		logger.New(logger.API).With("provider", "oidc").With("user", content.Username).With("error", err.Error()).Log(logger.Verbose, "could not sync user")
+		http.Redirect(w, r, state.getRedirect()+"?oauth=callback-error", http.StatusTemporaryRedirect)
+		return
+	}
+	var loginURL, loginErr = getLoginRedirect(state.getRedirect(), content.Username)
+	if loginErr != nil {
+		logger.New(logger.API).With("provider", "oidc").With("user", content.Username).With("error", loginErr.Error()).Log(logger.Verbose, "could not complete login")
+		return
+	}
+
+	logger.New(logger.API).With("provider", "oidc").With("user", content.Username).Log(logger.Verbose, "completed OAuth sign in")
+	http.Redirect(w, r, loginURL, http.StatusPermanentRedirect)
+}
+
+func getOIDCUserInfo(state *oauthState, code string) (*oidcUser, error) {
+	var token, err = auth_provider.Exchange(oauth2.NoContext, code, state.getExchangeOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %s", err.Error())
+	}
+	var rawIDToken, ok = token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("no id_token was returned by the provider")
+	}
+	claims, err := verifyOIDCIDToken(rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %s", err.Error())
+	}
+	if nonce, _ := claims["nonce"].(string); state.Nonce == "" || nonce != state.Nonce {
+		return nil, fmt.Errorf("invalid id_token: nonce does not match the login")
+	}
+	var usernameClaim = servercfg.GetOIDCUsernameClaim()
+	var groupsClaim = servercfg.GetOIDCGroupsClaim()
+	var needsGroups = len(servercfg.GetGroupMappings()) > 0 && claims[groupsClaim] == nil
+	if (claims[usernameClaim] == nil || needsGroups) && oidc_discovery.UserinfoEndpoint != "" { // some providers only release claims through userinfo
+		userinfo, err := getOIDCUserinfoClaims(token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		if userinfo["sub"] != claims["sub"] {
+			return nil, fmt.Errorf("userinfo subject does not match id_token subject")
+		}
+		for _, claim := range []string{usernameClaim, groupsClaim} {
+			if claims[claim] == nil {
+				claims[claim] = userinfo[claim]
+			}
+		}
+	}
+	var username, _ = claims[usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("claim %s was not provided for the user", usernameClaim)
+	}
+	var data []byte
+	data, err = json.Marshal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert token to json: %s", err.Error())
+	}
+	return &oidcUser{
+		Username:    username,
+		AccessToken: string(data),
+		Groups:      getOIDCClaimValues(claims[groupsClaim]),
+	}, nil
+}
+
+func verifyOIDCUser(token *oauth2.Token) bool {
+	return token.Valid()
+}
+
+// == private methods ==
+
+// oidcSupportsPKCE - checks if the provider advertises S256 PKCE challenges
+func oidcSupportsPKCE() bool {
+	if oidc_discovery == nil {
+		return false
+	}
+	for _, method := range oidc_discovery.CodeChallengeMethods {
+		if method == "S256" {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchOIDCDiscovery(issuer string) (*oidcDiscovery, error) {
+	// the issuer is compared exactly, some providers' issuers end in a slash
+	response, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned status %d", response.StatusCode)
+	}
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
+	}
+	var discovery = &oidcDiscovery{}
+	if err = json.Unmarshal(contents, discovery); err != nil {
+		return nil, fmt.Errorf("failed parsing discovery document: %s", err.Error())
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("issuer %s does not match discovery issuer %s", issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing required endpoints")
+	}
+	return discovery, nil
+}
+
+func refreshOIDCKeys() error {
+	oidc_keys_mutex.Lock()
+	defer oidc_keys_mutex.Unlock()
+	if time.Since(oidc_keys_fetched) < oidc_key_refresh_interval {
+		return nil
+	}
+	oidc_keys_fetched = time.Now()
+	response, err := http.Get(oidc_discovery.JWKSURI)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks returned status %d", response.StatusCode)
+	}
+	var keySet struct {
+		Keys []oidcJSONWebKey `json:"keys"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&keySet); err != nil {
+		return fmt.Errorf("failed parsing jwks: %s", err.Error())
+	}
+	var keys = map[string]interface{}{}
+	for _, webKey := range keySet.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		var key, err = parseOIDCKey(&webKey)
+		if err != nil {
+			logger.New(logger.API).With("provider", "oidc").With("key", webKey.Kid).With("error", err.Error()).Log(logger.Debug, "skipping OIDC signing key")
+			continue
+		}
+		keys[webKey.Kid] = key
+	}
+	oidc_keys = keys
+	return nil
+}
+
+func parseOIDCKey(webKey *oidcJSONWebKey) (interface{}, error) {
+	switch webKey.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(webKey.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(webKey.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch webKey.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", webKey.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(webKey.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(webKey.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", webKey.Kty)
+}
+
+func lookupOIDCKey(kid string) interface{} {
+	oidc_keys_mutex.Lock()
+	defer oidc_keys_mutex.Unlock()
+	if kid == "" && len(oidc_keys) == 1 {
+		for _, key := range oidc_keys {
+			return key
+		}
+	}
+	return oidc_keys[kid]
+}
+
+func getOIDCSigningKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+	}
+	var kid, _ = token.Header["kid"].(string)
+	if key := lookupOIDCKey(kid); key != nil {
+		return key, nil
+	}
+	// the provider may have rotated its keys
+	if err := refreshOIDCKeys(); err != nil {
+		return nil, err
+	}
+	if key := lookupOIDCKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %s", kid)
+}
+
+func verifyOIDCIDToken(rawIDToken string) (jwt.MapClaims, error) {
+	var claims = jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(rawIDToken, claims, getOIDCSigningKey); err != nil {
+		return nil, err
+	}
+	if !claims.VerifyIssuer(oidc_discovery.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer")
+	}
+	if !claims.VerifyAudience(auth_provider.ClientID, true) {
+		return nil, fmt.Errorf("unexpected audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("token is expired")
+	}
+	return claims, nil
+}
+
+func getOIDCUserinfoClaims(accessToken string) (map[string]interface{}, error) {
+	var httpReq, reqErr = http.NewRequest("GET", oidc_discovery.UserinfoEndpoint, nil)
+	if reqErr != nil {
+		return nil, fmt.Errorf("failed to create userinfo request")
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	response, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting user info: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo returned status %d", response.StatusCode)
+	}
+	var userinfo = map[string]interface{}{}
+	if err = json.NewDecoder(response.Body).Decode(&userinfo); err != nil {
+		return nil, fmt.Errorf("failed parsing userinfo response: %s", err.Error())
+	}
+	return userinfo, nil
+}
+
+// getOIDCClaimValues - reads a claim which may hold a single string or a list of strings
+func getOIDCClaimValues(claim interface{}) []string {
+	var values []string
+	switch value := claim.(type) {
+	case string:
+		values = append(values, value)
+	case []interface{}:
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockOIDCProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	kid       string
+	claims    jwt.MapClaims
+	userinfo  map[string]interface{}
+	challenge string // PKCE challenge of the last authorize request
+	issuer    string // issuer in the discovery document, the server url if empty
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	var provider = &mockOIDCProvider{key: key, kid: "test-key"}
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		var issuer = provider.issuer
+		if issuer == "" {
+			issuer = provider.server.URL
+		}
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: provider.server.URL + "/authorize",
+			TokenEndpoint:         provider.server.URL + "/token",
+			UserinfoEndpoint:      provider.server.URL + "/userinfo",
+			JWKSURI:               provider.server.URL + "/keys",
+			CodeChallengeMethods:  []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []oidcJSONWebKey{{
+				Kid: provider.kid,
+				Kty: "RSA",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(provider.key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(provider.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		var verifier = sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if provider.challenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		var idToken = jwt.NewWithClaims(jwt.SigningMethodRS256, provider.claims)
+		idToken.Header["kid"] = provider.kid
+		signed, err := idToken.SignedString(provider.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     signed,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(provider.userinfo)
+	})
+	provider.server = httptest.NewServer(mux)
+	provider.claims = provider.defaultClaims()
+	return provider
+}
+
+func (provider *mockOIDCProvider) defaultClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                provider.server.URL,
+		"aud":                "netmaker",
+		"sub":                "1234",
+		"email":              "user@example.com",
+		"preferred_username": "user",
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// authorize - starts a login and plays the provider's authorize endpoint, returns the callback request of the browser
+func (provider *mockOIDCProvider) authorize(t *testing.T) *http.Request {
+	var rec = httptest.NewRecorder()
+	loginURL, err := getAuthCodeURL(rec, httptest.NewRequest("GET", "/api/oauth/login", nil), oidcSupportsPKCE(), true)
+	assert.Nil(t, err)
+	parsed, err := url.Parse(loginURL)
+	assert.Nil(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	provider.challenge = parsed.Query().Get("code_challenge")
+	provider.claims["nonce"] = parsed.Query().Get("nonce")
+	var callback = httptest.NewRequest("GET", "/api/oauth/callback?state="+parsed.Query().Get("state"), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	return callback
+}
+
+// login - runs a full login against the provider with its current claims
+func (provider *mockOIDCProvider) login(t *testing.T) (*oidcUser, error) {
+	loginState, err := consumeOAuthState(httptest.NewRecorder(), provider.authorize(t))
+	if err != nil {
+		return nil, err
+	}
+	return getOIDCUserInfo(loginState, "code")
+}
+
+func TestOIDCUserInfo(t *testing.T) {
+	database.InitializeDatabase()
+	var provider = newMockOIDCProvider(t)
+	defer provider.server.Close()
+	os.Setenv("OIDC_ISSUER", provider.server.URL)
+	defer os.Unsetenv("OIDC_ISSUER")
+	initOIDC("http://localhost:8081/api/oauth/callback", "netmaker", "secret")
+	assert.NotNil(t, auth_provider)
+	t.Run("InvalidState", func(t *testing.T) {
+		_, err := consumeOAuthState(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/oauth/callback?state=wrong", nil))
+		assert.EqualError(t, err, "invalid OAuth state")
+	})
+	t.Run("StateIsSingleUse", func(t *testing.T) {
+		var callback = provider.authorize(t)
+		_, err := consumeOAuthState(httptest.NewRecorder(), callback)
+		assert.Nil(t, err)
+		_, err = consumeOAuthState(httptest.NewRecorder(), callback)
+		assert.EqualError(t, err, "invalid OAuth state")
+	})
+	t.Run("OtherBrowser", func(t *testing.T) {
+		var callback = provider.authorize(t)
+		var other = httptest.NewRequest("GET", callback.URL.String(), nil)
+		_, err := consumeOAuthState(httptest.NewRecorder(), other)
+		assert.EqualError(t, err, "OAuth state was not issued to this browser")
+		other.AddCookie(&http.Cookie{Name: oauth_state_cookie, Value: hashOAuthState("other")})
+		_, err = consumeOAuthState(httptest.NewRecorder(), other)
+		assert.EqualError(t, err, "OAuth state was not issued to this browser")
+	})
+	t.Run("RateLimited", func(t *testing.T) {
+		var limiter = oauthClientLimiter
+		defer func() { oauthClientLimiter = limiter }()
+		oauthClientLimiter = logic.NewRateLimiter(1, time.Minute)
+		provider.authorize(t)
+		_, err := getAuthCodeURL(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/oauth/login", nil), true, true)
+		assert.EqualError(t, err, "too many logins started, try again later")
+	})
+	t.Run("WrongVerifier", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		var callback = provider.authorize(t)
+		provider.challenge = "other"
+		loginState, err := consumeOAuthState(httptest.NewRecorder(), callback)
+		assert.Nil(t, err)
+		_, err = getOIDCUserInfo(loginState, "code")
+		assert.NotNil(t, err)
+	})
+	t.Run("WrongNonce", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		var callback = provider.authorize(t)
+		provider.claims["nonce"] = "replayed"
+		loginState, err := consumeOAuthState(httptest.NewRecorder(), callback)
+		assert.Nil(t, err)
+		_, err = getOIDCUserInfo(loginState, "code")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "nonce")
+	})
+	t.Run("Valid", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		user, err := provider.login(t)
+		assert.Nil(t, err)
+		assert.Equal(t, "user@example.com", user.Username)
+	})
+	t.Run("CustomClaim", func(t *testing.T) {
+		os.Setenv("OIDC_USERNAME_CLAIM", "preferred_username")
+		defer os.Unsetenv("OIDC_USERNAME_CLAIM")
+		provider.claims = provider.defaultClaims()
+		user, err := provider.login(t)
+		assert.Nil(t, err)
+		assert.Equal(t, "user", user.Username)
+	})
+	t.Run("ClaimFromUserinfo", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		delete(provider.claims, "email")
+		provider.userinfo = map[string]interface{}{"sub": "1234", "email": "info@example.com"}
+		user, err := provider.login(t)
+		assert.Nil(t, err)
+		assert.Equal(t, "info@example.com", user.Username)
+	})
+	t.Run("UserinfoSubjectMismatch", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		delete(provider.claims, "email")
+		provider.userinfo = map[string]interface{}{"sub": "5678", "email": "info@example.com"}
+		_, err := provider.login(t)
+		assert.NotNil(t, err)
+	})
+	t.Run("Groups", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		provider.claims["groups"] = []string{"netmaker-admins", "devs"}
+		user, err := provider.login(t)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"netmaker-admins", "devs"}, user.Groups)
+	})
+	t.Run("GroupsFromUserinfo", func(t *testing.T) {
+		os.Setenv("GROUP_MAPPINGS", `[{"group":"devs","networks":["skynet"]}]`)
+		defer os.Unsetenv("GROUP_MAPPINGS")
+		provider.claims = provider.defaultClaims()
+		provider.userinfo = map[string]interface{}{"sub": "1234", "groups": "devs"}
+		user, err := provider.login(t)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"devs"}, user.Groups)
+	})
+	t.Run("WrongAudience", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		provider.claims["aud"] = "someone-else"
+		_, err := provider.login(t)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "audience")
+	})
+	t.Run("WrongIssuer", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		provider.claims["iss"] = "https://evil.example.com"
+		_, err := provider.login(t)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "issuer")
+	})
+	t.Run("Expired", func(t *testing.T) {
+		provider.claims = provider.defaultClaims()
+		provider.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err := provider.login(t)
+		assert.NotNil(t, err)
+	})
+	t.Run("UnknownKey", func(t *testing.T) {
+		var original = provider.key
+		defer func() { provider.key = original }()
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.Nil(t, err)
+		provider.key = otherKey
+		provider.claims = provider.defaultClaims()
+		_, err = provider.login(t)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFetchOIDCDiscovery(t *testing.T) {
+	var provider = newMockOIDCProvider(t)
+	defer provider.server.Close()
+	t.Run("Valid", func(t *testing.T) {
+		discovery, err := fetchOIDCDiscovery(provider.server.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, provider.server.URL+"/token", discovery.TokenEndpoint)
+	})
+	t.Run("IssuerMismatch", func(t *testing.T) {
+		_, err := fetchOIDCDiscovery(provider.server.URL + "/other")
+		assert.NotNil(t, err)
+	})
+	t.Run("TrailingSlash", func(t *testing.T) {
+		provider.issuer = provider.server.URL + "/"
+		defer func() { provider.issuer = "" }()
+		discovery, err := fetchOIDCDiscovery(provider.server.URL + "/")
+		assert.Nil(t, err)
+		assert.Equal(t, provider.server.URL+"/", discovery.Issuer)
+		_, err = fetchOIDCDiscovery(provider.server.URL)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestGetGroupAccess(t *testing.T) {
+	os.Setenv("GROUP_MAPPINGS", `[
+		{"group": "*", "networks": ["public"]},
+		{"group": "gravitl/devs", "networks": ["skynet", "public"]},
+		{"group": "netmaker-admins", "admin": true}
+	]`)
+	defer os.Unsetenv("GROUP_MAPPINGS")
+	t.Run("NoGroups", func(t *testing.T) {
+		networks, isAdmin := logic.GetGroupAccess(nil)
+		assert.False(t, isAdmin)
+		assert.Equal(t, []string{"public"}, networks)
+	})
+	t.Run("Networks", func(t *testing.T) {
+		networks, isAdmin := logic.GetGroupAccess([]string{"gravitl", "Gravitl/Devs"})
+		assert.False(t, isAdmin)
+		assert.Equal(t, []string{"public", "skynet"}, networks)
+	})
+	t.Run("Admin", func(t *testing.T) {
+		_, isAdmin := logic.GetGroupAccess([]string{"netmaker-admins"})
+		assert.True(t, isAdmin)
+	})
+}
+
+func TestIsValidRedirect(t *testing.T) {
+	os.Setenv("FRONTEND_URL", "https://dashboard.netmaker.example.com")
+	defer os.Unsetenv("FRONTEND_URL")
+	assert.True(t, isValidRedirect("https://dashboard.netmaker.example.com"))
+	assert.True(t, isValidRedirect("https://dashboard.netmaker.example.com/login"))
+	assert.False(t, isValidRedirect("http://dashboard.netmaker.example.com"))
+	assert.False(t, isValidRedirect("https://evil.example.com"))
+	assert.False(t, isValidRedirect("https://dashboard.netmaker.example.com.evil.com"))
+	assert.False(t, isValidRedirect("https://user@dashboard.netmaker.example.com"))
+	assert.False(t, isValidRedirect("https://dashboard.netmaker.example.com/?next=https://evil.example.com"))
+	assert.False(t, isValidRedirect("//evil.example.com"))
+}
+
+func TestGetLoginRedirect(t *testing.T) {
+	database.InitializeDatabase()
+	users, _ := logic.GetUsers()
+	for _, user := range users {
+		logic.DeleteUser(user.UserName)
+	}
+	database.DeleteRecord(database.GENERATED_TABLE_NAME, auth_key)
+	_, err := fetchPassValue(logic.RandomString(64))
+	assert.Nil(t, err)
+	assert.Nil(t, syncUser("admin@example.com", nil))
+	assert.Nil(t, syncUser("user@example.com", nil))
+	os.Setenv("TOTP_REQUIRED_FOR_ADMINS", "on")
+	defer os.Unsetenv("TOTP_REQUIRED_FOR_ADMINS")
+	t.Run("NoSecondFactor", func(t *testing.T) {
+		loginURL, err := getLoginRedirect("https://dashboard.example.com", "user@example.com")
+		assert.Nil(t, err)
+		parsed, err := url.Parse(loginURL)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", parsed.Query().Get("login"))
+		assert.Equal(t, "", parsed.Query().Get("totptoken"))
+	})
+	t.Run("SecondFactorRequired", func(t *testing.T) {
+		loginURL, err := getLoginRedirect("https://dashboard.example.com", "admin@example.com")
+		assert.Nil(t, err)
+		parsed, err := url.Parse(loginURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "", parsed.Query().Get("login"))
+		assert.Equal(t, "true", parsed.Query().Get("totpenroll"))
+		username, err := logic.VerifyTOTPToken(parsed.Query().Get("totptoken"))
+		assert.Nil(t, err)
+		assert.Equal(t, "admin@example.com", username)
+	})
+	t.Run("Escaped", func(t *testing.T) {
+		assert.Nil(t, syncUser("a&totpenroll=false#b", nil))
+		loginURL, err := getLoginRedirect("https://dashboard.example.com", "a&totpenroll=false#b")
+		assert.Nil(t, err)
+		parsed, err := url.Parse(loginURL)
+		assert.Nil(t, err)
+		assert.Equal(t, "a&totpenroll=false#b", parsed.Query().Get("user"))
+		assert.Equal(t, "", parsed.Fragment)
+		assert.NotEqual(t, "", parsed.Query().Get("login"))
+	})
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/servercfg"
+	"golang.org/x/oauth2"
+)
+
+// how long a user has to complete a login at the provider
+const oauth_state_ttl = 10 * time.Minute
+
+// cookie binding a login to the browser which started it, holds a hash of the state
+const oauth_state_cookie = "netmaker_oauth_state"
+
+// logins a client may start per minute
+var oauthClientLimiter = logic.NewRateLimiter(30, time.Minute)
+
+// logins all clients together may start while their states are valid, caps the stored states
+var oauthStateLimiter = logic.NewRateLimiter(1000, oauth_state_ttl)
+
+var oauth_state_format = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// oauthState - server side record of a login started with a provider, keyed by the state parameter
+type oauthState struct {
+	Verifier string `json:"verifier" bson:"verifier"` // PKCE code verifier, empty if the provider lacks PKCE
+	Nonce    string `json:"nonce" bson:"nonce"`       // expected ID token nonce, empty if no ID token is used
+	Redirect string `json:"redirect" bson:"redirect"` // frontend url the user returns to
+	Expiry   int64  `json:"expiry" bson:"expiry"`
+}
+
+// getAuthCodeURL - stores a new login state, binds it to the browser and returns the provider url to send the user to
+func getAuthCodeURL(w http.ResponseWriter, r *http.Request, usePKCE bool, useNonce bool) (string, error) {
+	var redirect = r.URL.Query().Get("redirect")
+	if redirect == "" {
+		redirect = servercfg.GetFrontendURL()
+	} else if !isValidRedirect(redirect) {
+		return "", errors.New("redirect " + redirect + " does not match the frontend url")
+	}
+	if !oauthClientLimiter.Allow(clientIP(r)) || !oauthStateLimiter.Allow("") {
+		return "", errors.New("too many logins started, try again later")
+	}
+	var stateKey, err = randomURLString()
+	if err != nil {
+		return "", err
+	}
+	var state = oauthState{
+		Redirect: redirect,
+		Expiry:   time.Now().Add(oauth_state_ttl).Unix(),
+	}
+	var opts []oauth2.AuthCodeOption
+	if usePKCE {
+		if state.Verifier, err = randomURLString(); err != nil {
+			return "", err
+		}
+		var challenge = sha256.Sum256([]byte(state.Verifier))
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)
+	}
+	if useNonce {
+		if state.Nonce, err = randomURLString(); err != nil {
+			return "", err
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", state.Nonce))
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return "", err
+	}
+	if err = database.Insert(stateKey, string(data), database.SSO_STATE_TABLE_NAME); err != nil {
+		return "", err
+	}
+	setOAuthStateCookie(w, r, hashOAuthState(stateKey), int(oauth_state_ttl.Seconds()))
+	return auth_provider.AuthCodeURL(stateKey, opts...), nil
+}
+
+// consumeOAuthState - looks up and removes the state of a login callback, a state can only be used once
+// and only by the browser which started the login
+func consumeOAuthState(w http.ResponseWriter, r *http.Request) (*oauthState, error) {
+	var stateKey = r.FormValue("state")
+	if !oauth_state_format.MatchString(stateKey) {
+		return nil, errors.New("invalid OAuth state")
+	}
+	var cookie, err = r.Cookie(oauth_state_cookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashOAuthState(stateKey))) != 1 {
+		return nil, errors.New("OAuth state was not issued to this browser")
+	}
+	setOAuthStateCookie(w, r, "", -1)
+	record, err := database.FetchRecord(database.SSO_STATE_TABLE_NAME, stateKey)
+	if err != nil {
+		return nil, errors.New("invalid OAuth state")
+	}
+	if err = database.DeleteRecord(database.SSO_STATE_TABLE_NAME, stateKey); err != nil {
+		return nil, err
+	}
+	var state = &oauthState{}
+	if err = json.Unmarshal([]byte(record), state); err != nil {
+		return nil, errors.New("invalid OAuth state")
+	}
+	if time.Now().Unix() > state.Expiry {
+		return nil, errors.New("expired OAuth state")
+	}
+	return state, nil
+}
+
+// getExchangeOptions - passes the PKCE verifier of a login on to the code exchange
+func (state *oauthState) getExchangeOptions() []oauth2.AuthCodeOption {
+	if state.Verifier == "" {
+		return nil
+	}
+	return []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("code_verifier", state.Verifier)}
+}
+
+// getRedirect - gets the frontend url a user returns to after a login
+func (state *oauthState) getRedirect() string {
+	if state == nil || state.Redirect == "" {
+		return servercfg.GetFrontendURL()
+	}
+	return state.Redirect
+}
+
+// isValidRedirect - only urls on the configured frontend may be redirected to
+func isValidRedirect(redirect string) bool {
+	var frontend, err = url.Parse(servercfg.GetFrontendURL())
+	if err != nil || frontend.Host == "" {
+		return false
+	}
+	target, err := url.Parse(redirect)
+	if err != nil || target.User != nil || target.RawQuery != "" || target.Fragment != "" {
+		return false
+	}
+	var basePath = strings.TrimSuffix(frontend.Path, "/")
+	return strings.EqualFold(target.Scheme, frontend.Scheme) &&
+		strings.EqualFold(target.Host, frontend.Host) &&
+		(basePath == "" || target.Path == basePath || strings.HasPrefix(target.Path, basePath+"/"))
+}
+
+// purgeExpiredOAuthStates - removes the states of logins which were never completed
+func purgeExpiredOAuthStates() error {
+	var records, err = database.FetchRecords(database.SSO_STATE_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
+	}
+	var now = time.Now().Unix()
+	for key, record := range records {
+		var state oauthState
+		if err = json.Unmarshal([]byte(record), &state); err != nil || now > state.Expiry {
+			if err = database.DeleteRecord(database.SSO_STATE_TABLE_NAME, key); err != nil {
+				logger.New(logger.API).With("error", err.Error()).Log(logger.Debug, "could not remove expired OAuth state")
+			}
+		}
+	}
+	return nil
+}
+
+func setOAuthStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauth_state_cookie,
+		Value:    value,
+		Path:     "/api/oauth",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode, // sent on the top level redirect back from the provider
+	})
+}
+
+func hashOAuthState(stateKey string) string {
+	var hash = sha256.Sum256([]byte(stateKey))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// clientIP - the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func randomURLString() (string, error) {
+	var random = make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
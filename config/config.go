@@ -6,8 +6,10 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
@@ -24,8 +26,23 @@ func getEnv() string {
 	return env
 }
 
-// Config : application config stored as global variable
-var Config *EnvironmentConfig
+// current : application config, replaced as a whole on reload
+var current *EnvironmentConfig
+var currentLock sync.RWMutex
+
+// Get - returns the application config, it is shared and must not be modified
+func Get() *EnvironmentConfig {
+	currentLock.RLock()
+	defer currentLock.RUnlock()
+	return current
+}
+
+// Set - replaces the application config
+func Set(cfg *EnvironmentConfig) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+	current = cfg
+}
 
 // EnvironmentConfig :
 type EnvironmentConfig struct {
@@ -57,8 +74,8 @@ type ServerConfig struct {
 	Version               string `yaml:"version"`
 	SQLConn               string `yaml:"sqlconn"`
 	Platform              string `yaml:"platform"`
-	Database              string `yaml:database`
-	CheckinInterval       string `yaml:checkininterval`
+	Database              string `yaml:"database"`
+	CheckinInterval       string `yaml:"checkininterval"`
 	DefaultNodeLimit      int32  `yaml:"defaultnodelimit"`
 	Verbosity             int32  `yaml:"verbosity"`
 	ServerCheckinInterval int64  `yaml:"servercheckininterval"`
@@ -66,6 +83,37 @@ type ServerConfig struct {
 	ClientID              string `yaml:"clientid"`
 	ClientSecret          string `yaml:"clientsecret"`
 	FrontendURL           string `yaml:"frontendurl"`
+	OIDCIssuer            string `yaml:"oidcissuer"`
+	OIDCScopes            string `yaml:"oidcscopes"`
+	OIDCUsernameClaim     string `yaml:"oidcusernameclaim"`
+	OIDCGroupsClaim       string `yaml:"oidcgroupsclaim"`
+	LDAPURL               string `yaml:"ldapurl"`
+	LDAPBindDN            string `yaml:"ldapbinddn"`
+	LDAPBindPassword      string `yaml:"ldapbindpassword"`
+	LDAPBaseDN            string `yaml:"ldapbasedn"`
+	LDAPUserFilter        string `yaml:"ldapuserfilter"`
+	LDAPGroupAttribute    string `yaml:"ldapgroupattribute"`
+	LDAPStartTLS          string `yaml:"ldapstarttls"`
+	TOTPRequiredForAdmins string `yaml:"totprequiredforadmins"`
+	GRPCReflection        string `yaml:"grpcreflection"`
+	GRPCMTLS              string `yaml:"grpcmtls"`
+	RESTTLSCert           string `yaml:"resttlscert"`
+	RESTTLSKey            string `yaml:"resttlskey"`
+	RESTTLSClientCA       string `yaml:"resttlsclientca"`
+	RESTRedirectPort      string `yaml:"restredirectport"`
+	MinClientVersion      string `yaml:"minclientversion"`
+	LogFormat             string `yaml:"logformat"`
+	LogLevels             string `yaml:"loglevels"`
+	ExcludeOfflinePeers   string `yaml:"excludeofflinepeers"`
+
+	GroupMappings []GroupMapping `yaml:"groupmappings"`
+}
+
+// GroupMapping - grants the members of an identity provider group access to networks or admin
+type GroupMapping struct {
+	Group    string   `yaml:"group" json:"group"`
+	Networks []string `yaml:"networks" json:"networks"`
+	Admin    bool     `yaml:"admin" json:"admin"`
 }
 
 // Generic SQL Config
@@ -78,26 +126,34 @@ type SQLConfig struct {
 	SSLMode  string `yaml:"sslmode"`
 }
 
-//reading in the env file
-func readConfig() *EnvironmentConfig {
-	file := fmt.Sprintf("config/environments/%s.yaml", getEnv())
-	f, err := os.Open(file)
+// ConfigFile - the config file of the server, NETMAKER_CONFIG or config/environments/<NETMAKER_ENV>.yaml
+func ConfigFile() string {
+	if os.Getenv("NETMAKER_CONFIG") != "" {
+		return os.Getenv("NETMAKER_CONFIG")
+	}
+	return fmt.Sprintf("config/environments/%s.yaml", getEnv())
+}
+
+// Load - reads a config file, a missing or empty file is an empty config
+func Load(file string) (*EnvironmentConfig, error) {
 	var cfg EnvironmentConfig
+	f, err := os.Open(file)
 	if err != nil {
-		return &cfg
+		return &cfg, nil
 	}
 	defer f.Close()
 
 	decoder := yaml.NewDecoder(f)
-	err = decoder.Decode(&cfg)
-	if err != nil {
-		log.Fatal(err)
-		os.Exit(2)
+	if err = decoder.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read config file %s: %w", file, err)
 	}
-	return &cfg
-
+	return &cfg, nil
 }
 
 func init() {
-	Config = readConfig()
+	cfg, err := Load(ConfigFile())
+	if err != nil {
+		log.Fatal(err)
+	}
+	Set(cfg)
 }
@@ -1,8 +1,48 @@
 package config
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestReadConfig(t *testing.T) {
-	config := readConfig()
+	config, err := Load(ConfigFile())
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log(config)
 }
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netmaker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var write = func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	config, err := Load(write("valid.yaml", "server:\n  verbosity: 2\n  allowedorigin: \"https://example.com\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Server.Verbosity != 2 || config.Server.AllowedOrigin != "https://example.com" {
+		t.Errorf("unexpected config %+v", config.Server)
+	}
+	if config, err = Load(write("empty.yaml", "")); err != nil || config == nil {
+		t.Errorf("empty file should load as empty config, got %v", err)
+	}
+	if config, err = Load(filepath.Join(dir, "missing.yaml")); err != nil || config == nil {
+		t.Errorf("missing file should load as empty config, got %v", err)
+	}
+	if _, err = Load(write("invalid.yaml", "server:\n  verbosity: loud\n")); err == nil {
+		t.Error("invalid file should fail to load")
+	}
+}
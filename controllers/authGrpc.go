@@ -2,35 +2,68 @@ package controller
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/functions"
 	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gravitl/netmaker/servercfg"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// grpcContextKey - type of the context keys set by the gRPC interceptors
+type grpcContextKey string
+
+// grpcNodeIDKey - context key of the id of the node an authorized request was made by
+const grpcNodeIDKey grpcContextKey = "nodeid"
+
+// unauthenticatedMethods - gRPC methods which do not require an access token
+var unauthenticatedMethods = []string{
+	"/node.NodeService/Login",
+	"/node.NodeService/CreateNode",
+	"/node.v2.NodeService/RequestChallenge",
+	"/node.v2.NodeService/Login",
+	"/node.v2.NodeService/CreateNode",
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+	// grpc registers the v1alpha reflection service, newer versions register v1 next to it
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+}
+
 func AuthServerUnaryInterceptor(ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler) (interface{}, error) {
 	// Skip authorize when GetJWT is requested
 
-	if info.FullMethod != "/node.NodeService/Login" {
-		if info.FullMethod != "/node.NodeService/CreateNode" {
-
-			err := grpcAuthorize(ctx)
-			if err != nil {
-				return nil, err
+	version, err := grpcCheckVersion(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if !logic.StringSliceContains(unauthenticatedMethods, info.FullMethod) {
+		node, err := grpcAuthorize(ctx)
+		if err != nil {
+			if strings.HasPrefix(info.FullMethod, "/node.v2.") {
+				return nil, authErrorV2(err)
 			}
+			return nil, err
 		}
+		recordClientVersion(ctx, &node, version)
+		setGRPCRequestNode(ctx, node.MacAddress, node.Network)
+		ctx = context.WithValue(ctx, grpcNodeIDKey, node.ID)
 	}
 
 	// Calls the handler
@@ -44,124 +77,180 @@ func AuthServerStreamInterceptor(
 	info *grpc.StreamServerInfo,
 	handler grpc.StreamHandler,
 ) error {
-	if info.FullMethod == "/node.NodeService/GetPeers" {
-		if err := grpcAuthorize(stream.Context()); err != nil {
+	version, err := grpcCheckVersion(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	if !logic.StringSliceContains(unauthenticatedMethods, info.FullMethod) {
+		node, err := grpcAuthorize(stream.Context())
+		if err != nil {
+			if strings.HasPrefix(info.FullMethod, "/node.v2.") {
+				return authErrorV2(err)
+			}
 			return err
 		}
+		recordClientVersion(stream.Context(), &node, version)
+		setGRPCRequestNode(stream.Context(), node.MacAddress, node.Network)
+		stream = &contextServerStream{
+			ServerStream: stream,
+			ctx:          context.WithValue(stream.Context(), grpcNodeIDKey, node.ID),
+		}
 	}
 
 	// Calls the handler
 	return handler(srv, stream)
 }
 
-func grpcAuthorize(ctx context.Context) error {
+// grpcAuthorize - verifies the access token of a request, returns the node it was issued to
+func grpcAuthorize(ctx context.Context) (models.Node, error) {
 
 	md, ok := metadata.FromIncomingContext(ctx)
 
 	if !ok {
-		return status.Errorf(codes.InvalidArgument, "Retrieving metadata is failed")
+		return models.Node{}, status.Errorf(codes.InvalidArgument, "Retrieving metadata is failed")
 	}
 
 	authHeader, ok := md["authorization"]
 	if !ok {
-		return status.Errorf(codes.Unauthenticated, "Authorization token is not supplied")
+		return models.Node{}, status.Errorf(codes.Unauthenticated, "Authorization token is not supplied")
 	}
 
 	authToken := authHeader[0]
 
-	mac, network, err := logic.VerifyToken(authToken)
+	nodeID, network, err := logic.VerifyToken(authToken)
 	if err != nil {
-		return err
+		return models.Node{}, err
 	}
 
 	networkexists, err := functions.NetworkExists(network)
 
 	if err != nil {
-		return status.Errorf(codes.Unauthenticated, "Unauthorized. Network does not exist: "+network)
+		return models.Node{}, status.Errorf(codes.Unauthenticated, "Unauthorized. Network does not exist: "+network)
 	}
 	emptynode := models.Node{}
-	node, err := logic.GetNodeByMacAddress(network, mac)
+	node, err := logic.GetNodeByID(nodeID)
 	if database.IsEmptyRecord(err) {
-		if node, err = logic.GetDeletedNodeByMacAddress(network, mac); err == nil {
+		if node, err = logic.GetDeletedNodeByID(nodeID); err == nil {
 			if functions.RemoveDeletedNode(node.ID) {
-				return status.Errorf(codes.Unauthenticated, models.NODE_DELETE)
+				return models.Node{}, status.Errorf(codes.Unauthenticated, models.NODE_DELETE)
 			}
-			return status.Errorf(codes.Unauthenticated, "Node does not exist.")
+			return models.Node{}, status.Errorf(codes.Unauthenticated, "Node does not exist.")
 		}
-		return status.Errorf(codes.Unauthenticated, "Empty record")
+		return models.Node{}, status.Errorf(codes.Unauthenticated, "Empty record")
 	}
-	if err != nil || node.MacAddress == emptynode.MacAddress {
-		return status.Errorf(codes.Unauthenticated, "Node does not exist.")
+	if err != nil || node.ID == emptynode.ID || node.Network != network {
+		return models.Node{}, status.Errorf(codes.Unauthenticated, "Node does not exist.")
 	}
 
 	if !networkexists {
-		return status.Errorf(codes.Unauthenticated, "Network does not exist.")
+		return models.Node{}, status.Errorf(codes.Unauthenticated, "Network does not exist.")
 	}
-	return nil
+	if servercfg.IsGRPCMTLS() {
+		if err = checkClientCertificate(ctx, &node); err != nil {
+			return models.Node{}, status.Errorf(codes.Unauthenticated, err.Error())
+		}
+	}
+	return node, nil
 }
 
-//Node authenticates using its password and retrieves a JWT for authorization.
-func (s *NodeServiceServer) Login(ctx context.Context, req *nodepb.Object) (*nodepb.Object, error) {
+// checkClientCertificate - checks a request was made with the client certificate bound to its node
+func checkClientCertificate(ctx context.Context, node *models.Node) error {
+	var certificate *x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.VerifiedChains[0]) > 0 {
+			certificate = tlsInfo.State.VerifiedChains[0][0]
+		}
+	}
+	if certificate == nil {
+		return errors.New("a client certificate is required, log in again to request one")
+	}
+	if certificate.Subject.CommonName != node.ID || certificate.SerialNumber.Text(16) != node.CertificateSerial {
+		return errors.New("client certificate was not issued to this node")
+	}
+	return nil
+}
 
-	//out := new(LoginResponse)
-	var reqNode models.Node
-	if err := json.Unmarshal([]byte(req.Data), &reqNode); err != nil {
-		return nil, err
+// grpcCheckVersion - rejects netclients older than the minimum client version, returns the version sent by the client
+// only calls to the node services are checked, clients which do not send a version predate the check and count as too old
+func grpcCheckVersion(ctx context.Context, method string) (string, error) {
+	var version string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[models.NODE_VERSION_METADATA]) > 0 {
+		version = md[models.NODE_VERSION_METADATA][0]
+	}
+	if !strings.HasPrefix(method, "/node.") {
+		return version, nil
+	}
+	var minVersion = servercfg.GetMinClientVersion()
+	if logic.IsClientVersionSupported(version, minVersion) {
+		return version, nil
 	}
+	var clientVersion = version
+	if clientVersion == "" {
+		clientVersion = "without a version"
+	}
+	var message = "netclient " + clientVersion + " is not supported by this server, please upgrade the netclient to " + minVersion + " or newer"
+	if strings.HasPrefix(method, "/node.v2.") {
+		return version, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNSUPPORTED_VERSION, message)
+	}
+	return version, status.Error(codes.FailedPrecondition, message)
+}
 
-	macaddress := reqNode.MacAddress
-	network := reqNode.Network
-	password := reqNode.Password
+// recordClientVersion - stores the netclient version sent with a request on its node, failures only get logged
+func recordClientVersion(ctx context.Context, node *models.Node, version string) {
+	if err := logic.SetNodeClientVersion(node, version); err != nil {
+		grpcLogger(ctx).With("node", node.ID).With("version", version).With("error", err.Error()).
+			Log(logger.Verbose, "could not record netclient version")
+	}
+}
 
-	var result models.NodeAuth
+// authErrorV2 - converts an authorization error to an error of the v2 service
+func authErrorV2(err error) error {
+	var message = status.Convert(err).Message()
+	if message == models.NODE_DELETE {
+		return nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_NODE_DELETED, message)
+	}
+	return nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, message)
+}
 
-	err := errors.New("Generic server error.")
+//Node authenticates using its password or identity key and retrieves a JWT for authorization.
+//Nodes with an identity key first request a challenge with a NODE_CHALLENGE object, then log in with the signed nonce.
+func (s *NodeServiceServer) Login(ctx context.Context, req *nodepb.Object) (*nodepb.Object, error) {
 
-	if macaddress == "" {
-		//TODO: Set Error  response
-		err = errors.New("Missing Mac Address.")
+	var authParams models.AuthParams
+	if err := json.Unmarshal([]byte(req.Data), &authParams); err != nil {
 		return nil, err
-	} else if password == "" {
-		err = errors.New("Missing Password.")
-		return nil, err
-	} else {
-		//Search DB for node with Mac Address. Ignore pending nodes (they should not be able to authenticate with API until approved).
-		collection, err := database.FetchRecords(database.NODES_TABLE_NAME)
+	}
+	if authParams.ID == "" && authParams.MacAddress == "" {
+		return nil, errors.New("Missing node id.")
+	}
+
+	if req.Type == nodepb.NODE_CHALLENGE {
+		nonce, err := logic.CreateNodeChallenge(authParams.Network, &authParams)
 		if err != nil {
-			return nil, err
+			return nil, status.Errorf(codes.Unauthenticated, err.Error())
 		}
-		for _, value := range collection {
-			if err = json.Unmarshal([]byte(value), &result); err != nil {
-				continue // finish going through nodes
-			}
-			if result.MacAddress == macaddress && result.Network == network {
-				break
-			}
-		}
-
-		//compare password from request to stored password in database
-		//might be able to have a common hash (certificates?) and compare those so that a password isn't passed in in plain text...
-		//TODO: Consider a way of hashing the password client side before sending, or using certificates
-		err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(password))
-		if err != nil && result.Password != password {
-			return nil, err
-		} else {
-			//Create a new JWT for the node
-			tokenString, err := logic.CreateJWT(macaddress, result.Network)
+		return &nodepb.Object{
+			Data: nonce,
+			Type: nodepb.NODE_CHALLENGE,
+		}, nil
+	}
 
-			if err != nil {
-				return nil, err
-			}
-			if tokenString == "" {
-				err = errors.New("Something went wrong. Could not retrieve token.")
-				return nil, err
-			}
+	node, err := logic.VerifyNodeAuth(authParams.Network, &authParams)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, err.Error())
+	}
+	//Create a new JWT for the node
+	tokenString, err := logic.CreateJWT(node.ID, node.MacAddress, node.Network)
+	if err != nil {
+		return nil, err
+	}
+	if tokenString == "" {
+		return nil, errors.New("Something went wrong. Could not retrieve token.")
+	}
 
-			response := &nodepb.Object{
-				Data: tokenString,
-				Type: nodepb.ACCESS_TOKEN,
-			}
-			return response, nil
-		}
+	response := &nodepb.Object{
+		Data: tokenString,
+		Type: nodepb.ACCESS_TOKEN,
 	}
+	return response, nil
 }
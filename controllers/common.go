@@ -1,49 +1,29 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"strings"
 
 	"github.com/gravitl/netmaker/database"
-	"github.com/gravitl/netmaker/functions"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
-	"github.com/gravitl/netmaker/servercfg"
 )
 
-/**
- * If being deleted by server, create a record in the DELETED_NODES_TABLE for the client to find
- * If being deleted by the client, delete completely
- */
-func DeleteNode(key string, exterminate bool) error {
-	var err error
-	if !exterminate {
-		args := strings.Split(key, "###")
-		node, err := GetNode(args[0], args[1])
-		if err != nil {
-			return err
-		}
-		node.Action = models.NODE_DELETE
-		nodedata, err := json.Marshal(&node)
-		if err != nil {
-			return err
-		}
-		err = database.Insert(key, string(nodedata), database.DELETED_NODES_TABLE_NAME)
-		if err != nil {
+// DeleteNode - deletes a node by its id, see logic.DeleteNode
+// exterminating a node which is only left in the deleted nodes table removes it from there
+func DeleteNode(ctx context.Context, key string, exterminate bool) error {
+	node, err := logic.GetNodeByID(key)
+	if err != nil {
+		if !exterminate {
 			return err
 		}
-	} else {
-		if err := database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil {
-			functions.PrintUserLog("", err.Error(), 2)
+		if err = database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil && !database.IsEmptyRecord(err) {
+			logic.RequestLogger(ctx, logger.API).With("node", key).With("error", err.Error()).Log(logger.Debug, "could not remove deleted node record")
 		}
+		return nil
 	}
-	if err := database.DeleteRecord(database.NODES_TABLE_NAME, key); err != nil {
-		return err
-	}
-	if servercfg.IsDNSMode() {
-		err = logic.SetDNS()
-	}
-	return err
+	return logic.DeleteNode(ctx, &node, exterminate)
 }
 
 func DeleteIntClient(clientid string) (bool, error) {
@@ -56,28 +36,9 @@ func DeleteIntClient(clientid string) (bool, error) {
 	return true, nil
 }
 
-func GetNode(macaddress string, network string) (models.Node, error) {
-
-	var node models.Node
-
-	key, err := logic.GetRecordKey(macaddress, network)
-	if err != nil {
-		return node, err
-	}
-	data, err := database.FetchRecord(database.NODES_TABLE_NAME, key)
-	if err != nil {
-		if data == "" {
-			data, err = database.FetchRecord(database.DELETED_NODES_TABLE_NAME, key)
-			err = json.Unmarshal([]byte(data), &node)
-		}
-		return node, err
-	}
-	if err = json.Unmarshal([]byte(data), &node); err != nil {
-		return node, err
-	}
-	logic.SetNodeDefaults(&node)
-
-	return node, err
+// GetNode - gets a node of a network by its id, including nodes waiting to learn of their deletion
+func GetNode(nodeid string, network string) (models.Node, error) {
+	return logic.GetNode(nodeid, network)
 }
 
 func GetIntClient(clientid string) (models.IntClient, error) {
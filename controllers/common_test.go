@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/gravitl/netmaker/database"
@@ -40,17 +43,105 @@ func TestGetPeerList(t *testing.T) {
 	})
 }
 
+func TestPeerListCache(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	peers, err := logic.GetPeersList("skynet", false, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1", peers[0].Endpoint)
+	t.Run("Copied", func(t *testing.T) {
+		peers[0].Endpoint = "changed"
+		cached, err := logic.GetPeersList("skynet", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.1", cached[0].Endpoint)
+	})
+	t.Run("InvalidatedByUpdate", func(t *testing.T) {
+		var update = node
+		update.Endpoint = "10.0.0.5"
+		assert.Nil(t, logic.UpdateNode(context.Background(), &node, &update))
+		updated, err := logic.GetPeersList("skynet", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.5", updated[0].Endpoint)
+	})
+	t.Run("SlicesCopied", func(t *testing.T) {
+		_, err := logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Ranges: []string{"10.100.100.0/24"}, Interface: "eth0"})
+		assert.Nil(t, err)
+		cached, err := logic.GetPeersList("skynet", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.100.100.0/24"}, cached[0].EgressGatewayRanges)
+		cached[0].EgressGatewayRanges[0] = "changed"
+		cached, err = logic.GetPeersList("skynet", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.100.100.0/24"}, cached[0].EgressGatewayRanges)
+	})
+	t.Run("InvalidatedByDelete", func(t *testing.T) {
+		assert.Nil(t, DeleteNode(context.Background(), node.ID, true))
+		deleted, err := logic.GetPeersList("skynet", false, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(deleted))
+	})
+}
+
+// BenchmarkGetPeersList - compares serving peer lists of a large network from the cache to computing them
+func BenchmarkGetPeersList(b *testing.B) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	assert.Nil(b, CreateNetwork(models.Network{NetID: "benchnet", AddressRange: "10.100.0.0/16"}))
+	const nodeCount = 3000
+	for i := 0; i < nodeCount; i++ {
+		var node = models.Node{
+			ID:                  fmt.Sprintf("benchnode%d", i),
+			Name:                fmt.Sprintf("benchnode%d", i),
+			Network:             "benchnet",
+			PublicKey:           fmt.Sprintf("benchkey%d", i),
+			Address:             fmt.Sprintf("10.100.%d.%d", i/250, i%250+1),
+			Endpoint:            fmt.Sprintf("192.168.%d.%d", i/250, i%250+1),
+			ListenPort:          51821,
+			PersistentKeepalive: 20,
+			IsPending:           "no",
+			IsRelayed:           "no",
+		}
+		data, err := json.Marshal(&node)
+		assert.Nil(b, err)
+		assert.Nil(b, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+	}
+	logic.NotifyPeerUpdate("benchnet")
+	b.Run("Cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if peers, err := logic.GetPeersList("benchnet", true, ""); err != nil || len(peers) != nodeCount {
+				b.Fatal("unexpected peer list", len(peers), err)
+			}
+		}
+	})
+	b.Run("Uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			logic.NotifyPeerUpdate("benchnet")
+			if peers, err := logic.GetPeersList("benchnet", true, ""); err != nil || len(peers) != nodeCount {
+				b.Fatal("unexpected peer list", len(peers), err)
+			}
+		}
+	})
+	b.StopTimer()
+	for i := 0; i < nodeCount; i++ {
+		database.DeleteRecord(database.NODES_TABLE_NAME, fmt.Sprintf("benchnode%d", i))
+	}
+	logic.NotifyPeerUpdate("benchnet")
+	logic.DeleteNetwork("benchnet")
+}
+
 func TestDeleteNode(t *testing.T) {
 	database.InitializeDatabase()
 	deleteAllNetworks()
 	createNet()
 	node := createTestNode()
 	t.Run("NodeExists", func(t *testing.T) {
-		err := DeleteNode(node.MacAddress, true)
+		err := DeleteNode(context.Background(), node.ID, true)
 		assert.Nil(t, err)
 	})
 	t.Run("NonExistantNode", func(t *testing.T) {
-		err := DeleteNode(node.MacAddress, true)
+		err := DeleteNode(context.Background(), node.ID, true)
 		assert.Nil(t, err)
 	})
 }
@@ -59,7 +150,7 @@ func TestGetNode(t *testing.T) {
 	database.InitializeDatabase()
 	deleteAllNetworks()
 	t.Run("NoNode", func(t *testing.T) {
-		response, err := GetNode("01:02:03:04:05:06", "skynet")
+		response, err := GetNode("c2b3bd1e-5d2a-4a56-a1a5-6c6b0b5ba5a1", "skynet")
 		assert.Equal(t, models.Node{}, response)
 		assert.EqualError(t, err, "unexpected end of JSON input")
 	})
@@ -67,7 +158,7 @@ func TestGetNode(t *testing.T) {
 	node := createTestNode()
 
 	t.Run("NodeExists", func(t *testing.T) {
-		response, err := GetNode(node.MacAddress, node.Network)
+		response, err := GetNode(node.ID, node.Network)
 		assert.Nil(t, err)
 		assert.Equal(t, "10.0.0.1", response.Endpoint)
 		assert.Equal(t, "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", response.PublicKey)
@@ -77,19 +168,61 @@ func TestGetNode(t *testing.T) {
 		assert.Equal(t, "skynet", response.Network)
 		assert.Equal(t, "nm-skynet", response.Interface)
 	})
-	t.Run("BadMac", func(t *testing.T) {
-		response, err := GetNode("01:02:03:04:05:07", node.Network)
+	t.Run("BadID", func(t *testing.T) {
+		response, err := GetNode("01:02:03:04:05:06", node.Network)
 		assert.Equal(t, models.Node{}, response)
 		assert.EqualError(t, err, "unexpected end of JSON input")
 	})
 	t.Run("BadNetwork", func(t *testing.T) {
-		response, err := GetNode(node.MacAddress, "badnet")
+		response, err := GetNode(node.ID, "badnet")
 		assert.Equal(t, models.Node{}, response)
-		assert.EqualError(t, err, "unexpected end of JSON input")
+		assert.EqualError(t, err, "node "+node.ID+" does not belong to network badnet")
+	})
+	t.Run("SameMacAddress", func(t *testing.T) {
+		clone := createTestNode()
+		assert.NotEqual(t, node.ID, clone.ID)
+		response, err := GetNode(clone.ID, clone.Network)
+		assert.Nil(t, err)
+		assert.Equal(t, node.MacAddress, response.MacAddress)
 	})
 
 }
 
+func TestMigrateNodeIDs(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	var legacy = models.Node{ID: "01:02:03:04:05:06###skynet", PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "legacynode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", Network: "skynet"}
+	data, err := json.Marshal(&legacy)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert(legacy.ID, string(data), database.NODES_TABLE_NAME))
+	var extClient = models.ExtClient{ClientID: "legacyclient", Network: "skynet", IngressGatewayID: legacy.MacAddress}
+	data, err = json.Marshal(&extClient)
+	assert.Nil(t, err)
+	key, err := logic.GetRecordKey(extClient.ClientID, extClient.Network)
+	assert.Nil(t, err)
+	assert.Nil(t, database.Insert(key, string(data), database.EXT_CLIENT_TABLE_NAME))
+
+	assert.Nil(t, logic.MigrateNodeIDs())
+	_, err = database.FetchRecord(database.NODES_TABLE_NAME, legacy.ID)
+	assert.True(t, database.IsEmptyRecord(err))
+	node, err := logic.GetNodeByMacAddress("skynet", legacy.MacAddress)
+	assert.Nil(t, err)
+	assert.False(t, node.HasLegacyID())
+	assert.Equal(t, "legacynode", node.Name)
+	client, err := logic.GetExtClient(extClient.ClientID, extClient.Network)
+	assert.Nil(t, err)
+	assert.Equal(t, node.ID, client.IngressGatewayID)
+	t.Run("RunTwice", func(t *testing.T) {
+		assert.Nil(t, logic.MigrateNodeIDs())
+		migrated, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.ID, migrated.ID)
+	})
+	logic.DeleteExtClient(extClient.Network, extClient.ClientID)
+	deleteAllNodes()
+}
+
 func TestCreateNode(t *testing.T) {
 	t.Skip()
 	database.InitializeDatabase()
@@ -2,20 +2,22 @@ package controller
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"os"
-	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/servercfg"
 )
 
-// HandleRESTRequests - handles the rest requests
-func HandleRESTRequests(wg *sync.WaitGroup) {
+// restShutdownTimeout - how long in-flight requests may take to finish on shutdown
+const restShutdownTimeout = 30 * time.Second
+
+// HandleRESTRequests - handles the rest requests until the context is done, then drains them
+func HandleRESTRequests(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	r := mux.NewRouter()
@@ -23,7 +25,11 @@ func HandleRESTRequests(wg *sync.WaitGroup) {
 	// Currently allowed dev origin is all. Should change in prod
 	// should consider analyzing the allowed methods further
 	headersOk := handlers.AllowedHeaders([]string{"Access-Control-Allow-Origin", "X-Requested-With", "Content-Type", "authorization"})
-	originsOk := handlers.AllowedOrigins([]string{servercfg.GetAllowedOrigin()})
+	// the allowed origin is looked up per request so a config reload applies without a restart
+	originsOk := handlers.AllowedOriginValidator(func(origin string) bool {
+		allowedOrigin := servercfg.GetAllowedOrigin()
+		return allowedOrigin == "*" || allowedOrigin == origin
+	})
 	methodsOk := handlers.AllowedMethods([]string{"GET", "PUT", "POST", "DELETE"})
 
 	nodeHandlers(r)
@@ -33,29 +39,60 @@ func HandleRESTRequests(wg *sync.WaitGroup) {
 	fileHandlers(r)
 	serverHandlers(r)
 	extClientHandlers(r)
+	tenantHandlers(r)
+	hostHandlers(r)
 
 	port := servercfg.GetAPIPort()
 
 	srv := &http.Server{Addr: ":" + port, Handler: handlers.CORS(originsOk, headersOk, methodsOk)(r)}
-	go func() {
-		err := srv.ListenAndServe()
+	var redirectSrv *http.Server
+	var stopReload = make(chan struct{})
+	if servercfg.IsRESTTLS() {
+		// serve TLS without a reverse proxy, the certificate is reloaded when its files change
+		reloader, err := newCertificateReloader(servercfg.GetRESTTLSCert(), servercfg.GetRESTTLSKey())
 		if err != nil {
-			log.Println(err)
+			logger.New(logger.API).Error("could not load API certificate", err)
+			os.Exit(1)
+		}
+		if srv.TLSConfig, err = getRESTTLSConfig(reloader); err != nil {
+			logger.New(logger.API).Error("could not load API client certificate authority", err)
+			os.Exit(1)
+		}
+		go reloader.watch(stopReload)
+		if redirectPort := servercfg.GetRESTRedirectPort(); redirectPort != "" {
+			redirectSrv = &http.Server{Addr: ":" + redirectPort, Handler: httpsRedirect(port)}
+			go func() {
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.New(logger.API).With("port", redirectPort).Error("HTTPS redirect stopped", err)
+				}
+			}()
+			logger.New(logger.API).With("port", redirectPort).Log(logger.Info, "redirecting HTTP to HTTPS")
+		}
+	}
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.New(logger.API).With("port", port).Error("REST server stopped", err)
 		}
 	}()
-	logic.Log("REST Server successfully started on port "+port+" (REST)", 0)
-	c := make(chan os.Signal)
-
-	// Relay os.Interrupt to our channel (os.Interrupt = CTRL+C)
-	// Ignore other incoming signals
-	signal.Notify(c, os.Interrupt)
-
-	// Block main routine until a signal is received
-	// As long as user doesn't press CTRL+C a message is not passed and our main routine keeps running
-	<-c
+	logger.New(logger.API).With("port", port).Log(logger.Info, "REST server successfully started")
 
-	// After receiving CTRL+C Properly stop the server
-	logic.Log("Stopping the REST server...", 0)
-	srv.Shutdown(context.TODO())
-	logic.Log("REST Server closed.", 0)
+	// Block until shutdown, then stop accepting and wait for in-flight requests
+	<-ctx.Done()
+	logger.New(logger.API).Log(logger.Info, "stopping the REST server")
+	close(stopReload)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), restShutdownTimeout)
+	defer cancel()
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.New(logger.API).Error("REST requests did not finish in time", err)
+	}
+	logger.New(logger.API).Log(logger.Info, "REST server closed")
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/functions"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 )
@@ -46,11 +47,25 @@ func getNodeDNS(w http.ResponseWriter, r *http.Request) {
 //Gets all nodes associated with network, including pending nodes
 func getAllDNS(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	networksSlice := []string{}
+	if err := json.Unmarshal([]byte(r.Header.Get("networks")), &networksSlice); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
 	dns, err := GetAllDNS()
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	if networksSlice[0] != ALL_NETWORK_ACCESS { // tenant admins only see the entries of their networks
+		var tenantDNS = []models.DNSEntry{}
+		for _, entry := range dns {
+			if functions.SliceContains(networksSlice, entry.Network) {
+				tenantDNS = append(tenantDNS, entry)
+			}
+		}
+		dns = tenantDNS
+	}
 	//Returns all the nodes in JSON format
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(dns)
@@ -169,12 +184,7 @@ func createDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entry, err = CreateDNS(entry)
-	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
-	}
-	err = logic.SetDNS()
+	entry, err = logic.CreateDNS(entry)
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
@@ -191,7 +201,7 @@ func updateDNS(w http.ResponseWriter, r *http.Request) {
 	var entry models.DNSEntry
 
 	//start here
-	entry, err := GetDNSEntry(params["domain"], params["network"])
+	entry, err := logic.GetDNSEntry(params["domain"], params["network"])
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
@@ -223,17 +233,12 @@ func updateDNS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entry, err = UpdateDNS(dnschange, entry)
+	entry, err = logic.UpdateDNS(dnschange, entry)
 
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	err = logic.SetDNS()
-	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
-	}
 	json.NewEncoder(w).Encode(entry)
 }
 
@@ -244,88 +249,17 @@ func deleteDNS(w http.ResponseWriter, r *http.Request) {
 	// get params
 	var params = mux.Vars(r)
 
-	err := DeleteDNS(params["domain"], params["network"])
+	err := logic.DeleteDNS(params["domain"], params["network"])
 
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
 	entrytext := params["domain"] + "." + params["network"]
-	functions.PrintUserLog(models.NODE_SERVER_NAME, "deleted dns entry: "+entrytext, 1)
-	err = logic.SetDNS()
-	if err != nil {
-		returnErrorResponse(w, r, formatError(err, "internal"))
-		return
-	}
+	apiLogger(r).With("network", params["network"]).With("domain", params["domain"]).Log(logger.Verbose, "deleted dns entry")
 	json.NewEncoder(w).Encode(entrytext + " deleted.")
 }
 
-// CreateDNS - creates a DNS entry
-func CreateDNS(entry models.DNSEntry) (models.DNSEntry, error) {
-
-	data, err := json.Marshal(&entry)
-	if err != nil {
-		return models.DNSEntry{}, err
-	}
-	key, err := logic.GetRecordKey(entry.Name, entry.Network)
-	if err != nil {
-		return models.DNSEntry{}, err
-	}
-	err = database.Insert(key, string(data), database.DNS_TABLE_NAME)
-
-	return entry, err
-}
-
-// GetDNSEntry - gets a DNS entry
-func GetDNSEntry(domain string, network string) (models.DNSEntry, error) {
-	var entry models.DNSEntry
-	key, err := logic.GetRecordKey(domain, network)
-	if err != nil {
-		return entry, err
-	}
-	record, err := database.FetchRecord(database.DNS_TABLE_NAME, key)
-	if err != nil {
-		return entry, err
-	}
-	err = json.Unmarshal([]byte(record), &entry)
-	return entry, err
-}
-
-// UpdateDNS - updates DNS entry
-func UpdateDNS(dnschange models.DNSEntry, entry models.DNSEntry) (models.DNSEntry, error) {
-
-	key, err := logic.GetRecordKey(entry.Name, entry.Network)
-	if err != nil {
-		return entry, err
-	}
-	if dnschange.Name != "" {
-		entry.Name = dnschange.Name
-	}
-	if dnschange.Address != "" {
-		entry.Address = dnschange.Address
-	}
-	newkey, err := logic.GetRecordKey(entry.Name, entry.Network)
-
-	err = database.DeleteRecord(database.DNS_TABLE_NAME, key)
-	if err != nil {
-		return entry, err
-	}
-
-	data, err := json.Marshal(&entry)
-	err = database.Insert(newkey, string(data), database.DNS_TABLE_NAME)
-	return entry, err
-}
-
-// DeleteDNS - deletes a DNS entry
-func DeleteDNS(domain string, network string) error {
-	key, err := logic.GetRecordKey(domain, network)
-	if err != nil {
-		return err
-	}
-	err = database.DeleteRecord(database.DNS_TABLE_NAME, key)
-	return err
-}
-
 func pushDNS(w http.ResponseWriter, r *http.Request) {
 	// Set header
 	w.Header().Set("Content-Type", "application/json")
@@ -336,7 +270,7 @@ func pushDNS(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "pushed DNS updates to nameserver", 1)
+	apiLogger(r).Log(logger.Verbose, "pushed DNS updates to nameserver")
 	json.NewEncoder(w).Encode("DNS Pushed to CoreDNS")
 }
 
@@ -358,7 +292,7 @@ func ValidateDNSCreate(entry models.DNSEntry) error {
 	err := v.Struct(entry)
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			functions.PrintUserLog("", e.Error(), 1)
+			logger.New(logger.API).With("network", entry.Network).With("domain", entry.Name).Log(logger.Verbose, e.Error())
 		}
 	}
 	return err
@@ -380,7 +314,7 @@ func ValidateDNSUpdate(change models.DNSEntry, entry models.DNSEntry) error {
 	_ = v.RegisterValidation("network_exists", func(fl validator.FieldLevel) bool {
 		_, err := logic.GetParentNetwork(change.Network)
 		if err != nil {
-			functions.PrintUserLog("", err.Error(), 0)
+			logger.New(logger.API).With("network", change.Network).Error("could not find network of dns entry", err)
 		}
 		return err == nil
 	})
@@ -403,7 +337,7 @@ func ValidateDNSUpdate(change models.DNSEntry, entry models.DNSEntry) error {
 
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			functions.PrintUserLog("", e.Error(), 1)
+			logger.New(logger.API).With("network", change.Network).With("domain", change.Name).Log(logger.Verbose, e.Error())
 		}
 	}
 	return err
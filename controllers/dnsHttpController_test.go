@@ -23,14 +23,14 @@ func TestGetAllDNS(t *testing.T) {
 	})
 	t.Run("OneEntry", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.3", "newhost", "skynet"}
-		CreateDNS(entry)
+		logic.CreateDNS(entry)
 		entries, err := GetAllDNS()
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(entries))
 	})
 	t.Run("MultipleEntry", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.7", "anotherhost", "skynet"}
-		CreateDNS(entry)
+		logic.CreateDNS(entry)
 		entries, err := GetAllDNS()
 		assert.Nil(t, err)
 		assert.Equal(t, 2, len(entries))
@@ -85,14 +85,14 @@ func TestGetCustomDNS(t *testing.T) {
 	})
 	t.Run("EntryExist", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.3", "newhost", "skynet"}
-		CreateDNS(entry)
+		logic.CreateDNS(entry)
 		dns, err := logic.GetCustomDNS("skynet")
 		assert.Nil(t, err)
 		assert.Equal(t, 1, len(dns))
 	})
 	t.Run("MultipleEntries", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.4", "host4", "skynet"}
-		CreateDNS(entry)
+		logic.CreateDNS(entry)
 		dns, err := logic.GetCustomDNS("skynet")
 		assert.Nil(t, err)
 		assert.Equal(t, 2, len(dns))
@@ -111,7 +111,7 @@ func TestGetDNSEntryNum(t *testing.T) {
 	})
 	t.Run("NodeExists", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-		_, err := CreateDNS(entry)
+		_, err := logic.CreateDNS(entry)
 		assert.Nil(t, err)
 		num, err := GetDNSEntryNum("newhost", "skynet")
 		assert.Nil(t, err)
@@ -130,7 +130,7 @@ func TestGetDNS(t *testing.T) {
 	})
 	t.Run("CustomDNSExists", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-		_, err := CreateDNS(entry)
+		_, err := logic.CreateDNS(entry)
 		assert.Nil(t, err)
 		dns, err := logic.GetDNS("skynet")
 		t.Log(dns)
@@ -150,7 +150,7 @@ func TestGetDNS(t *testing.T) {
 	})
 	t.Run("NodeAndCustomDNS", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-		_, err := CreateDNS(entry)
+		_, err := logic.CreateDNS(entry)
 		dns, err := logic.GetDNS("skynet")
 		t.Log(dns)
 		assert.Nil(t, err)
@@ -167,7 +167,7 @@ func TestCreateDNS(t *testing.T) {
 	deleteAllNetworks()
 	createNet()
 	entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-	dns, err := CreateDNS(entry)
+	dns, err := logic.CreateDNS(entry)
 	assert.Nil(t, err)
 	assert.Equal(t, "newhost", dns.Name)
 }
@@ -206,7 +206,7 @@ func TestSetDNS(t *testing.T) {
 	})
 	t.Run("EntryExists", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.3", "newhost", "skynet"}
-		CreateDNS(entry)
+		logic.CreateDNS(entry)
 		err := logic.SetDNS()
 		assert.Nil(t, err)
 		info, err := os.Stat("./config/dnsconfig/netmaker.hosts")
@@ -226,24 +226,24 @@ func TestGetDNSEntry(t *testing.T) {
 	createNet()
 	createTestNode()
 	entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-	CreateDNS(entry)
+	logic.CreateDNS(entry)
 	t.Run("wrong net", func(t *testing.T) {
-		entry, err := GetDNSEntry("newhost", "w286 Toronto Street South, Uxbridge, ONirecat")
+		entry, err := logic.GetDNSEntry("newhost", "w286 Toronto Street South, Uxbridge, ONirecat")
 		assert.EqualError(t, err, "no result found")
 		assert.Equal(t, models.DNSEntry{}, entry)
 	})
 	t.Run("wrong host", func(t *testing.T) {
-		entry, err := GetDNSEntry("badhost", "skynet")
+		entry, err := logic.GetDNSEntry("badhost", "skynet")
 		assert.EqualError(t, err, "no result found")
 		assert.Equal(t, models.DNSEntry{}, entry)
 	})
 	t.Run("good host", func(t *testing.T) {
-		entry, err := GetDNSEntry("newhost", "skynet")
+		entry, err := logic.GetDNSEntry("newhost", "skynet")
 		assert.Nil(t, err)
 		assert.Equal(t, "newhost", entry.Name)
 	})
 	t.Run("node", func(t *testing.T) {
-		entry, err := GetDNSEntry("testnode", "skynet")
+		entry, err := logic.GetDNSEntry("testnode", "skynet")
 		assert.EqualError(t, err, "no result found")
 		assert.Equal(t, models.DNSEntry{}, entry)
 	})
@@ -255,22 +255,22 @@ func TestUpdateDNS(t *testing.T) {
 	deleteAllNetworks()
 	createNet()
 	entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-	CreateDNS(entry)
+	logic.CreateDNS(entry)
 	t.Run("change address", func(t *testing.T) {
 		newentry.Address = "10.0.0.75"
-		updated, err := UpdateDNS(newentry, entry)
+		updated, err := logic.UpdateDNS(newentry, entry)
 		assert.Nil(t, err)
 		assert.Equal(t, newentry.Address, updated.Address)
 	})
 	t.Run("change name", func(t *testing.T) {
 		newentry.Name = "newname"
-		updated, err := UpdateDNS(newentry, entry)
+		updated, err := logic.UpdateDNS(newentry, entry)
 		assert.Nil(t, err)
 		assert.Equal(t, newentry.Name, updated.Name)
 	})
 	t.Run("change network", func(t *testing.T) {
 		newentry.Network = "wirecat"
-		updated, err := UpdateDNS(newentry, entry)
+		updated, err := logic.UpdateDNS(newentry, entry)
 		assert.Nil(t, err)
 		assert.NotEqual(t, newentry.Network, updated.Network)
 	})
@@ -281,18 +281,18 @@ func TestDeleteDNS(t *testing.T) {
 	deleteAllNetworks()
 	createNet()
 	entry := models.DNSEntry{"10.0.0.2", "newhost", "skynet"}
-	CreateDNS(entry)
+	logic.CreateDNS(entry)
 	t.Run("EntryExists", func(t *testing.T) {
-		err := DeleteDNS("newhost", "skynet")
+		err := logic.DeleteDNS("newhost", "skynet")
 		assert.Nil(t, err)
 	})
 	t.Run("NodeExists", func(t *testing.T) {
-		err := DeleteDNS("myhost", "skynet")
+		err := logic.DeleteDNS("myhost", "skynet")
 		assert.Nil(t, err)
 	})
 
 	t.Run("NoEntries", func(t *testing.T) {
-		err := DeleteDNS("myhost", "skynet")
+		err := logic.DeleteDNS("myhost", "skynet")
 		assert.Nil(t, err)
 	})
 }
@@ -348,20 +348,20 @@ func TestValidateDNSUpdate(t *testing.T) {
 	})
 	t.Run("NameUnique", func(t *testing.T) {
 		change := models.DNSEntry{"10.0.0.2", "myhost", "wirecat"}
-		CreateDNS(entry)
-		CreateDNS(change)
+		logic.CreateDNS(entry)
+		logic.CreateDNS(change)
 		err := ValidateDNSUpdate(change, entry)
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "Field validation for 'Name' failed on the 'name_unique' tag")
 		//cleanup
-		err = DeleteDNS("myhost", "wirecat")
+		err = logic.DeleteDNS("myhost", "wirecat")
 		assert.Nil(t, err)
 	})
 
 }
 func TestValidateDNSCreate(t *testing.T) {
 	database.InitializeDatabase()
-	_ = DeleteDNS("mynode", "skynet")
+	_ = logic.DeleteDNS("mynode", "skynet")
 	t.Run("NoNetwork", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.2", "myhost", "badnet"}
 		err := ValidateDNSCreate(entry)
@@ -398,7 +398,7 @@ func TestValidateDNSCreate(t *testing.T) {
 	})
 	t.Run("NameUnique", func(t *testing.T) {
 		entry := models.DNSEntry{"10.0.0.2", "myhost", "skynet"}
-		_, _ = CreateDNS(entry)
+		_, _ = logic.CreateDNS(entry)
 		err := ValidateDNSCreate(entry)
 		assert.NotNil(t, err)
 		assert.Contains(t, err.Error(), "Field validation for 'Name' failed on the 'name_unique' tag")
@@ -409,7 +409,7 @@ func deleteAllDNS(t *testing.T) {
 	dns, err := GetAllDNS()
 	assert.Nil(t, err)
 	for _, record := range dns {
-		err := DeleteDNS(record.Name, record.Network)
+		err := logic.DeleteDNS(record.Name, record.Network)
 		assert.Nil(t, err)
 	}
 }
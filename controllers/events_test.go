@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	var events []models.Event
+	unsubscribe := logic.SubscribeEvents("test", func(event models.Event) error {
+		events = append(events, event)
+		return nil
+	}, models.EVENT_NODE_CREATED, models.EVENT_NODE_UPDATED, models.EVENT_NODE_DELETED, models.EVENT_GATEWAY_UPDATED)
+	defer unsubscribe()
+
+	node := createTestNode()
+	t.Run("NodeCreated", func(t *testing.T) {
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, models.EVENT_NODE_CREATED, events[0].Type)
+		assert.Equal(t, "skynet", events[0].Network)
+		assert.Equal(t, node.ID, events[0].Node.ID)
+	})
+	t.Run("NodeUpdated", func(t *testing.T) {
+		events = nil
+		var update = node
+		update.Name = "renamed"
+		assert.Nil(t, logic.UpdateNode(logic.WithRequestID(context.Background(), "testrequest"), &node, &update))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, models.EVENT_NODE_UPDATED, events[0].Type)
+		assert.Equal(t, "testnode", events[0].Previous.Name)
+		assert.Equal(t, "renamed", events[0].Node.Name)
+		assert.Equal(t, "testrequest", events[0].RequestID)
+	})
+	t.Run("GatewayUpdated", func(t *testing.T) {
+		events = nil
+		other, err := logic.CreateNode(models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "othernode", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:07", Password: "password", Network: "skynet"}, "skynet")
+		assert.Nil(t, err)
+		_, err = logic.CreateEgressGateway(models.EgressGatewayRequest{NodeID: node.ID, NetID: "skynet", Ranges: []string{"10.100.100.0/24"}, Interface: "eth0"})
+		assert.Nil(t, err)
+		assert.Equal(t, models.EVENT_GATEWAY_UPDATED, events[len(events)-1].Type)
+		other, err = logic.GetNodeByID(other.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "yes", other.PullChanges)
+	})
+	t.Run("NodeDeleted", func(t *testing.T) {
+		events = nil
+		assert.Nil(t, DeleteNode(logic.WithRequestID(context.Background(), "testrequest"), node.ID, true))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, models.EVENT_NODE_DELETED, events[0].Type)
+		assert.Equal(t, node.ID, events[0].Node.ID)
+		assert.Equal(t, "testrequest", events[0].RequestID)
+	})
+	t.Run("FailingSubscriber", func(t *testing.T) {
+		var called bool
+		unsubscribeFailing := logic.SubscribeEvents("failing", func(event models.Event) error {
+			return errors.New("unavailable")
+		}, models.EVENT_DNS_UPDATED)
+		unsubscribeLater := logic.SubscribeEvents("later", func(event models.Event) error {
+			called = true
+			return nil
+		}, models.EVENT_DNS_UPDATED)
+		err := logic.PublishEvent(models.Event{Type: models.EVENT_DNS_UPDATED, Network: "skynet"})
+		assert.EqualError(t, err, "failing: unavailable")
+		assert.True(t, called)
+		unsubscribeFailing()
+		unsubscribeLater()
+		assert.Nil(t, logic.PublishEvent(models.Event{Type: models.EVENT_DNS_UPDATED, Network: "skynet"}))
+	})
+	t.Run("Unsubscribed", func(t *testing.T) {
+		unsubscribe()
+		events = nil
+		createTestNode()
+		assert.Equal(t, 0, len(events))
+	})
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// newTestCertificateRequest - generates a key and a PEM encoded certificate request like a netclient does
+func newTestCertificateRequest(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	assert.Nil(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+}
+
+// tlsHandshake - runs a TLS handshake between the GRPC server config and a client presenting a certificate
+func tlsHandshake(serverConfig *tls.Config, clientCertificate tls.Certificate) error {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	var serverErr = make(chan error, 1)
+	go func() {
+		serverErr <- tls.Server(serverConn, serverConfig).Handshake()
+	}()
+	client := tls.Client(clientConn, &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{clientCertificate},
+		MaxVersion:         tls.VersionTLS12,
+	})
+	clientErr := client.Handshake()
+	if err := <-serverErr; err != nil {
+		return err
+	}
+	return clientErr
+}
+
+func TestMutualTLS(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	os.Setenv("GRPC_MTLS", "on")
+	defer os.Unsetenv("GRPC_MTLS")
+	var server = &NodeServiceServerV2{}
+	key, csr := newTestCertificateRequest(t)
+	res, err := server.Login(context.Background(), &nodepbv2.LoginRequest{Id: node.ID, Network: "skynet", Password: "password", CertificateRequest: csr})
+	assert.Nil(t, err)
+	assert.NotNil(t, res.Certificate)
+	block, _ := pem.Decode(res.Certificate.Certificate)
+	assert.NotNil(t, block)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+	t.Run("Issued", func(t *testing.T) {
+		assert.Equal(t, node.ID, certificate.Subject.CommonName)
+		assert.Equal(t, []string{"skynet"}, certificate.Subject.OrganizationalUnit)
+		ca, _, err := logic.GetCA()
+		assert.Nil(t, err)
+		assert.Nil(t, certificate.CheckSignatureFrom(ca))
+		assert.Contains(t, string(res.Certificate.CaCertificate), "CERTIFICATE")
+	})
+	t.Run("BoundToNode", func(t *testing.T) {
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		var ctx = peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}},
+		}})
+		assert.Nil(t, checkClientCertificate(ctx, &stored))
+		assert.NotNil(t, checkClientCertificate(context.Background(), &stored))
+		other := stored
+		other.ID = "othernode"
+		assert.NotNil(t, checkClientCertificate(ctx, &other))
+	})
+	t.Run("Handshake", func(t *testing.T) {
+		serverConfig, err := logic.GetGRPCServerTLSConfig()
+		assert.Nil(t, err)
+		var clientCertificate = tls.Certificate{Certificate: [][]byte{certificate.Raw}, PrivateKey: key}
+		assert.Nil(t, tlsHandshake(serverConfig, clientCertificate))
+		// a node may connect without a certificate to join or log in
+		assert.Nil(t, tlsHandshake(serverConfig, tls.Certificate{}))
+	})
+	t.Run("Renewed", func(t *testing.T) {
+		_, csr := newTestCertificateRequest(t)
+		res, err := server.Login(context.Background(), &nodepbv2.LoginRequest{Id: node.ID, Network: "skynet", Password: "password", CertificateRequest: csr})
+		assert.Nil(t, err)
+		assert.NotNil(t, res.Certificate)
+		assert.NotNil(t, logic.CheckNodeCertificate(certificate))
+		// the renewed certificate becomes the current one for the rest of the test
+		block, _ := pem.Decode(res.Certificate.Certificate)
+		certificate, err = x509.ParseCertificate(block.Bytes)
+		assert.Nil(t, err)
+		assert.Nil(t, logic.CheckNodeCertificate(certificate))
+	})
+	t.Run("RevokedOnDelete", func(t *testing.T) {
+		assert.Nil(t, DeleteNode(context.Background(), node.ID, true))
+		assert.NotNil(t, logic.CheckNodeCertificate(certificate))
+	})
+}
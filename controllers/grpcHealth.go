@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcHealthInterval - how often the readiness reported by gRPC health checks is refreshed
+const grpcHealthInterval = 10 * time.Second
+
+// grpcHealthServices - the services health is reported for, the empty name stands for the whole server
+var grpcHealthServices = []string{
+	"",
+	nodepb.NodeService_ServiceDesc.ServiceName,
+	nodepbv2.NodeService_ServiceDesc.ServiceName,
+}
+
+// NewGRPCHealthServer - creates the grpc.health.v1 service, services are serving while the database can be read
+func NewGRPCHealthServer() *health.Server {
+	var healthServer = health.NewServer()
+	UpdateGRPCHealth(healthServer)
+	return healthServer
+}
+
+// UpdateGRPCHealth - sets the status of the gRPC services from the readiness of the database, returns if they are serving
+func UpdateGRPCHealth(healthServer *health.Server) bool {
+	var serving = database.IsReadable()
+	var status = healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range grpcHealthServices {
+		healthServer.SetServingStatus(service, status)
+	}
+	return serving
+}
+
+// RunGRPCHealthChecks - refreshes the reported health until stopped, then reports every service as not serving
+func RunGRPCHealthChecks(healthServer *health.Server, stop <-chan struct{}) {
+	ticker := time.NewTicker(grpcHealthInterval)
+	defer ticker.Stop()
+	var serving = true
+	for {
+		select {
+		case <-stop:
+			healthServer.Shutdown()
+			return
+		case <-ticker.C:
+			if readable := UpdateGRPCHealth(healthServer); readable != serving {
+				serving = readable
+				if serving {
+					logger.New(logger.GRPC).Log(logger.Info, "database is readable again, gRPC health is serving")
+				} else {
+					logger.New(logger.GRPC).Log(logger.Info, "database is not readable, gRPC health is not serving")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/stretchr/testify/assert"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCHealth(t *testing.T) {
+	database.InitializeDatabase()
+	var healthServer = NewGRPCHealthServer()
+	assert.True(t, UpdateGRPCHealth(healthServer))
+	for _, service := range []string{"", "node.v2.NodeService", "node.NodeService"} {
+		res, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		assert.Nil(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+	}
+	t.Run("UnknownService", func(t *testing.T) {
+		_, err := healthServer.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPC_REQUEST_ID_METADATA - gRPC metadata key of request ids, read from requests and set on responses
+const GRPC_REQUEST_ID_METADATA = "x-request-id"
+
+// grpcRequestKey - context key of the details of a request, filled in while it is handled
+const grpcRequestKey grpcContextKey = "request"
+
+// grpcRequest - details of a request reported by the logging interceptors
+type grpcRequest struct {
+	ID         string
+	MacAddress string
+	Network    string
+}
+
+var (
+	grpcRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "netmaker",
+		Subsystem: "grpc",
+		Name:      "requests_total",
+		Help:      "gRPC requests handled, by method and status code.",
+	}, []string{"method", "code"})
+	grpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "netmaker",
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle gRPC requests, streams until they close.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	grpcStreamsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "netmaker",
+		Subsystem: "grpc",
+		Name:      "streams_active",
+		Help:      "gRPC streams currently open, by method.",
+	}, []string{"method"})
+	grpcPanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "netmaker",
+		Subsystem: "grpc",
+		Name:      "panics_total",
+		Help:      "gRPC requests which panicked, by method.",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(grpcRequestsTotal, grpcRequestDuration, grpcStreamsActive, grpcPanicsTotal)
+}
+
+// GRPCUnaryInterceptors - the interceptors every unary call passes, in order
+func GRPCUnaryInterceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		RequestIDUnaryInterceptor,
+		LoggingUnaryInterceptor,
+		MetricsUnaryInterceptor,
+		RecoveryUnaryInterceptor,
+		AuthServerUnaryInterceptor,
+	}
+}
+
+// GRPCStreamInterceptors - the interceptors every stream passes, in order
+func GRPCStreamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		RequestIDStreamInterceptor,
+		LoggingStreamInterceptor,
+		MetricsStreamInterceptor,
+		RecoveryStreamInterceptor,
+		AuthServerStreamInterceptor,
+	}
+}
+
+// RequestIDUnaryInterceptor - assigns a request id to a call, the one sent by the client if any, and returns it in the response headers
+func RequestIDUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = withGRPCRequest(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(GRPC_REQUEST_ID_METADATA, logic.GetRequestID(ctx)))
+	return handler(ctx, req)
+}
+
+// RequestIDStreamInterceptor - assigns a request id to a stream, the one sent by the client if any, and returns it in the response headers
+func RequestIDStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var ctx = withGRPCRequest(stream.Context())
+	stream.SetHeader(metadata.Pairs(GRPC_REQUEST_ID_METADATA, logic.GetRequestID(ctx)))
+	return handler(srv, &contextServerStream{ServerStream: stream, ctx: ctx})
+}
+
+// LoggingUnaryInterceptor - logs the method, node, network, latency and status of every call
+func LoggingUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var start = time.Now()
+	res, err := handler(ctx, req)
+	logGRPCRequest(ctx, info.FullMethod, time.Since(start), err)
+	return res, err
+}
+
+// LoggingStreamInterceptor - logs the method, node, network, duration and status of every stream once it closes
+func LoggingStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var start = time.Now()
+	err := handler(srv, stream)
+	logGRPCRequest(stream.Context(), info.FullMethod, time.Since(start), err)
+	return err
+}
+
+// MetricsUnaryInterceptor - counts calls by status and records their latency
+func MetricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var start = time.Now()
+	res, err := handler(ctx, req)
+	grpcRequestsTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	grpcRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	return res, err
+}
+
+// MetricsStreamInterceptor - counts streams by status, records how long they were open and how many are open
+func MetricsStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	var start = time.Now()
+	grpcStreamsActive.WithLabelValues(info.FullMethod).Inc()
+	err := handler(srv, stream)
+	grpcStreamsActive.WithLabelValues(info.FullMethod).Dec()
+	grpcRequestsTotal.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	grpcRequestDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// RecoveryUnaryInterceptor - turns a panic while handling a call into an Internal error instead of crashing the server
+func RecoveryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverGRPCPanic(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// RecoveryStreamInterceptor - turns a panic while handling a stream into an Internal error instead of crashing the server
+func RecoveryStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverGRPCPanic(stream.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, stream)
+}
+
+// contextServerStream - a server stream handled with a context derived from its own, e.g. carrying the authorized node id
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// contextServerStream.Context - returns the derived context of the stream
+func (stream *contextServerStream) Context() context.Context {
+	return stream.ctx
+}
+
+// withGRPCRequest - returns a context carrying the id and the details of a request
+func withGRPCRequest(ctx context.Context) context.Context {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md[GRPC_REQUEST_ID_METADATA]) > 0 {
+		requestID = md[GRPC_REQUEST_ID_METADATA][0]
+	}
+	if !logic.IsRequestIDValid(requestID) {
+		requestID = logic.NewRequestID()
+	}
+	ctx = logic.WithRequestID(ctx, requestID)
+	return context.WithValue(ctx, grpcRequestKey, &grpcRequest{ID: requestID})
+}
+
+// setGRPCRequestNode - records the node a request was authorized for, for the logging interceptors
+func setGRPCRequestNode(ctx context.Context, macAddress, network string) {
+	if request, ok := ctx.Value(grpcRequestKey).(*grpcRequest); ok {
+		request.MacAddress = macAddress
+		request.Network = network
+	}
+}
+
+// grpcLogger - returns a logger adding the request id and the node of a request to every message
+func grpcLogger(ctx context.Context) logger.Logger {
+	var log = logic.RequestLogger(ctx, logger.GRPC)
+	if request, ok := ctx.Value(grpcRequestKey).(*grpcRequest); ok {
+		log = log.With("mac", request.MacAddress).With("network", request.Network)
+	}
+	return log
+}
+
+// logGRPCRequest - logs a handled request, failed requests at a lower level than successful ones
+func logGRPCRequest(ctx context.Context, method string, latency time.Duration, err error) {
+	var code = status.Code(err)
+	var loglevel = logger.Debug
+	if code != codes.OK {
+		loglevel = logger.Verbose
+	}
+	grpcLogger(ctx).With("method", method).With("latency", latency.String()).With("status", code.String()).
+		Log(loglevel, "grpc request handled")
+}
+
+// recoverGRPCPanic - logs a recovered panic with its stack, returns the error sent to the client
+func recoverGRPCPanic(ctx context.Context, method string, r interface{}) error {
+	grpcPanicsTotal.WithLabelValues(method).Inc()
+	grpcLogger(ctx).With("method", method).With("stack", string(debug.Stack())).
+		Error("panic handling grpc request", fmt.Errorf("%v", r))
+	var message = "internal server error, request " + logic.GetRequestID(ctx)
+	if strings.HasPrefix(method, "/node.v2.") {
+		return nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, message)
+	}
+	return status.Error(codes.Internal, message)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// chainUnary - runs a handler through unary interceptors the way the server chains them
+func chainUnary(ctx context.Context, method string, handler grpc.UnaryHandler, interceptors ...grpc.UnaryServerInterceptor) (interface{}, error) {
+	var info = &grpc.UnaryServerInfo{FullMethod: method}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		var interceptor, next = interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(ctx, nil)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	t.Run("RequestID", func(t *testing.T) {
+		var ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(GRPC_REQUEST_ID_METADATA, "abc-123"))
+		var requestID string
+		_, err := chainUnary(ctx, "/node.v2.NodeService/GetPeers", func(ctx context.Context, req interface{}) (interface{}, error) {
+			requestID = logic.GetRequestID(ctx)
+			return nil, nil
+		}, RequestIDUnaryInterceptor, LoggingUnaryInterceptor)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc-123", requestID)
+	})
+	t.Run("GeneratedRequestID", func(t *testing.T) {
+		var ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(GRPC_REQUEST_ID_METADATA, "not valid\n"))
+		var requestID string
+		chainUnary(ctx, "/node.v2.NodeService/GetPeers", func(ctx context.Context, req interface{}) (interface{}, error) {
+			requestID = logic.GetRequestID(ctx)
+			return nil, nil
+		}, RequestIDUnaryInterceptor)
+		assert.Len(t, requestID, 16)
+	})
+	t.Run("Recovery", func(t *testing.T) {
+		var panicking = func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("test panic")
+		}
+		_, err := chainUnary(context.Background(), "/node.v2.NodeService/GetPeers", panicking, RequestIDUnaryInterceptor, LoggingUnaryInterceptor, RecoveryUnaryInterceptor)
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, nodepbv2.GetErrorCode(err))
+		_, err = chainUnary(context.Background(), "/node.NodeService/GetPeers", panicking, RecoveryUnaryInterceptor)
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+	t.Run("Reflection", func(t *testing.T) {
+		var stream = &testWatchPeersStream{ctx: context.Background()}
+		for _, method := range []string{
+			"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+			"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+		} {
+			var called bool
+			err := AuthServerStreamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: method}, func(srv interface{}, stream grpc.ServerStream) error {
+				called = true
+				return nil
+			})
+			assert.Nil(t, err)
+			assert.True(t, called, method)
+		}
+		err := AuthServerStreamInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/node.v2.NodeService/WatchPeers"}, func(srv interface{}, stream grpc.ServerStream) error {
+			return nil
+		})
+		assert.NotNil(t, err)
+	})
+	t.Run("Metrics", func(t *testing.T) {
+		var method = "/node.v2.NodeService/ReadNode"
+		var before = testutil.ToFloat64(grpcRequestsTotal.WithLabelValues(method, codes.NotFound.String()))
+		chainUnary(context.Background(), method, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "not found")
+		}, MetricsUnaryInterceptor)
+		assert.Equal(t, before+1, testutil.ToFloat64(grpcRequestsTotal.WithLabelValues(method, codes.NotFound.String())))
+	})
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+)
+
+// hosts may span the networks of several tenants, so only admins of the whole server manage them
+func hostHandlers(r *mux.Router) {
+	r.HandleFunc("/api/hosts", securityCheckServer(true, http.HandlerFunc(getHosts))).Methods("GET")
+	r.HandleFunc("/api/hosts/{hostid}", securityCheckServer(true, http.HandlerFunc(getHost))).Methods("GET")
+	r.HandleFunc("/api/hosts/{hostid}", securityCheckServer(true, http.HandlerFunc(updateHost))).Methods("PUT")
+	r.HandleFunc("/api/hosts/{hostid}", securityCheckServer(true, http.HandlerFunc(deleteHost))).Methods("DELETE")
+	r.HandleFunc("/api/hosts/{hostid}/nodes", securityCheckServer(true, http.HandlerFunc(getHostNodes))).Methods("GET")
+}
+
+func getHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	hosts, err := logic.GetHosts()
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	for i := range hosts {
+		hosts[i].Secret = ""
+	}
+	apiLogger(r).Log(logger.Debug, "fetched hosts")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(hosts)
+}
+
+func getHost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	host, err := logic.GetHost(params["hostid"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	host.Secret = ""
+	apiLogger(r).With("host", host.ID).Log(logger.Debug, "fetched host")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(host)
+}
+
+// gets the nodes, and so the interfaces, of a host in every network
+func getHostNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if _, err := logic.GetHost(params["hostid"]); err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	nodes, err := logic.GetHostNodes(params["hostid"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	apiLogger(r).With("host", params["hostid"]).Log(logger.Debug, "fetched nodes of host")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(nodes)
+}
+
+func updateHost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	host, err := logic.GetHost(params["hostid"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	var hostchange models.Host
+	if err = json.NewDecoder(r.Body).Decode(&hostchange); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	host, err = logic.UpdateHost(hostchange, host)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	host.Secret = ""
+	apiLogger(r).With("host", host.ID).Log(logger.Verbose, "updated host")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(host)
+}
+
+// removes a host from all of its networks
+func deleteHost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if err := logic.DeleteHost(params["hostid"]); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("host", params["hostid"]).Log(logger.Verbose, "deleted host")
+	returnSuccessResponse(w, r, params["hostid"]+" deleted.")
+}
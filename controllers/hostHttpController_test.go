@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHosts(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	assert.Nil(t, CreateNetwork(models.Network{NetID: "hostnet", AddressRange: "10.20.0.0/24"}))
+	var node = models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "hostnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password", OS: "linux", Version: "v0.8.5", HostSecret: "hostsecret"}
+	skynetNode, err := logic.CreateNode(node, "skynet")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", skynetNode.HostID)
+	assert.Equal(t, "", skynetNode.HostSecret)
+	host, err := logic.GetHost(skynetNode.HostID)
+	assert.Nil(t, err)
+	assert.Equal(t, "hostnode", host.Name)
+	assert.Equal(t, "linux", host.OS)
+	assert.Equal(t, "v0.8.5", host.Version)
+	t.Run("WrongSecret", func(t *testing.T) {
+		var joining = node
+		joining.HostID = host.ID
+		joining.HostSecret = "wrong"
+		_, err := logic.CreateNode(joining, "hostnet")
+		assert.EqualError(t, err, "invalid secret for host "+host.ID)
+	})
+	var joining = node
+	joining.HostID = host.ID
+	hostnetNode, err := logic.CreateNode(joining, "hostnet")
+	assert.Nil(t, err)
+	assert.Equal(t, host.ID, hostnetNode.HostID)
+	t.Run("HostNodes", func(t *testing.T) {
+		nodes, err := logic.GetHostNodes(host.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(nodes))
+		hosts, err := logic.GetHosts()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(hosts))
+	})
+	t.Run("SharedEndpoint", func(t *testing.T) {
+		var update = models.Node{Endpoint: "10.0.0.9", HostID: "otherhost"}
+		assert.Nil(t, logic.UpdateNode(context.Background(), &skynetNode, &update))
+		assert.Equal(t, host.ID, update.HostID)
+		updated, err := logic.GetHost(host.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.9", updated.Endpoint)
+	})
+	t.Run("Rename", func(t *testing.T) {
+		renamed, err := logic.UpdateHost(models.Host{Name: "workstation"}, host)
+		assert.Nil(t, err)
+		assert.Equal(t, "workstation", renamed.Name)
+		_, err = logic.UpdateHost(models.Host{Name: "bad name"}, host)
+		assert.NotNil(t, err)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		assert.Nil(t, logic.DeleteHost(host.ID))
+		nodes, err := logic.GetHostNodes(host.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(nodes))
+		_, err = logic.GetDeletedNodeByID(hostnetNode.ID)
+		assert.Nil(t, err)
+		_, err = logic.GetHost(host.ID)
+		assert.NotNil(t, err)
+	})
+	t.Run("UnknownHost", func(t *testing.T) {
+		var joining = node
+		joining.HostID = host.ID
+		created, err := logic.CreateNode(joining, "skynet")
+		assert.Nil(t, err)
+		assert.NotEqual(t, host.ID, created.HostID)
+	})
+	deleteAllNodes()
+	logic.DeleteNetwork("hostnet")
+}
+
+func TestMigrateNodeHosts(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	assert.Nil(t, CreateNetwork(models.Network{NetID: "hostnet", AddressRange: "10.20.0.0/24"}))
+	for _, legacy := range []models.Node{
+		{ID: "legacy1", Name: "legacy", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Network: "skynet"},
+		{ID: "legacy2", Name: "legacy", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Network: "hostnet"},
+		{ID: "legacy3", Name: "other", Endpoint: "10.0.0.2", MacAddress: "01:02:03:04:05:06", Network: "skynet"},
+	} {
+		data, err := json.Marshal(&legacy)
+		assert.Nil(t, err)
+		assert.Nil(t, database.Insert(legacy.ID, string(data), database.NODES_TABLE_NAME))
+	}
+	assert.Nil(t, logic.MigrateNodeHosts())
+	first, err := logic.GetNodeByID("legacy1")
+	assert.Nil(t, err)
+	second, err := logic.GetNodeByID("legacy2")
+	assert.Nil(t, err)
+	other, err := logic.GetNodeByID("legacy3")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", first.HostID)
+	assert.Equal(t, first.HostID, second.HostID)
+	assert.NotEqual(t, first.HostID, other.HostID)
+	hosts, err := logic.GetHosts()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(hosts))
+	deleteAllNodes()
+	logic.DeleteNetwork("hostnet")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/functions"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/servercfg"
@@ -29,6 +30,7 @@ func networkHandlers(r *mux.Router) {
 	r.HandleFunc("/api/networks/{networkname}/nodelimit", securityCheck(true, http.HandlerFunc(updateNetworkNodeLimit))).Methods("PUT")
 	r.HandleFunc("/api/networks/{networkname}", securityCheck(true, http.HandlerFunc(deleteNetwork))).Methods("DELETE")
 	r.HandleFunc("/api/networks/{networkname}/keyupdate", securityCheck(false, http.HandlerFunc(keyUpdate))).Methods("POST")
+	r.HandleFunc("/api/networks/{networkname}/versions", securityCheck(false, http.HandlerFunc(getClientVersions))).Methods("GET")
 	r.HandleFunc("/api/networks/{networkname}/keys", securityCheck(false, http.HandlerFunc(createAccessKey))).Methods("POST")
 	r.HandleFunc("/api/networks/{networkname}/keys", securityCheck(false, http.HandlerFunc(getAccessKeys))).Methods("GET")
 	r.HandleFunc("/api/networks/{networkname}/signuptoken", securityCheck(false, http.HandlerFunc(getSignupToken))).Methods("GET")
@@ -45,8 +47,15 @@ func securityCheck(reqAdmin bool, next http.Handler) http.HandlerFunc {
 		}
 
 		var params = mux.Vars(r)
+		var netname = params["networkname"]
+		if netname == "" {
+			netname = params["network"]
+		}
+		if reqAdmin {
+			clientCertificateAuth(r)
+		}
 		bearerToken := r.Header.Get("Authorization")
-		err, networks, username := SecurityCheck(reqAdmin, params["networkname"], bearerToken)
+		err, networks, username := SecurityCheck(reqAdmin, netname, bearerToken)
 		if err != nil {
 			if strings.Contains(err.Error(), "does not exist") {
 				errorResponse.Code = http.StatusNotFound
@@ -63,6 +72,7 @@ func securityCheck(reqAdmin bool, next http.Handler) http.HandlerFunc {
 		}
 		r.Header.Set("user", username)
 		r.Header.Set("networks", string(networksJson))
+		r.Header.Set("tenant", logic.GetUserTenant(username))
 		next.ServeHTTP(w, r)
 	}
 }
@@ -92,7 +102,15 @@ func SecurityCheck(reqAdmin bool, netname string, token string) (error, []string
 			return errors.New("you are unauthorized to access this endpoint"), nil, username
 		}
 		userNetworks = networks
-		if isadmin {
+		if tenant := logic.GetUserTenant(username); isadmin && tenant != "" {
+			// tenant admins administer the networks of their tenant only
+			if userNetworks, err = logic.GetTenantNetworks(tenant); err != nil {
+				return err, nil, username
+			}
+			if netname != "" && !functions.SliceContains(userNetworks, netname) {
+				return errors.New("you are unauthorized to access this endpoint"), nil, username
+			}
+		} else if isadmin {
 			userNetworks = []string{ALL_NETWORK_ACCESS}
 		} else {
 			networkexists, err := functions.NetworkExists(netname)
@@ -146,7 +164,7 @@ func getNetworks(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "fetched networks.", 2)
+	apiLogger(r).Log(logger.Debug, "fetched networks")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(allnetworks)
 }
@@ -166,7 +184,7 @@ func ValidateNetworkUpdate(network models.Network) error {
 
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			functions.PrintUserLog("validator", e.Error(), 1)
+			logger.New(logger.API).With("network", network.NetID).Log(logger.Verbose, e.Error())
 		}
 	}
 	return err
@@ -183,7 +201,7 @@ func getNetwork(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "fetched network "+netname, 2)
+	apiLogger(r).With("network", netname).Log(logger.Debug, "fetched network")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(network)
 }
@@ -211,7 +229,7 @@ func keyUpdate(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "updated key on network "+netname, 2)
+	apiLogger(r).With("network", netname).Log(logger.Debug, "updated key on network")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(network)
 }
@@ -280,7 +298,7 @@ func updateNetwork(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "updated network "+netname, 1)
+	apiLogger(r).With("network", netname).Log(logger.Verbose, "updated network")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(newNetwork)
 }
@@ -308,7 +326,7 @@ func updateNetworkNodeLimit(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME)
-		functions.PrintUserLog(r.Header.Get("user"), "updated network node limit on, "+netname, 1)
+		apiLogger(r).With("network", netname).Log(logger.Verbose, "updated network node limit")
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(network)
@@ -322,7 +340,7 @@ func deleteNetwork(w http.ResponseWriter, r *http.Request) {
 
 	var params = mux.Vars(r)
 	network := params["networkname"]
-	err := DeleteNetwork(network)
+	err := logic.DeleteNetwork(network)
 
 	if err != nil {
 		errtype := "badrequest"
@@ -332,32 +350,11 @@ func deleteNetwork(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, errtype))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "deleted network "+network, 1)
+	apiLogger(r).With("network", network).Log(logger.Verbose, "deleted network")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode("success")
 }
 
-func DeleteNetwork(network string) error {
-	nodeCount, err := functions.GetNetworkNonServerNodeCount(network)
-	if nodeCount == 0 || database.IsEmptyRecord(err) {
-		// delete server nodes first then db records
-		servers, err := logic.GetSortedNetworkServerNodes(network)
-		if err == nil {
-			for _, s := range servers {
-				if err = logic.DeleteNode(&s, true); err != nil {
-					functions.PrintUserLog("", "could not removed server "+s.Name+" before deleting network "+network, 2)
-				} else {
-					functions.PrintUserLog("", "removed server "+s.Name+" before deleting network "+network, 2)
-				}
-			}
-		} else {
-			functions.PrintUserLog("", "could not remove servers before deleting network "+network, 1)
-		}
-		return database.DeleteRecord(database.NETWORKS_TABLE_NAME, network)
-	}
-	return errors.New("node check failed. All nodes must be deleted before deleting network")
-}
-
 //Create a network
 //Pretty simple
 func createNetwork(w http.ResponseWriter, r *http.Request) {
@@ -372,13 +369,17 @@ func createNetwork(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	// networks created by tenant admins always belong to their tenant
+	if tenant := r.Header.Get("tenant"); tenant != "" {
+		network.Tenant = tenant
+	}
 
 	err = CreateNetwork(network)
 	if err != nil {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "created network "+network.NetID, 1)
+	apiLogger(r).With("network", network.NetID).Log(logger.Verbose, "created network")
 	w.WriteHeader(http.StatusOK)
 	//json.NewEncoder(w).Encode(result)
 }
@@ -395,6 +396,11 @@ func CreateNetwork(network models.Network) error {
 		//returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return err
 	}
+	if network.Tenant != "" {
+		if err = logic.CheckTenantNetworkLimit(network.Tenant); err != nil {
+			return err
+		}
+	}
 
 	data, err := json.Marshal(&network)
 	if err != nil {
@@ -408,7 +414,7 @@ func CreateNetwork(network models.Network) error {
 		var success bool
 		success, err = serverctl.AddNetwork(network.NetID)
 		if err != nil || !success {
-			DeleteNetwork(network.NetID)
+			logic.DeleteNetwork(network.NetID)
 			if err == nil {
 				err = errors.New("Failed to add server to network " + network.DisplayName)
 			}
@@ -440,7 +446,7 @@ func createAccessKey(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "created access key "+accesskey.Name+" on "+netname, 1)
+	apiLogger(r).With("network", netname).With("key", accesskey.Name).Log(logger.Verbose, "created access key")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(key)
 	//w.Write([]byte(accesskey.AccessString))
@@ -487,8 +493,12 @@ func CreateAccessKey(accesskey models.AccessKey, network models.Network) (models
 		GRPCHost:        s.GRPCHost,
 		GRPCPort:        s.GRPCPort,
 		GRPCSSL:         s.GRPCSSL,
+		GRPCMTLS:        s.GRPCMTLS,
 		CheckinInterval: s.CheckinInterval,
 	}
+	if servervals.GRPCCA, err = grpcCAFingerprint(); err != nil {
+		return models.AccessKey{}, err
+	}
 	accessToken.ServerConfig = servervals
 	accessToken.ClientConfig.Network = netID
 	accessToken.ClientConfig.Key = accesskey.Value
@@ -506,7 +516,7 @@ func CreateAccessKey(accesskey models.AccessKey, network models.Network) (models
 	err = v.Struct(accesskey)
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			functions.PrintUserLog("validator", e.Error(), 1)
+			logger.New(logger.API).With("network", network.NetID).With("key", accesskey.Name).Log(logger.Verbose, e.Error())
 		}
 		return models.AccessKey{}, err
 	}
@@ -536,6 +546,11 @@ func GetSignupToken(netID string) (models.AccessKey, error) {
 		GRPCHost:       s.GRPCHost,
 		GRPCPort:       s.GRPCPort,
 		GRPCSSL:        s.GRPCSSL,
+		GRPCMTLS:       s.GRPCMTLS,
+	}
+	var err error
+	if servervals.GRPCCA, err = grpcCAFingerprint(); err != nil {
+		return accesskey, err
 	}
 	accessToken.ServerConfig = servervals
 
@@ -547,6 +562,14 @@ func GetSignupToken(netID string) (models.AccessKey, error) {
 	accesskey.AccessString = base64.StdEncoding.EncodeToString([]byte(tokenjson))
 	return accesskey, nil
 }
+// grpcCAFingerprint - the fingerprint of the certificate authority netclients pin at join, empty without mutual TLS
+func grpcCAFingerprint() (string, error) {
+	if !servercfg.IsGRPCMTLS() {
+		return "", nil
+	}
+	return logic.GetCAFingerprint()
+}
+
 func getSignupToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var params = mux.Vars(r)
@@ -557,11 +580,41 @@ func getSignupToken(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "got signup token "+netID, 2)
+	apiLogger(r).With("network", netID).Log(logger.Debug, "got signup token")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(token)
 }
 
+// getClientVersions - counts the nodes of a network per netclient version, to plan upgrades against the minimum version
+func getClientVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	netname := params["networkname"]
+	if _, err := GetNetwork(netname); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	versions, err := logic.GetClientVersions(netname)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	var response = models.ClientVersions{
+		Network:          netname,
+		ServerVersion:    servercfg.GetVersion(),
+		MinClientVersion: servercfg.GetMinClientVersion(),
+		Versions:         versions,
+	}
+	for version, count := range versions {
+		if !logic.IsClientVersionSupported(version, response.MinClientVersion) {
+			response.Unsupported += count
+		}
+	}
+	apiLogger(r).With("network", netname).Log(logger.Debug, "fetched netclient versions on network")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
 //pretty simple get
 func getAccessKeys(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -572,7 +625,7 @@ func getAccessKeys(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "fetched access keys on network "+network, 2)
+	apiLogger(r).With("network", network).Log(logger.Debug, "fetched access keys on network")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(keys)
 }
@@ -600,7 +653,7 @@ func deleteAccessKey(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "deleted access key "+keyname+" on network "+netname, 1)
+	apiLogger(r).With("network", netname).With("key", keyname).Log(logger.Verbose, "deleted access key")
 	w.WriteHeader(http.StatusOK)
 }
 func DeleteKey(keyname, netname string) error {
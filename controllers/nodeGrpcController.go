@@ -6,10 +6,13 @@ import (
 	"errors"
 	"strings"
 
-	"github.com/gravitl/netmaker/functions"
+	"github.com/gravitl/netmaker/database"
 	nodepb "github.com/gravitl/netmaker/grpc"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // NodeServiceServer - represents the service server for gRPC
@@ -19,23 +22,18 @@ type NodeServiceServer struct {
 
 // NodeServiceServer.ReadNode - reads node and responds with gRPC
 func (s *NodeServiceServer) ReadNode(ctx context.Context, req *nodepb.Object) (*nodepb.Object, error) {
-	// convert string id (from proto) to mongoDB ObjectId
-	macAndNetwork := strings.Split(req.Data, "###")
-
-	if len(macAndNetwork) != 2 {
-		return nil, errors.New("could not read node, invalid node id given")
-	}
-	node, err := GetNode(macAndNetwork[0], macAndNetwork[1])
+	node, err := getAuthorizedRequestNode(ctx, req.Data)
 	if err != nil {
 		return nil, err
 	}
-	node.SetLastCheckIn()
+	var checkedIn = node
+	checkedIn.SetLastCheckIn()
 	// Cast to ReadNodeRes type
-	nodeData, err := json.Marshal(&node)
+	nodeData, err := json.Marshal(&checkedIn)
 	if err != nil {
 		return nil, err
 	}
-	logic.UpdateNode(&node, &node)
+	logic.UpdateNode(ctx, &node, &checkedIn)
 	response := &nodepb.Object{
 		Data: string(nodeData),
 		Type: nodepb.NODE_TYPE,
@@ -53,12 +51,27 @@ func (s *NodeServiceServer) CreateNode(ctx context.Context, req *nodepb.Object)
 		return nil, err
 	}
 
+	node, err := createGrpcNode(node)
+	if err != nil {
+		return nil, err
+	}
+	nodeData, err := json.Marshal(&node)
+	// return the node in a CreateNodeRes type
+	response := &nodepb.Object{
+		Data: string(nodeData),
+		Type: nodepb.NODE_TYPE,
+	}
+	return response, err
+}
+
+// createGrpcNode - creates a node joining over gRPC, nodes without a valid access key are pending if the network allows it
+func createGrpcNode(node models.Node) (models.Node, error) {
 	//Check to see if key is valid
 	//TODO: Triple inefficient!!! This is the third call to the DB we make for networks
 	validKey := logic.IsKeyValid(node.Network, node.AccessKey)
 	network, err := logic.GetParentNetwork(node.Network)
 	if err != nil {
-		return nil, err
+		return models.Node{}, err
 	}
 
 	if !validKey {
@@ -67,26 +80,18 @@ func (s *NodeServiceServer) CreateNode(ctx context.Context, req *nodepb.Object)
 		if network.AllowManualSignUp == "yes" {
 			node.IsPending = "yes"
 		} else {
-			return nil, errors.New("invalid key, and network does not allow no-key signups")
+			return models.Node{}, errors.New("invalid key, and network does not allow no-key signups")
 		}
 	}
 
 	node, err = logic.CreateNode(node, node.Network)
 	if err != nil {
-		return nil, err
+		return models.Node{}, err
 	}
-	nodeData, err := json.Marshal(&node)
-	// return the node in a CreateNodeRes type
-	response := &nodepb.Object{
-		Data: string(nodeData),
-		Type: nodepb.NODE_TYPE,
+	if err = logic.SetNetworkNodesLastModified(node.Network); err != nil {
+		return models.Node{}, err
 	}
-	err = logic.SetNetworkNodesLastModified(node.Network)
-	if err != nil {
-		return nil, err
-	}
-
-	return response, nil
+	return node, nil
 }
 
 // NodeServiceServer.UpdateNode updates a node and responds over gRPC
@@ -96,14 +101,25 @@ func (s *NodeServiceServer) UpdateNode(ctx context.Context, req *nodepb.Object)
 	if err := json.Unmarshal([]byte(req.GetData()), &newnode); err != nil {
 		return nil, err
 	}
-	macaddress := newnode.MacAddress
-	networkName := newnode.Network
-
-	node, err := logic.GetNodeByMacAddress(networkName, macaddress)
+	var node models.Node
+	var err error
+	if newnode.ID == "" || newnode.HasLegacyID() {
+		// older clients do not know their id yet
+		node, err = logic.GetNodeByMacAddress(newnode.Network, newnode.MacAddress)
+		newnode.ID = node.ID
+	} else {
+		node, err = logic.GetNodeByID(newnode.ID)
+	}
 	if err != nil {
 		return nil, err
 	}
-	err = logic.UpdateNode(&node, &newnode)
+	if err = authorizeRequestNode(ctx, &node); err != nil {
+		return nil, err
+	}
+	// nodes may not extend their own expiry, they check in with ReadNode
+	newnode.ExpirationDateTime = node.ExpirationDateTime
+	newnode.LastCheckIn = node.LastCheckIn
+	err = logic.UpdateNode(ctx, &node, &newnode)
 	if err != nil {
 		return nil, err
 	}
@@ -119,9 +135,11 @@ func (s *NodeServiceServer) UpdateNode(ctx context.Context, req *nodepb.Object)
 
 // NodeServiceServer.DeleteNode - deletes a node and responds over gRPC
 func (s *NodeServiceServer) DeleteNode(ctx context.Context, req *nodepb.Object) (*nodepb.Object, error) {
-	nodeID := req.GetData()
-
-	err := DeleteNode(nodeID, true)
+	node, err := getAuthorizedRequestNode(ctx, req.GetData())
+	if err != nil {
+		return nil, err
+	}
+	err = DeleteNode(ctx, node.ID, true)
 	if err != nil {
 		return nil, err
 	}
@@ -134,10 +152,9 @@ func (s *NodeServiceServer) DeleteNode(ctx context.Context, req *nodepb.Object)
 
 // NodeServiceServer.GetPeers - fetches peers over gRPC
 func (s *NodeServiceServer) GetPeers(ctx context.Context, req *nodepb.Object) (*nodepb.Object, error) {
-	macAndNetwork := strings.Split(req.Data, "###")
-	if len(macAndNetwork) == 2 {
+	if req.Data != "" {
 		// TODO: Make constant and new variable for isServer
-		node, err := GetNode(macAndNetwork[0], macAndNetwork[1])
+		node, err := getAuthorizedRequestNode(ctx, req.Data)
 		if err != nil {
 			return nil, err
 		}
@@ -149,13 +166,13 @@ func (s *NodeServiceServer) GetPeers(ctx context.Context, req *nodepb.Object) (*
 		if node.IsRelayed == "yes" {
 			relayedNode = node.Address
 		}
-		peers, err := logic.GetPeersList(macAndNetwork[1], excludeIsRelayed, relayedNode)
+		peers, err := logic.GetPeersList(node.Network, excludeIsRelayed, relayedNode)
 		if err != nil {
 			return nil, err
 		}
 
 		peersData, err := json.Marshal(&peers)
-		functions.PrintUserLog(node.Address, "checked in successfully", 3)
+		grpcLogger(ctx).With("node", node.ID).With("address", node.Address).Log(logger.Trace, "node checked in")
 		return &nodepb.Object{
 			Data: string(peersData),
 			Type: nodepb.NODE_TYPE,
@@ -172,11 +189,14 @@ func (s *NodeServiceServer) GetExtPeers(ctx context.Context, req *nodepb.Object)
 	// Initiate a NodeItem type to write decoded data to
 	//data := &models.PeersResponse{}
 	// collection.Find returns a cursor for our (empty) query
-	macAndNetwork := strings.Split(req.Data, "###")
-	if len(macAndNetwork) != 2 {
+	node, err := getRequestNode(req.Data)
+	if err != nil {
 		return nil, errors.New("did not receive valid node id when fetching ext peers")
 	}
-	peers, err := logic.GetExtPeersList(macAndNetwork[0], macAndNetwork[1])
+	if err = authorizeRequestNode(ctx, &node); err != nil {
+		return nil, err
+	}
+	peers, err := logic.GetExtPeersList(ctx, node.ID, node.Network)
 	if err != nil {
 		return nil, err
 	}
@@ -203,3 +223,44 @@ func (s *NodeServiceServer) GetExtPeers(ctx context.Context, req *nodepb.Object)
 		Type: nodepb.EXT_PEER,
 	}, nil
 }
+
+// getAuthorizedRequestNode - gets the node a request refers to, a node may only refer to itself
+func getAuthorizedRequestNode(ctx context.Context, nodeid string) (models.Node, error) {
+	if err := authorizeRequestNode(ctx, nil); err != nil {
+		return models.Node{}, err
+	}
+	node, err := getRequestNode(nodeid)
+	if err != nil {
+		return node, err
+	}
+	return node, authorizeRequestNode(ctx, &node)
+}
+
+// authorizeRequestNode - checks a request was made with an access token, issued to the given node if there is one
+func authorizeRequestNode(ctx context.Context, node *models.Node) error {
+	tokenNodeID, _ := ctx.Value(grpcNodeIDKey).(string)
+	if tokenNodeID == "" {
+		return status.Error(codes.Unauthenticated, "request is not authorized")
+	}
+	if node != nil && node.ID != tokenNodeID {
+		return status.Error(codes.PermissionDenied, "node "+tokenNodeID+" can not access node "+node.ID)
+	}
+	return nil
+}
+
+// getRequestNode - gets the node a request refers to by its id, including nodes waiting to learn of their deletion
+// older clients refer to themselves by mac address and network until they learn their id
+func getRequestNode(nodeid string) (models.Node, error) {
+	if args := strings.Split(nodeid, "###"); len(args) == 2 {
+		node, err := logic.GetNodeByMacAddress(args[1], args[0])
+		if err != nil {
+			return node, err
+		}
+		nodeid = node.ID
+	}
+	node, err := logic.GetNodeByID(nodeid)
+	if database.IsEmptyRecord(err) {
+		return logic.GetDeletedNodeByID(nodeid)
+	}
+	return node, err
+}
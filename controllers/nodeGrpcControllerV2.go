@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// peerWatchResyncInterval - how often a peer stream recomputes the peers of its node without being signalled
+const peerWatchResyncInterval = time.Minute
+
+// peerStreamsClosed - closed on shutdown to end every peer stream, graceful stops would wait for them forever
+var peerStreamsClosed = make(chan struct{})
+var closePeerStreams sync.Once
+
+// ClosePeerStreams - ends all open peer streams, netclients reopen them once the server is back
+func ClosePeerStreams() {
+	closePeerStreams.Do(func() {
+		close(peerStreamsClosed)
+	})
+}
+
+// NodeServiceServerV2 - serves the typed node.v2 gRPC service next to the json based NodeServiceServer
+type NodeServiceServerV2 struct {
+	nodepbv2.UnimplementedNodeServiceServer
+}
+
+// NodeServiceServerV2.RequestChallenge - issues a nonce for a node to sign with its identity key
+func (s *NodeServiceServerV2) RequestChallenge(ctx context.Context, req *nodepbv2.ChallengeRequest) (*nodepbv2.ChallengeResponse, error) {
+	if req.Id == "" && req.MacAddress == "" {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, "missing node id")
+	}
+	nonce, err := logic.CreateNodeChallenge(req.Network, &models.AuthParams{ID: req.Id, MacAddress: req.MacAddress, Network: req.Network})
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, err.Error())
+	}
+	return &nodepbv2.ChallengeResponse{Nonce: nonce}, nil
+}
+
+// NodeServiceServerV2.Login - logs a node in with its password or a signed nonce and returns an access token
+func (s *NodeServiceServerV2) Login(ctx context.Context, req *nodepbv2.LoginRequest) (*nodepbv2.LoginResponse, error) {
+	if req.Id == "" && req.MacAddress == "" {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, "missing node id")
+	}
+	node, err := logic.VerifyNodeAuth(req.Network, &models.AuthParams{
+		ID:         req.Id,
+		MacAddress: req.MacAddress,
+		Network:    req.Network,
+		Password:   req.Password,
+		Nonce:      req.Nonce,
+		Signature:  req.Signature,
+	})
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, err.Error())
+	}
+	tokenString, err := logic.CreateJWT(node.ID, node.MacAddress, node.Network)
+	if err != nil || tokenString == "" {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, "could not create access token")
+	}
+	certificate, err := issueGrpcCertificate(ctx, &node, req.CertificateRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &nodepbv2.LoginResponse{AccessToken: tokenString, Certificate: certificate}, nil
+}
+
+// NodeServiceServerV2.CreateNode - joins a node to a network
+func (s *NodeServiceServerV2) CreateNode(ctx context.Context, req *nodepbv2.NodeMessage) (*nodepbv2.NodeMessage, error) {
+	node, err := createGrpcNode(req.GetNode().ToModel())
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, err.Error())
+	}
+	certificate, err := issueGrpcCertificate(ctx, &node, req.CertificateRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &nodepbv2.NodeMessage{Node: newNodeResponse(&node), Certificate: certificate}, nil
+}
+
+// issueGrpcCertificate - issues a client certificate to a node which sent a certificate request, only when mutual TLS is on
+func issueGrpcCertificate(ctx context.Context, node *models.Node, csr []byte) (*nodepbv2.Certificate, error) {
+	if len(csr) == 0 || !servercfg.IsGRPCMTLS() {
+		return nil, nil
+	}
+	certificate, err := logic.IssueNodeCertificate(ctx, node, csr)
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, "could not issue client certificate: "+err.Error())
+	}
+	caCertificate, err := logic.GetCAPEM()
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	return &nodepbv2.Certificate{Certificate: certificate, CaCertificate: caCertificate}, nil
+}
+
+// NodeServiceServerV2.ReadNode - reads the calling node
+func (s *NodeServiceServerV2) ReadNode(ctx context.Context, req *nodepbv2.NodeRequest) (*nodepbv2.NodeMessage, error) {
+	node, err := getAuthorizedNode(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	var checkedIn = node
+	checkedIn.SetLastCheckIn()
+	if err = logic.UpdateNode(ctx, &node, &checkedIn); err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	return &nodepbv2.NodeMessage{Node: newNodeResponse(&checkedIn)}, nil
+}
+
+// NodeServiceServerV2.UpdateNode - updates the calling node with the values set by its client
+func (s *NodeServiceServerV2) UpdateNode(ctx context.Context, req *nodepbv2.NodeMessage) (*nodepbv2.NodeMessage, error) {
+	var newnode = req.GetNode().ToModel()
+	node, err := getAuthorizedNode(ctx, newnode.ID)
+	if err != nil {
+		return nil, err
+	}
+	newnode.ID = node.ID
+	// nodes may not extend their own expiry, they check in with CheckIn
+	newnode.ExpirationDateTime = node.ExpirationDateTime
+	newnode.LastCheckIn = node.LastCheckIn
+	if err = logic.UpdateNode(ctx, &node, &newnode); err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, err.Error())
+	}
+	return &nodepbv2.NodeMessage{Node: newNodeResponse(&newnode)}, nil
+}
+
+// NodeServiceServerV2.DeleteNode - removes the calling node from its network
+func (s *NodeServiceServerV2) DeleteNode(ctx context.Context, req *nodepbv2.NodeRequest) (*nodepbv2.DeleteNodeResponse, error) {
+	node, err := getAuthorizedNode(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err = DeleteNode(ctx, node.ID, true); err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	return &nodepbv2.DeleteNodeResponse{}, nil
+}
+
+// NodeServiceServerV2.GetPeers - gets the peers of the calling node, only the changed ones when it sends the revision of its last peer list
+func (s *NodeServiceServerV2) GetPeers(ctx context.Context, req *nodepbv2.GetPeersRequest) (*nodepbv2.PeersResponse, error) {
+	node, err := getAuthorizedNode(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	network, err := logic.GetParentNetwork(node.Network)
+	if err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	peers, err := logic.GetPeers(node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	var response = &nodepbv2.PeersResponse{Revision: logic.GetPeersRevision(&network, peers)}
+	if changed, removed, ok := logic.GetChangedPeers(&node, &network, peers, req.Revision); ok {
+		response.Delta = true
+		response.Unchanged = len(changed) == 0 && len(removed) == 0
+		response.RemovedPublicKeys = removed
+		peers = changed
+	}
+	for i := range peers {
+		response.Peers = append(response.Peers, nodepbv2.NewPeer(&peers[i]))
+	}
+	grpcLogger(ctx).With("node", node.ID).With("address", node.Address).Log(logger.Trace, "node checked in")
+	return response, nil
+}
+
+// NodeServiceServerV2.GetExtPeers - gets the ext clients of the calling ingress gateway
+func (s *NodeServiceServerV2) GetExtPeers(ctx context.Context, req *nodepbv2.NodeRequest) (*nodepbv2.PeersResponse, error) {
+	node, err := getAuthorizedNode(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	extPeers, err := logic.GetExtPeersList(ctx, node.ID, node.Network)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	var response = &nodepbv2.PeersResponse{}
+	for i := range extPeers {
+		response.Peers = append(response.Peers, nodepbv2.NewExtPeer(&extPeers[i]))
+	}
+	return response, nil
+}
+
+// NodeServiceServerV2.CheckIn - records the state reported by the client of a node and returns the state kept by the server
+func (s *NodeServiceServerV2) CheckIn(ctx context.Context, req *nodepbv2.CheckInRequest) (*nodepbv2.CheckInResponse, error) {
+	var reported = req.GetNode().ToModel()
+	node, err := getAuthorizedNode(ctx, reported.ID)
+	if err != nil {
+		return nil, err
+	}
+	reported.ID = node.ID
+	reported.ExpirationDateTime = node.ExpirationDateTime
+	reported.SetLastCheckIn()
+	if err = logic.UpdateNode(ctx, &node, &reported); err != nil {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INVALID_ARGUMENT, err.Error())
+	}
+	return &nodepbv2.CheckInResponse{Node: newNodeResponse(&reported)}, nil
+}
+
+// NodeServiceServerV2.WatchPeers - streams the peers of the calling node, first in full and then as changes whenever its network is written to
+// ingress gateways receive their ext clients as peers too, streams also resync periodically to catch writes of other server instances
+func (s *NodeServiceServerV2) WatchPeers(req *nodepbv2.WatchPeersRequest, stream nodepbv2.NodeService_WatchPeersServer) error {
+	node, err := getAuthorizedNode(stream.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+	updates, unsubscribe := logic.SubscribePeerUpdates(node.Network)
+	defer unsubscribe()
+	resync := time.NewTicker(peerWatchResyncInterval)
+	defer resync.Stop()
+
+	var sent map[string]*nodepbv2.Peer
+	for {
+		peers, err := getWatchedPeers(stream.Context(), req.Id)
+		if err != nil {
+			return err
+		}
+		if sent == nil {
+			var token = nodepbv2.PeersToken(peers)
+			if req.ResumeToken == "" || req.ResumeToken != token {
+				if err = stream.Send(&nodepbv2.PeerUpdate{ResumeToken: token, Full: true, Peers: peers}); err != nil {
+					return err
+				}
+			}
+			sent = nodepbv2.PeerMap(peers)
+		} else if update := nodepbv2.DiffPeers(sent, peers); update != nil {
+			if err = stream.Send(update); err != nil {
+				return err
+			}
+			sent = nodepbv2.PeerMap(peers)
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-peerStreamsClosed:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-updates:
+		case <-resync.C:
+		}
+	}
+}
+
+// getWatchedPeers - gets the peers streamed to the calling node
+func getWatchedPeers(ctx context.Context, nodeid string) ([]*nodepbv2.Peer, error) {
+	node, err := getAuthorizedNode(ctx, nodeid)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := logic.GetPeers(node)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+	}
+	var peers []*nodepbv2.Peer
+	for i := range nodes {
+		if nodes[i].PublicKey != node.PublicKey {
+			peers = append(peers, nodepbv2.NewPeer(&nodes[i]))
+		}
+	}
+	if node.IsIngressGateway == "yes" {
+		extPeers, err := logic.GetExtPeersList(ctx, node.ID, node.Network)
+		if err != nil && !database.IsEmptyRecord(err) {
+			return nil, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_INTERNAL, err.Error())
+		}
+		for i := range extPeers {
+			peers = append(peers, nodepbv2.NewExtPeer(&extPeers[i]))
+		}
+	}
+	return peers, nil
+}
+
+// getAuthorizedNode - gets the node the access token of a request was issued to
+// a node may only refer to itself, older configs without a server assigned id refer to the token's node
+func getAuthorizedNode(ctx context.Context, nodeid string) (models.Node, error) {
+	tokenNodeID, _ := ctx.Value(grpcNodeIDKey).(string)
+	if tokenNodeID == "" {
+		return models.Node{}, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, "request is not authorized")
+	}
+	if nodeid != "" && !(&models.Node{ID: nodeid}).HasLegacyID() && nodeid != tokenNodeID {
+		return models.Node{}, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, "node "+tokenNodeID+" can not access node "+nodeid)
+	}
+	node, err := logic.GetNodeByID(tokenNodeID)
+	if database.IsEmptyRecord(err) {
+		if _, deletedErr := logic.GetDeletedNodeByID(tokenNodeID); deletedErr == nil {
+			return models.Node{}, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_NODE_DELETED, models.NODE_DELETE)
+		}
+	}
+	if err != nil {
+		return models.Node{}, nodepbv2.NewError(nodepbv2.ErrorCode_ERROR_CODE_NOT_FOUND, err.Error())
+	}
+	return node, nil
+}
+
+// newNodeResponse - converts a node for a response, secrets never leave the server
+func newNodeResponse(node *models.Node) *nodepbv2.Node {
+	var response = nodepbv2.NewNode(node)
+	response.Password = ""
+	response.HostSecret = ""
+	return response
+}
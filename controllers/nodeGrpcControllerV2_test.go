@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNodeServiceServerV2(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	other := models.Node{PublicKey: "RM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "othernode", Endpoint: "10.0.0.2", MacAddress: "02:02:03:04:05:06", Password: "password", Network: "skynet"}
+	other, err := logic.CreateNode(other, "skynet")
+	assert.Nil(t, err)
+	var server = &NodeServiceServerV2{}
+	var ctx = context.WithValue(context.Background(), grpcNodeIDKey, node.ID)
+	t.Run("Login", func(t *testing.T) {
+		res, err := server.Login(context.Background(), &nodepbv2.LoginRequest{Id: node.ID, Network: "skynet", Password: "password"})
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", res.AccessToken)
+		_, err = server.Login(context.Background(), &nodepbv2.LoginRequest{Id: node.ID, Network: "skynet", Password: "wrong"})
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, nodepbv2.GetErrorCode(err))
+	})
+	t.Run("ReadNode", func(t *testing.T) {
+		res, err := server.ReadNode(ctx, &nodepbv2.NodeRequest{Id: node.ID})
+		assert.Nil(t, err)
+		assert.Equal(t, node.ID, res.GetNode().GetId())
+		assert.Equal(t, "", res.GetNode().GetPassword())
+	})
+	t.Run("OtherNode", func(t *testing.T) {
+		_, err := server.ReadNode(ctx, &nodepbv2.NodeRequest{Id: other.ID})
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, nodepbv2.GetErrorCode(err))
+		_, err = server.DeleteNode(ctx, &nodepbv2.NodeRequest{Id: other.ID})
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, nodepbv2.GetErrorCode(err))
+	})
+	t.Run("NoToken", func(t *testing.T) {
+		_, err := server.ReadNode(context.Background(), &nodepbv2.NodeRequest{Id: node.ID})
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED, nodepbv2.GetErrorCode(err))
+	})
+	t.Run("GetPeers", func(t *testing.T) {
+		res, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID})
+		assert.Nil(t, err)
+		assert.False(t, res.Delta)
+		var names []string
+		for _, peer := range res.GetPeers() {
+			names = append(names, peer.GetName())
+		}
+		assert.Contains(t, names, "othernode")
+	})
+	t.Run("DeltaPeers", func(t *testing.T) {
+		// revisions leave out the current second
+		time.Sleep(1100 * time.Millisecond)
+		res, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID})
+		assert.Nil(t, err)
+		unchanged, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: res.Revision})
+		assert.Nil(t, err)
+		assert.True(t, unchanged.Delta)
+		assert.True(t, unchanged.Unchanged)
+		assert.Equal(t, 0, len(unchanged.Peers))
+		time.Sleep(1100 * time.Millisecond)
+		var moved = other
+		moved.Endpoint = "10.0.0.8"
+		assert.Nil(t, logic.UpdateNode(context.Background(), &other, &moved))
+		changed, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: res.Revision})
+		assert.Nil(t, err)
+		assert.True(t, changed.Delta)
+		assert.False(t, changed.Unchanged)
+		assert.Equal(t, 1, len(changed.Peers))
+		assert.Equal(t, "10.0.0.8", changed.Peers[0].Endpoint)
+		time.Sleep(1100 * time.Millisecond)
+		settled, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: changed.Revision})
+		assert.Nil(t, err)
+		var checkedIn = moved
+		checkedIn.SetLastCheckIn()
+		assert.Nil(t, logic.UpdateNode(context.Background(), &moved, &checkedIn))
+		same, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: settled.Revision})
+		assert.Nil(t, err)
+		assert.True(t, same.Unchanged)
+		// a check in through the server which changes nothing keeps the peer list unchanged
+		time.Sleep(1100 * time.Millisecond)
+		var otherCtx = context.WithValue(context.Background(), grpcNodeIDKey, other.ID)
+		stored, err := logic.GetNodeByID(other.ID)
+		assert.Nil(t, err)
+		_, err = server.CheckIn(otherCtx, &nodepbv2.CheckInRequest{Node: nodepbv2.NewNode(&stored)})
+		assert.Nil(t, err)
+		logic.NotifyPeerUpdate("skynet") // as if the cached peers expired
+		noop, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: settled.Revision})
+		assert.Nil(t, err)
+		assert.True(t, noop.Delta)
+		assert.True(t, noop.Unchanged)
+		assert.Equal(t, 0, len(noop.Peers))
+		assert.Equal(t, settled.Revision, noop.Revision)
+		assert.Nil(t, DeleteNode(context.Background(), other.ID, true))
+		removed, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: settled.Revision})
+		assert.Nil(t, err)
+		assert.True(t, removed.Delta)
+		assert.False(t, removed.Unchanged)
+		assert.Equal(t, 0, len(removed.Peers))
+		assert.Equal(t, []string{other.PublicKey}, removed.RemovedPublicKeys)
+		unknown, err := server.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: node.ID, Revision: settled.Revision - 3600})
+		assert.Nil(t, err)
+		assert.False(t, unknown.Delta)
+	})
+	t.Run("CheckIn", func(t *testing.T) {
+		var reported = node
+		reported.Endpoint = "10.0.0.9"
+		res, err := server.CheckIn(ctx, &nodepbv2.CheckInRequest{Node: nodepbv2.NewNode(&reported)})
+		assert.Nil(t, err)
+		assert.Equal(t, "10.0.0.9", res.GetNode().GetEndpoint())
+		assert.NotEqual(t, int64(0), res.GetNode().GetLastCheckIn())
+	})
+	t.Run("DeleteNode", func(t *testing.T) {
+		_, err := server.DeleteNode(ctx, &nodepbv2.NodeRequest{Id: node.ID})
+		assert.Nil(t, err)
+		_, err = server.ReadNode(ctx, &nodepbv2.NodeRequest{Id: node.ID})
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_NOT_FOUND, nodepbv2.GetErrorCode(err))
+	})
+	deleteAllNodes()
+}
+
+func TestNodeMessageConversion(t *testing.T) {
+	var node = models.Node{ID: "id", Network: "skynet", Address: "10.0.0.1", IsEgressGateway: "yes", DNSOn: "no", EgressGatewayRanges: []string{"192.168.0.0/24"}}
+	var converted = nodepbv2.NewNode(&node).ToModel()
+	assert.Equal(t, node, converted)
+	assert.Equal(t, "", converted.IsRelay)
+	var peer = nodepbv2.NewPeer(&node).ToModel()
+	assert.Equal(t, "yes", peer.IsEgressGateway)
+	assert.Equal(t, node.EgressGatewayRanges, peer.EgressGatewayRanges)
+}
+
+func TestDiffPeers(t *testing.T) {
+	var first = &nodepbv2.Peer{PublicKey: "first", Endpoint: "10.0.0.1"}
+	var second = &nodepbv2.Peer{PublicKey: "second", Endpoint: "10.0.0.2"}
+	var previous = nodepbv2.PeerMap([]*nodepbv2.Peer{first, second})
+	assert.Nil(t, nodepbv2.DiffPeers(previous, []*nodepbv2.Peer{second, first}))
+	assert.Equal(t, nodepbv2.PeersToken([]*nodepbv2.Peer{first, second}), nodepbv2.PeersToken([]*nodepbv2.Peer{second, first}))
+	var moved = &nodepbv2.Peer{PublicKey: "first", Endpoint: "10.0.0.9"}
+	var third = &nodepbv2.Peer{PublicKey: "third"}
+	var current = []*nodepbv2.Peer{moved, third}
+	update := nodepbv2.DiffPeers(previous, current)
+	assert.Equal(t, 2, len(update.Peers))
+	assert.Equal(t, []string{"second"}, update.RemovedPublicKeys)
+	assert.Equal(t, nodepbv2.PeersToken(current), update.ResumeToken)
+	update.Apply(previous)
+	assert.Nil(t, nodepbv2.DiffPeers(previous, current))
+}
+
+func TestWatchPeers(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), grpcNodeIDKey, node.ID))
+	defer cancel()
+	var stream = &testWatchPeersStream{ctx: ctx, updates: make(chan *nodepbv2.PeerUpdate, 10)}
+	var server = &NodeServiceServerV2{}
+	go server.WatchPeers(&nodepbv2.WatchPeersRequest{Id: node.ID}, stream)
+	first := receivePeerUpdate(t, stream)
+	assert.True(t, first.Full)
+	assert.Equal(t, 0, len(first.Peers))
+	other, err := logic.CreateNode(models.Node{PublicKey: "RM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "othernode", Endpoint: "10.0.0.2", MacAddress: "02:02:03:04:05:06", Password: "password", Network: "skynet"}, "skynet")
+	assert.Nil(t, err)
+	t.Run("Added", func(t *testing.T) {
+		update := receivePeerUpdate(t, stream)
+		assert.False(t, update.Full)
+		assert.Equal(t, 1, len(update.Peers))
+		assert.Equal(t, other.PublicKey, update.Peers[0].PublicKey)
+		assert.NotEqual(t, first.ResumeToken, update.ResumeToken)
+	})
+	t.Run("Changed", func(t *testing.T) {
+		var changed = other
+		changed.Endpoint = "10.0.0.3"
+		assert.Nil(t, logic.UpdateNode(context.Background(), &other, &changed))
+		update := receivePeerUpdate(t, stream)
+		assert.Equal(t, 1, len(update.Peers))
+		assert.Equal(t, "10.0.0.3", update.Peers[0].Endpoint)
+	})
+	t.Run("Removed", func(t *testing.T) {
+		assert.Nil(t, DeleteNode(context.Background(), other.ID, true))
+		update := receivePeerUpdate(t, stream)
+		assert.Equal(t, 0, len(update.Peers))
+		assert.Equal(t, []string{other.PublicKey}, update.RemovedPublicKeys)
+		assert.Equal(t, first.ResumeToken, update.ResumeToken)
+	})
+	t.Run("Resume", func(t *testing.T) {
+		resumeCtx, resumeCancel := context.WithCancel(context.WithValue(context.Background(), grpcNodeIDKey, node.ID))
+		var resumed = &testWatchPeersStream{ctx: resumeCtx, updates: make(chan *nodepbv2.PeerUpdate, 10)}
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			resumeCancel()
+		}()
+		assert.Nil(t, server.WatchPeers(&nodepbv2.WatchPeersRequest{Id: node.ID, ResumeToken: first.ResumeToken}, resumed))
+		assert.Equal(t, 0, len(resumed.updates))
+	})
+	deleteAllNodes()
+}
+
+// testWatchPeersStream - collects the updates sent on a peer stream
+type testWatchPeersStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	updates chan *nodepbv2.PeerUpdate
+}
+
+func (stream *testWatchPeersStream) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *testWatchPeersStream) Send(update *nodepbv2.PeerUpdate) error {
+	stream.updates <- update
+	return nil
+}
+
+func receivePeerUpdate(t *testing.T, stream *testWatchPeersStream) *nodepbv2.PeerUpdate {
+	select {
+	case update := <-stream.updates:
+		return update
+	case <-time.After(5 * time.Second):
+		t.Fatal("no peer update received")
+		return nil
+	}
+}
+
+func TestClientVersion(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	defer os.Unsetenv("MIN_CLIENT_VERSION")
+	var versionContext = func(version string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(models.NODE_VERSION_METADATA, version))
+	}
+	t.Run("CompareVersions", func(t *testing.T) {
+		assert.Equal(t, 0, logic.CompareVersions("v0.8.5", "0.8.5"))
+		assert.Equal(t, -1, logic.CompareVersions("v0.8.5", "v0.10.0"))
+		assert.Equal(t, 1, logic.CompareVersions("v1.0", "v0.9.9-rc1"))
+		assert.False(t, logic.IsVersionValid("dev"))
+	})
+	t.Run("NoMinimum", func(t *testing.T) {
+		os.Unsetenv("MIN_CLIENT_VERSION")
+		version, err := grpcCheckVersion(context.Background(), "/node.v2.NodeService/GetPeers")
+		assert.Nil(t, err)
+		assert.Equal(t, "", version)
+	})
+	t.Run("Unsupported", func(t *testing.T) {
+		os.Setenv("MIN_CLIENT_VERSION", "v0.9.0")
+		_, err := grpcCheckVersion(versionContext("v0.8.5"), "/node.v2.NodeService/GetPeers")
+		assert.Equal(t, nodepbv2.ErrorCode_ERROR_CODE_UNSUPPORTED_VERSION, nodepbv2.GetErrorCode(err))
+		assert.Contains(t, err.Error(), "v0.9.0")
+		_, err = grpcCheckVersion(context.Background(), "/node.NodeService/Login")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+		_, err = grpcCheckVersion(context.Background(), "/grpc.health.v1.Health/Check")
+		assert.Nil(t, err)
+	})
+	t.Run("Supported", func(t *testing.T) {
+		os.Setenv("MIN_CLIENT_VERSION", "v0.9.0")
+		version, err := grpcCheckVersion(versionContext("v0.9.1"), "/node.v2.NodeService/GetPeers")
+		assert.Nil(t, err)
+		assert.Equal(t, "v0.9.1", version)
+	})
+	t.Run("Recorded", func(t *testing.T) {
+		recordClientVersion(context.Background(), &node, "v0.9.1")
+		stored, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "v0.9.1", stored.Version)
+		versions, err := logic.GetClientVersions("skynet")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, versions["v0.9.1"])
+	})
+}
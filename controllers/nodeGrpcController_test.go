@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	nodepb "github.com/gravitl/netmaker/grpc"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNodeServiceServer(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	other := models.Node{PublicKey: "RM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "othernode", Endpoint: "10.0.0.2", MacAddress: "02:02:03:04:05:06", Password: "password", Network: "skynet"}
+	other, err := logic.CreateNode(other, "skynet")
+	assert.Nil(t, err)
+	var server = &NodeServiceServer{}
+	var ctx = context.WithValue(context.Background(), grpcNodeIDKey, node.ID)
+	t.Run("ReadNode", func(t *testing.T) {
+		res, err := server.ReadNode(ctx, &nodepb.Object{Data: node.ID, Type: nodepb.STRING_TYPE})
+		assert.Nil(t, err)
+		var read models.Node
+		assert.Nil(t, json.Unmarshal([]byte(res.Data), &read))
+		assert.Equal(t, node.ID, read.ID)
+		_, err = server.ReadNode(ctx, &nodepb.Object{Data: node.MacAddress + "###skynet", Type: nodepb.STRING_TYPE})
+		assert.Nil(t, err)
+	})
+	t.Run("OtherNode", func(t *testing.T) {
+		_, err := server.ReadNode(ctx, &nodepb.Object{Data: other.ID, Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = server.ReadNode(ctx, &nodepb.Object{Data: other.MacAddress + "###skynet", Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = server.GetPeers(ctx, &nodepb.Object{Data: other.ID, Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = server.GetExtPeers(ctx, &nodepb.Object{Data: other.ID, Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		var update = other
+		update.Name = "renamed"
+		data, _ := json.Marshal(&update)
+		_, err = server.UpdateNode(ctx, &nodepb.Object{Data: string(data), Type: nodepb.NODE_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = server.DeleteNode(ctx, &nodepb.Object{Data: other.ID, Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		read, err := logic.GetNodeByID(other.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "othernode", read.Name)
+	})
+	t.Run("NoToken", func(t *testing.T) {
+		_, err := server.ReadNode(context.Background(), &nodepb.Object{Data: node.ID, Type: nodepb.STRING_TYPE})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+	t.Run("DeleteNode", func(t *testing.T) {
+		_, err := server.DeleteNode(ctx, &nodepb.Object{Data: node.ID, Type: nodepb.STRING_TYPE})
+		assert.Nil(t, err)
+	})
+	deleteAllNodes()
+}
@@ -1,9 +1,18 @@
 package controller
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/gravitl/netmaker/database"
+	nodepb "github.com/gravitl/netmaker/grpc"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/stretchr/testify/assert"
@@ -17,16 +26,16 @@ func TestCreateEgressGateway(t *testing.T) {
 	deleteAllNetworks()
 	createNet()
 	t.Run("NoNodes", func(t *testing.T) {
-		node, err := CreateEgressGateway(gateway)
+		node, err := logic.CreateEgressGateway(gateway)
 		assert.Equal(t, models.Node{}, node)
 		assert.EqualError(t, err, "unable to get record key")
 	})
 	t.Run("Success", func(t *testing.T) {
 		testnode := createTestNode()
 		gateway.NetID = "skynet"
-		gateway.NodeID = testnode.MacAddress
+		gateway.NodeID = testnode.ID
 
-		node, err := CreateEgressGateway(gateway)
+		node, err := logic.CreateEgressGateway(gateway)
 		assert.Nil(t, err)
 		assert.Equal(t, "yes", node.IsEgressGateway)
 		assert.Equal(t, gateway.Ranges, node.EgressGatewayRanges)
@@ -43,13 +52,13 @@ func TestDeleteEgressGateway(t *testing.T) {
 	gateway.Interface = "eth0"
 	gateway.Ranges = []string{"10.100.100.0/24"}
 	gateway.NetID = "skynet"
-	gateway.NodeID = testnode.MacAddress
+	gateway.NodeID = testnode.ID
 	t.Run("Success", func(t *testing.T) {
-		node, err := CreateEgressGateway(gateway)
+		node, err := logic.CreateEgressGateway(gateway)
 		assert.Nil(t, err)
 		assert.Equal(t, "yes", node.IsEgressGateway)
 		assert.Equal(t, []string{"10.100.100.0/24"}, node.EgressGatewayRanges)
-		node, err = DeleteEgressGateway(gateway.NetID, gateway.NodeID)
+		node, err = logic.DeleteEgressGateway(gateway.NetID, gateway.NodeID)
 		assert.Nil(t, err)
 		assert.Equal(t, "no", node.IsEgressGateway)
 		assert.Equal(t, []string([]string{}), node.EgressGatewayRanges)
@@ -57,7 +66,7 @@ func TestDeleteEgressGateway(t *testing.T) {
 		assert.Equal(t, "", node.PostDown)
 	})
 	t.Run("NotGateway", func(t *testing.T) {
-		node, err := DeleteEgressGateway(gateway.NetID, gateway.NodeID)
+		node, err := logic.DeleteEgressGateway(gateway.NetID, gateway.NodeID)
 		assert.Nil(t, err)
 		assert.Equal(t, "no", node.IsEgressGateway)
 		assert.Equal(t, []string([]string{}), node.EgressGatewayRanges)
@@ -65,13 +74,13 @@ func TestDeleteEgressGateway(t *testing.T) {
 		assert.Equal(t, "", node.PostDown)
 	})
 	t.Run("BadNode", func(t *testing.T) {
-		node, err := DeleteEgressGateway(gateway.NetID, "01:02:03")
+		node, err := logic.DeleteEgressGateway(gateway.NetID, "01:02:03")
 		assert.EqualError(t, err, "no result found")
 		assert.Equal(t, models.Node{}, node)
 	})
 	t.Run("BadNet", func(t *testing.T) {
-		node, err := DeleteEgressGateway("badnet", gateway.NodeID)
-		assert.EqualError(t, err, "no result found")
+		node, err := logic.DeleteEgressGateway("badnet", gateway.NodeID)
+		assert.EqualError(t, err, "node "+gateway.NodeID+" does not belong to network badnet")
 		assert.Equal(t, models.Node{}, node)
 	})
 
@@ -106,42 +115,290 @@ func TestUncordonNode(t *testing.T) {
 	createNet()
 	node := createTestNode()
 	t.Run("BadNet", func(t *testing.T) {
-		resp, err := UncordonNode("badnet", node.MacAddress)
+		resp, err := UncordonNode("badnet", node.ID)
 		assert.Equal(t, models.Node{}, resp)
-		assert.EqualError(t, err, "no result found")
+		assert.EqualError(t, err, "node "+node.ID+" does not belong to network badnet")
 	})
-	t.Run("BadMac", func(t *testing.T) {
+	t.Run("BadID", func(t *testing.T) {
 		resp, err := UncordonNode("skynet", "01:02:03")
 		assert.Equal(t, models.Node{}, resp)
 		assert.EqualError(t, err, "no result found")
 	})
 	t.Run("Success", func(t *testing.T) {
-		resp, err := UncordonNode("skynet", node.MacAddress)
+		resp, err := UncordonNode("skynet", node.ID)
 		assert.Nil(t, err)
 		assert.Equal(t, "no", resp.IsPending)
 	})
 
 }
+func TestNodeExpiry(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	t.Run("Default", func(t *testing.T) {
+		node := createTestNode()
+		assert.InDelta(t, time.Now().Unix()+models.TEN_YEARS_IN_SECONDS, node.ExpirationDateTime, 5)
+		read, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.ExpirationDateTime, read.ExpirationDateTime)
+	})
+	t.Run("NetworkDefault", func(t *testing.T) {
+		network := getNet()
+		network.DefaultNodeExpiry = 3600
+		_, _, err := logic.UpdateNetwork(&network, &network)
+		assert.Nil(t, err)
+		node := createTestNode()
+		assert.InDelta(t, time.Now().Unix()+3600, node.ExpirationDateTime, 5)
+	})
+	t.Run("AccessKey", func(t *testing.T) {
+		key, err := CreateAccessKey(models.AccessKey{Name: "expiring", Uses: 1, NodeExpiry: 600}, getNet())
+		assert.Nil(t, err)
+		node, err := createGrpcNode(models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "keynode", Endpoint: "10.0.0.3", MacAddress: "01:02:03:04:05:08", Password: "password", Network: "skynet", AccessKey: key.Value, ExpirationDateTime: 1})
+		assert.Nil(t, err)
+		assert.InDelta(t, time.Now().Unix()+600, node.ExpirationDateTime, 5)
+	})
+	t.Run("ClientExpiry", func(t *testing.T) {
+		node, err := logic.CreateNode(models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "joining", Endpoint: "10.0.0.5", MacAddress: "01:02:03:04:05:0a", Password: "password", Network: "skynet", ExpirationDateTime: time.Now().Add(100 * 365 * 24 * time.Hour).Unix()}, "skynet")
+		assert.Nil(t, err)
+		assert.InDelta(t, time.Now().Unix()+3600, node.ExpirationDateTime, 5)
+	})
+	t.Run("Expired", func(t *testing.T) {
+		deleteAllNodes()
+		var events []models.EventType
+		unsubscribe := logic.SubscribeEvents("test", func(event models.Event) error {
+			events = append(events, event.Type)
+			return nil
+		}, models.EVENT_NODE_EXPIRING, models.EVENT_NODE_EXPIRED)
+		defer unsubscribe()
+		node := createTestNode()
+		expiring, err := logic.CreateNode(models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "expiring", Endpoint: "10.0.0.4", MacAddress: "01:02:03:04:05:09", Password: "password", Network: "skynet"}, "skynet")
+		assert.Nil(t, err)
+		expiring, err = ExtendNodeExpiry(context.Background(), expiring, time.Now().Add(24*time.Hour-10*time.Second).Unix())
+		assert.Nil(t, err)
+		_, err = ExtendNodeExpiry(context.Background(), node, time.Now().Add(-10*time.Second).Unix())
+		assert.Nil(t, err)
+		assert.Nil(t, logic.EnforceNodeExpiry())
+		assert.Equal(t, []models.EventType{models.EVENT_NODE_EXPIRED, models.EVENT_NODE_EXPIRING}, sortEventTypes(events))
+		peers, err := logic.GetPeersList("skynet", true, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(peers))
+		assert.Equal(t, expiring.Address, peers[0].Address)
+		_, err = logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+	})
+	t.Run("Extend", func(t *testing.T) {
+		node, err := logic.GetNodeByID(createTestNode().ID)
+		assert.Nil(t, err)
+		node, err = ExtendNodeExpiry(context.Background(), node, time.Now().Add(-time.Minute).Unix())
+		assert.Nil(t, err)
+		_, err = getExtendedExpiry(&node, &models.NodeExpiryRequest{ExpirationDateTime: time.Now().Unix() - 1})
+		assert.EqualError(t, err, "expdatetime must be in the future")
+		_, err = getExtendedExpiry(&node, &models.NodeExpiryRequest{})
+		assert.NotNil(t, err)
+		expiry, err := getExtendedExpiry(&node, &models.NodeExpiryRequest{ExtendBy: 3600})
+		assert.Nil(t, err)
+		assert.InDelta(t, time.Now().Unix()+3600, expiry, 5)
+		node, err = ExtendNodeExpiry(context.Background(), node, expiry)
+		assert.Nil(t, err)
+		peers, err := logic.GetPeersList("skynet", true, "")
+		assert.Nil(t, err)
+		var found bool
+		for _, peer := range peers {
+			found = found || peer.Address == node.Address
+		}
+		assert.True(t, found)
+	})
+	t.Run("ClientUpdate", func(t *testing.T) {
+		node := createTestNode()
+		var update = node
+		update.ExpirationDateTime = time.Now().Add(100 * 365 * 24 * time.Hour).Unix()
+		data, _ := json.Marshal(&update)
+		_, err := (&NodeServiceServer{}).UpdateNode(context.WithValue(context.Background(), grpcNodeIDKey, node.ID), &nodepb.Object{Data: string(data), Type: nodepb.NODE_TYPE})
+		assert.Nil(t, err)
+		read, err := logic.GetNodeByID(node.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, node.ExpirationDateTime, read.ExpirationDateTime)
+	})
+	network := getNet()
+	network.DefaultNodeExpiry = 0
+	logic.UpdateNetwork(&network, &network)
+}
+
+func TestNodeStatus(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	node := createTestNode()
+	t.Run("Status", func(t *testing.T) {
+		var checked = node
+		assert.Equal(t, models.NODE_STATUS_ONLINE, logic.GetNodeStatus(&checked))
+		checked.LastCheckIn = time.Now().Add(-logic.StaleAfter(&node)).Unix()
+		assert.Equal(t, models.NODE_STATUS_STALE, logic.GetNodeStatus(&checked))
+		checked.LastCheckIn = time.Now().Add(-logic.OfflineAfter(&node)).Unix()
+		assert.Equal(t, models.NODE_STATUS_OFFLINE, logic.GetNodeStatus(&checked))
+		checked.ExpirationDateTime = time.Now().Unix() - 1
+		assert.Equal(t, models.NODE_STATUS_EXPIRED, logic.GetNodeStatus(&checked))
+		checked.IsPending = "yes"
+		assert.Equal(t, models.NODE_STATUS_PENDING, logic.GetNodeStatus(&checked))
+	})
+	t.Run("Filter", func(t *testing.T) {
+		var offline = node
+		offline.LastCheckIn = time.Now().Add(-logic.OfflineAfter(&node)).Unix()
+		nodes, err := filterNodesByStatus([]models.Node{node, offline}, "offline,stale")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(nodes))
+		assert.Equal(t, models.NODE_STATUS_OFFLINE, nodes[0].Status)
+		nodes, err = filterNodesByStatus([]models.Node{node, offline}, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(nodes))
+		assert.Equal(t, models.NODE_STATUS_ONLINE, nodes[0].Status)
+		_, err = filterNodesByStatus([]models.Node{node}, "sleeping")
+		assert.EqualError(t, err, "invalid node status sleeping")
+	})
+	t.Run("OfflinePeers", func(t *testing.T) {
+		os.Setenv("EXCLUDE_OFFLINE_PEERS", "on")
+		defer os.Unsetenv("EXCLUDE_OFFLINE_PEERS")
+		var events []models.Event
+		unsubscribe := logic.SubscribeEvents("test", func(event models.Event) error {
+			events = append(events, event)
+			return nil
+		}, models.EVENT_NODE_STATUS_CHANGED)
+		defer unsubscribe()
+		var offline = node
+		offline.LastCheckIn = time.Now().Add(-logic.OfflineAfter(&node)).Unix()
+		data, _ := json.Marshal(&offline)
+		assert.Nil(t, database.Insert(offline.ID, string(data), database.NODES_TABLE_NAME))
+		assert.Nil(t, logic.SetNetworkNodesLastModified("skynet"))
+		peers, err := logic.GetPeersList("skynet", true, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(peers))
+
+		var checkedIn = offline
+		checkedIn.SetLastCheckIn()
+		assert.Nil(t, logic.UpdateNode(context.Background(), &offline, &checkedIn))
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, models.NODE_STATUS_OFFLINE, events[0].Previous.Status)
+		assert.Equal(t, models.NODE_STATUS_ONLINE, events[0].Node.Status)
+		peers, err = logic.GetPeersList("skynet", true, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(peers))
+	})
+}
+
+func sortEventTypes(types []models.EventType) []models.EventType {
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
 func TestValidateEgressGateway(t *testing.T) {
 	var gateway models.EgressGatewayRequest
 	t.Run("EmptyRange", func(t *testing.T) {
 		gateway.Interface = "eth0"
 		gateway.Ranges = []string{}
-		err := ValidateEgressGateway(gateway)
+		err := logic.ValidateEgressGateway(gateway)
 		assert.EqualError(t, err, "IP Ranges Cannot Be Empty")
 	})
 	t.Run("EmptyInterface", func(t *testing.T) {
 		gateway.Interface = ""
-		err := ValidateEgressGateway(gateway)
+		err := logic.ValidateEgressGateway(gateway)
 		assert.NotNil(t, err)
 		assert.Equal(t, "Interface cannot be empty", err.Error())
 	})
 	t.Run("Success", func(t *testing.T) {
 		gateway.Interface = "eth0"
 		gateway.Ranges = []string{"10.100.100.0/24"}
-		err := ValidateEgressGateway(gateway)
+		err := logic.ValidateEgressGateway(gateway)
+		assert.Nil(t, err)
+	})
+}
+
+func TestNodeAuth(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	passwordNode := createTestNode()
+	identityNode, err := logic.CreateNode(models.Node{PublicKey: "RM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "identitynode", Endpoint: "10.0.0.2", MacAddress: "02:02:03:04:05:06", IdentityKey: base64.StdEncoding.EncodeToString(publicKey), Network: "skynet"}, "skynet")
+	assert.Nil(t, err)
+	assert.Equal(t, "", identityNode.Password)
+	var sign = func(nonce string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, models.NodeChallengeMessage("skynet", identityNode.ID, nonce)))
+	}
+	t.Run("Password", func(t *testing.T) {
+		_, err := logic.VerifyNodeAuth("skynet", &models.AuthParams{ID: passwordNode.ID, Password: "password"})
+		assert.Nil(t, err)
+		// older clients log in with their mac address
+		_, err = logic.VerifyNodeAuth("skynet", &models.AuthParams{MacAddress: passwordNode.MacAddress, Password: "password"})
 		assert.Nil(t, err)
+		_, err = logic.VerifyNodeAuth("badnet", &models.AuthParams{ID: passwordNode.ID, Password: "password"})
+		assert.EqualError(t, err, "node does not exist")
+		_, err = logic.VerifyNodeAuth("skynet", &models.AuthParams{MacAddress: passwordNode.MacAddress, Password: "wrong"})
+		assert.EqualError(t, err, "incorrect credentials")
+		_, err = logic.CreateNodeChallenge("skynet", &models.AuthParams{ID: passwordNode.ID})
+		assert.NotNil(t, err)
+	})
+	t.Run("InvalidIdentityKey", func(t *testing.T) {
+		_, err := logic.CreateNode(models.Node{PublicKey: "RM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Endpoint: "10.0.0.3", MacAddress: "03:02:03:04:05:06", IdentityKey: "bm90IGEga2V5", Network: "skynet"}, "skynet")
+		assert.NotNil(t, err)
+	})
+	t.Run("PasswordRejected", func(t *testing.T) {
+		_, err := logic.VerifyNodeAuth("skynet", &models.AuthParams{MacAddress: identityNode.MacAddress, Password: ""})
+		assert.NotNil(t, err)
+	})
+	t.Run("Challenge", func(t *testing.T) {
+		nonce, err := logic.CreateNodeChallenge("skynet", &models.AuthParams{ID: identityNode.ID})
+		assert.Nil(t, err)
+		_, err = logic.VerifyNodeAuth("skynet", &models.AuthParams{ID: identityNode.ID, Nonce: nonce, Signature: sign(nonce)})
+		assert.Nil(t, err)
+		// a nonce can only be used once
+		_, err = logic.VerifyNodeAuth("skynet", &models.AuthParams{ID: identityNode.ID, Nonce: nonce, Signature: sign(nonce)})
+		assert.EqualError(t, err, "invalid challenge")
+	})
+	t.Run("WrongKey", func(t *testing.T) {
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		nonce, err := logic.CreateNodeChallenge("skynet", &models.AuthParams{ID: identityNode.ID})
+		assert.Nil(t, err)
+		var signature = base64.StdEncoding.EncodeToString(ed25519.Sign(otherKey, models.NodeChallengeMessage("skynet", identityNode.ID, nonce)))
+		_, err = logic.VerifyNodeAuth("skynet", &models.AuthParams{ID: identityNode.ID, Nonce: nonce, Signature: signature})
+		assert.EqualError(t, err, "invalid signature")
+	})
+	t.Run("GRPCLogin", func(t *testing.T) {
+		var server = &NodeServiceServer{}
+		challenge, err := server.Login(context.Background(), &nodepb.Object{
+			Data: `{"id": "` + identityNode.ID + `", "network": "skynet"}`,
+			Type: nodepb.NODE_CHALLENGE,
+		})
+		assert.Nil(t, err)
+		data, err := json.Marshal(&models.AuthParams{ID: identityNode.ID, Network: "skynet", Nonce: challenge.Data, Signature: sign(challenge.Data)})
+		assert.Nil(t, err)
+		token, err := server.Login(context.Background(), &nodepb.Object{Data: string(data)})
+		assert.Nil(t, err)
+		assert.Equal(t, nodepb.ACCESS_TOKEN, token.Type)
+		nodeID, network, err := logic.VerifyToken(token.Data)
+		assert.Nil(t, err)
+		assert.Equal(t, identityNode.ID, nodeID)
+		assert.Equal(t, "skynet", network)
+	})
+	t.Run("IdentityKeyOnlyAtJoin", func(t *testing.T) {
+		var update = models.Node{IdentityKey: base64.StdEncoding.EncodeToString(publicKey)}
+		update.Fill(&passwordNode)
+		assert.Equal(t, "", update.IdentityKey)
+		otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		update = models.Node{IdentityKey: base64.StdEncoding.EncodeToString(otherKey)}
+		update.Fill(&identityNode)
+		assert.Equal(t, identityNode.IdentityKey, update.IdentityKey)
+	})
+	t.Run("ChallengesLimited", func(t *testing.T) {
+		var err error
+		for i := 0; err == nil && i < 100; i++ {
+			_, err = logic.CreateNodeChallenge("skynet", &models.AuthParams{ID: identityNode.ID})
+		}
+		assert.EqualError(t, err, "too many challenges requested for node "+identityNode.ID+", try again later")
 	})
+	deleteAllNodes()
 }
 
 //
@@ -150,7 +407,6 @@ func TestValidateEgressGateway(t *testing.T) {
 func deleteAllNodes() {
 	nodes, _ := logic.GetAllNodes()
 	for _, node := range nodes {
-		key := node.MacAddress + "###" + node.Network
-		DeleteNode(key, true)
+		DeleteNode(context.Background(), node.ID, true)
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 )
@@ -22,6 +23,8 @@ func formatError(err error, errType string) models.ErrorResponse {
 		status = http.StatusUnauthorized
 	case "forbidden":
 		status = http.StatusForbidden
+	case "conflict":
+		status = http.StatusConflict
 	default:
 		status = http.StatusInternalServerError
 	}
@@ -42,13 +45,19 @@ func returnSuccessResponse(response http.ResponseWriter, request *http.Request,
 	json.NewEncoder(response).Encode(httpResponse)
 }
 
+// apiLogger - returns a logger adding the request id and the user of a request to every message
+func apiLogger(r *http.Request) logger.Logger {
+	return logic.RequestLogger(r.Context(), logger.API).With("user", r.Header.Get("user"))
+}
+
 func returnErrorResponse(response http.ResponseWriter, request *http.Request, errorMessage models.ErrorResponse) {
 	httpResponse := &models.ErrorResponse{Code: errorMessage.Code, Message: errorMessage.Message}
 	jsonResponse, err := json.Marshal(httpResponse)
 	if err != nil {
 		panic(err)
 	}
-	logic.Log("processed request error: "+errorMessage.Message, 1)
+	apiLogger(request).With("method", request.Method).With("path", request.URL.Path).With("code", errorMessage.Code).
+		Log(logger.Verbose, "processed request error: "+errorMessage.Message)
 	response.Header().Set("Content-Type", "application/json")
 	response.WriteHeader(errorMessage.Code)
 	response.Write(jsonResponse)
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// restTLSReloadInterval - how often the API certificate files are checked for changes
+const restTLSReloadInterval = 10 * time.Second
+
+// certificateReloader - serves a certificate from files and reloads it when they change, e.g. after a renewal
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	modified    time.Time
+}
+
+// newCertificateReloader - loads a certificate and its key, fails if they can not be loaded
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	var reloader = &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// certificateReloader.GetCertificate - returns the current certificate, used as tls.Config.GetCertificate
+func (reloader *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.certificate, nil
+}
+
+// certificateReloader.reloadIfChanged - reloads the certificate when one of its files changed, reports if it did
+// the current certificate is kept when the new files can not be loaded, e.g. while only one of them was replaced
+func (reloader *certificateReloader) reloadIfChanged() (bool, error) {
+	modified, err := lastModified(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return false, err
+	}
+	reloader.mutex.RLock()
+	var unchanged = reloader.certificate != nil && !modified.After(reloader.modified)
+	reloader.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return false, err
+	}
+	reloader.mutex.Lock()
+	reloader.certificate = &certificate
+	reloader.modified = modified
+	reloader.mutex.Unlock()
+	return true, nil
+}
+
+// certificateReloader.watch - reloads the certificate on changes until stopped
+func (reloader *certificateReloader) watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(restTLSReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := reloader.reloadIfChanged()
+			if err != nil {
+				logger.New(logger.API).With("certificate", reloader.certFile).With("error", err.Error()).
+					Log(logger.Verbose, "could not reload API certificate, still serving the previous one")
+			} else if reloaded {
+				logger.New(logger.API).With("certificate", reloader.certFile).Log(logger.Info, "reloaded API certificate")
+			}
+		}
+	}
+}
+
+// getRESTTLSConfig - gets the TLS config of the API, requesting client certificates when a client authority is set
+func getRESTTLSConfig(reloader *certificateReloader) (*tls.Config, error) {
+	var tlsConfig = &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if caFile := servercfg.GetRESTTLSClientCA(); caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		var clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in " + caFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		// browsers and tokens without a certificate keep working
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// clientCertificateAuth - authenticates an admin request with a verified client certificate and no token as the admin named by its common name
+// the request gets a token of that user, certificates naming no admin or a user with a second factor authenticate nobody
+func clientCertificateAuth(r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 || r.Header.Get("Authorization") != "" {
+		return
+	}
+	var name = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	var log = apiLogger(r).With("method", r.Method).With("path", r.URL.Path).With("certificate", name)
+	user, err := logic.GetUser(name)
+	if err != nil || !user.IsAdmin {
+		log.Log(logger.Verbose, "client certificate does not name an admin user, not authenticated")
+		return
+	}
+	if logic.IsTOTPEnabled(user.UserName) || logic.IsTOTPRequired(&user) {
+		// a certificate would bypass the second factor
+		log.Log(logger.Verbose, "client certificate names a user with TOTP, not authenticated")
+		return
+	}
+	token, err := logic.CreateUserJWT(user.UserName, user.Networks, user.IsAdmin)
+	if err != nil {
+		log.Error("could not create token for client certificate", err)
+		return
+	}
+	log.Log(logger.Debug, "authenticated by client certificate")
+	r.Header.Set("Authorization", "Bearer "+token)
+}
+
+// httpsRedirect - redirects plain HTTP requests to the same path on the TLS port of the API
+func httpsRedirect(apiPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if apiPort != "443" {
+			host = net.JoinHostPort(host, apiPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// lastModified - gets the latest modification time of files
+func lastModified(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate - writes a self signed certificate and its key, returns the certificate
+func writeTestCertificate(t *testing.T, certFile, keyFile, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.Nil(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+	certificate, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return certificate
+}
+
+func TestRESTTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netmaker-rest-tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	var certFile, keyFile = filepath.Join(dir, "api.crt"), filepath.Join(dir, "api.key")
+	t.Run("Reload", func(t *testing.T) {
+		first := writeTestCertificate(t, certFile, keyFile, "first.example.com")
+		reloader, err := newCertificateReloader(certFile, keyFile)
+		assert.Nil(t, err)
+		served, _ := reloader.GetCertificate(nil)
+		assert.Equal(t, first.Raw, served.Certificate[0])
+		reloaded, err := reloader.reloadIfChanged()
+		assert.Nil(t, err)
+		assert.False(t, reloaded)
+
+		second := writeTestCertificate(t, certFile, keyFile, "second.example.com")
+		var later = time.Now().Add(time.Minute)
+		assert.Nil(t, os.Chtimes(certFile, later, later))
+		reloaded, err = reloader.reloadIfChanged()
+		assert.Nil(t, err)
+		assert.True(t, reloaded)
+		served, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, second.Raw, served.Certificate[0])
+
+		// a half written key keeps the previous certificate
+		assert.Nil(t, ioutil.WriteFile(keyFile, []byte("garbage"), 0600))
+		later = later.Add(time.Minute)
+		assert.Nil(t, os.Chtimes(keyFile, later, later))
+		_, err = reloader.reloadIfChanged()
+		assert.NotNil(t, err)
+		served, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, second.Raw, served.Certificate[0])
+	})
+	t.Run("Redirect", func(t *testing.T) {
+		var recorder = httptest.NewRecorder()
+		httpsRedirect("8081").ServeHTTP(recorder, httptest.NewRequest("GET", "http://api.example.com/api/networks?x=1", nil))
+		assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+		assert.Equal(t, "https://api.example.com:8081/api/networks?x=1", recorder.Header().Get("Location"))
+		recorder = httptest.NewRecorder()
+		httpsRedirect("443").ServeHTTP(recorder, httptest.NewRequest("GET", "http://api.example.com:80/api", nil))
+		assert.Equal(t, "https://api.example.com/api", recorder.Header().Get("Location"))
+	})
+	t.Run("ClientCertificateAuth", func(t *testing.T) {
+		database.InitializeDatabase()
+		deleteAllUsers()
+		_, err := logic.CreateAdmin(models.User{UserName: "admin", Password: "password"})
+		assert.Nil(t, err)
+		_, err = logic.CreateUser(models.User{UserName: "operator", Password: "password"})
+		assert.Nil(t, err)
+		var clientFile, clientKeyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+		client := writeTestCertificate(t, clientFile, clientKeyFile, "admin")
+		var authorization string
+		var next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		})
+		var serve = func(handler http.Handler, cert *x509.Certificate) int {
+			authorization = ""
+			var request = httptest.NewRequest("GET", "https://api.example.com/api/networks", nil)
+			request.TLS = &tls.ConnectionState{}
+			if cert != nil {
+				request.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+			}
+			var recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			return recorder.Code
+		}
+		assert.Equal(t, http.StatusOK, serve(securityCheck(true, next), client))
+		assert.NotEqual(t, "Bearer "+servercfg.GetMasterKey(), authorization)
+		username, _, isadmin, err := logic.VerifyUserToken(strings.TrimPrefix(authorization, "Bearer "))
+		assert.Nil(t, err)
+		assert.Equal(t, "admin", username)
+		assert.True(t, isadmin)
+		assert.Equal(t, http.StatusOK, serve(securityCheckServer(true, next), client))
+		assert.Equal(t, http.StatusOK, serve(authorizeUserAdm(next), client))
+
+		// only admin routes accept certificates
+		assert.Equal(t, http.StatusUnauthorized, serve(securityCheck(false, next), client))
+		assert.Equal(t, "", authorization)
+
+		// certificates of users who are no admins authenticate nobody
+		operator := writeTestCertificate(t, clientFile, clientKeyFile, "operator")
+		assert.Equal(t, http.StatusUnauthorized, serve(securityCheck(true, next), operator))
+		assert.Equal(t, "", authorization)
+		assert.Equal(t, http.StatusUnauthorized, serve(securityCheck(true, next), nil))
+
+		// certificates would bypass a second factor
+		os.Setenv("TOTP_REQUIRED_FOR_ADMINS", "on")
+		assert.Equal(t, http.StatusUnauthorized, serve(securityCheck(true, next), client))
+		os.Unsetenv("TOTP_REQUIRED_FOR_ADMINS")
+		enrollment, err := logic.EnrollTOTP("admin")
+		assert.Nil(t, err)
+		code, _ := logic.GenerateTOTPCode(enrollment.Secret, time.Now())
+		assert.Nil(t, logic.ConfirmTOTP("admin", code))
+		assert.Equal(t, http.StatusUnauthorized, serve(securityCheck(true, next), client))
+		assert.Equal(t, "", authorization)
+		assert.Nil(t, logic.DisableTOTP("admin"))
+
+		os.Setenv("REST_TLS_CLIENT_CA", clientFile)
+		defer os.Unsetenv("REST_TLS_CLIENT_CA")
+		writeTestCertificate(t, certFile, keyFile, "api.example.com")
+		reloader, err := newCertificateReloader(certFile, keyFile)
+		assert.Nil(t, err)
+		tlsConfig, err := getRESTTLSConfig(reloader)
+		assert.Nil(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+	})
+}
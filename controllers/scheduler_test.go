@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	createNet()
+	database.DeleteRecord(database.JOBS_TABLE_NAME, "testjob")
+	var runs = make(chan struct{}, 10)
+	logic.RegisterJob(logic.Job{
+		Name:       "testjob",
+		Interval:   func() time.Duration { return time.Hour },
+		LeaderOnly: true,
+		Run: func() error {
+			runs <- struct{}{}
+			return errors.New("test failure")
+		},
+	})
+	t.Run("Interval", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			logic.RunScheduler(ctx)
+			close(stopped)
+		}()
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("job did not run on the first tick")
+		}
+		cancel()
+		<-stopped
+		assert.Equal(t, 0, len(runs))
+	})
+	t.Run("Manual", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		runJob(rec, mux.SetURLVars(httptest.NewRequest("POST", "/api/server/jobs/testjob/run", nil), map[string]string{"job": "testjob"}))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var run models.JobRun
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &run))
+		assert.Equal(t, logic.JOB_TRIGGER_MANUAL, run.Trigger)
+		assert.Equal(t, "test failure", run.Error)
+
+		rec = httptest.NewRecorder()
+		runJob(rec, mux.SetURLVars(httptest.NewRequest("POST", "/api/server/jobs/nojob/run", nil), map[string]string{"job": "nojob"}))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+	t.Run("Panic", func(t *testing.T) {
+		logic.RegisterJob(logic.Job{
+			Name:     "panicjob",
+			Interval: func() time.Duration { return time.Hour },
+			Run: func() error {
+				panic("test panic")
+			},
+		})
+		run, err := logic.RunJob("panicjob")
+		assert.Nil(t, err)
+		assert.Equal(t, "job panicked: test panic", run.Error)
+		_, err = logic.RunJob("panicjob")
+		assert.Nil(t, err)
+	})
+	t.Run("History", func(t *testing.T) {
+		for _, job := range logic.GetJobs() {
+			if job.Name == "testjob" {
+				assert.Equal(t, int64(3600), job.Interval)
+				assert.Equal(t, 2, len(job.Runs))
+				assert.Equal(t, logic.JOB_TRIGGER_MANUAL, job.Runs[0].Trigger)
+				assert.Equal(t, logic.JOB_TRIGGER_INTERVAL, job.Runs[1].Trigger)
+				return
+			}
+		}
+		t.Error("testjob not listed")
+	})
+	t.Run("NodeExpiry", func(t *testing.T) {
+		node := createTestNode()
+		node.ExpirationDateTime = time.Now().Add(-48 * time.Hour).Unix()
+		data, _ := json.Marshal(&node)
+		assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+		assert.Nil(t, logic.EnforceNodeExpiry())
+		_, err := logic.GetNodeByID(node.ID)
+		assert.NotNil(t, err)
+		_, err = database.FetchRecord(database.DELETED_NODES_TABLE_NAME, node.ID)
+		assert.Nil(t, err)
+	})
+	t.Run("NodeExpiryWhileDown", func(t *testing.T) {
+		var events []models.Event
+		unsubscribe := logic.SubscribeEvents("test", func(event models.Event) error {
+			events = append(events, event)
+			return nil
+		}, models.EVENT_NODE_EXPIRED)
+		defer unsubscribe()
+		// the last check ran an hour ago, before the servers went down
+		assert.Nil(t, database.Insert("checked:nodeexpiry", fmt.Sprintf(`{"checked": %d}`, time.Now().Add(-time.Hour).Unix()), database.JOBS_TABLE_NAME))
+		node := createTestNode()
+		node.ExpirationDateTime = time.Now().Add(-30 * time.Minute).Unix()
+		data, _ := json.Marshal(&node)
+		assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+		assert.Nil(t, logic.EnforceNodeExpiry())
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, node.ID, events[0].Node.ID)
+		assert.Nil(t, logic.EnforceNodeExpiry())
+		assert.Equal(t, 1, len(events))
+		DeleteNode(context.Background(), node.ID, true)
+	})
+	t.Run("NodeStatus", func(t *testing.T) {
+		var events []models.Event
+		unsubscribe := logic.SubscribeEvents("test", func(event models.Event) error {
+			events = append(events, event)
+			return nil
+		}, models.EVENT_NODE_STATUS_CHANGED)
+		defer unsubscribe()
+		node := createTestNode()
+		node.LastCheckIn = time.Now().Add(-logic.StaleAfter(&node) - 10*time.Second).Unix()
+		data, _ := json.Marshal(&node)
+		assert.Nil(t, database.Insert(node.ID, string(data), database.NODES_TABLE_NAME))
+		assert.Nil(t, logic.UpdateNodeStatus())
+		assert.Equal(t, 1, len(events))
+		assert.Equal(t, node.ID, events[0].Node.ID)
+		assert.Equal(t, models.NODE_STATUS_ONLINE, events[0].Previous.Status)
+		assert.Equal(t, models.NODE_STATUS_STALE, events[0].Node.Status)
+		assert.Nil(t, logic.UpdateNodeStatus())
+		assert.Equal(t, 1, len(events))
+	})
+	t.Run("DeletedNodes", func(t *testing.T) {
+		var old = models.Node{ID: "olddeleted", Network: "skynet", LastModified: time.Now().Add(-8 * 24 * time.Hour).Unix()}
+		var recent = models.Node{ID: "recentdeleted", Network: "skynet", LastModified: time.Now().Unix()}
+		for _, node := range []models.Node{old, recent} {
+			data, _ := json.Marshal(&node)
+			assert.Nil(t, database.Insert(node.ID, string(data), database.DELETED_NODES_TABLE_NAME))
+		}
+		assert.Nil(t, logic.PurgeDeletedNodes())
+		_, err := database.FetchRecord(database.DELETED_NODES_TABLE_NAME, old.ID)
+		assert.NotNil(t, err)
+		_, err = database.FetchRecord(database.DELETED_NODES_TABLE_NAME, recent.ID)
+		assert.Nil(t, err)
+	})
+}
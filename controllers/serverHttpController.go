@@ -6,16 +6,22 @@ import (
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/servercfg"
 	"github.com/gravitl/netmaker/serverctl"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func serverHandlers(r *mux.Router) {
 	r.HandleFunc("/api/server/addnetwork/{network}", securityCheckServer(true, http.HandlerFunc(addNetwork))).Methods("POST")
 	r.HandleFunc("/api/server/getconfig", securityCheckServer(false, http.HandlerFunc(getConfig))).Methods("GET")
 	r.HandleFunc("/api/server/removenetwork/{network}", securityCheckServer(true, http.HandlerFunc(removeNetwork))).Methods("DELETE")
+	// prometheus metrics of the server, scraped with the master key as bearer token
+	r.Handle("/api/server/metrics", securityCheckServer(true, promhttp.Handler())).Methods("GET")
+	r.HandleFunc("/api/server/jobs", securityCheckServer(true, http.HandlerFunc(getJobs))).Methods("GET")
+	r.HandleFunc("/api/server/jobs/{job}/run", securityCheckServer(true, http.HandlerFunc(runJob))).Methods("POST")
 }
 
 //Security check is middleware for every function and just checks to make sure that its the master calling
@@ -27,6 +33,9 @@ func securityCheckServer(adminonly bool, next http.Handler) http.HandlerFunc {
 			Code: http.StatusInternalServerError, Message: "W1R3: It's not you it's me.",
 		}
 
+		if adminonly {
+			clientCertificateAuth(r)
+		}
 		bearerToken := r.Header.Get("Authorization")
 
 		var tokenSplit = strings.Split(bearerToken, " ")
@@ -50,7 +59,7 @@ func securityCheckServer(adminonly bool, next http.Handler) http.HandlerFunc {
 			returnErrorResponse(w, r, errorResponse)
 			return
 		}
-		if adminonly && !isadmin && !authenticateMasterServer(authToken) {
+		if adminonly && (!isadmin || logic.GetUserTenant(user) != "") && !authenticateMasterServer(authToken) {
 			returnErrorResponse(w, r, errorResponse)
 			return
 		}
@@ -110,3 +119,25 @@ func addNetwork(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode("Server added to network " + params["network"])
 }
+
+// getJobs - lists the scheduled jobs of the server with their recent runs
+func getJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logic.GetJobs())
+}
+
+// runJob - runs a scheduled job now and responds with the run, a failed run is still a successful request
+func runJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	run, err := logic.RunJob(params["job"])
+	if err == logic.ErrJobNotFound {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	} else if err == logic.ErrJobRunning {
+		returnErrorResponse(w, r, formatError(err, "conflict"))
+		return
+	}
+	apiLogger(r).With("job", params["job"]).Log(logger.Verbose, "ran job")
+	json.NewEncoder(w).Encode(run)
+}
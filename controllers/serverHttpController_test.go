@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravitl/netmaker/config"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/servercfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfig(t *testing.T) {
+	var original = config.Get()
+	defer config.Set(original)
+	t.Run("Valid", func(t *testing.T) {
+		assert.Nil(t, servercfg.Validate())
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		os.Setenv("API_PORT", "http")
+		os.Setenv("DATABASE", "mongodb")
+		os.Setenv("GROUP_MAPPINGS", `{"group": "devs"}`)
+		defer os.Unsetenv("API_PORT")
+		defer os.Unsetenv("DATABASE")
+		defer os.Unsetenv("GROUP_MAPPINGS")
+		err := servercfg.Validate()
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "API_PORT")
+		assert.Contains(t, err.Error(), "DATABASE")
+		assert.Contains(t, err.Error(), "GROUP_MAPPINGS")
+	})
+	t.Run("Redacted", func(t *testing.T) {
+		os.Setenv("MASTER_KEY", "supersecret")
+		defer os.Unsetenv("MASTER_KEY")
+		rec := httptest.NewRecorder()
+		getConfig(rec, httptest.NewRequest("GET", "/api/server/getconfig", nil))
+		assert.NotContains(t, rec.Body.String(), "supersecret")
+		var cfg config.ServerConfig
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+		assert.Equal(t, "(hidden)", cfg.MasterKey)
+	})
+	t.Run("Reload", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "netmaker-config")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		var file = filepath.Join(dir, "netmaker.yaml")
+		os.Setenv("NETMAKER_CONFIG", file)
+		defer os.Unsetenv("NETMAKER_CONFIG")
+		config.Set(&config.EnvironmentConfig{})
+
+		assert.Nil(t, ioutil.WriteFile(file, []byte("server:\n  allowedorigin: \"https://dashboard.example.com\"\n  servercheckininterval: 30\n"), 0600))
+		result, err := servercfg.Reload()
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{"allowedorigin", "servercheckininterval"}, result.Applied)
+		assert.False(t, result.NeedRestart)
+		assert.Equal(t, "https://dashboard.example.com", servercfg.GetAllowedOrigin())
+		assert.Equal(t, int64(30), servercfg.GetServerCheckinInterval())
+
+		os.Setenv("CORS_ALLOWED_ORIGIN", "*")
+		defer os.Unsetenv("CORS_ALLOWED_ORIGIN")
+		assert.Nil(t, ioutil.WriteFile(file, []byte("server:\n  allowedorigin: \"https://other.example.com\"\n  servercheckininterval: 30\n  apiport: \"9090\"\n"), 0600))
+		result, err = servercfg.Reload()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"allowedorigin"}, result.Overridden)
+		assert.True(t, result.NeedRestart)
+		assert.Equal(t, "*", servercfg.GetAllowedOrigin())
+		assert.Equal(t, "8081", servercfg.GetAPIPort())
+
+		assert.Nil(t, ioutil.WriteFile(file, []byte("server:\n  verbosity: 9\n"), 0600))
+		_, err = servercfg.Reload()
+		assert.NotNil(t, err)
+		assert.Equal(t, int64(30), servercfg.GetServerCheckinInterval())
+
+		var output bytes.Buffer
+		logger.SetOutput(&output)
+		defer logger.SetOutput(os.Stderr)
+		defer servercfg.SetLogLevels()
+		assert.Nil(t, ioutil.WriteFile(file, []byte("server:\n  loglevels: \"api=2\"\n"), 0600))
+		result, err = servercfg.Reload()
+		assert.Nil(t, err)
+		assert.Contains(t, result.Applied, "loglevels")
+		logger.New(logger.API).Log(logger.Debug, "shown after reload")
+		logger.New(logger.GRPC).Log(logger.Debug, "still hidden")
+		assert.Contains(t, output.String(), "shown after reload")
+		assert.NotContains(t, output.String(), "still hidden")
+	})
+}
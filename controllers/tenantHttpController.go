@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+)
+
+func tenantHandlers(r *mux.Router) {
+	r.HandleFunc("/api/tenants", securityCheck(true, http.HandlerFunc(getTenants))).Methods("GET")
+	r.HandleFunc("/api/tenants", securityCheckServer(true, http.HandlerFunc(createTenant))).Methods("POST")
+	r.HandleFunc("/api/tenants/{tenantname}", securityCheck(true, http.HandlerFunc(getTenant))).Methods("GET")
+	r.HandleFunc("/api/tenants/{tenantname}", securityCheckServer(true, http.HandlerFunc(updateTenant))).Methods("PUT")
+	r.HandleFunc("/api/tenants/{tenantname}", securityCheckServer(true, http.HandlerFunc(deleteTenant))).Methods("DELETE")
+	r.HandleFunc("/api/tenants/{tenantname}/networks/{netid}", securityCheckServer(true, http.HandlerFunc(addTenantNetwork))).Methods("PUT")
+	r.HandleFunc("/api/tenants/{tenantname}/networks/{netid}", securityCheckServer(true, http.HandlerFunc(removeTenantNetwork))).Methods("DELETE")
+	r.HandleFunc("/api/tenants/{tenantname}/users/{username}", securityCheckServer(true, http.HandlerFunc(addTenantUser))).Methods("PUT")
+	r.HandleFunc("/api/tenants/{tenantname}/users/{username}", securityCheckServer(true, http.HandlerFunc(removeTenantUser))).Methods("DELETE")
+}
+
+// gets all tenants, tenant admins only see their own tenant
+func getTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	tenants, err := logic.GetTenants()
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	if tenant := r.Header.Get("tenant"); tenant != "" {
+		var ownTenants = []models.Tenant{}
+		for _, t := range tenants {
+			if t.Name == tenant {
+				ownTenants = append(ownTenants, t)
+			}
+		}
+		tenants = ownTenants
+	}
+	apiLogger(r).Log(logger.Debug, "fetched tenants")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tenants)
+}
+
+func getTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	tenantname := params["tenantname"]
+	if tenant := r.Header.Get("tenant"); tenant != "" && tenant != tenantname {
+		returnErrorResponse(w, r, formatError(errors.New("you are unauthorized to access this endpoint"), "unauthorized"))
+		return
+	}
+	tenant, err := logic.GetTenant(tenantname)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	apiLogger(r).With("tenant", tenantname).Log(logger.Debug, "fetched tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+func createTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var tenant models.Tenant
+	if err := json.NewDecoder(r.Body).Decode(&tenant); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	tenant, err := logic.CreateTenant(tenant)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("tenant", tenant.Name).Log(logger.Verbose, "created tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+func updateTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	tenantname := params["tenantname"]
+	tenant, err := logic.GetTenant(tenantname)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	var tenantchange models.Tenant
+	if err = json.NewDecoder(r.Body).Decode(&tenantchange); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	tenant, err = logic.UpdateTenant(tenantchange, tenant)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("tenant", tenantname).Log(logger.Verbose, "updated tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tenant)
+}
+
+func deleteTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	tenantname := params["tenantname"]
+	if err := logic.DeleteTenant(tenantname); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("tenant", tenantname).Log(logger.Verbose, "deleted tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tenantname + " deleted.")
+}
+
+// moves a network into a tenant
+func addTenantNetwork(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if _, err := logic.GetTenant(params["tenantname"]); err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	if err := logic.SetNetworkTenant(params["netid"], params["tenantname"]); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("tenant", params["tenantname"]).With("network", params["netid"]).Log(logger.Verbose, "moved network to tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("success")
+}
+
+// returns a network of a tenant to the server
+func removeTenantNetwork(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	network, err := logic.GetParentNetwork(params["netid"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	if network.Tenant != params["tenantname"] {
+		returnErrorResponse(w, r, formatError(errors.New("network "+network.NetID+" does not belong to tenant "+params["tenantname"]), "badrequest"))
+		return
+	}
+	if err = logic.SetNetworkTenant(network.NetID, ""); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	apiLogger(r).With("tenant", params["tenantname"]).With("network", network.NetID).Log(logger.Verbose, "removed network from tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("success")
+}
+
+// moves a user into a tenant
+func addTenantUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	if err := logic.SetUserTenant(params["username"], params["tenantname"]); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("tenant", params["tenantname"]).With("target_user", params["username"]).Log(logger.Verbose, "moved user to tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("success")
+}
+
+// removes a user from a tenant, the user keeps their networks
+func removeTenantUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var params = mux.Vars(r)
+	user, err := logic.GetUser(params["username"])
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "notfound"))
+		return
+	}
+	if user.Tenant != params["tenantname"] {
+		returnErrorResponse(w, r, formatError(errors.New("user "+user.UserName+" does not belong to tenant "+params["tenantname"]), "badrequest"))
+		return
+	}
+	if user.IsAdmin {
+		// a tenant admin would become an admin of the whole server
+		returnErrorResponse(w, r, formatError(errors.New("can not remove admin "+user.UserName+" from its tenant"), "forbidden"))
+		return
+	}
+	if err = logic.SetUserTenant(user.UserName, ""); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	apiLogger(r).With("tenant", params["tenantname"]).With("target_user", user.UserName).Log(logger.Verbose, "removed user from tenant")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode("success")
+}
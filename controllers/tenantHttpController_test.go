@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logic"
+	"github.com/gravitl/netmaker/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenants(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllNetworks()
+	deleteAllUsers()
+	deleteAllTenants()
+	createNet()
+	t.Run("InvalidName", func(t *testing.T) {
+		_, err := logic.CreateTenant(models.Tenant{Name: "Bad Name"})
+		assert.NotNil(t, err)
+	})
+	t.Run("Create", func(t *testing.T) {
+		tenant, err := logic.CreateTenant(models.Tenant{Name: "acme", NetworkLimit: 1, NodeLimit: 1})
+		assert.Nil(t, err)
+		assert.Equal(t, "acme", tenant.Name)
+		_, err = logic.CreateTenant(models.Tenant{Name: "acme"})
+		assert.EqualError(t, err, "tenant acme exists")
+	})
+	t.Run("NetworkLimit", func(t *testing.T) {
+		var network = models.Network{NetID: "acmenet", AddressRange: "10.10.0.0/24", Tenant: "acme"}
+		assert.Nil(t, CreateNetwork(network))
+		network = models.Network{NetID: "acmenet2", AddressRange: "10.11.0.0/24", Tenant: "acme"}
+		assert.EqualError(t, CreateNetwork(network), "tenant acme has reached its limit of 1 networks")
+		assert.NotNil(t, logic.SetNetworkTenant("skynet", "acme"))
+	})
+	t.Run("NodeLimit", func(t *testing.T) {
+		var node = models.Node{PublicKey: "DM5qhLAE20PG9BbfBCger+Ac9D2NDOwCtY1rbYDLf34=", Name: "testnode", Endpoint: "10.0.0.1", MacAddress: "01:02:03:04:05:06", Password: "password"}
+		_, err := logic.CreateNode(node, "acmenet")
+		assert.Nil(t, err)
+		node.MacAddress = "01:02:03:04:05:07"
+		_, err = logic.CreateNode(node, "acmenet")
+		assert.EqualError(t, err, "tenant acme has reached its limit of 1 nodes")
+		// networks outside of a tenant are not limited
+		_, err = logic.CreateNode(node, "skynet")
+		assert.Nil(t, err)
+	})
+	t.Run("UserNetworks", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "acmeuser", Password: "password", Networks: []string{"skynet"}, Tenant: "acme"})
+		assert.EqualError(t, err, "network skynet does not belong to tenant acme")
+		_, err = logic.CreateUser(models.User{UserName: "acmeuser", Password: "password", Networks: []string{"acmenet"}, Tenant: "acme"})
+		assert.Nil(t, err)
+	})
+	t.Run("TenantAdmin", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "acmeadmin", Password: "password", IsAdmin: true, Tenant: "acme"})
+		assert.Nil(t, err)
+		hasAdmin, err := logic.HasAdmin()
+		assert.Nil(t, err)
+		assert.False(t, hasAdmin)
+		token, err := logic.CreateUserJWT("acmeadmin", nil, true)
+		assert.Nil(t, err)
+		err, networks, _ := SecurityCheck(true, "", "Bearer "+token)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"acmenet"}, networks)
+		err, _, _ = SecurityCheck(true, "acmenet", "Bearer "+token)
+		assert.Nil(t, err)
+		err, _, _ = SecurityCheck(false, "skynet", "Bearer "+token)
+		assert.NotNil(t, err)
+		tenant, err := validateUserToken("Bearer "+token, "acmeuser", true)
+		assert.Nil(t, err)
+		assert.Equal(t, "acme", tenant)
+		_, err = logic.CreateUser(models.User{UserName: "otheruser", Password: "password"})
+		assert.Nil(t, err)
+		assert.NotNil(t, ValidateUserToken("Bearer "+token, "otheruser", true))
+	})
+	t.Run("UpdateUserNetworks", func(t *testing.T) {
+		// a tenant admin granting a network of another tenant
+		user, err := logic.GetUser("acmeuser")
+		assert.Nil(t, err)
+		_, err = logic.UpdateUser(models.User{UserName: "acmeuser", Password: "password", Networks: []string{"skynet"}}, user)
+		assert.EqualError(t, err, "network skynet does not belong to tenant acme")
+		user, err = logic.GetUser("acmeuser")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"acmenet"}, user.Networks)
+	})
+	t.Run("GroupMappings", func(t *testing.T) {
+		// a mapping granting networks of several tenants
+		assert.Nil(t, logic.SetUserAccess("acmeuser", []string{"skynet", "acmenet"}, false))
+		user, err := logic.GetUser("acmeuser")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"acmenet"}, user.Networks)
+		assert.Nil(t, logic.SetUserAccess("acmeuser", []string{"skynet"}, false))
+		user, err = logic.GetUser("acmeuser")
+		assert.Nil(t, err)
+		assert.Empty(t, user.Networks)
+		assert.Nil(t, logic.SetUserAccess("acmeuser", []string{"acmenet"}, false))
+	})
+	t.Run("UpdateKeepsTenant", func(t *testing.T) {
+		network, err := logic.GetParentNetwork("acmenet")
+		assert.Nil(t, err)
+		var change = network
+		change.Tenant = ""
+		_, _, err = logic.UpdateNetwork(&network, &change)
+		assert.Nil(t, err)
+		network, err = logic.GetParentNetwork("acmenet")
+		assert.Nil(t, err)
+		assert.Equal(t, "acme", network.Tenant)
+	})
+	t.Run("DeleteWithNetworks", func(t *testing.T) {
+		err := logic.DeleteTenant("acme")
+		assert.EqualError(t, err, "tenant acme still owns networks acmenet")
+	})
+	t.Run("Delete", func(t *testing.T) {
+		assert.Nil(t, logic.SetNetworkTenant("acmenet", ""))
+		assert.Nil(t, logic.SetUserTenant("acmeuser", ""))
+		assert.EqualError(t, logic.DeleteTenant("acme"), "tenant acme still has users")
+		_, err := logic.DeleteUser("acmeadmin")
+		assert.Nil(t, err)
+		assert.Nil(t, logic.DeleteTenant("acme"))
+	})
+	deleteAllNetworks()
+	deleteAllUsers()
+}
+
+func deleteAllTenants() {
+	tenants, _ := logic.GetTenants()
+	for _, tenant := range tenants {
+		database.DeleteRecord(database.TENANTS_TABLE_NAME, tenant.Name)
+	}
+}
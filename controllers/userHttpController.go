@@ -10,9 +10,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/auth"
 	"github.com/gravitl/netmaker/database"
-	"github.com/gravitl/netmaker/functions"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
+	"github.com/skip2/go-qrcode"
 )
 
 func userHandlers(r *mux.Router) {
@@ -20,6 +21,13 @@ func userHandlers(r *mux.Router) {
 	r.HandleFunc("/api/users/adm/hasadmin", hasAdmin).Methods("GET")
 	r.HandleFunc("/api/users/adm/createadmin", createAdmin).Methods("POST")
 	r.HandleFunc("/api/users/adm/authenticate", authenticateUser).Methods("POST")
+	r.HandleFunc("/api/users/adm/authenticate/totp", authenticateUserTOTP).Methods("POST")
+	r.HandleFunc("/api/users/adm/authenticate/totp/enroll", enrollRequiredTOTP).Methods("POST")
+	r.HandleFunc("/api/users/{username}/totp", authorizeUserSelf(http.HandlerFunc(enrollTOTP))).Methods("POST")
+	r.HandleFunc("/api/users/{username}/totp/confirm", authorizeUserSelf(http.HandlerFunc(confirmTOTP))).Methods("POST")
+	r.HandleFunc("/api/users/{username}/totp/recoverycodes", authorizeUserSelf(http.HandlerFunc(regenerateRecoveryCodes))).Methods("POST")
+	r.HandleFunc("/api/users/{username}/totp", authorizeUserSelf(http.HandlerFunc(disableTOTP))).Methods("DELETE")
+	r.HandleFunc("/api/users/{username}/totp/reset", authorizeUserAdm(http.HandlerFunc(resetTOTP))).Methods("POST")
 	r.HandleFunc("/api/users/{username}", authorizeUser(http.HandlerFunc(updateUser))).Methods("PUT")
 	r.HandleFunc("/api/users/networks/{username}", authorizeUserAdm(http.HandlerFunc(updateUserNetworks))).Methods("PUT")
 	r.HandleFunc("/api/users/{username}/adm", authorizeUserAdm(http.HandlerFunc(updateUserAdm))).Methods("PUT")
@@ -62,6 +70,11 @@ func authenticateUser(response http.ResponseWriter, request *http.Request) {
 	}
 
 	username := authRequest.UserName
+	user, err := logic.GetUser(username)
+	if err != nil {
+		returnErrorResponse(response, request, formatError(err, "internal"))
+		return
+	}
 	var successResponse = models.SuccessResponse{
 		Code:    http.StatusOK,
 		Message: "W1R3: Device " + username + " Authorized",
@@ -70,6 +83,21 @@ func authenticateUser(response http.ResponseWriter, request *http.Request) {
 			UserName:  username,
 		},
 	}
+	// hold back the jwt until the second factor is provided
+	if totpEnabled := logic.IsTOTPEnabled(username); totpEnabled || logic.IsTOTPRequired(&user) {
+		totpToken, err := logic.CreateTOTPToken(username)
+		if err != nil {
+			returnErrorResponse(response, request, formatError(err, "internal"))
+			return
+		}
+		successResponse.Message = "W1R3: second factor required for " + username
+		successResponse.Response = models.SuccessfulUserLoginResponse{
+			UserName:           username,
+			TOTPRequired:       true,
+			TOTPEnrollRequired: !totpEnabled,
+			TOTPToken:          totpToken,
+		}
+	}
 	// Send back the JWT
 	successJSONResponse, jsonError := json.Marshal(successResponse)
 
@@ -77,11 +105,169 @@ func authenticateUser(response http.ResponseWriter, request *http.Request) {
 		returnErrorResponse(response, request, errorResponse)
 		return
 	}
-	functions.PrintUserLog(username, "was authenticated", 2)
+	apiLogger(request).With("user", username).Log(logger.Debug, "user was authenticated")
 	response.Header().Set("Content-Type", "application/json")
 	response.Write(successJSONResponse)
 }
 
+// authenticateUserTOTP - second login step, exchanges the TOTP token and a code for a JWT
+func authenticateUserTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var params models.TOTPAuthParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	username, err := logic.VerifyTOTPToken(params.TOTPToken)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	user, err := logic.GetUser(username)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	if logic.IsTOTPEnabled(username) {
+		err = logic.VerifyTOTP(username, params.Code)
+	} else if logic.IsTOTPRequired(&user) { // finishes the enrollment started at login
+		err = logic.ConfirmTOTP(username, params.Code)
+	} else {
+		err = errors.New("TOTP is not enabled for user " + username)
+	}
+	if err != nil {
+		apiLogger(r).With("user", username).With("error", err.Error()).Log(logger.Verbose, "user failed second factor")
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	jwt, err := logic.CreateUserJWT(user.UserName, user.Networks, user.IsAdmin)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	apiLogger(r).With("user", username).Log(logger.Debug, "user was authenticated with a second factor")
+	json.NewEncoder(w).Encode(models.SuccessResponse{
+		Code:    http.StatusOK,
+		Message: "W1R3: Device " + username + " Authorized",
+		Response: models.SuccessfulUserLoginResponse{
+			AuthToken: jwt,
+			UserName:  username,
+		},
+	})
+}
+
+// enrollRequiredTOTP - lets a user who must use a second factor enroll during login
+func enrollRequiredTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var params models.TOTPAuthParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	username, err := logic.VerifyTOTPToken(params.TOTPToken)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	user, err := logic.GetUser(username)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	if !logic.IsTOTPRequired(&user) {
+		returnErrorResponse(w, r, formatError(errors.New("enroll with an authenticated session instead"), "forbidden"))
+		return
+	}
+	writeTOTPEnrollment(w, r, username)
+}
+
+func enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeTOTPEnrollment(w, r, mux.Vars(r)["username"])
+}
+
+func writeTOTPEnrollment(w http.ResponseWriter, r *http.Request, username string) {
+	enrollment, err := logic.EnrollTOTP(username)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	if enrollment.QRCode, err = qrcode.Encode(enrollment.URL, qrcode.Medium, 220); err != nil {
+		returnErrorResponse(w, r, formatError(err, "internal"))
+		return
+	}
+	apiLogger(r).With("user", username).Log(logger.Verbose, "user started TOTP enrollment")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+func confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var username = mux.Vars(r)["username"]
+	var params models.TOTPAuthParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	if err := logic.ConfirmTOTP(username, params.Code); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("user", username).Log(logger.Verbose, "user enabled TOTP")
+	json.NewEncoder(w).Encode(username + " TOTP enabled.")
+}
+
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var username = mux.Vars(r)["username"]
+	codes, err := logic.RegenerateRecoveryCodes(username)
+	if err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "regenerated TOTP recovery codes")
+	json.NewEncoder(w).Encode(codes)
+}
+
+// disableTOTP - removes the second factor of a user, who has to prove they still own it
+func disableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var username = mux.Vars(r)["username"]
+	var params models.TOTPAuthParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	if err := logic.VerifyTOTP(username, params.Code); err != nil {
+		returnErrorResponse(w, r, formatError(err, "unauthorized"))
+		return
+	}
+	if err := logic.DisableTOTP(username); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "disabled TOTP")
+	json.NewEncoder(w).Encode(username + " TOTP disabled.")
+}
+
+// resetTOTP - lets an admin remove the second factor of a user who lost it
+func resetTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var username = mux.Vars(r)["username"]
+	var admin = getTokenUserName(r.Header.Get("Authorization"))
+	if admin == username {
+		returnErrorResponse(w, r, formatError(errors.New("admins can not reset their own TOTP, disable it with a code instead"), "badrequest"))
+		return
+	}
+	if err := logic.DisableTOTP(username); err != nil {
+		returnErrorResponse(w, r, formatError(err, "badrequest"))
+		return
+	}
+	apiLogger(r).With("admin", admin).With("target_user", username).Log(logger.Info, "admin reset TOTP")
+	json.NewEncoder(w).Encode(username + " TOTP reset.")
+}
+
 // The middleware for most requests to the API
 // They all pass  through here first
 // This will validate the JWT (or check for master token)
@@ -97,12 +283,13 @@ func authorizeUser(next http.Handler) http.HandlerFunc {
 		// get the auth token
 		bearerToken := r.Header.Get("Authorization")
 		username := params["username"]
-		err := ValidateUserToken(bearerToken, username, false)
+		tenant, err := validateUserToken(bearerToken, username, false)
 		if err != nil {
 			returnErrorResponse(w, r, formatError(err, "unauthorized"))
 			return
 		}
 		r.Header.Set("user", username)
+		r.Header.Set("tenant", tenant)
 		next.ServeHTTP(w, r)
 	}
 }
@@ -113,20 +300,63 @@ func authorizeUserAdm(next http.Handler) http.HandlerFunc {
 		var params = mux.Vars(r)
 
 		//get the auth token
+		clientCertificateAuth(r)
 		bearerToken := r.Header.Get("Authorization")
 		username := params["username"]
-		err := ValidateUserToken(bearerToken, username, true)
+		tenant, err := validateUserToken(bearerToken, username, true)
 		if err != nil {
 			returnErrorResponse(w, r, formatError(err, "unauthorized"))
 			return
 		}
 		r.Header.Set("user", username)
+		r.Header.Set("tenant", tenant)
 		next.ServeHTTP(w, r)
 	}
 }
 
+// authorizeUserSelf - only lets users act on their own account, admins included
+func authorizeUserSelf(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var params = mux.Vars(r)
+
+		bearerToken := r.Header.Get("Authorization")
+		username := params["username"]
+		tenant, err := validateUserToken(bearerToken, username, false)
+		if err == nil && getTokenUserName(bearerToken) != username {
+			err = errors.New("You are unauthorized to access this endpoint.")
+		}
+		if err != nil {
+			returnErrorResponse(w, r, formatError(err, "unauthorized"))
+			return
+		}
+		r.Header.Set("user", username)
+		r.Header.Set("tenant", tenant)
+		next.ServeHTTP(w, r)
+	}
+}
+
+// getTokenUserName - gets the name of the user a bearer token was issued to, empty if the token is invalid
+func getTokenUserName(token string) string {
+	var tokenSplit = strings.Split(token, " ")
+	if len(tokenSplit) < 2 {
+		return ""
+	}
+	username, _, _, err := logic.VerifyUserToken(tokenSplit[1])
+	if err != nil {
+		return ""
+	}
+	return username
+}
+
 // ValidateUserToken - self explained
 func ValidateUserToken(token string, user string, adminonly bool) error {
+	_, err := validateUserToken(token, user, adminonly)
+	return err
+}
+
+// validateUserToken - validates a user token and returns the tenant of the caller
+func validateUserToken(token string, user string, adminonly bool) (string, error) {
 	var tokenSplit = strings.Split(token, " ")
 	//I put this in in case the user doesn't put in a token at all (in which case it's empty)
 	//There's probably a smarter way of handling this.
@@ -135,12 +365,12 @@ func ValidateUserToken(token string, user string, adminonly bool) error {
 	if len(tokenSplit) > 1 {
 		authToken = tokenSplit[1]
 	} else {
-		return errors.New("Missing Auth Token.")
+		return "", errors.New("Missing Auth Token.")
 	}
 
 	username, _, isadmin, err := logic.VerifyUserToken(authToken)
 	if err != nil {
-		return errors.New("Error Verifying Auth Token")
+		return "", errors.New("Error Verifying Auth Token")
 	}
 	isAuthorized := false
 	if adminonly {
@@ -148,11 +378,18 @@ func ValidateUserToken(token string, user string, adminonly bool) error {
 	} else {
 		isAuthorized = username == user || isadmin
 	}
+	var tenant = logic.GetUserTenant(username)
+	if isAuthorized && isadmin && tenant != "" && user != "" && user != username {
+		// tenant admins can only manage the users of their tenant
+		if target, err := logic.GetUser(user); err == nil && target.Tenant != tenant {
+			isAuthorized = false
+		}
+	}
 	if !isAuthorized {
-		return errors.New("You are unauthorized to access this endpoint.")
+		return "", errors.New("You are unauthorized to access this endpoint.")
 	}
 
-	return nil
+	return tenant, nil
 }
 
 func hasAdmin(w http.ResponseWriter, r *http.Request) {
@@ -196,7 +433,7 @@ func getUser(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
-	functions.PrintUserLog(r.Header.Get("user"), "fetched user "+usernameFetched, 2)
+	apiLogger(r).With("target_user", usernameFetched).Log(logger.Debug, "fetched user")
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -211,8 +448,17 @@ func getUsers(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "internal"))
 		return
 	}
+	if tenant := r.Header.Get("tenant"); tenant != "" {
+		var tenantUsers = []models.ReturnUser{}
+		for _, user := range users {
+			if user.Tenant == tenant {
+				tenantUsers = append(tenantUsers, user)
+			}
+		}
+		users = tenantUsers
+	}
 
-	functions.PrintUserLog(r.Header.Get("user"), "fetched users", 2)
+	apiLogger(r).Log(logger.Debug, "fetched users")
 	json.NewEncoder(w).Encode(users)
 }
 
@@ -229,7 +475,7 @@ func createAdmin(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(admin.UserName, "was made a new admin", 1)
+	apiLogger(r).With("target_user", admin.UserName).Log(logger.Verbose, "created admin")
 	json.NewEncoder(w).Encode(admin)
 }
 
@@ -239,6 +485,10 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	// get node from body of request
 	_ = json.NewDecoder(r.Body).Decode(&user)
+	// users created by tenant admins always belong to their tenant
+	if tenant := r.Header.Get("tenant"); tenant != "" {
+		user.Tenant = tenant
+	}
 
 	user, err := logic.CreateUser(user)
 
@@ -246,7 +496,7 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(user.UserName, "was created", 1)
+	apiLogger(r).With("target_user", user.UserName).Log(logger.Verbose, "created user")
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -274,7 +524,7 @@ func updateUserNetworks(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(username, "status was updated", 1)
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "updated user networks")
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -306,7 +556,7 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(username, "was updated", 1)
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "updated user")
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -337,7 +587,7 @@ func updateUserAdm(w http.ResponseWriter, r *http.Request) {
 		returnErrorResponse(w, r, formatError(err, "badrequest"))
 		return
 	}
-	functions.PrintUserLog(username, "was updated (admin)", 1)
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "updated user as admin")
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -359,6 +609,6 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	functions.PrintUserLog(username, "was deleted", 1)
+	apiLogger(r).With("target_user", username).Log(logger.Verbose, "deleted user")
 	json.NewEncoder(w).Encode(params["username"] + " deleted.")
 }
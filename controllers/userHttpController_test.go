@@ -1,8 +1,17 @@
 package controller
 
 import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gorilla/mux"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
@@ -31,7 +40,7 @@ func TestHasAdmin(t *testing.T) {
 		assert.False(t, found)
 	})
 	t.Run("No admin user", func(t *testing.T) {
-		var user = models.User{"noadmin", "password", nil, false}
+		var user = models.User{UserName: "noadmin", Password: "password", Networks: nil, IsAdmin: false}
 		_, err := logic.CreateUser(user)
 		assert.Nil(t, err)
 		found, err := logic.HasAdmin()
@@ -39,7 +48,7 @@ func TestHasAdmin(t *testing.T) {
 		assert.False(t, found)
 	})
 	t.Run("admin user", func(t *testing.T) {
-		var user = models.User{"admin", "password", nil, true}
+		var user = models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 		_, err := logic.CreateUser(user)
 		assert.Nil(t, err)
 		found, err := logic.HasAdmin()
@@ -47,7 +56,7 @@ func TestHasAdmin(t *testing.T) {
 		assert.True(t, found)
 	})
 	t.Run("multiple admins", func(t *testing.T) {
-		var user = models.User{"admin1", "password", nil, true}
+		var user = models.User{UserName: "admin1", Password: "password", Networks: nil, IsAdmin: true}
 		_, err := logic.CreateUser(user)
 		assert.Nil(t, err)
 		found, err := logic.HasAdmin()
@@ -59,7 +68,7 @@ func TestHasAdmin(t *testing.T) {
 func TestCreateUser(t *testing.T) {
 	database.InitializeDatabase()
 	deleteAllUsers()
-	user := models.User{"admin", "password", nil, true}
+	user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 	t.Run("NoUser", func(t *testing.T) {
 		admin, err := logic.CreateUser(user)
 		assert.Nil(t, err)
@@ -101,7 +110,7 @@ func TestDeleteUser(t *testing.T) {
 		assert.False(t, deleted)
 	})
 	t.Run("Existing User", func(t *testing.T) {
-		user := models.User{"admin", "password", nil, true}
+		user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 		logic.CreateUser(user)
 		deleted, err := logic.DeleteUser("admin")
 		assert.Nil(t, err)
@@ -166,7 +175,7 @@ func TestGetUser(t *testing.T) {
 		assert.Equal(t, "", admin.UserName)
 	})
 	t.Run("UserExisits", func(t *testing.T) {
-		user := models.User{"admin", "password", nil, true}
+		user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 		logic.CreateUser(user)
 		admin, err := logic.GetUser("admin")
 		assert.Nil(t, err)
@@ -183,7 +192,7 @@ func TestGetUserInternal(t *testing.T) {
 		assert.Equal(t, "", admin.UserName)
 	})
 	t.Run("UserExisits", func(t *testing.T) {
-		user := models.User{"admin", "password", nil, true}
+		user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 		logic.CreateUser(user)
 		admin, err := GetUserInternal("admin")
 		assert.Nil(t, err)
@@ -200,14 +209,14 @@ func TestGetUsers(t *testing.T) {
 		assert.Equal(t, []models.ReturnUser(nil), admin)
 	})
 	t.Run("UserExisits", func(t *testing.T) {
-		user := models.User{"admin", "password", nil, true}
+		user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
 		logic.CreateUser(user)
 		admins, err := logic.GetUsers()
 		assert.Nil(t, err)
 		assert.Equal(t, user.UserName, admins[0].UserName)
 	})
 	t.Run("MulipleUsers", func(t *testing.T) {
-		user := models.User{"user", "password", nil, true}
+		user := models.User{UserName: "user", Password: "password", Networks: nil, IsAdmin: true}
 		logic.CreateUser(user)
 		admins, err := logic.GetUsers()
 		assert.Nil(t, err)
@@ -225,8 +234,8 @@ func TestGetUsers(t *testing.T) {
 func TestUpdateUser(t *testing.T) {
 	database.InitializeDatabase()
 	deleteAllUsers()
-	user := models.User{"admin", "password", nil, true}
-	newuser := models.User{"hello", "world", []string{"wirecat, netmaker"}, true}
+	user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: true}
+	newuser := models.User{UserName: "hello", Password: "world", Networks: []string{"wirecat, netmaker"}, IsAdmin: true}
 	t.Run("NonExistantUser", func(t *testing.T) {
 		admin, err := logic.UpdateUser(newuser, user)
 		assert.EqualError(t, err, "could not find any records")
@@ -291,7 +300,7 @@ func TestVerifyAuthRequest(t *testing.T) {
 		assert.EqualError(t, err, "incorrect credentials")
 	})
 	t.Run("Non-Admin", func(t *testing.T) {
-		user := models.User{"nonadmin", "somepass", nil, false}
+		user := models.User{UserName: "nonadmin", Password: "somepass", Networks: nil, IsAdmin: false}
 		logic.CreateUser(user)
 		authRequest := models.UserAuthParams{"nonadmin", "somepass"}
 		jwt, err := logic.VerifyAuthRequest(authRequest)
@@ -299,7 +308,7 @@ func TestVerifyAuthRequest(t *testing.T) {
 		assert.Nil(t, err)
 	})
 	t.Run("WrongPassword", func(t *testing.T) {
-		user := models.User{"admin", "password", nil, false}
+		user := models.User{UserName: "admin", Password: "password", Networks: nil, IsAdmin: false}
 		logic.CreateUser(user)
 		authRequest := models.UserAuthParams{"admin", "badpass"}
 		jwt, err := logic.VerifyAuthRequest(authRequest)
@@ -313,3 +322,237 @@ func TestVerifyAuthRequest(t *testing.T) {
 		assert.NotNil(t, jwt)
 	})
 }
+
+// fakeLDAP - an in-process stand-in for an LDAP server holding uid based user entries
+type fakeLDAP struct {
+	passwords map[string]string   // dn -> password
+	groups    map[string][]string // dn -> memberOf
+}
+
+func (l *fakeLDAP) StartTLS(config *tls.Config) error { return nil }
+
+func (l *fakeLDAP) Bind(username, password string) error {
+	if pass, ok := l.passwords[username]; ok && pass == password && password != "" {
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (l *fakeLDAP) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	var result = &ldap.SearchResult{}
+	for dn := range l.passwords {
+		if strings.HasPrefix(dn, "uid=") && request.Filter == "(uid="+strings.TrimPrefix(strings.Split(dn, ",")[0], "uid=")+")" {
+			result.Entries = append(result.Entries, ldap.NewEntry(dn, map[string][]string{"memberOf": l.groups[dn]}))
+		}
+	}
+	return result, nil
+}
+
+func (l *fakeLDAP) Close() {}
+
+func TestVerifyAuthRequestLDAP(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllUsers()
+	var directory = &fakeLDAP{
+		passwords: map[string]string{
+			"cn=netmaker,dc=example,dc=com":         "servicepass",
+			"uid=alice,ou=people,dc=example,dc=com": "alicepass",
+			"uid=bob,ou=people,dc=example,dc=com":   "bobpass",
+		},
+		groups: map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {"cn=netadmins,ou=groups,dc=example,dc=com"},
+			"uid=bob,ou=people,dc=example,dc=com":   {"cn=devs,ou=groups,dc=example,dc=com"},
+		},
+	}
+	logic.LDAPDialer = func(serverURL string) (logic.LDAPConn, error) { return directory, nil }
+	os.Setenv("LDAP_URL", "ldap://ldap.example.com")
+	os.Setenv("LDAP_BIND_DN", "cn=netmaker,dc=example,dc=com")
+	os.Setenv("LDAP_BIND_PASSWORD", "servicepass")
+	os.Setenv("LDAP_BASE_DN", "dc=example,dc=com")
+	// logins must not touch the dns config of the tree
+	os.Setenv("DNS_MODE", "off")
+	defer func() {
+		os.Unsetenv("DNS_MODE")
+		os.Unsetenv("LDAP_URL")
+		os.Unsetenv("LDAP_BIND_DN")
+		os.Unsetenv("LDAP_BIND_PASSWORD")
+		os.Unsetenv("LDAP_BASE_DN")
+		deleteAllUsers()
+	}()
+	t.Run("WrongPassword", func(t *testing.T) {
+		jwt, err := logic.VerifyAuthRequest(models.UserAuthParams{UserName: "alice", Password: "badpass"})
+		assert.Equal(t, "", jwt)
+		assert.EqualError(t, err, "incorrect credentials")
+		_, err = logic.GetUser("alice")
+		assert.NotNil(t, err)
+	})
+	t.Run("UnknownUser", func(t *testing.T) {
+		jwt, err := logic.VerifyAuthRequest(models.UserAuthParams{UserName: "carol", Password: "carolpass"})
+		assert.Equal(t, "", jwt)
+		assert.EqualError(t, err, "incorrect credentials")
+	})
+	t.Run("JustInTimeUser", func(t *testing.T) {
+		jwt, err := logic.VerifyAuthRequest(models.UserAuthParams{UserName: "alice", Password: "alicepass"})
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", jwt)
+		user, err := logic.GetUser("alice")
+		assert.Nil(t, err)
+		assert.True(t, logic.IsLDAPUser(&user))
+		assert.True(t, user.IsAdmin) // first user becomes admin
+	})
+	t.Run("GroupMappings", func(t *testing.T) {
+		os.Setenv("GROUP_MAPPINGS", `[{"group": "netadmins", "admin": true}, {"group": "devs", "networks": ["skynet"]}]`)
+		defer os.Unsetenv("GROUP_MAPPINGS")
+		_, err := logic.VerifyAuthRequest(models.UserAuthParams{UserName: "bob", Password: "bobpass"})
+		assert.Nil(t, err)
+		user, err := logic.GetUser("bob")
+		assert.Nil(t, err)
+		assert.False(t, user.IsAdmin)
+		assert.Equal(t, []string{"skynet"}, user.Networks)
+		// revoked in the directory, revoked on the next login
+		directory.groups["uid=bob,ou=people,dc=example,dc=com"] = nil
+		_, err = logic.VerifyAuthRequest(models.UserAuthParams{UserName: "bob", Password: "bobpass"})
+		assert.Nil(t, err)
+		user, err = logic.GetUser("bob")
+		assert.Nil(t, err)
+		assert.Empty(t, user.Networks)
+	})
+	t.Run("LocalUser", func(t *testing.T) {
+		_, err := logic.CreateUser(models.User{UserName: "local", Password: "localpass"})
+		assert.Nil(t, err)
+		jwt, err := logic.VerifyAuthRequest(models.UserAuthParams{UserName: "local", Password: "localpass"})
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", jwt)
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	database.InitializeDatabase()
+	deleteAllUsers()
+	_, err := logic.CreateAdmin(models.User{UserName: "admin", Password: "password"})
+	assert.Nil(t, err)
+	var enrollment models.TOTPEnrollment
+	t.Run("RFC6238", func(t *testing.T) {
+		code, err := logic.GenerateTOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(59, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, "287082", code)
+		code, err = logic.GenerateTOTPCode("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", time.Unix(1111111109, 0))
+		assert.Nil(t, err)
+		assert.Equal(t, "081804", code)
+	})
+	t.Run("NotEnabled", func(t *testing.T) {
+		assert.False(t, logic.IsTOTPEnabled("admin"))
+		err := logic.VerifyTOTP("admin", "123456")
+		assert.EqualError(t, err, "TOTP is not enabled for user admin")
+	})
+	t.Run("Enroll", func(t *testing.T) {
+		enrollment, err = logic.EnrollTOTP("admin")
+		assert.Nil(t, err)
+		assert.NotEmpty(t, enrollment.Secret)
+		assert.Contains(t, enrollment.URL, "otpauth://totp/")
+		assert.Len(t, enrollment.RecoveryCodes, 10)
+		assert.False(t, logic.IsTOTPEnabled("admin"))
+	})
+	t.Run("ConfirmWrongCode", func(t *testing.T) {
+		err := logic.ConfirmTOTP("admin", "000000")
+		assert.EqualError(t, err, "invalid TOTP code")
+		assert.False(t, logic.IsTOTPEnabled("admin"))
+	})
+	t.Run("Confirm", func(t *testing.T) {
+		code, err := logic.GenerateTOTPCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+		assert.Nil(t, err)
+		err = logic.ConfirmTOTP("admin", code)
+		assert.Nil(t, err)
+		assert.True(t, logic.IsTOTPEnabled("admin"))
+	})
+	t.Run("Verify", func(t *testing.T) {
+		code, err := logic.GenerateTOTPCode(enrollment.Secret, time.Now())
+		assert.Nil(t, err)
+		err = logic.VerifyTOTP("admin", code)
+		assert.Nil(t, err)
+		// a code can not be replayed
+		err = logic.VerifyTOTP("admin", code)
+		assert.EqualError(t, err, "invalid TOTP code")
+	})
+	t.Run("RecoveryCode", func(t *testing.T) {
+		err := logic.VerifyTOTP("admin", enrollment.RecoveryCodes[0])
+		assert.Nil(t, err)
+		err = logic.VerifyTOTP("admin", enrollment.RecoveryCodes[0])
+		assert.EqualError(t, err, "invalid TOTP code")
+	})
+	t.Run("Token", func(t *testing.T) {
+		token, err := logic.CreateTOTPToken("admin")
+		assert.Nil(t, err)
+		username, err := logic.VerifyTOTPToken(token)
+		assert.Nil(t, err)
+		assert.Equal(t, "admin", username)
+		// the token between both steps is not a user token
+		_, _, _, err = logic.VerifyUserToken(token)
+		assert.NotNil(t, err)
+		userToken, _ := logic.CreateUserJWT("admin", nil, true)
+		_, err = logic.VerifyTOTPToken(userToken)
+		assert.NotNil(t, err)
+	})
+	t.Run("Required", func(t *testing.T) {
+		user, _ := logic.GetUser("admin")
+		assert.False(t, logic.IsTOTPRequired(&user))
+		os.Setenv("TOTP_REQUIRED_FOR_ADMINS", "on")
+		defer os.Unsetenv("TOTP_REQUIRED_FOR_ADMINS")
+		assert.True(t, logic.IsTOTPRequired(&user))
+	})
+	t.Run("Lockout", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			logic.VerifyTOTP("admin", "000000")
+		}
+		code, _ := logic.GenerateTOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+		err := logic.VerifyTOTP("admin", code)
+		assert.EqualError(t, err, "too many failed attempts, try again later")
+	})
+	var router = mux.NewRouter()
+	userHandlers(router)
+	var request = func(method, path, token, body string) int {
+		var recorder = httptest.NewRecorder()
+		var req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	_, err = logic.CreateUser(models.User{UserName: "bob", Password: "bobpassword"})
+	assert.Nil(t, err)
+	adminToken, _ := logic.CreateUserJWT("admin", nil, true)
+	bobToken, _ := logic.CreateUserJWT("bob", nil, false)
+	var enrollBob = func(t *testing.T) models.TOTPEnrollment {
+		enrollment, err := logic.EnrollTOTP("bob")
+		assert.Nil(t, err)
+		code, _ := logic.GenerateTOTPCode(enrollment.Secret, time.Now().Add(-30*time.Second))
+		assert.Nil(t, logic.ConfirmTOTP("bob", code))
+		return enrollment
+	}
+	t.Run("OwnerOnly", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request("POST", "/api/users/bob/totp", adminToken, ""))
+		assert.Equal(t, http.StatusOK, request("POST", "/api/users/bob/totp", bobToken, ""))
+		assert.Equal(t, http.StatusUnauthorized, request("POST", "/api/users/bob/totp/confirm", adminToken, `{"code": "000000"}`))
+	})
+	t.Run("DisableRequiresCode", func(t *testing.T) {
+		bobEnrollment := enrollBob(t)
+		assert.Equal(t, http.StatusUnauthorized, request("DELETE", "/api/users/bob/totp", bobToken, `{}`))
+		assert.Equal(t, http.StatusUnauthorized, request("DELETE", "/api/users/bob/totp", adminToken, `{"code": "`+bobEnrollment.RecoveryCodes[0]+`"}`))
+		assert.True(t, logic.IsTOTPEnabled("bob"))
+		assert.Equal(t, http.StatusOK, request("DELETE", "/api/users/bob/totp", bobToken, `{"code": "`+bobEnrollment.RecoveryCodes[0]+`"}`))
+		assert.False(t, logic.IsTOTPEnabled("bob"))
+	})
+	t.Run("AdminReset", func(t *testing.T) {
+		enrollBob(t)
+		assert.Equal(t, http.StatusUnauthorized, request("POST", "/api/users/bob/totp/reset", bobToken, ""))
+		assert.True(t, logic.IsTOTPEnabled("bob"))
+		assert.Equal(t, http.StatusOK, request("POST", "/api/users/bob/totp/reset", adminToken, ""))
+		assert.False(t, logic.IsTOTPEnabled("bob"))
+		assert.Equal(t, http.StatusBadRequest, request("POST", "/api/users/admin/totp/reset", adminToken, ""))
+		assert.True(t, logic.IsTOTPEnabled("admin"))
+	})
+	t.Run("Disable", func(t *testing.T) {
+		err := logic.DisableTOTP("admin")
+		assert.Nil(t, err)
+		assert.False(t, logic.IsTOTPEnabled("admin"))
+	})
+}
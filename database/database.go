@@ -42,6 +42,27 @@ const DATABASE_FILENAME = "netmaker.db"
 // GENERATED_TABLE_NAME - stores server generated k/v
 const GENERATED_TABLE_NAME = "generated"
 
+// USER_TOTP_TABLE_NAME - stores the second factor of users
+const USER_TOTP_TABLE_NAME = "usertotp"
+
+// SSO_STATE_TABLE_NAME - stores pending OAuth logins
+const SSO_STATE_TABLE_NAME = "ssostate"
+
+// TENANTS_TABLE_NAME - tenants table
+const TENANTS_TABLE_NAME = "tenants"
+
+// NODE_CHALLENGES_TABLE_NAME - stores the pending login challenges of nodes
+const NODE_CHALLENGES_TABLE_NAME = "nodechallenges"
+
+// HOSTS_TABLE_NAME - hosts table, groups the nodes of a machine across networks
+const HOSTS_TABLE_NAME = "hosts"
+
+// CERTIFICATES_TABLE_NAME - stores the client certificates issued to nodes, by serial
+const CERTIFICATES_TABLE_NAME = "certificates"
+
+// JOBS_TABLE_NAME - stores the run history of scheduled jobs and the lease of the server running leader only jobs
+const JOBS_TABLE_NAME = "jobs"
+
 // == ERROR CONSTS ==
 
 // NO_RECORD - no singular result found
@@ -61,6 +82,9 @@ const CREATE_TABLE = "createtable"
 // INSERT - insert into db const
 const INSERT = "insert"
 
+// INSERT_IF - conditional insert into db const
+const INSERT_IF = "insertif"
+
 // INSERT_PEER - insert peer into db const
 const INSERT_PEER = "insertpeer"
 
@@ -118,6 +142,13 @@ func createTables() {
 	createTable(PEERS_TABLE_NAME)
 	createTable(SERVERCONF_TABLE_NAME)
 	createTable(GENERATED_TABLE_NAME)
+	createTable(USER_TOTP_TABLE_NAME)
+	createTable(SSO_STATE_TABLE_NAME)
+	createTable(TENANTS_TABLE_NAME)
+	createTable(NODE_CHALLENGES_TABLE_NAME)
+	createTable(HOSTS_TABLE_NAME)
+	createTable(CERTIFICATES_TABLE_NAME)
+	createTable(JOBS_TABLE_NAME)
 }
 
 func createTable(tableName string) error {
@@ -139,6 +170,16 @@ func Insert(key string, value string, tableName string) error {
 	}
 }
 
+// InsertIf - writes an object only if its record still holds previous, an empty previous only creates the record
+// returns false without an error if the record was changed by someone else, for records written by several servers
+func InsertIf(key string, value string, previous string, tableName string) (bool, error) {
+	if key != "" && value != "" && IsJSONString(value) {
+		return getCurrentDB()[INSERT_IF].(func(string, string, string, string) (bool, error))(key, value, previous, tableName)
+	} else {
+		return false, errors.New("invalid insert " + key + " : " + value)
+	}
+}
+
 // InsertPeer - inserts peer into db
 func InsertPeer(key string, value string) error {
 	if key != "" && value != "" && IsJSONString(value) {
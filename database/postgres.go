@@ -16,6 +16,7 @@ var PG_FUNCTIONS = map[string]interface{}{
 	INIT_DB:      initPGDB,
 	CREATE_TABLE: pgCreateTable,
 	INSERT:       pgInsert,
+	INSERT_IF:    pgInsertIf,
 	INSERT_PEER:  pgInsertPeer,
 	DELETE:       pgDeleteRecord,
 	DELETE_ALL:   pgDeleteAllRecords,
@@ -72,6 +73,21 @@ func pgInsert(key string, value string, tableName string) error {
 	}
 }
 
+func pgInsertIf(key string, value string, previous string, tableName string) (bool, error) {
+	var result sql.Result
+	var err error
+	if previous == "" {
+		result, err = PGDB.Exec("INSERT INTO "+tableName+" (key, value) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING;", key, value)
+	} else {
+		result, err = PGDB.Exec("UPDATE "+tableName+" SET value = $1 WHERE key = $2 AND value = $3;", value, key, previous)
+	}
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
 func pgInsertPeer(key string, value string) error {
 	if key != "" && value != "" && IsJSONString(value) {
 		err := pgInsert(key, value, PEERS_TABLE_NAME)
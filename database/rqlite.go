@@ -15,6 +15,7 @@ var RQLITE_FUNCTIONS = map[string]interface{}{
 	INIT_DB:      initRqliteDatabase,
 	CREATE_TABLE: rqliteCreateTable,
 	INSERT:       rqliteInsert,
+	INSERT_IF:    rqliteInsertIf,
 	INSERT_PEER:  rqliteInsertPeer,
 	DELETE:       rqliteDeleteRecord,
 	DELETE_ALL:   rqliteDeleteAllRecords,
@@ -52,6 +53,20 @@ func rqliteInsert(key string, value string, tableName string) error {
 	return errors.New("invalid insert " + key + " : " + value)
 }
 
+func rqliteInsertIf(key string, value string, previous string, tableName string) (bool, error) {
+	var statement string
+	if previous == "" {
+		statement = "INSERT OR IGNORE INTO " + tableName + " (key, value) VALUES ('" + key + "', '" + value + "')"
+	} else {
+		statement = "UPDATE " + tableName + " SET value = '" + value + "' WHERE key = '" + key + "' AND value = '" + previous + "'"
+	}
+	result, err := RQliteDatabase.WriteOne(statement)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func rqliteInsertPeer(key string, value string) error {
 	if key != "" && value != "" && IsJSONString(value) {
 		_, err := RQliteDatabase.WriteOne("INSERT OR REPLACE INTO " + PEERS_TABLE_NAME + " (key, value) VALUES ('" + key + "', '" + value + "')")
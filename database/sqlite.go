@@ -20,6 +20,7 @@ var SQLITE_FUNCTIONS = map[string]interface{}{
 	INIT_DB:      initSqliteDB,
 	CREATE_TABLE: sqliteCreateTable,
 	INSERT:       sqliteInsert,
+	INSERT_IF:    sqliteInsertIf,
 	INSERT_PEER:  sqliteInsertPeer,
 	DELETE:       sqliteDeleteRecord,
 	DELETE_ALL:   sqliteDeleteAllRecords,
@@ -73,6 +74,21 @@ func sqliteInsert(key string, value string, tableName string) error {
 	return errors.New("invalid insert " + key + " : " + value)
 }
 
+func sqliteInsertIf(key string, value string, previous string, tableName string) (bool, error) {
+	var result sql.Result
+	var err error
+	if previous == "" {
+		result, err = SqliteDB.Exec("INSERT OR IGNORE INTO "+tableName+" (key, value) VALUES (?, ?)", key, value)
+	} else {
+		result, err = SqliteDB.Exec("UPDATE "+tableName+" SET value = ? WHERE key = ? AND value = ?", value, key, previous)
+	}
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
 func sqliteInsertPeer(key string, value string) error {
 	if key != "" && value != "" && IsJSONString(value) {
 		err := sqliteInsert(key, value, PEERS_TABLE_NAME)
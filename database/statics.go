@@ -57,3 +57,9 @@ func IsEmptyRecord(err error) bool {
 	}
 	return strings.Contains(err.Error(), NO_RECORD) || strings.Contains(err.Error(), NO_RECORDS)
 }
+
+// IsReadable - checks if the database answers reads, used to report readiness
+func IsReadable() bool {
+	_, err := FetchRecords(SERVERCONF_TABLE_NAME)
+	return err == nil || IsEmptyRecord(err)
+}
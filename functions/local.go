@@ -3,6 +3,7 @@ package functions
 import (
 	"os"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 )
 
@@ -25,21 +26,21 @@ func SetDNSDir() error {
 	if os.IsNotExist(err) {
 		os.Mkdir(dir+"/config/dnsconfig", 0744)
 	} else if err != nil {
-		PrintUserLog("", "couldnt find or create /config/dnsconfig", 0)
+		logger.New(logger.SERVER).Error("could not find or create /config/dnsconfig", err)
 		return err
 	}
 	_, err = os.Stat(dir + "/config/dnsconfig/Corefile")
 	if os.IsNotExist(err) {
 		err = logic.SetCorefile(".")
 		if err != nil {
-			PrintUserLog("", err.Error(), 0)
+			logger.New(logger.SERVER).Error("could not set the Corefile", err)
 		}
 	}
 	_, err = os.Stat(dir + "/config/dnsconfig/netmaker.hosts")
 	if os.IsNotExist(err) {
 		_, err = os.Create(dir + "/config/dnsconfig/netmaker.hosts")
 		if err != nil {
-			PrintUserLog("", err.Error(), 0)
+			logger.New(logger.SERVER).Error("could not create netmaker.hosts", err)
 		}
 	}
 	return nil
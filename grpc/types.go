@@ -4,3 +4,4 @@ const STRING_TYPE = "string"
 const NODE_TYPE = "node"
 const EXT_PEER = "extpeer"
 const ACCESS_TOKEN = "accesstoken"
+const NODE_CHALLENGE = "nodechallenge"
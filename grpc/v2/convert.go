@@ -0,0 +1,231 @@
+package nodepbv2
+
+import (
+	"github.com/gravitl/netmaker/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewNode - converts a node model to its message, "yes"/"no" flags become set booleans
+func NewNode(node *models.Node) *Node {
+	return &Node{
+		Id:                  node.ID,
+		Network:             node.Network,
+		Name:                node.Name,
+		Address:             node.Address,
+		Address6:            node.Address6,
+		LocalAddress:        node.LocalAddress,
+		ListenPort:          node.ListenPort,
+		PublicKey:           node.PublicKey,
+		Endpoint:            node.Endpoint,
+		PostUp:              node.PostUp,
+		PostDown:            node.PostDown,
+		AllowedIps:          node.AllowedIPs,
+		PersistentKeepalive: node.PersistentKeepalive,
+		AccessKey:           node.AccessKey,
+		Interface:           node.Interface,
+		LastModified:        node.LastModified,
+		KeyUpdateTimestamp:  node.KeyUpdateTimeStamp,
+		ExpirationDateTime:  node.ExpirationDateTime,
+		LastPeerUpdate:      node.LastPeerUpdate,
+		LastCheckIn:         node.LastCheckIn,
+		MacAddress:          node.MacAddress,
+		CheckInInterval:     node.CheckInInterval,
+		Password:            node.Password,
+		IdentityKey:         node.IdentityKey,
+		EgressGatewayRanges: node.EgressGatewayRanges,
+		RelayAddrs:          node.RelayAddrs,
+		IngressGatewayRange: node.IngressGatewayRange,
+		Action:              node.Action,
+		LocalRange:          node.LocalRange,
+		Os:                  node.OS,
+		Mtu:                 node.MTU,
+		Version:             node.Version,
+		HostId:              node.HostID,
+		HostSecret:          node.HostSecret,
+		SaveConfig:          fromYesNo(node.SaveConfig),
+		IsRelayed:           fromYesNo(node.IsRelayed),
+		IsPending:           fromYesNo(node.IsPending),
+		IsRelay:             fromYesNo(node.IsRelay),
+		IsEgressGateway:     fromYesNo(node.IsEgressGateway),
+		IsIngressGateway:    fromYesNo(node.IsIngressGateway),
+		IsStatic:            fromYesNo(node.IsStatic),
+		UdpHolePunch:        fromYesNo(node.UDPHolePunch),
+		PullChanges:         fromYesNo(node.PullChanges),
+		DnsOn:               fromYesNo(node.DNSOn),
+		IsDualStack:         fromYesNo(node.IsDualStack),
+		IsServer:            fromYesNo(node.IsServer),
+		IsLocal:             fromYesNo(node.IsLocal),
+		Roaming:             fromYesNo(node.Roaming),
+		IpForwarding:        fromYesNo(node.IPForwarding),
+	}
+}
+
+// ToModel - converts a node message to the node model, unset flags stay empty
+func (node *Node) ToModel() models.Node {
+	if node == nil {
+		return models.Node{}
+	}
+	return models.Node{
+		ID:                  node.Id,
+		Network:             node.Network,
+		Name:                node.Name,
+		Address:             node.Address,
+		Address6:            node.Address6,
+		LocalAddress:        node.LocalAddress,
+		ListenPort:          node.ListenPort,
+		PublicKey:           node.PublicKey,
+		Endpoint:            node.Endpoint,
+		PostUp:              node.PostUp,
+		PostDown:            node.PostDown,
+		AllowedIPs:          node.AllowedIps,
+		PersistentKeepalive: node.PersistentKeepalive,
+		AccessKey:           node.AccessKey,
+		Interface:           node.Interface,
+		LastModified:        node.LastModified,
+		KeyUpdateTimeStamp:  node.KeyUpdateTimestamp,
+		ExpirationDateTime:  node.ExpirationDateTime,
+		LastPeerUpdate:      node.LastPeerUpdate,
+		LastCheckIn:         node.LastCheckIn,
+		MacAddress:          node.MacAddress,
+		CheckInInterval:     node.CheckInInterval,
+		Password:            node.Password,
+		IdentityKey:         node.IdentityKey,
+		EgressGatewayRanges: node.EgressGatewayRanges,
+		RelayAddrs:          node.RelayAddrs,
+		IngressGatewayRange: node.IngressGatewayRange,
+		Action:              node.Action,
+		LocalRange:          node.LocalRange,
+		OS:                  node.Os,
+		MTU:                 node.Mtu,
+		Version:             node.Version,
+		HostID:              node.HostId,
+		HostSecret:          node.HostSecret,
+		SaveConfig:          toYesNo(node.SaveConfig),
+		IsRelayed:           toYesNo(node.IsRelayed),
+		IsPending:           toYesNo(node.IsPending),
+		IsRelay:             toYesNo(node.IsRelay),
+		IsEgressGateway:     toYesNo(node.IsEgressGateway),
+		IsIngressGateway:    toYesNo(node.IsIngressGateway),
+		IsStatic:            toYesNo(node.IsStatic),
+		UDPHolePunch:        toYesNo(node.UdpHolePunch),
+		PullChanges:         toYesNo(node.PullChanges),
+		DNSOn:               toYesNo(node.DnsOn),
+		IsDualStack:         toYesNo(node.IsDualStack),
+		IsServer:            toYesNo(node.IsServer),
+		IsLocal:             toYesNo(node.IsLocal),
+		Roaming:             toYesNo(node.Roaming),
+		IPForwarding:        toYesNo(node.IpForwarding),
+	}
+}
+
+// NewPeer - converts a peer node to its message
+func NewPeer(node *models.Node) *Peer {
+	return &Peer{
+		PublicKey:           node.PublicKey,
+		Endpoint:            node.Endpoint,
+		Address:             node.Address,
+		Address6:            node.Address6,
+		LocalAddress:        node.LocalAddress,
+		ListenPort:          node.ListenPort,
+		PersistentKeepalive: node.PersistentKeepalive,
+		AllowedIps:          node.AllowedIPs,
+		IsEgressGateway:     node.IsEgressGateway == "yes",
+		EgressGatewayRanges: node.EgressGatewayRanges,
+		IsServer:            node.IsServer == "yes",
+		Name:                node.Name,
+	}
+}
+
+// NewExtPeer - converts an ext client of an ingress gateway to a peer message
+func NewExtPeer(extPeer *models.ExtPeersResponse) *Peer {
+	return &Peer{
+		PublicKey:           extPeer.PublicKey,
+		Endpoint:            extPeer.Endpoint,
+		Address:             extPeer.Address,
+		Address6:            extPeer.Address6,
+		LocalAddress:        extPeer.LocalAddress,
+		ListenPort:          extPeer.ListenPort,
+		PersistentKeepalive: extPeer.KeepAlive,
+		IsExtClient:         true,
+	}
+}
+
+// ToModel - converts a peer message to a node holding the settings of the peer
+func (peer *Peer) ToModel() models.Node {
+	var node = models.Node{
+		Name:                peer.Name,
+		PublicKey:           peer.PublicKey,
+		Endpoint:            peer.Endpoint,
+		Address:             peer.Address,
+		Address6:            peer.Address6,
+		LocalAddress:        peer.LocalAddress,
+		ListenPort:          peer.ListenPort,
+		PersistentKeepalive: peer.PersistentKeepalive,
+		AllowedIPs:          peer.AllowedIps,
+		EgressGatewayRanges: peer.EgressGatewayRanges,
+		IsEgressGateway:     "no",
+		IsServer:            "no",
+	}
+	if peer.IsEgressGateway {
+		node.IsEgressGateway = "yes"
+	}
+	if peer.IsServer {
+		node.IsServer = "yes"
+	}
+	return node
+}
+
+// NewError - creates a status error carrying an Error detail
+func NewError(code ErrorCode, message string) error {
+	var grpcCode = codes.Unknown
+	switch code {
+	case ErrorCode_ERROR_CODE_INVALID_ARGUMENT:
+		grpcCode = codes.InvalidArgument
+	case ErrorCode_ERROR_CODE_UNAUTHENTICATED, ErrorCode_ERROR_CODE_NODE_DELETED:
+		grpcCode = codes.Unauthenticated
+	case ErrorCode_ERROR_CODE_NOT_FOUND:
+		grpcCode = codes.NotFound
+	case ErrorCode_ERROR_CODE_INTERNAL:
+		grpcCode = codes.Internal
+	case ErrorCode_ERROR_CODE_UNSUPPORTED_VERSION:
+		grpcCode = codes.FailedPrecondition
+	}
+	st, err := status.New(grpcCode, message).WithDetails(&Error{Code: code, Message: message})
+	if err != nil {
+		return status.Error(grpcCode, message)
+	}
+	return st.Err()
+}
+
+// GetErrorCode - gets the code of an error returned by the v2 service, unspecified for other errors
+func GetErrorCode(err error) ErrorCode {
+	st, ok := status.FromError(err)
+	if !ok || st == nil {
+		return ErrorCode_ERROR_CODE_UNSPECIFIED
+	}
+	for _, detail := range st.Details() {
+		if e, ok := detail.(*Error); ok {
+			return e.Code
+		}
+	}
+	return ErrorCode_ERROR_CODE_UNSPECIFIED
+}
+
+func fromYesNo(value string) *bool {
+	if value == "" {
+		return nil
+	}
+	var isYes = value == "yes"
+	return &isYes
+}
+
+func toYesNo(value *bool) string {
+	if value == nil {
+		return ""
+	}
+	if *value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,69 @@
+package nodepbv2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// PeersToken - derives the resume token of a peer list, equal lists have equal tokens
+func PeersToken(peers []*Peer) string {
+	var sorted = make([]*Peer, len(peers))
+	copy(sorted, peers)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PublicKey < sorted[j].PublicKey })
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(&PeersResponse{Peers: sorted})
+	if err != nil {
+		return ""
+	}
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffPeers - creates the update turning the previous peers, keyed by public key, into the current ones
+// returns nil when nothing changed
+func DiffPeers(previous map[string]*Peer, current []*Peer) *PeerUpdate {
+	var update = &PeerUpdate{ResumeToken: PeersToken(current)}
+	var seen = make(map[string]bool, len(current))
+	for _, peer := range current {
+		seen[peer.PublicKey] = true
+		if old, ok := previous[peer.PublicKey]; !ok || !proto.Equal(old, peer) {
+			update.Peers = append(update.Peers, peer)
+		}
+	}
+	for key := range previous {
+		if !seen[key] {
+			update.RemovedPublicKeys = append(update.RemovedPublicKeys, key)
+		}
+	}
+	if len(update.Peers) == 0 && len(update.RemovedPublicKeys) == 0 {
+		return nil
+	}
+	sort.Strings(update.RemovedPublicKeys)
+	return update
+}
+
+// PeerUpdate.Apply - applies an update to the peers, keyed by public key, it was computed against
+func (update *PeerUpdate) Apply(peers map[string]*Peer) {
+	if update.Full {
+		for key := range peers {
+			delete(peers, key)
+		}
+	}
+	for _, key := range update.RemovedPublicKeys {
+		delete(peers, key)
+	}
+	for _, peer := range update.Peers {
+		peers[peer.PublicKey] = peer
+	}
+}
+
+// PeerMap - keys peers by their public key
+func PeerMap(peers []*Peer) map[string]*Peer {
+	var keyed = make(map[string]*Peer, len(peers))
+	for _, peer := range peers {
+		keyed[peer.PublicKey] = peer
+	}
+	return keyed
+}
@@ -0,0 +1,236 @@
+// Package logger writes structured log lines, as logfmt or JSON, so log pipelines can index them by field
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level - verbosity a message is shown from, the same scale as the VERBOSITY setting
+type Level int
+
+const (
+	// Info - always shown
+	Info Level = iota
+	// Verbose - shown from verbosity 1
+	Verbose
+	// Debug - shown from verbosity 2
+	Debug
+	// Trace - shown from verbosity 3
+	Trace
+)
+
+// levelError - level of errors, shown like Info but named error in the log line
+const levelError Level = -1
+
+// String - name of the level in log lines
+func (level Level) String() string {
+	switch level {
+	case levelError:
+		return "error"
+	case Info:
+		return "info"
+	case Verbose:
+		return "verbose"
+	case Debug:
+		return "debug"
+	default:
+		return "trace"
+	}
+}
+
+// FORMAT_LOGFMT - key=value log lines, the default
+const FORMAT_LOGFMT = "logfmt"
+
+// FORMAT_JSON - one JSON object per log line
+const FORMAT_JSON = "json"
+
+// the subsystems of netmaker, each can have its own verbosity
+const (
+	// SERVER - server startup, shutdown and background work
+	SERVER = "server"
+	// API - the REST API
+	API = "api"
+	// GRPC - the gRPC API used by netclients
+	GRPC = "grpc"
+	// NETCLIENT - the netclient
+	NETCLIENT = "netclient"
+)
+
+var settings = struct {
+	sync.Mutex
+	format    string
+	output    io.Writer
+	verbosity func(subsystem string) Level
+}{
+	format: os.Getenv("LOG_FORMAT"),
+	output: os.Stderr,
+	verbosity: func(subsystem string) Level {
+		return Info
+	},
+}
+
+// SetFormat - sets the format of log lines, logfmt or json
+func SetFormat(format string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+	settings.Lock()
+	defer settings.Unlock()
+	settings.format = format
+	return nil
+}
+
+// ValidateFormat - checks a log format, empty means logfmt
+func ValidateFormat(format string) error {
+	if format != "" && format != FORMAT_LOGFMT && format != FORMAT_JSON {
+		return errors.New("log format must be " + FORMAT_LOGFMT + " or " + FORMAT_JSON)
+	}
+	return nil
+}
+
+// SetVerbosity - sets how the verbosity of a subsystem is looked up, it is called for every message
+func SetVerbosity(verbosity func(subsystem string) Level) {
+	settings.Lock()
+	defer settings.Unlock()
+	settings.verbosity = verbosity
+}
+
+// SetOutput - sets where log lines are written, stderr by default
+func SetOutput(output io.Writer) {
+	settings.Lock()
+	defer settings.Unlock()
+	settings.output = output
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger - logs the messages of a subsystem with a set of fields
+type Logger struct {
+	subsystem string
+	fields    []field
+}
+
+// New - creates a logger for a subsystem
+func New(subsystem string) Logger {
+	return Logger{subsystem: subsystem}
+}
+
+// With - returns a logger adding a field to every message, an empty value leaves the field out
+func (logger Logger) With(key string, value interface{}) Logger {
+	if value == nil || value == "" {
+		return logger
+	}
+	var fields = make([]field, 0, len(logger.fields)+1)
+	for _, f := range logger.fields {
+		if f.key != key {
+			fields = append(fields, f)
+		}
+	}
+	logger.fields = append(fields, field{key: key, value: value})
+	return logger
+}
+
+// Log - logs a message if the subsystem is at least as verbose as the level
+func (logger Logger) Log(level Level, message string) {
+	logger.write(level, message)
+}
+
+// Error - logs a message with the error that caused it, shown at every verbosity
+func (logger Logger) Error(message string, err error) {
+	if err != nil {
+		logger = logger.With("error", err.Error())
+	}
+	logger.write(levelError, message)
+}
+
+func (logger Logger) write(level Level, message string) {
+	settings.Lock()
+	defer settings.Unlock()
+	if level > settings.verbosity(logger.subsystem) {
+		return
+	}
+	var fields = append([]field{
+		{"time", time.Now().Format(time.RFC3339)},
+		{"level", level.String()},
+		{"subsystem", logger.subsystem},
+		{"msg", message},
+	}, logger.fields...)
+	var line bytes.Buffer
+	if settings.format == FORMAT_JSON {
+		writeJSON(&line, fields)
+	} else {
+		writeLogfmt(&line, fields)
+	}
+	line.WriteByte('\n')
+	settings.output.Write(line.Bytes())
+}
+
+func writeLogfmt(line *bytes.Buffer, fields []field) {
+	for i, f := range fields {
+		if i > 0 {
+			line.WriteByte(' ')
+		}
+		var value = fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " =\"\\\n\t") {
+			value = strconv.Quote(value)
+		}
+		line.WriteString(f.key + "=" + value)
+	}
+}
+
+func writeJSON(line *bytes.Buffer, fields []field) {
+	line.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		line.Write(key)
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteByte('}')
+}
+
+// ParseLevels - parses per subsystem verbosities like "grpc=3,api=1"
+func ParseLevels(levels string) (map[string]Level, error) {
+	var parsed = make(map[string]Level)
+	for _, entry := range strings.Split(levels, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var parts = strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not subsystem=level", entry)
+		}
+		var subsystem = strings.TrimSpace(parts[0])
+		switch subsystem {
+		case SERVER, API, GRPC, NETCLIENT:
+		default:
+			return nil, fmt.Errorf("unknown subsystem %q, use %s, %s, %s or %s", subsystem, SERVER, API, GRPC, NETCLIENT)
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || level < int(Info) || level > int(Trace) {
+			return nil, fmt.Errorf("level of %s must be between 0 and 3", subsystem)
+		}
+		parsed[subsystem] = Level(level)
+	}
+	return parsed, nil
+}
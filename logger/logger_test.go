@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var output bytes.Buffer
+	SetOutput(&output)
+	SetVerbosity(func(subsystem string) Level {
+		if subsystem == GRPC {
+			return Debug
+		}
+		return Info
+	})
+	defer SetFormat(FORMAT_LOGFMT)
+
+	var log = New(GRPC).With("network", "skynet").With("request_id", "")
+	log.With("mac", "aa:bb").Log(Debug, "node checked in")
+	line := output.String()
+	if !strings.Contains(line, `level=debug subsystem=grpc msg="node checked in" network=skynet mac=aa:bb`) {
+		t.Errorf("unexpected logfmt line %q", line)
+	}
+	if strings.Contains(line, "request_id") {
+		t.Errorf("empty field logged in %q", line)
+	}
+
+	output.Reset()
+	log.Log(Trace, "hidden")
+	New(API).Log(Verbose, "hidden")
+	if output.Len() != 0 {
+		t.Errorf("message above the subsystem verbosity logged: %q", output.String())
+	}
+
+	if err := SetFormat("xml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if err := SetFormat(FORMAT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	New(API).With("user", "admin").Error("could not create network", errors.New("network exists"))
+	var fields map[string]string
+	if err := json.Unmarshal(output.Bytes(), &fields); err != nil {
+		t.Fatalf("invalid json line %q: %v", output.String(), err)
+	}
+	if fields["level"] != "error" || fields["subsystem"] != API || fields["user"] != "admin" || fields["error"] != "network exists" {
+		t.Errorf("unexpected json fields %v", fields)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("grpc=3, api=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels[GRPC] != Trace || levels[API] != Verbose || len(levels) != 2 {
+		t.Errorf("unexpected levels %v", levels)
+	}
+	for _, invalid := range []string{"grpc", "grpc=4", "mesh=1"} {
+		if _, err := ParseLevels(invalid); err == nil {
+			t.Errorf("%q accepted", invalid)
+		}
+	}
+}
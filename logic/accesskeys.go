@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 )
 
@@ -31,13 +32,26 @@ func DecrimentKey(networkName string, keyvalue string) {
 	}
 
 	if newNetworkData, err := json.Marshal(&network); err != nil {
-		Log("failed to decrement key", 2)
+		logger.New(logger.SERVER).With("network", networkName).With("error", err.Error()).Log(logger.Debug, "failed to decrement key")
 		return
 	} else {
 		database.Insert(network.NetID, string(newNetworkData), database.NETWORKS_TABLE_NAME)
 	}
 }
 
+// getAccessKey - finds an access key of a network by its value
+func getAccessKey(network *models.Network, keyvalue string) (models.AccessKey, bool) {
+	if keyvalue == "" {
+		return models.AccessKey{}, false
+	}
+	for _, key := range network.AccessKeys {
+		if key.Value == keyvalue {
+			return key, true
+		}
+	}
+	return models.AccessKey{}, false
+}
+
 // IsKeyValid - check if key is valid
 func IsKeyValid(networkname string, keyvalue string) bool {
 
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -28,7 +31,7 @@ func HasAdmin() (bool, error) {
 		if err != nil {
 			continue
 		}
-		if user.IsAdmin {
+		if user.IsAdmin && user.Tenant == "" {
 			return true, nil
 		}
 	}
@@ -84,6 +87,9 @@ func CreateUser(user models.User) (models.User, error) {
 	if err != nil {
 		return models.User{}, err
 	}
+	if err = ValidateUserTenant(&user); err != nil {
+		return models.User{}, err
+	}
 
 	// encrypt that password so we never see it again
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 5)
@@ -120,6 +126,7 @@ func CreateAdmin(admin models.User) (models.User, error) {
 		return models.User{}, errors.New("admin user already exists")
 	}
 	admin.IsAdmin = true
+	admin.Tenant = ""
 	return CreateUser(admin)
 }
 
@@ -133,10 +140,14 @@ func VerifyAuthRequest(authRequest models.UserAuthParams) (string, error) {
 	}
 	//Search DB for node with Mac Address. Ignore pending nodes (they should not be able to authenticate with API until approved).
 	record, err := database.FetchRecord(database.USERS_TABLE_NAME, authRequest.UserName)
-	if err != nil {
-		return "", errors.New("incorrect credentials")
+	if err == nil {
+		err = json.Unmarshal([]byte(record), &result)
+	}
+	// local users take precedence, unknown users are looked up in LDAP if configured
+	if servercfg.IsLDAPEnabled() && (err != nil || IsLDAPUser(&result)) {
+		return verifyLDAPAuthRequest(authRequest, err == nil)
 	}
-	if err = json.Unmarshal([]byte(record), &result); err != nil {
+	if err != nil {
 		return "", errors.New("incorrect credentials")
 	}
 
@@ -166,6 +177,9 @@ func UpdateUserNetworks(newNetworks []string, isadmin bool, currentUser *models.
 	} else {
 		currentUser.Networks = newNetworks
 	}
+	if err := ValidateUserTenant(currentUser); err != nil {
+		return err
+	}
 
 	data, err := json.Marshal(currentUser)
 	if err != nil {
@@ -178,6 +192,71 @@ func UpdateUserNetworks(newNetworks []string, isadmin bool, currentUser *models.
 	return nil
 }
 
+// SetUserAccess - overwrites the networks and admin status of a user, used by external identity providers
+func SetUserAccess(username string, networks []string, isadmin bool) error {
+	user, err := GetUser(username)
+	if err != nil {
+		return err
+	}
+	user.IsAdmin = isadmin
+	user.Networks = nil
+	if !isadmin {
+		// mappings are server wide, users of a tenant only get the networks of their tenant
+		var tenantNetworks []string
+		if user.Tenant != "" {
+			if tenantNetworks, err = GetTenantNetworks(user.Tenant); err != nil {
+				return err
+			}
+		}
+		for _, network := range networks {
+			if user.Tenant == "" || StringSliceContains(tenantNetworks, network) {
+				user.Networks = append(user.Networks, network)
+			}
+		}
+	}
+	if err = ValidateUserTenant(&user); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&user)
+	if err != nil {
+		return err
+	}
+	return database.Insert(user.UserName, string(data), database.USERS_TABLE_NAME)
+}
+
+// GetGroupAccess - evaluates the configured group mappings against a user's groups,
+// a mapping for group "*" applies to every user
+func GetGroupAccess(groups []string) ([]string, bool) {
+	var networks []string
+	var isadmin bool
+	for _, mapping := range servercfg.GetGroupMappings() {
+		if !groupMatches(mapping.Group, groups) {
+			continue
+		}
+		if mapping.Admin {
+			isadmin = true
+		}
+		for _, network := range mapping.Networks {
+			if !StringSliceContains(networks, network) {
+				networks = append(networks, network)
+			}
+		}
+	}
+	return networks, isadmin
+}
+
+func groupMatches(group string, groups []string) bool {
+	if group == "*" {
+		return true
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
 // UpdateUser - updates a given user
 func UpdateUser(userchange models.User, user models.User) (models.User, error) {
 	//check if user exists
@@ -198,6 +277,9 @@ func UpdateUser(userchange models.User, user models.User) (models.User, error) {
 	if len(userchange.Networks) > 0 {
 		user.Networks = userchange.Networks
 	}
+	if err = ValidateUserTenant(&user); err != nil {
+		return models.User{}, err
+	}
 	if userchange.Password != "" {
 		// encrypt that password so we never see it again
 		hash, err := bcrypt.GenerateFromPassword([]byte(userchange.Password), 5)
@@ -220,7 +302,7 @@ func UpdateUser(userchange models.User, user models.User) (models.User, error) {
 	if err = database.Insert(user.UserName, string(data), database.USERS_TABLE_NAME); err != nil {
 		return models.User{}, err
 	}
-	Log("updated user "+queryUser, 1)
+	logger.New(logger.SERVER).With("user", queryUser).Log(logger.Verbose, "updated user")
 	return user, nil
 }
 
@@ -232,7 +314,7 @@ func ValidateUser(user models.User) error {
 
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			Log(e.Error(), 2)
+			logger.New(logger.SERVER).With("user", user.UserName).Log(logger.Debug, e.Error())
 		}
 	}
 
@@ -250,6 +332,9 @@ func DeleteUser(user string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if err = database.DeleteRecord(database.USER_TOTP_TABLE_NAME, user); err != nil && !database.IsEmptyRecord(err) {
+		logger.New(logger.SERVER).With("user", user).With("error", err.Error()).Log(logger.Verbose, "could not remove second factor of deleted user")
+	}
 	return true, nil
 }
 
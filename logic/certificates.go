@@ -0,0 +1,374 @@
+package logic
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+const (
+	// caRecordKey - key of the certificate authority in the server config table
+	caRecordKey = "grpcca"
+	// caValidity - how long the certificate authority is valid
+	caValidity = 10 * 365 * 24 * time.Hour
+	// nodeCertificateValidity - how long client certificates of nodes are valid, netclients renew them at login before they expire
+	nodeCertificateValidity = 365 * 24 * time.Hour
+	// serverCertificateValidity - how long the certificate of the GRPC listener is valid, a new one is issued at every start
+	serverCertificateValidity = 90 * 24 * time.Hour
+	// certificateClockSkew - backdates certificates for clients with slightly late clocks
+	certificateClockSkew = 5 * time.Minute
+)
+
+// caRecord - the certificate authority as stored in the database
+type caRecord struct {
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"privatekey"`
+}
+
+// certificateAuthority - the loaded certificate authority, shared by all requests
+var certificateAuthority = struct {
+	sync.Mutex
+	certificate *x509.Certificate
+	key         crypto.Signer
+	pem         []byte
+}{}
+
+// GetCA - gets the certificate authority issuing GRPC certificates, creates it on first use
+func GetCA() (*x509.Certificate, crypto.Signer, error) {
+	certificateAuthority.Lock()
+	defer certificateAuthority.Unlock()
+	if certificateAuthority.certificate != nil {
+		return certificateAuthority.certificate, certificateAuthority.key, nil
+	}
+	record, err := database.FetchRecord(database.SERVERCONF_TABLE_NAME, caRecordKey)
+	if err != nil {
+		if !database.IsEmptyRecord(err) {
+			return nil, nil, err
+		}
+		if err = createCA(); err != nil {
+			return nil, nil, err
+		}
+		// read back what was stored, another server sharing the database may have stored its authority first
+		if record, err = database.FetchRecord(database.SERVERCONF_TABLE_NAME, caRecordKey); err != nil {
+			return nil, nil, err
+		}
+	}
+	var ca caRecord
+	if err = json.Unmarshal([]byte(record), &ca); err != nil {
+		return nil, nil, err
+	}
+	certificate, err := parseCertificatePEM([]byte(ca.Certificate))
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode([]byte(ca.PrivateKey))
+	if keyBlock == nil {
+		return nil, nil, errors.New("could not decode the private key of the certificate authority")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificateAuthority.certificate = certificate
+	certificateAuthority.key = key
+	certificateAuthority.pem = []byte(ca.Certificate)
+	return certificate, key, nil
+}
+
+// GetCAPEM - gets the certificate of the certificate authority in PEM format, as handed to nodes
+func GetCAPEM() ([]byte, error) {
+	if _, _, err := GetCA(); err != nil {
+		return nil, err
+	}
+	certificateAuthority.Lock()
+	defer certificateAuthority.Unlock()
+	return certificateAuthority.pem, nil
+}
+
+// GetCAFingerprint - gets the sha256 fingerprint of the certificate authority, netclients pin it at join
+func GetCAFingerprint() (string, error) {
+	certificate, _, err := GetCA()
+	if err != nil {
+		return "", err
+	}
+	return CertificateFingerprint(certificate.Raw), nil
+}
+
+// CertificateFingerprint - hex encoded sha256 fingerprint of a DER encoded certificate
+func CertificateFingerprint(der []byte) string {
+	var sum = sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueNodeCertificate - signs the certificate request of a node, binds the certificate to the node and revokes its previous one
+// the subject is always set by the server, the common name is the node id and the organizational unit its network
+func IssueNodeCertificate(ctx context.Context, node *models.Node, csrPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("could not decode certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return nil, err
+	}
+	var now = time.Now()
+	var template = &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: node.ID, OrganizationalUnit: []string{node.Network}},
+		NotBefore:    now.Add(-certificateClockSkew),
+		NotAfter:     now.Add(nodeCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := signCertificate(template, csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var record = models.NodeCertificate{
+		Serial:   serialString(serial),
+		NodeID:   node.ID,
+		Network:  node.Network,
+		NotAfter: template.NotAfter.Unix(),
+	}
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return nil, err
+	}
+	if err = database.Insert(record.Serial, string(data), database.CERTIFICATES_TABLE_NAME); err != nil {
+		return nil, err
+	}
+	if err = RevokeNodeCertificate(node); err != nil {
+		RequestLogger(ctx, logger.SERVER).With("node", node.ID).With("network", node.Network).With("error", err.Error()).
+			Log(logger.Verbose, "could not revoke previous certificate of node")
+	}
+	node.CertificateSerial = record.Serial
+	if data, err = json.Marshal(node); err != nil {
+		return nil, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), nil
+}
+
+// RevokeNodeCertificate - revokes the client certificate bound to a node, if it has one
+func RevokeNodeCertificate(node *models.Node) error {
+	if node.CertificateSerial == "" {
+		return nil
+	}
+	record, err := getNodeCertificate(node.CertificateSerial)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
+	}
+	if record.RevokedAt != 0 {
+		return nil
+	}
+	record.RevokedAt = time.Now().Unix()
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	return database.Insert(record.Serial, string(data), database.CERTIFICATES_TABLE_NAME)
+}
+
+// CheckNodeCertificate - checks a verified client certificate was issued by this server and is not revoked
+func CheckNodeCertificate(certificate *x509.Certificate) error {
+	record, err := getNodeCertificate(serialString(certificate.SerialNumber))
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return errors.New("client certificate was not issued by this server")
+		}
+		return err
+	}
+	if record.RevokedAt != 0 {
+		return errors.New("client certificate was revoked")
+	}
+	if record.NodeID != certificate.Subject.CommonName {
+		return errors.New("client certificate does not match its record")
+	}
+	return nil
+}
+
+// GetGRPCServerTLSConfig - the TLS config of the GRPC listener when mutual TLS is on
+// clients without a certificate may connect to join or log in, every other call requires a certificate checked by the auth interceptor
+func GetGRPCServerTLSConfig() (*tls.Config, error) {
+	ca, _, err := GetCA()
+	if err != nil {
+		return nil, err
+	}
+	serverCertificate, err := issueServerCertificate()
+	if err != nil {
+		return nil, err
+	}
+	var clientCAs = x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2"},
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+				return nil
+			}
+			return CheckNodeCertificate(verifiedChains[0][0])
+		},
+	}, nil
+}
+
+// issueServerCertificate - issues the certificate of the GRPC listener, the chain includes the authority so netclients can pin it at join
+func issueServerCertificate() (tls.Certificate, error) {
+	ca, _, err := GetCA()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var now = time.Now()
+	var template = &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "Netmaker GRPC"},
+		NotBefore:    now.Add(-certificateClockSkew),
+		NotAfter:     now.Add(serverCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	for _, host := range []string{servercfg.GetGRPCHost(), grpcConnHost()} {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	certificate, err := signCertificate(template, key.Public())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{certificate, ca.Raw}, PrivateKey: key}, nil
+}
+
+// createCA - generates a certificate authority and stores it
+func createCA() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return err
+	}
+	var now = time.Now()
+	var template = &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Netmaker GRPC CA"},
+		NotBefore:             now.Add(-certificateClockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&caRecord{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})),
+	})
+	if err != nil {
+		return err
+	}
+	logger.New(logger.SERVER).Log(logger.Info, "created certificate authority for GRPC")
+	return database.Insert(caRecordKey, string(data), database.SERVERCONF_TABLE_NAME)
+}
+
+// signCertificate - signs a certificate with the certificate authority, returns it DER encoded
+func signCertificate(template *x509.Certificate, publicKey interface{}) ([]byte, error) {
+	ca, key, err := GetCA()
+	if err != nil {
+		return nil, err
+	}
+	return x509.CreateCertificate(rand.Reader, template, ca, publicKey, key)
+}
+
+// getNodeCertificate - gets the record of an issued certificate by serial
+func getNodeCertificate(serial string) (models.NodeCertificate, error) {
+	var record models.NodeCertificate
+	data, err := database.FetchRecord(database.CERTIFICATES_TABLE_NAME, serial)
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal([]byte(data), &record)
+	return record, err
+}
+
+// newCertificateSerial - generates a random 128 bit certificate serial
+func newCertificateSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// serialString - the hex encoded serial certificates are stored by
+func serialString(serial *big.Int) string {
+	return serial.Text(16)
+}
+
+// grpcConnHost - the host of the GRPC connection string, if one is set
+func grpcConnHost() string {
+	var conn = servercfg.GetGRPCConnString()
+	if host, _, err := net.SplitHostPort(conn); err == nil {
+		return host
+	}
+	return strings.TrimSpace(conn)
+}
+
+// parseCertificatePEM - parses a PEM encoded certificate
+func parseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("could not decode certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
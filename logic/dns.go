@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/servercfg"
 	"github.com/txn2/txeh"
@@ -108,6 +109,77 @@ func GetCustomDNS(network string) ([]models.DNSEntry, error) {
 	return dns, err
 }
 
+// CreateDNS - creates a DNS entry
+func CreateDNS(entry models.DNSEntry) (models.DNSEntry, error) {
+
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return models.DNSEntry{}, err
+	}
+	key, err := GetRecordKey(entry.Name, entry.Network)
+	if err != nil {
+		return models.DNSEntry{}, err
+	}
+	if err = database.Insert(key, string(data), database.DNS_TABLE_NAME); err != nil {
+		return entry, err
+	}
+	return entry, PublishEvent(models.Event{Type: models.EVENT_DNS_UPDATED, Network: entry.Network})
+}
+
+// GetDNSEntry - gets a DNS entry
+func GetDNSEntry(domain string, network string) (models.DNSEntry, error) {
+	var entry models.DNSEntry
+	key, err := GetRecordKey(domain, network)
+	if err != nil {
+		return entry, err
+	}
+	record, err := database.FetchRecord(database.DNS_TABLE_NAME, key)
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal([]byte(record), &entry)
+	return entry, err
+}
+
+// UpdateDNS - updates DNS entry
+func UpdateDNS(dnschange models.DNSEntry, entry models.DNSEntry) (models.DNSEntry, error) {
+
+	key, err := GetRecordKey(entry.Name, entry.Network)
+	if err != nil {
+		return entry, err
+	}
+	if dnschange.Name != "" {
+		entry.Name = dnschange.Name
+	}
+	if dnschange.Address != "" {
+		entry.Address = dnschange.Address
+	}
+	newkey, err := GetRecordKey(entry.Name, entry.Network)
+
+	err = database.DeleteRecord(database.DNS_TABLE_NAME, key)
+	if err != nil {
+		return entry, err
+	}
+
+	data, err := json.Marshal(&entry)
+	if err = database.Insert(newkey, string(data), database.DNS_TABLE_NAME); err != nil {
+		return entry, err
+	}
+	return entry, PublishEvent(models.Event{Type: models.EVENT_DNS_UPDATED, Network: entry.Network})
+}
+
+// DeleteDNS - deletes a DNS entry
+func DeleteDNS(domain string, network string) error {
+	key, err := GetRecordKey(domain, network)
+	if err != nil {
+		return err
+	}
+	if err = database.DeleteRecord(database.DNS_TABLE_NAME, key); err != nil {
+		return err
+	}
+	return PublishEvent(models.Event{Type: models.EVENT_DNS_UPDATED, Network: network})
+}
+
 // SetCorefile - sets the core file of the system
 func SetCorefile(domains string) error {
 	dir, err := os.Getwd()
@@ -118,7 +190,7 @@ func SetCorefile(domains string) error {
 	if os.IsNotExist(err) {
 		os.Mkdir(dir+"/config/dnsconfig", 744)
 	} else if err != nil {
-		Log("couldnt find or create /config/dnsconfig", 0)
+		logger.New(logger.SERVER).Error("could not find or create /config/dnsconfig", err)
 		return err
 	}
 
@@ -0,0 +1,140 @@
+package logic
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// serverRefreshDelay - how long the server node waits after a peer change before it checks in, to batch bursts of changes
+const serverRefreshDelay = time.Second
+
+type eventSubscriber struct {
+	name    string
+	types   map[models.EventType]bool
+	handler func(models.Event) error
+}
+
+// eventSubscribers - the subscribers of the event bus, in order of subscription
+var eventSubscribers = struct {
+	sync.RWMutex
+	list []*eventSubscriber
+}{}
+
+func init() {
+	SubscribeEvents("peerupdates", notifyPeerStreams, models.EVENT_PEERS_CHANGED, models.EVENT_NODE_UPDATED)
+	SubscribeEvents("pullchanges", flagPullChanges, models.EVENT_GATEWAY_UPDATED)
+	SubscribeEvents("dns", regenerateDNS, models.EVENT_NODE_CREATED, models.EVENT_NODE_UPDATED, models.EVENT_NODE_DELETED, models.EVENT_DNS_UPDATED)
+	SubscribeEvents("serverpeers", refreshServerPeers, models.EVENT_PEERS_CHANGED)
+}
+
+// SubscribeEvents - calls a handler for every published event of the given types, or of every type if none are given
+// returns a func to unsubscribe, handlers run synchronously in the publishing goroutine and may publish events themselves
+func SubscribeEvents(name string, handler func(models.Event) error, types ...models.EventType) func() {
+	var subscriber = &eventSubscriber{name: name, handler: handler}
+	if len(types) > 0 {
+		subscriber.types = make(map[models.EventType]bool)
+		for _, eventType := range types {
+			subscriber.types[eventType] = true
+		}
+	}
+	eventSubscribers.Lock()
+	eventSubscribers.list = append(eventSubscribers.list, subscriber)
+	eventSubscribers.Unlock()
+	return func() {
+		eventSubscribers.Lock()
+		defer eventSubscribers.Unlock()
+		for i := range eventSubscribers.list {
+			if eventSubscribers.list[i] == subscriber {
+				eventSubscribers.list = append(eventSubscribers.list[:i], eventSubscribers.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// PublishEvent - passes an event to its subscribers in order of subscription
+// every subscriber runs even if an earlier one failed, the failures are returned together
+func PublishEvent(event models.Event) error {
+	eventSubscribers.RLock()
+	var subscribers = make([]*eventSubscriber, 0, len(eventSubscribers.list))
+	for _, subscriber := range eventSubscribers.list {
+		if subscriber.types == nil || subscriber.types[event.Type] {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	eventSubscribers.RUnlock()
+
+	var failures []string
+	for _, subscriber := range subscribers {
+		if err := subscriber.handler(event); err != nil {
+			logger.New(logger.SERVER).With("request_id", event.RequestID).With("event", string(event.Type)).With("network", event.Network).
+				With("subscriber", subscriber.name).Error("event subscriber failed", err)
+			failures = append(failures, subscriber.name+": "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// notifyPeerStreams - signals peer streams of changed peers, node updates only matter if they change how the node appears to peers
+func notifyPeerStreams(event models.Event) error {
+	if event.Type == models.EVENT_NODE_UPDATED && !peerSettingsChanged(event.Previous, event.Node) {
+		return nil
+	}
+	NotifyPeerUpdate(event.Network)
+	return nil
+}
+
+// flagPullChanges - tells every node of the network to pull its config
+func flagPullChanges(event models.Event) error {
+	return NetworkNodesUpdatePullChanges(event.Network)
+}
+
+// regenerateDNS - rewrites the DNS config in DNS mode, node updates only matter if they change a name or address
+func regenerateDNS(event models.Event) error {
+	if !servercfg.IsDNSMode() {
+		return nil
+	}
+	if event.Type == models.EVENT_NODE_UPDATED && event.Previous.Name == event.Node.Name &&
+		event.Previous.Address == event.Node.Address && event.Previous.Address6 == event.Node.Address6 {
+		return nil
+	}
+	return SetDNS()
+}
+
+// serverRefreshes - the networks with a pending server node check in
+var serverRefreshes = struct {
+	sync.Mutex
+	pending map[string]bool
+}{pending: make(map[string]bool)}
+
+// refreshServerPeers - checks the server node of a network in shortly after its peers changed, instead of on its next interval
+func refreshServerPeers(event models.Event) error {
+	if servercfg.IsClientMode() == "off" {
+		return nil
+	}
+	serverRefreshes.Lock()
+	defer serverRefreshes.Unlock()
+	if serverRefreshes.pending[event.Network] {
+		return nil
+	}
+	serverRefreshes.pending[event.Network] = true
+	go func(network string) {
+		time.Sleep(serverRefreshDelay)
+		serverRefreshes.Lock()
+		delete(serverRefreshes.pending, network)
+		serverRefreshes.Unlock()
+		if err := ServerCheckin(servercfg.GetNodeID(), network); err != nil {
+			logger.New(logger.SERVER).With("network", network).Log(logger.Verbose, "could not refresh server peers: "+err.Error())
+		}
+	}(event.Network)
+	return nil
+}
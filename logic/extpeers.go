@@ -1,14 +1,18 @@
 package logic
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-// GetExtPeersList - gets the ext peers lists
-func GetExtPeersList(macaddress string, networkName string) ([]models.ExtPeersResponse, error) {
+// GetExtPeersList - gets the ext peers of an ingress gateway node
+func GetExtPeersList(ctx context.Context, nodeid string, networkName string) ([]models.ExtPeersResponse, error) {
 
 	var peers []models.ExtPeersResponse
 	records, err := database.FetchRecords(database.EXT_CLIENT_TABLE_NAME)
@@ -22,15 +26,17 @@ func GetExtPeersList(macaddress string, networkName string) ([]models.ExtPeersRe
 		var extClient models.ExtClient
 		err = json.Unmarshal([]byte(value), &peer)
 		if err != nil {
-			Log("failed to unmarshal peer when getting ext peer list", 2)
+			RequestLogger(ctx, logger.SERVER).With("node", nodeid).With("network", networkName).With("error", err.Error()).
+				Log(logger.Debug, "failed to unmarshal peer when getting ext peer list")
 			continue
 		}
 		err = json.Unmarshal([]byte(value), &extClient)
 		if err != nil {
-			Log("failed to unmarshal ext client", 2)
+			RequestLogger(ctx, logger.SERVER).With("node", nodeid).With("network", networkName).With("error", err.Error()).
+				Log(logger.Debug, "failed to unmarshal ext client")
 			continue
 		}
-		if extClient.Network == networkName && extClient.IngressGatewayID == macaddress {
+		if extClient.Network == networkName && extClient.IngressGatewayID == nodeid {
 			peers = append(peers, peer)
 		}
 	}
@@ -62,3 +68,123 @@ func GetEgressRangesOnNetwork(client *models.ExtClient) ([]string, error) {
 
 	return result, nil
 }
+
+// GetNetworkExtClients - gets the ext clients of given network
+func GetNetworkExtClients(network string) ([]models.ExtClient, error) {
+	var extclients []models.ExtClient
+
+	records, err := database.FetchRecords(database.EXT_CLIENT_TABLE_NAME)
+	if err != nil {
+		return extclients, err
+	}
+	for _, value := range records {
+		var extclient models.ExtClient
+		err = json.Unmarshal([]byte(value), &extclient)
+		if err != nil {
+			continue
+		}
+		if extclient.Network == network {
+			extclients = append(extclients, extclient)
+		}
+	}
+	return extclients, err
+}
+
+// GetExtClient - gets a single ext client on a network
+func GetExtClient(clientid string, network string) (models.ExtClient, error) {
+	var extclient models.ExtClient
+	key, err := GetRecordKey(clientid, network)
+	if err != nil {
+		return extclient, err
+	}
+	data, err := database.FetchRecord(database.EXT_CLIENT_TABLE_NAME, key)
+	if err != nil {
+		return extclient, err
+	}
+	err = json.Unmarshal([]byte(data), &extclient)
+
+	return extclient, err
+}
+
+// CreateExtClient - creates an extclient
+func CreateExtClient(extclient models.ExtClient) error {
+	if extclient.PrivateKey == "" {
+		privateKey, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return err
+		}
+
+		extclient.PrivateKey = privateKey.String()
+		extclient.PublicKey = privateKey.PublicKey().String()
+	}
+
+	if extclient.Address == "" {
+		newAddress, err := UniqueAddress(extclient.Network)
+		if err != nil {
+			return err
+		}
+		extclient.Address = newAddress
+	}
+
+	if extclient.ClientID == "" {
+		extclient.ClientID = models.GenerateNodeName()
+	}
+
+	extclient.LastModified = time.Now().Unix()
+
+	key, err := GetRecordKey(extclient.ClientID, extclient.Network)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&extclient)
+	if err != nil {
+		return err
+	}
+	if err = database.Insert(key, string(data), database.EXT_CLIENT_TABLE_NAME); err != nil {
+		return err
+	}
+	err = SetNetworkNodesLastModified(extclient.Network)
+	return err
+}
+
+// UpdateExtClient - only supports name changes right now
+func UpdateExtClient(newclientid string, network string, client models.ExtClient) (models.ExtClient, error) {
+
+	err := DeleteExtClient(network, client.ClientID)
+	if err != nil {
+		return client, err
+	}
+	client.ClientID = newclientid
+	CreateExtClient(client)
+	return client, err
+}
+
+// DeleteExtClient - deletes an existing ext client
+func DeleteExtClient(network string, clientid string) error {
+	key, err := GetRecordKey(clientid, network)
+	if err != nil {
+		return err
+	}
+	if err = database.DeleteRecord(database.EXT_CLIENT_TABLE_NAME, key); err != nil {
+		return err
+	}
+	return PublishEvent(models.Event{Type: models.EVENT_PEERS_CHANGED, Network: network})
+}
+
+// DeleteGatewayExtClients - deletes ext clients based on gateway (node id) of ingress node and network
+func DeleteGatewayExtClients(gatewayID string, networkName string) error {
+	currentExtClients, err := GetNetworkExtClients(networkName)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return err
+	}
+	for _, extClient := range currentExtClients {
+		if extClient.IngressGatewayID == gatewayID {
+			if err = DeleteExtClient(networkName, extClient.ClientID); err != nil {
+				logger.New(logger.SERVER).With("node", gatewayID).With("network", networkName).With("client", extClient.ClientID).With("error", err.Error()).
+					Log(logger.Debug, "failed to remove ext client")
+				continue
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofrs/uuid"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GetHosts - gets all hosts
+func GetHosts() ([]models.Host, error) {
+	var hosts = []models.Host{}
+	collection, err := database.FetchRecords(database.HOSTS_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return hosts, nil
+		}
+		return hosts, err
+	}
+	for _, value := range collection {
+		var host models.Host
+		if err := json.Unmarshal([]byte(value), &host); err != nil {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// GetHost - gets a host by id
+func GetHost(hostid string) (models.Host, error) {
+	var host models.Host
+	record, err := database.FetchRecord(database.HOSTS_TABLE_NAME, hostid)
+	if err != nil {
+		return host, err
+	}
+	if err = json.Unmarshal([]byte(record), &host); err != nil {
+		return models.Host{}, err
+	}
+	return host, nil
+}
+
+// GetHostNodes - gets the nodes of a host in all networks
+func GetHostNodes(hostid string) ([]models.Node, error) {
+	var hostNodes = []models.Node{}
+	nodes, err := GetAllNodes()
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return hostNodes, nil
+		}
+		return hostNodes, err
+	}
+	for _, node := range nodes {
+		if node.HostID == hostid {
+			hostNodes = append(hostNodes, node)
+		}
+	}
+	return hostNodes, nil
+}
+
+// UpdateHost - renames a host, the shared fields are only set by its nodes
+func UpdateHost(hostchange models.Host, host models.Host) (models.Host, error) {
+	if hostchange.ID != "" && hostchange.ID != host.ID {
+		return models.Host{}, errors.New("cannot change the id of host " + host.ID)
+	}
+	host.Name = hostchange.Name
+	if err := ValidateHost(&host); err != nil {
+		return models.Host{}, err
+	}
+	return host, saveHost(&host)
+}
+
+// DeleteHost - removes a host from all of its networks
+// the nodes are marked deleted so their netclients leave on the next checkin
+func DeleteHost(hostid string) error {
+	if _, err := GetHost(hostid); err != nil {
+		return errors.New("host " + hostid + " does not exist")
+	}
+	nodes, err := GetHostNodes(hostid)
+	if err != nil {
+		return err
+	}
+	for i := range nodes {
+		if err = DeleteNode(context.Background(), &nodes[i], false); err != nil {
+			return err
+		}
+		SetNetworkNodesLastModified(nodes[i].Network)
+	}
+	return RemoveEmptyHost(hostid)
+}
+
+// RemoveEmptyHost - deletes a host once none of its nodes remain
+func RemoveEmptyHost(hostid string) error {
+	if hostid == "" {
+		return nil
+	}
+	nodes, err := GetHostNodes(hostid)
+	if err != nil {
+		return err
+	}
+	if len(nodes) > 0 {
+		return nil
+	}
+	return database.DeleteRecord(database.HOSTS_TABLE_NAME, hostid)
+}
+
+// ValidateHost - validates the fields of a host
+func ValidateHost(host *models.Host) error {
+	v := validator.New()
+	_ = v.RegisterValidation("hostname_valid", func(fl validator.FieldLevel) bool {
+		for _, char := range strings.ToLower(fl.Field().String()) {
+			if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz1234567890-.", char) {
+				return false
+			}
+		}
+		return true
+	})
+	err := v.Struct(host)
+	if err != nil {
+		for _, e := range err.(validator.ValidationErrors) {
+			logger.New(logger.SERVER).With("host", host.ID).Log(logger.Debug, e.Error())
+		}
+	}
+	return err
+}
+
+// MigrateNodeHosts - creates hosts for nodes which joined before hosts existed
+// the nodes of a machine are recognized by sharing a mac address and endpoint
+func MigrateNodeHosts() error {
+	nodes, err := GetAllNodes()
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
+	}
+	var hosts = make(map[string]*models.Host) // mac address and endpoint -> host
+	var count int
+	for i := range nodes {
+		var node = &nodes[i]
+		if node.HostID != "" || node.IsServer == "yes" {
+			continue
+		}
+		var key = node.MacAddress + "|" + node.Endpoint
+		host, ok := hosts[key]
+		if !ok {
+			host = newHost(node)
+			hosts[key] = host
+		}
+		node.HostID = host.ID
+		if err = saveHost(host); err != nil {
+			return err
+		}
+		data, err := json.Marshal(node)
+		if err != nil {
+			return err
+		}
+		if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+			return err
+		}
+		count++
+	}
+	if count > 0 {
+		logger.New(logger.SERVER).With("nodes", count).With("hosts", len(hosts)).Log(logger.Info, "grouped nodes into hosts")
+	}
+	return nil
+}
+
+// setNodeHost - attaches a new node to the host it names or to a new host
+// joining an existing host requires the secret of that host
+func setNodeHost(node *models.Node) error {
+	var secret = node.HostSecret
+	node.HostSecret = ""
+	if node.IsServer == "yes" {
+		node.HostID = ""
+		return nil
+	}
+	if node.HostID != "" {
+		host, err := GetHost(node.HostID)
+		if err == nil {
+			if host.Secret == "" || bcrypt.CompareHashAndPassword([]byte(host.Secret), []byte(secret)) != nil {
+				return errors.New("invalid secret for host " + node.HostID)
+			}
+			setHostFields(&host, node)
+			return saveHost(&host)
+		}
+		// the host was removed since the client last joined
+		logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network).With("host", node.HostID).
+			Log(logger.Debug, "host of node does not exist, creating a new host")
+	}
+	var host = newHost(node)
+	if secret != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), 5)
+		if err != nil {
+			return err
+		}
+		host.Secret = string(hash)
+	}
+	node.HostID = host.ID
+	return saveHost(host)
+}
+
+// syncNodeHost - shares the endpoint, os and version of a checking in node with its host
+// hosts created before their client sent a secret adopt the first one they receive
+func syncNodeHost(node *models.Node) error {
+	var secret = node.HostSecret
+	node.HostSecret = ""
+	if node.HostID == "" {
+		return nil
+	}
+	host, err := GetHost(node.HostID)
+	if err != nil {
+		return err
+	}
+	var current = host
+	setHostFields(&host, node)
+	if host.Secret == "" && secret != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), 5)
+		if err != nil {
+			return err
+		}
+		host.Secret = string(hash)
+	}
+	if host == current {
+		return nil
+	}
+	return saveHost(&host)
+}
+
+func newHost(node *models.Node) *models.Host {
+	var host = &models.Host{
+		ID:   uuid.Must(uuid.NewV4()).String(),
+		Name: node.Name,
+	}
+	setHostFields(host, node)
+	return host
+}
+
+func setHostFields(host *models.Host, node *models.Node) {
+	if node.Endpoint != "" {
+		host.Endpoint = node.Endpoint
+	}
+	if node.OS != "" {
+		host.OS = node.OS
+	}
+	if node.Version != "" {
+		host.Version = node.Version
+	}
+}
+
+func saveHost(host *models.Host) error {
+	data, err := json.Marshal(host)
+	if err != nil {
+		return err
+	}
+	return database.Insert(host.ID, string(data), database.HOSTS_TABLE_NAME)
+}
@@ -0,0 +1,185 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// nodeExpiryWarning - how long before a node expires EVENT_NODE_EXPIRING is published
+const nodeExpiryWarning = 24 * time.Hour
+
+// expiredNodeRetention - how long expired nodes are kept out of peer lists before they are deleted, their expiry may still be extended until then
+const expiredNodeRetention = 24 * time.Hour
+
+// deletedNodeRetention - how long deleted nodes are kept for their netclients to learn of the deletion
+const deletedNodeRetention = 7 * 24 * time.Hour
+
+// RegisterMaintenanceJobs - registers the periodic maintenance of nodes and DNS with the scheduler
+func RegisterMaintenanceJobs() {
+	RegisterJob(Job{
+		Name:        "nodeexpiry",
+		Description: "warns of expiring nodes, removes expired nodes from peer lists and deletes them a day later",
+		Interval:    func() time.Duration { return time.Minute },
+		LeaderOnly:  true,
+		Run:         EnforceNodeExpiry,
+	})
+	RegisterJob(Job{
+		Name:        "nodestatus",
+		Description: "publishes an event for every node which went stale or offline",
+		Interval:    func() time.Duration { return 10 * time.Second },
+		LeaderOnly:  true,
+		Run:         UpdateNodeStatus,
+	})
+	RegisterJob(Job{
+		Name:        "deletednodes",
+		Description: "purges deleted nodes whose netclients never learned of the deletion",
+		Interval:    func() time.Duration { return time.Hour },
+		LeaderOnly:  true,
+		Run:         PurgeDeletedNodes,
+	})
+	RegisterJob(Job{
+		Name:        "nodechallenges",
+		Description: "removes the login challenges nodes did not answer in time",
+		Interval:    func() time.Duration { return time.Minute },
+		LeaderOnly:  true,
+		Run:         PurgeNodeChallenges,
+	})
+	RegisterJob(Job{
+		Name:        "dns",
+		Description: "regenerates the DNS config of this server in DNS mode",
+		Interval:    func() time.Duration { return 5 * time.Minute },
+		Run: func() error {
+			if !servercfg.IsDNSMode() {
+				return nil
+			}
+			return SetDNS()
+		},
+	})
+}
+
+// checkWindow - when a check last ran, state changes since are handled once by the next run
+// the time is kept in the jobs table, so changes while no server ran the check, e.g. during a restart or a change of leader, are not missed
+type checkWindow struct {
+	sync.Mutex
+	key string
+}
+
+// checkWindowRecord - the record of a check window in the jobs table
+type checkWindowRecord struct {
+	Checked int64 `json:"checked"`
+}
+
+// checkWindow.since - start of the window checked by a run, the first run ever looks back a minute
+func (window *checkWindow) since(now time.Time) time.Time {
+	var record checkWindowRecord
+	if data, err := database.FetchRecord(database.JOBS_TABLE_NAME, window.key); err == nil {
+		if err = json.Unmarshal([]byte(data), &record); err == nil && record.Checked > 0 {
+			return time.Unix(record.Checked, 0)
+		}
+	}
+	return now.Add(-time.Minute)
+}
+
+// checkWindow.checked - records that a run checked the window up to now
+func (window *checkWindow) checked(now time.Time) error {
+	data, err := json.Marshal(&checkWindowRecord{Checked: now.Unix()})
+	if err != nil {
+		return err
+	}
+	return database.Insert(window.key, string(data), database.JOBS_TABLE_NAME)
+}
+
+// inWindow - checks if a point in time falls into the window between since and now
+func inWindow(at time.Time, since time.Time, now time.Time) bool {
+	return at.After(since) && !at.After(now)
+}
+
+// nodeExpiryChecked - when EnforceNodeExpiry last ran
+var nodeExpiryChecked = checkWindow{key: "checked:nodeexpiry"}
+
+// nodeStatusChecked - when UpdateNodeStatus last ran
+var nodeStatusChecked = checkWindow{key: "checked:nodestatus"}
+
+// EnforceNodeExpiry - publishes events for nodes which expire soon or expired since the previous run, the peers of their networks are updated
+// nodes expired longer than expiredNodeRetention are deleted, their netclients learn of it on their next check in
+func EnforceNodeExpiry() error {
+	nodeExpiryChecked.Lock()
+	defer nodeExpiryChecked.Unlock()
+	var now = time.Now()
+	var since = nodeExpiryChecked.since(now)
+	nodes, err := GetAllNodes()
+	if err != nil {
+		return err
+	}
+	var expiredNetworks = make(map[string]bool)
+	var failures []string
+	for i := range nodes {
+		var node = nodes[i]
+		if node.IsServer == "yes" || node.ExpirationDateTime == 0 {
+			continue
+		}
+		var log = logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network)
+		var expiresAt = time.Unix(node.ExpirationDateTime, 0)
+		switch {
+		case !expiresAt.Add(expiredNodeRetention).After(now):
+			if err = DeleteNode(context.Background(), &node, false); err != nil {
+				failures = append(failures, node.ID+": "+err.Error())
+				continue
+			}
+			log.Log(logger.Info, "deleted expired node")
+		case inWindow(expiresAt, since, now):
+			log.Log(logger.Info, "node expired")
+			expiredNetworks[node.Network] = true
+			PublishEvent(models.Event{Type: models.EVENT_NODE_EXPIRED, Network: node.Network, Node: &node})
+		case inWindow(expiresAt.Add(-nodeExpiryWarning), since, now):
+			log.With("expires", expiresAt.Format(time.RFC3339)).Log(logger.Verbose, "node expires soon")
+			PublishEvent(models.Event{Type: models.EVENT_NODE_EXPIRING, Network: node.Network, Node: &node})
+		}
+	}
+	// expired nodes leave the peer lists when they are computed next
+	for network := range expiredNetworks {
+		if err = SetNetworkNodesLastModified(network); err != nil {
+			failures = append(failures, network+": "+err.Error())
+		}
+	}
+	if err = nodeExpiryChecked.checked(now); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return errors.New("could not enforce node expiry " + strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// PurgeDeletedNodes - removes the deleted nodes kept longer than their retention
+func PurgeDeletedNodes() error {
+	records, err := database.FetchRecords(database.DELETED_NODES_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
+	}
+	var cutoff = time.Now().Add(-deletedNodeRetention).Unix()
+	for key, value := range records {
+		var node models.Node
+		if err = json.Unmarshal([]byte(value), &node); err != nil {
+			continue
+		}
+		if node.LastModified < cutoff {
+			if err = database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
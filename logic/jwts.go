@@ -12,9 +12,10 @@ import (
 var jwtSecretKey = []byte("(BytesOverTheWire)")
 
 // CreateJWT func will used to create the JWT while signing in and signing out
-func CreateJWT(macaddress string, network string) (response string, err error) {
+func CreateJWT(uuid string, macaddress string, network string) (response string, err error) {
 	expirationTime := time.Now().Add(5 * time.Minute)
 	claims := &models.Claims{
+		ID:         uuid,
 		MacAddress: macaddress,
 		Network:    network,
 		StandardClaims: jwt.StandardClaims{
@@ -73,7 +74,7 @@ func VerifyUserToken(tokenString string) (username string, networks []string, is
 }
 
 // VerifyToken - gRPC [nodes] Only
-func VerifyToken(tokenString string) (macaddress string, network string, err error) {
+func VerifyToken(tokenString string) (nodeID string, network string, err error) {
 	claims := &models.Claims{}
 
 	//this may be a stupid way of serving up a master key
@@ -87,7 +88,7 @@ func VerifyToken(tokenString string) (macaddress string, network string, err err
 	})
 
 	if token != nil {
-		return claims.MacAddress, claims.Network, nil
+		return claims.ID, claims.Network, nil
 	}
 	return "", "", err
 }
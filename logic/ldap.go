@@ -0,0 +1,168 @@
+package logic
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const ldap_auth_key = "netmaker_ldap"
+
+// LDAPConn - the parts of an LDAP connection used to authenticate users
+type LDAPConn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// LDAPDialer - opens a connection to the LDAP server, can be replaced to use a stand-in server
+var LDAPDialer = func(serverURL string) (LDAPConn, error) {
+	return ldap.DialURL(serverURL)
+}
+
+// IsLDAPUser - checks if a user was created from an LDAP login
+func IsLDAPUser(user *models.User) bool {
+	var secret, err = getLDAPSecret()
+	if err != nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(secret)) == nil
+}
+
+// verifyLDAPAuthRequest - binds as the user, creates the user if needed and returns a user jwt
+func verifyLDAPAuthRequest(authRequest models.UserAuthParams, exists bool) (string, error) {
+	var groups, err = authenticateLDAPUser(authRequest.UserName, authRequest.Password)
+	if err != nil {
+		logger.New(logger.SERVER).With("user", authRequest.UserName).With("error", err.Error()).Log(logger.Verbose, "LDAP authentication failed")
+		return "", errors.New("incorrect credentials")
+	}
+	if !exists {
+		if err = addLDAPUser(authRequest.UserName); err != nil {
+			return "", err
+		}
+	}
+	if len(servercfg.GetGroupMappings()) > 0 {
+		var networks, isadmin = GetGroupAccess(groups)
+		if err = SetUserAccess(authRequest.UserName, networks, isadmin); err != nil {
+			return "", err
+		}
+	}
+	user, err := GetUser(authRequest.UserName)
+	if err != nil {
+		return "", err
+	}
+	tokenString, _ := CreateUserJWT(user.UserName, user.Networks, user.IsAdmin)
+	return tokenString, nil
+}
+
+// authenticateLDAPUser - looks up a user with the service account, binds as the user and returns the user's groups
+func authenticateLDAPUser(username string, password string) ([]string, error) {
+	if password == "" { // an empty password would be an anonymous bind
+		return nil, errors.New("password can't be empty")
+	}
+	var serverURL = servercfg.GetLDAPURL()
+	conn, err := LDAPDialer(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if servercfg.IsLDAPStartTLS() {
+		var host = ""
+		if parsed, err := url.Parse(serverURL); err == nil {
+			host = parsed.Hostname()
+		}
+		if err = conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return nil, err
+		}
+	}
+	if servercfg.GetLDAPBindDN() != "" {
+		if err = conn.Bind(servercfg.GetLDAPBindDN(), servercfg.GetLDAPBindPassword()); err != nil {
+			return nil, fmt.Errorf("service account bind failed: %s", err.Error())
+		}
+	}
+	var groupAttribute = servercfg.GetLDAPGroupAttribute()
+	result, err := conn.Search(ldap.NewSearchRequest(
+		servercfg.GetLDAPBaseDN(),
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(servercfg.GetLDAPUserFilter(), ldap.EscapeFilter(username)),
+		[]string{"dn", groupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("found %d entries for user", len(result.Entries))
+	}
+	var entry = result.Entries[0]
+	if err = conn.Bind(entry.DN, password); err != nil {
+		return nil, err
+	}
+	return getLDAPGroups(entry.GetAttributeValues(groupAttribute)), nil
+}
+
+// getLDAPGroups - returns each group DN along with its common name so mappings can use either
+func getLDAPGroups(values []string) []string {
+	var groups []string
+	for _, value := range values {
+		groups = append(groups, value)
+		if dn, err := ldap.ParseDN(value); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+		}
+	}
+	return groups
+}
+
+func addLDAPUser(username string) error {
+	var secret, err = getLDAPSecret()
+	if err != nil {
+		return err
+	}
+	hasAdmin, err := HasAdmin()
+	if err != nil {
+		return err
+	}
+	var newUser = models.User{
+		UserName: username,
+		Password: secret,
+	}
+	if !hasAdmin { // must be first attempt, create an admin
+		_, err = CreateAdmin(newUser)
+	} else {
+		_, err = CreateUser(newUser)
+	}
+	if err != nil {
+		logger.New(logger.SERVER).With("user", username).With("error", err.Error()).Log(logger.Verbose, "error creating user from LDAP, user not added")
+		return err
+	}
+	logger.New(logger.SERVER).With("user", username).Log(logger.Info, "user created from LDAP")
+	return nil
+}
+
+func getLDAPSecret() (string, error) {
+	type valueHolder struct {
+		Value string `json:"value" bson:"value"`
+	}
+	var data, err = json.Marshal(&valueHolder{Value: RandomString(32)})
+	if err != nil {
+		return "", err
+	}
+	record, err := FetchAuthSecret(ldap_auth_key, string(data))
+	if err != nil {
+		return "", err
+	}
+	var holder valueHolder
+	if err = json.Unmarshal([]byte(record), &holder); err != nil {
+		return "", err
+	}
+	return holder.Value, nil
+}
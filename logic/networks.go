@@ -1,15 +1,16 @@
 package logic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net"
 	"os/exec"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/validation"
@@ -57,14 +58,14 @@ func UniqueAddress(networkName string) (string, error) {
 	var network models.Network
 	network, err := GetParentNetwork(networkName)
 	if err != nil {
-		fmt.Println("UniqueAddress encountered  an error")
+		logger.New(logger.SERVER).With("network", networkName).Error("could not find a unique address", err)
 		return "666", err
 	}
 
 	offset := true
 	ip, ipnet, err := net.ParseCIDR(network.AddressRange)
 	if err != nil {
-		fmt.Println("UniqueAddress encountered  an error")
+		logger.New(logger.SERVER).With("network", networkName).Error("could not find a unique address", err)
 		return "666", err
 	}
 	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); Inc(ip) {
@@ -123,7 +124,7 @@ func UniqueAddress6(networkName string) (string, error) {
 	var network models.Network
 	network, err := GetParentNetwork(networkName)
 	if err != nil {
-		fmt.Println("Network Not Found")
+		logger.New(logger.SERVER).With("network", networkName).Error("network not found", err)
 		return "", err
 	}
 	if network.IsDualStack == "no" {
@@ -133,7 +134,7 @@ func UniqueAddress6(networkName string) (string, error) {
 	offset := true
 	ip, ipnet, err := net.ParseCIDR(network.AddressRange6)
 	if err != nil {
-		fmt.Println("UniqueAddress6 encountered  an error")
+		logger.New(logger.SERVER).With("network", networkName).Error("could not find a unique ipv6 address", err)
 		return "666", err
 	}
 	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); Inc(ip) {
@@ -221,28 +222,28 @@ func UpdateNetworkLocalAddresses(networkName string) error {
 
 		err := json.Unmarshal([]byte(value), &node)
 		if err != nil {
-			fmt.Println("error in node address assignment!")
+			logger.New(logger.SERVER).With("network", networkName).Error("error in node address assignment", err)
 			return err
 		}
 		if node.Network == networkName {
 			ipaddr, iperr := UniqueAddress(networkName)
 			if iperr != nil {
-				fmt.Println("error in node  address assignment!")
+				logger.New(logger.SERVER).With("network", networkName).With("node", node.ID).Error("error in node address assignment", iperr)
 				return iperr
 			}
 
 			node.Address = ipaddr
+			node.SetLastPeerUpdate()
 			newNodeData, err := json.Marshal(&node)
 			if err != nil {
-				fmt.Println("error in node  address assignment!")
+				logger.New(logger.SERVER).With("network", networkName).With("node", node.ID).Error("error in node address assignment", err)
 				return err
 			}
-			node.SetID()
 			database.Insert(node.ID, string(newNodeData), database.NODES_TABLE_NAME)
 		}
 	}
 
-	return nil
+	return SetNetworkNodesLastModified(networkName)
 }
 
 // UpdateNetworkNodeAddresses - updates network node addresses
@@ -258,28 +259,28 @@ func UpdateNetworkNodeAddresses(networkName string) error {
 		var node models.Node
 		err := json.Unmarshal([]byte(value), &node)
 		if err != nil {
-			fmt.Println("error in node address assignment!")
+			logger.New(logger.SERVER).With("network", networkName).Error("error in node address assignment", err)
 			return err
 		}
 		if node.Network == networkName {
 			ipaddr, iperr := UniqueAddress(networkName)
 			if iperr != nil {
-				fmt.Println("error in node  address assignment!")
+				logger.New(logger.SERVER).With("network", networkName).With("node", node.ID).Error("error in node address assignment", iperr)
 				return iperr
 			}
 
 			node.Address = ipaddr
+			node.SetLastPeerUpdate()
 			node.PullChanges = "yes"
 			data, err := json.Marshal(&node)
 			if err != nil {
 				return err
 			}
-			node.SetID()
 			database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
 		}
 	}
 
-	return nil
+	return SetNetworkNodesLastModified(networkName)
 }
 
 // IsNetworkDisplayNameUnique - checks if displayname is unique from other networks
@@ -330,6 +331,7 @@ func UpdateNetwork(currentNetwork *models.Network, newNetwork *models.Network) (
 		return false, false, err
 	}
 	if newNetwork.NetID == currentNetwork.NetID {
+		newNetwork.Tenant = currentNetwork.Tenant // moved between tenants with SetNetworkTenant only
 		hasrangeupdate := newNetwork.AddressRange != currentNetwork.AddressRange
 		localrangeupdate := newNetwork.LocalRange != currentNetwork.LocalRange
 		data, err := json.Marshal(newNetwork)
@@ -337,8 +339,10 @@ func UpdateNetwork(currentNetwork *models.Network, newNetwork *models.Network) (
 			return false, false, err
 		}
 		newNetwork.SetNetworkLastModified()
-		err = database.Insert(newNetwork.NetID, string(data), database.NETWORKS_TABLE_NAME)
-		return hasrangeupdate, localrangeupdate, err
+		if err = database.Insert(newNetwork.NetID, string(data), database.NETWORKS_TABLE_NAME); err != nil {
+			return false, false, err
+		}
+		return hasrangeupdate, localrangeupdate, PublishEvent(models.Event{Type: models.EVENT_PEERS_CHANGED, Network: newNetwork.NetID})
 	}
 	// copy values
 	return false, false, errors.New("failed to update network " + newNetwork.NetID + ", cannot change netid.")
@@ -407,13 +411,61 @@ func ValidateNetwork(network *models.Network, isUpdate bool) error {
 	err := v.Struct(network)
 	if err != nil {
 		for _, e := range err.(validator.ValidationErrors) {
-			fmt.Println(e)
+			logger.New(logger.SERVER).With("network", network.NetID).Log(logger.Info, e.Error())
 		}
 	}
 
 	return err
 }
 
+// DeleteNetwork - deletes a network once only server nodes are left in it
+func DeleteNetwork(network string) error {
+	nodeCount, err := GetNetworkNonServerNodeCount(network)
+	if nodeCount == 0 || database.IsEmptyRecord(err) {
+		// delete server nodes first then db records
+		servers, err := GetSortedNetworkServerNodes(network)
+		if err == nil {
+			for _, s := range servers {
+				var log = logger.New(logger.SERVER).With("network", network).With("node", s.ID)
+				if err = DeleteNode(context.Background(), &s, true); err != nil {
+					log.With("error", err.Error()).Log(logger.Debug, "could not remove server before deleting network")
+				} else {
+					log.Log(logger.Debug, "removed server before deleting network")
+				}
+			}
+		} else {
+			logger.New(logger.SERVER).With("network", network).With("error", err.Error()).Log(logger.Verbose, "could not remove servers before deleting network")
+		}
+		if err = database.DeleteRecord(database.NETWORKS_TABLE_NAME, network); err != nil {
+			return err
+		}
+		return PublishEvent(models.Event{Type: models.EVENT_PEERS_CHANGED, Network: network})
+	}
+	return errors.New("node check failed. All nodes must be deleted before deleting network")
+}
+
+// GetNetworkNonServerNodeCount - get number of network non server nodes
+func GetNetworkNonServerNodeCount(networkName string) (int, error) {
+
+	collection, err := database.FetchRecords(database.NODES_TABLE_NAME)
+	count := 0
+	if err != nil && !database.IsEmptyRecord(err) {
+		return count, err
+	}
+	for _, value := range collection {
+		var node models.Node
+		if err = json.Unmarshal([]byte(value), &node); err != nil {
+			return count, err
+		} else {
+			if node.Network == networkName && node.IsServer != "yes" {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
+
 // == Private ==
 
 func deleteInterface(ifacename string, postdown string) error {
@@ -424,7 +476,7 @@ func deleteInterface(ifacename string, postdown string) error {
 		ipExec, errN := exec.LookPath("ip")
 		err = errN
 		if err != nil {
-			Log(err.Error(), 1)
+			logger.New(logger.SERVER).With("interface", ifacename).With("error", err.Error()).Log(logger.Verbose, "could not find ip command")
 		}
 		_, err = ncutils.RunCmd(ipExec+" link del "+ifacename, false)
 		if postdown != "" {
@@ -440,7 +492,7 @@ func isInterfacePresent(iface string, address string) (string, bool) {
 	var err error
 	interfaces, err = net.Interfaces()
 	if err != nil {
-		Log("ERROR: could not read interfaces", 0)
+		logger.New(logger.SERVER).Error("could not read interfaces", err)
 		return "", true
 	}
 	for _, currIface := range interfaces {
@@ -451,11 +503,11 @@ func isInterfacePresent(iface string, address string) (string, bool) {
 		}
 		for _, addr := range currAddrs {
 			if strings.Contains(addr.String(), address) && currIface.Name != iface {
-				Log("found iface "+addr.String()+" "+currIface.Name, 2)
+				logger.New(logger.SERVER).With("interface", currIface.Name).With("address", addr.String()).Log(logger.Debug, "found interface")
 				return currIface.Name, false
 			}
 		}
 	}
-	Log("failed to find iface "+iface, 2)
+	logger.New(logger.SERVER).With("interface", iface).Log(logger.Debug, "failed to find interface")
 	return "", true
 }
@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long a node has to answer a challenge
+const node_challenge_seconds = 60
+
+// challenges a node may request per minute, anyone can request challenges for a node
+var nodeChallengeLimiter = NewRateLimiter(10, time.Minute)
+
+// nodeChallenge - a pending login challenge, keyed by its nonce
+type nodeChallenge struct {
+	Network string `json:"network" bson:"network"`
+	NodeID  string `json:"nodeid" bson:"nodeid"`
+	Expiry  int64  `json:"expiry" bson:"expiry"`
+}
+
+// CreateNodeChallenge - issues a single use nonce to a node with an identity key
+func CreateNodeChallenge(network string, authParams *models.AuthParams) (string, error) {
+	node, err := getAuthNode(network, authParams)
+	if err != nil {
+		return "", errors.New("node does not exist")
+	}
+	if node.IdentityKey == "" {
+		return "", errors.New("node " + node.ID + " has no identity key")
+	}
+	if !nodeChallengeLimiter.Allow(node.ID) {
+		return "", errors.New("too many challenges requested for node " + node.ID + ", try again later")
+	}
+	var random = make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return "", err
+	}
+	var nonce = base64.RawURLEncoding.EncodeToString(random)
+	data, err := json.Marshal(&nodeChallenge{
+		Network: network,
+		NodeID:  node.ID,
+		Expiry:  time.Now().Unix() + node_challenge_seconds,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err = database.Insert(nonce, string(data), database.NODE_CHALLENGES_TABLE_NAME); err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// VerifyNodeAuth - checks the credentials of a node, nodes with an identity key must sign a challenge
+func VerifyNodeAuth(network string, authParams *models.AuthParams) (models.Node, error) {
+	node, err := getAuthNode(network, authParams)
+	if err != nil {
+		return models.Node{}, errors.New("node does not exist")
+	}
+	if node.IdentityKey != "" {
+		return node, verifyNodeChallenge(&node, authParams.Nonce, authParams.Signature)
+	}
+	if authParams.Signature != "" {
+		return node, errors.New("node " + node.ID + " has no identity key")
+	}
+	if authParams.Password == "" {
+		return node, errors.New("missing password")
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(node.Password), []byte(authParams.Password)); err != nil {
+		return node, errors.New("incorrect credentials")
+	}
+	return node, nil
+}
+
+// PurgeNodeChallenges - removes the challenges nodes did not answer in time
+func PurgeNodeChallenges() error {
+	records, err := database.FetchRecords(database.NODE_CHALLENGES_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
+	}
+	var now = time.Now().Unix()
+	for key, record := range records {
+		var challenge nodeChallenge
+		if err = json.Unmarshal([]byte(record), &challenge); err != nil || now > challenge.Expiry {
+			if err = database.DeleteRecord(database.NODE_CHALLENGES_TABLE_NAME, key); err != nil {
+				logger.New(logger.SERVER).With("challenge", key).With("error", err.Error()).Log(logger.Debug, "could not remove expired node challenge")
+			}
+		}
+	}
+	return nil
+}
+
+// == private methods ==
+
+// older clients do not know their id yet and log in with their mac address
+func getAuthNode(network string, authParams *models.AuthParams) (models.Node, error) {
+	if authParams.ID != "" {
+		node, err := GetNodeByID(authParams.ID)
+		if err == nil && node.Network != network {
+			return models.Node{}, errors.New("node does not exist")
+		}
+		return node, err
+	}
+	return GetNodeByMacAddress(network, authParams.MacAddress)
+}
+
+func verifyNodeChallenge(node *models.Node, nonce string, signature string) error {
+	if nonce == "" || signature == "" {
+		return errors.New("node " + node.ID + " must authenticate with its identity key")
+	}
+	record, err := database.FetchRecord(database.NODE_CHALLENGES_TABLE_NAME, nonce)
+	if err != nil {
+		return errors.New("invalid challenge")
+	}
+	if err = database.DeleteRecord(database.NODE_CHALLENGES_TABLE_NAME, nonce); err != nil {
+		return err
+	}
+	var challenge nodeChallenge
+	if err = json.Unmarshal([]byte(record), &challenge); err != nil {
+		return errors.New("invalid challenge")
+	}
+	if challenge.Network != node.Network || challenge.NodeID != node.ID {
+		return errors.New("invalid challenge")
+	}
+	if time.Now().Unix() > challenge.Expiry {
+		return errors.New("expired challenge")
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(node.IdentityKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid identity key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	if !ed25519.Verify(publicKey, models.NodeChallengeMessage(node.Network, node.ID, nonce), sig) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -1,14 +1,17 @@
 package logic
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/validation"
 )
@@ -79,11 +82,55 @@ func GetPeers(node models.Node) ([]models.Node, error) {
 	return peers, nil
 }
 
+// GetPeersRevision - gets the revision of a peer list, later changes have a later LastPeerUpdate or NodesLastModified
+// the current second is left out as changes may still be written during it
+func GetPeersRevision(network *models.Network, peers []models.Node) int64 {
+	var revision = network.NodesLastModified
+	for i := range peers {
+		if peers[i].LastPeerUpdate > revision {
+			revision = peers[i].LastPeerUpdate
+		}
+	}
+	if latest := time.Now().Unix() - 1; revision > latest {
+		revision = latest
+	}
+	return revision
+}
+
+// GetChangedPeers - gets the peers added or changed and the public keys of the peers removed after a revision of the peer list of a node
+// records the list sent for the current revision, returns false when the revision is unknown, so the full list is needed
+func GetChangedPeers(node *models.Node, network *models.Network, peers []models.Node, revision int64) ([]models.Node, []string, bool) {
+	var current = GetPeersRevision(network, peers)
+	var hashes = hashPeers(peers)
+	defer recordPeerSnapshot(node.ID, current, hashes)
+	if revision <= 0 || revision > current {
+		return nil, nil, false
+	}
+	previous, ok := getPeerSnapshot(node.ID, revision)
+	if !ok {
+		return nil, nil, false
+	}
+	var changed []models.Node
+	for i := range peers {
+		if hash, ok := previous[peers[i].PublicKey]; !ok || hash != hashes[peers[i].PublicKey] {
+			changed = append(changed, peers[i])
+		}
+	}
+	var removed []string
+	for publicKey := range previous {
+		if _, ok := hashes[publicKey]; !ok {
+			removed = append(removed, publicKey)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed, true
+}
+
 // IsLeader - determines if a given server node is a leader
 func IsLeader(node *models.Node) bool {
 	nodes, err := GetSortedNetworkServerNodes(node.Network)
 	if err != nil {
-		Log("ERROR: COULD NOT RETRIEVE SERVER NODES. THIS WILL BREAK HOLE PUNCHING.", 0)
+		logger.New(logger.SERVER).With("network", node.Network).Error("could not retrieve server nodes, this will break hole punching", err)
 		return false
 	}
 	for _, n := range nodes {
@@ -96,38 +143,88 @@ func IsLeader(node *models.Node) bool {
 
 // == DB related functions ==
 
-// UpdateNode - takes a node and updates another node with it's values
-func UpdateNode(currentNode *models.Node, newNode *models.Node) error {
+// UpdateNode - takes a node and updates another node with it's values, ctx carries the id of the request logged with the update
+func UpdateNode(ctx context.Context, currentNode *models.Node, newNode *models.Node) error {
 	newNode.Fill(currentNode)
 	if err := ValidateNode(newNode, true); err != nil {
 		return err
 	}
-	newNode.SetID()
+	if err := syncNodeHost(newNode); err != nil {
+		RequestLogger(ctx, logger.SERVER).With("node", newNode.ID).With("network", newNode.Network).With("host", newNode.HostID).With("error", err.Error()).
+			Log(logger.Verbose, "could not update host of node")
+	}
 	if newNode.ID == currentNode.ID {
 		newNode.SetLastModified()
-		if data, err := json.Marshal(newNode); err != nil {
+		newNode.LastPeerUpdate = currentNode.LastPeerUpdate
+		var peerChanged = peerSettingsChanged(currentNode, newNode)
+		if peerChanged {
+			newNode.SetLastPeerUpdate()
+		}
+		newNode.Status = ""
+		data, err := json.Marshal(newNode)
+		if err != nil {
+			return err
+		}
+		if err = database.Insert(newNode.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+			return err
+		}
+		if peerListChanged(currentNode, newNode) {
+			// nodes joining or leaving the peer lists of others need a full peer list
+			if err = SetNetworkNodesLastModified(newNode.Network); err != nil {
+				return err
+			}
+		}
+		if err = PublishEvent(models.Event{Type: models.EVENT_NODE_UPDATED, Network: newNode.Network, Node: newNode, Previous: currentNode, RequestID: GetRequestID(ctx)}); err != nil {
 			return err
-		} else {
-			return database.Insert(newNode.ID, string(data), database.NODES_TABLE_NAME)
 		}
+		return nodeStatusChanged(ctx, currentNode, newNode)
 	}
-	return fmt.Errorf("failed to update node " + newNode.MacAddress + ", cannot change macaddress.")
+	return fmt.Errorf("failed to update node " + currentNode.ID + ", cannot change node id.")
+}
+
+// peerSettingsChanged - checks if an update changes how a node appears in the peer lists of other nodes
+func peerSettingsChanged(currentNode *models.Node, newNode *models.Node) bool {
+	return currentNode.PublicKey != newNode.PublicKey ||
+		currentNode.Endpoint != newNode.Endpoint ||
+		currentNode.Name != newNode.Name ||
+		currentNode.Address != newNode.Address ||
+		currentNode.Address6 != newNode.Address6 ||
+		currentNode.LocalAddress != newNode.LocalAddress ||
+		currentNode.ListenPort != newNode.ListenPort ||
+		currentNode.PersistentKeepalive != newNode.PersistentKeepalive ||
+		currentNode.UDPHolePunch != newNode.UDPHolePunch ||
+		currentNode.IsServer != newNode.IsServer ||
+		currentNode.IsEgressGateway != newNode.IsEgressGateway ||
+		currentNode.IsIngressGateway != newNode.IsIngressGateway ||
+		!stringSlicesEqual(currentNode.AllowedIPs, newNode.AllowedIPs) ||
+		!stringSlicesEqual(currentNode.EgressGatewayRanges, newNode.EgressGatewayRanges) ||
+		peerListChanged(currentNode, newNode)
+}
+
+// peerListChanged - checks if an update adds a node to or removes it from the peer lists of other nodes
+// peers are identified by their public key, so a new key replaces the node in the peer lists
+func peerListChanged(currentNode *models.Node, newNode *models.Node) bool {
+	return currentNode.PublicKey != newNode.PublicKey ||
+		excludedFromPeers(currentNode) != excludedFromPeers(newNode) ||
+		currentNode.IsRelayed != newNode.IsRelayed ||
+		currentNode.IsRelay != newNode.IsRelay ||
+		!stringSlicesEqual(currentNode.RelayAddrs, newNode.RelayAddrs)
 }
 
-func IsNodeIDUnique(node *models.Node) (bool, error) {
-	_, err := database.FetchRecord(database.NODES_TABLE_NAME, node.ID)
-	return database.IsEmptyRecord(err), err
+func stringSlicesEqual(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func ValidateNode(node *models.Node, isUpdate bool) error {
 	v := validator.New()
-	_ = v.RegisterValidation("macaddress_unique", func(fl validator.FieldLevel) bool {
-		if isUpdate {
-			return true
-		}
-		isFieldUnique, _ := IsNodeIDUnique(node)
-		return isFieldUnique
-	})
 	_ = v.RegisterValidation("network_exists", func(fl validator.FieldLevel) bool {
 		_, err := GetNetworkByNode(node)
 		return err == nil
@@ -179,7 +276,7 @@ func CheckIsServer(node *models.Node) bool {
 		if err := json.Unmarshal([]byte(value), &tmpNode); err != nil {
 			continue
 		}
-		if tmpNode.Network == node.Network && tmpNode.MacAddress != node.MacAddress {
+		if tmpNode.Network == node.Network && tmpNode.ID != node.ID {
 			return false
 		}
 	}
@@ -200,13 +297,29 @@ func GetNetworkByNode(node *models.Node) (models.Network, error) {
 	return network, nil
 }
 
+// getNodeLifetime - seconds a node may stay in its network after joining
+// the access key it joined with takes precedence over the network default, server nodes do not expire
+func getNodeLifetime(node *models.Node, network *models.Network) int64 {
+	if node.IsServer != "yes" {
+		if key, ok := getAccessKey(network, node.AccessKey); ok && key.NodeExpiry > 0 {
+			return key.NodeExpiry
+		}
+		if network.DefaultNodeExpiry > 0 {
+			return network.DefaultNodeExpiry
+		}
+	}
+	return models.TEN_YEARS_IN_SECONDS
+}
+
 // SetNodeDefaults - sets the defaults of a node to avoid empty fields
 func SetNodeDefaults(node *models.Node) {
 
 	//TODO: Maybe I should make Network a part of the node struct. Then we can just query the Network object for stuff.
 	parentNetwork, _ := GetNetworkByNode(node)
 
-	node.ExpirationDateTime = time.Now().Unix() + models.TEN_YEARS_IN_SECONDS
+	if node.ExpirationDateTime == 0 {
+		node.ExpirationDateTime = time.Now().Unix() + getNodeLifetime(node, &parentNetwork)
+	}
 
 	if node.ListenPort == 0 {
 		node.ListenPort = parentNetwork.DefaultListenPort
@@ -251,12 +364,15 @@ func SetNodeDefaults(node *models.Node) {
 	node.SetIsDualStackDefault()
 	node.SetLastModified()
 	node.SetDefaultName()
-	node.SetLastCheckIn()
-	node.SetLastPeerUpdate()
+	if node.LastCheckIn == 0 {
+		node.SetLastCheckIn()
+	}
+	if node.LastPeerUpdate == 0 {
+		node.SetLastPeerUpdate()
+	}
 	node.SetRoamingDefault()
 	node.SetPullChangesDefault()
 	node.SetDefaultAction()
-	node.SetID()
 	node.SetIsServerDefault()
 	node.SetIsStaticDefault()
 	node.SetDefaultEgressGateway()
@@ -276,54 +392,68 @@ func GetRecordKey(id string, network string) (string, error) {
 	return id + "###" + network, nil
 }
 
-// GetNodeByMacAddress - gets a node by mac address
-func GetNodeByMacAddress(network string, macaddress string) (models.Node, error) {
-
+// GetNodeByID - gets a node by its server assigned id
+func GetNodeByID(uuid string) (models.Node, error) {
 	var node models.Node
-
-	key, err := GetRecordKey(macaddress, network)
-	if err != nil {
-		return node, err
+	if uuid == "" {
+		return node, errors.New("unable to get record key")
 	}
-
-	record, err := database.FetchRecord(database.NODES_TABLE_NAME, key)
+	record, err := database.FetchRecord(database.NODES_TABLE_NAME, uuid)
 	if err != nil {
 		return models.Node{}, err
 	}
-
 	if err = json.Unmarshal([]byte(record), &node); err != nil {
 		return models.Node{}, err
 	}
-
 	SetNodeDefaults(&node)
-
 	return node, nil
 }
 
-// GetDeletedNodeByMacAddress - get a deleted node
-func GetDeletedNodeByMacAddress(network string, macaddress string) (models.Node, error) {
-
-	var node models.Node
-
-	key, err := GetRecordKey(macaddress, network)
+// GetNetworkNode - gets a node by its id, making sure it belongs to the given network
+func GetNetworkNode(network string, nodeid string) (models.Node, error) {
+	node, err := GetNodeByID(nodeid)
 	if err != nil {
-		return node, err
+		return models.Node{}, err
+	}
+	if node.Network != network {
+		return models.Node{}, errors.New("node " + nodeid + " does not belong to network " + network)
 	}
+	return node, nil
+}
 
-	record, err := database.FetchRecord(database.DELETED_NODES_TABLE_NAME, key)
+// GetDeletedNodeByID - get a deleted node by its server assigned id
+func GetDeletedNodeByID(uuid string) (models.Node, error) {
+	var node models.Node
+	if uuid == "" {
+		return node, errors.New("unable to get record key")
+	}
+	record, err := database.FetchRecord(database.DELETED_NODES_TABLE_NAME, uuid)
 	if err != nil {
 		return models.Node{}, err
 	}
-
 	if err = json.Unmarshal([]byte(record), &node); err != nil {
 		return models.Node{}, err
 	}
-
 	SetNodeDefaults(&node)
-
 	return node, nil
 }
 
+// GetNodeByMacAddress - gets the first node of a network with a given mac address
+// mac addresses are not unique, only use this to resolve nodes of older clients
+func GetNodeByMacAddress(network string, macaddress string) (models.Node, error) {
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return models.Node{}, err
+	}
+	for _, node := range nodes {
+		if node.MacAddress == macaddress {
+			SetNodeDefaults(&node)
+			return node, nil
+		}
+	}
+	return models.Node{}, errors.New("no node with mac address " + macaddress + " on network " + network)
+}
+
 // GetNodeRelay - gets the relay node of a given network
 func GetNodeRelay(network string, relayedNodeAddr string) (models.Node, error) {
 	collection, err := database.FetchRecords(database.NODES_TABLE_NAME)
@@ -332,13 +462,13 @@ func GetNodeRelay(network string, relayedNodeAddr string) (models.Node, error) {
 		if database.IsEmptyRecord(err) {
 			return relay, nil
 		}
-		Log(err.Error(), 2)
+		logger.New(logger.SERVER).With("network", network).With("error", err.Error()).Log(logger.Debug, "could not fetch nodes")
 		return relay, err
 	}
 	for _, value := range collection {
 		err := json.Unmarshal([]byte(value), &relay)
 		if err != nil {
-			Log(err.Error(), 2)
+			logger.New(logger.SERVER).With("network", network).With("error", err.Error()).Log(logger.Debug, "could not parse node")
 			continue
 		}
 		if relay.IsRelay == "yes" {
@@ -351,3 +481,75 @@ func GetNodeRelay(network string, relayedNodeAddr string) (models.Node, error) {
 	}
 	return relay, errors.New("could not find relay for node " + relayedNodeAddr)
 }
+
+// MigrateNodeIDs - moves node records keyed by mac address and network to server assigned ids
+func MigrateNodeIDs() error {
+	var migrated = make(map[string]string) // legacy id -> server assigned id
+	for _, table := range []string{database.NODES_TABLE_NAME, database.DELETED_NODES_TABLE_NAME} {
+		records, err := database.FetchRecords(table)
+		if err != nil {
+			if database.IsEmptyRecord(err) {
+				continue
+			}
+			return err
+		}
+		for key, value := range records {
+			if !strings.Contains(key, "###") {
+				continue
+			}
+			var node models.Node
+			if err = json.Unmarshal([]byte(value), &node); err != nil {
+				logger.New(logger.SERVER).With("node", key).With("error", err.Error()).Log(logger.Verbose, "could not migrate node")
+				continue
+			}
+			node.ID = migrated[key]
+			node.SetID()
+			data, err := json.Marshal(&node)
+			if err != nil {
+				return err
+			}
+			if err = database.Insert(node.ID, string(data), table); err != nil {
+				return err
+			}
+			if err = database.DeleteRecord(table, key); err != nil {
+				return err
+			}
+			migrated[key] = node.ID
+			// server nodes keep their WireGuard private key under the node id
+			if privateKey, err := FetchPrivKey(key); err == nil {
+				if err = StorePrivKey(node.ID, privateKey); err != nil {
+					return err
+				}
+				if err = RemovePrivKey(key); err != nil {
+					logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network).With("error", err.Error()).
+						Log(logger.Verbose, "could not remove private key stored under the old id")
+				}
+			}
+		}
+	}
+	if len(migrated) == 0 {
+		return nil
+	}
+	records, err := database.FetchRecords(database.EXT_CLIENT_TABLE_NAME)
+	if err != nil && !database.IsEmptyRecord(err) {
+		return err
+	}
+	for key, value := range records {
+		var extClient models.ExtClient
+		if err = json.Unmarshal([]byte(value), &extClient); err != nil {
+			continue
+		}
+		if id, ok := migrated[extClient.IngressGatewayID+"###"+extClient.Network]; ok {
+			extClient.IngressGatewayID = id
+			data, err := json.Marshal(&extClient)
+			if err != nil {
+				return err
+			}
+			if err = database.Insert(key, string(data), database.EXT_CLIENT_TABLE_NAME); err != nil {
+				return err
+			}
+		}
+	}
+	logger.New(logger.SERVER).With("nodes", len(migrated)).Log(logger.Info, "migrated nodes to server assigned ids")
+	return nil
+}
@@ -0,0 +1,152 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// staleCheckins - how many check ins a node may miss before it is stale
+const staleCheckins = 3
+
+// offlineCheckins - how many check ins a node may miss before it is offline
+const offlineCheckins = 20
+
+// checkinInterval - how often a node checks in, server nodes check in at the server checkin interval
+func checkinInterval(node *models.Node) time.Duration {
+	if node.IsServer == "yes" {
+		return time.Duration(servercfg.GetServerCheckinInterval()) * time.Second
+	}
+	seconds, err := strconv.Atoi(servercfg.GetCheckinInterval())
+	if err != nil || seconds < 1 {
+		seconds = 15
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// StaleAfter - how long after its last check in a node is stale
+func StaleAfter(node *models.Node) time.Duration {
+	return staleCheckins * checkinInterval(node)
+}
+
+// OfflineAfter - how long after its last check in a node is offline
+func OfflineAfter(node *models.Node) time.Duration {
+	return offlineCheckins * checkinInterval(node)
+}
+
+// GetNodeStatus - gets the status of a node, pending and expired take precedence over its check ins
+func GetNodeStatus(node *models.Node) string {
+	switch {
+	case node.IsPending == "yes":
+		return models.NODE_STATUS_PENDING
+	case node.IsExpired():
+		return models.NODE_STATUS_EXPIRED
+	}
+	var lastCheckIn = time.Unix(node.LastCheckIn, 0)
+	switch {
+	case time.Since(lastCheckIn) >= OfflineAfter(node):
+		return models.NODE_STATUS_OFFLINE
+	case time.Since(lastCheckIn) >= StaleAfter(node):
+		return models.NODE_STATUS_STALE
+	}
+	return models.NODE_STATUS_ONLINE
+}
+
+// SetNodesStatus - sets the status of nodes for a response
+func SetNodesStatus(nodes []models.Node) {
+	for i := range nodes {
+		nodes[i].Status = GetNodeStatus(&nodes[i])
+	}
+}
+
+// IsValidNodeStatus - checks if a status is one nodes can have
+func IsValidNodeStatus(status string) bool {
+	switch status {
+	case models.NODE_STATUS_ONLINE, models.NODE_STATUS_STALE, models.NODE_STATUS_OFFLINE, models.NODE_STATUS_PENDING, models.NODE_STATUS_EXPIRED:
+		return true
+	}
+	return false
+}
+
+// excludedFromPeers - checks if a node is left out of the peer lists of its network
+// offline nodes are left out only with EXCLUDE_OFFLINE_PEERS, server nodes never
+func excludedFromPeers(node *models.Node) bool {
+	switch GetNodeStatus(node) {
+	case models.NODE_STATUS_PENDING, models.NODE_STATUS_EXPIRED:
+		return true
+	case models.NODE_STATUS_OFFLINE:
+		return node.IsServer != "yes" && servercfg.IsExcludeOfflinePeers()
+	}
+	return false
+}
+
+// nodeStatusChanged - publishes EVENT_NODE_STATUS_CHANGED if an update changes the status of a node
+func nodeStatusChanged(ctx context.Context, currentNode *models.Node, newNode *models.Node) error {
+	var before, after = *currentNode, *newNode
+	before.Status, after.Status = GetNodeStatus(currentNode), GetNodeStatus(newNode)
+	if before.Status == after.Status {
+		return nil
+	}
+	return publishNodeStatus(ctx, &before, &after)
+}
+
+// publishNodeStatus - publishes EVENT_NODE_STATUS_CHANGED for nodes carrying their previous and new status
+func publishNodeStatus(ctx context.Context, previous *models.Node, node *models.Node) error {
+	RequestLogger(ctx, logger.SERVER).With("node", node.ID).With("network", node.Network).With("previous", previous.Status).
+		Log(logger.Verbose, "node is "+node.Status)
+	return PublishEvent(models.Event{Type: models.EVENT_NODE_STATUS_CHANGED, Network: node.Network, Node: node, Previous: previous, RequestID: GetRequestID(ctx)})
+}
+
+// UpdateNodeStatus - publishes EVENT_NODE_STATUS_CHANGED once for every node which went stale or offline since the previous run
+// nodes going online are published when they check in, networks with nodes going offline get new peer lists with EXCLUDE_OFFLINE_PEERS
+func UpdateNodeStatus() error {
+	nodeStatusChecked.Lock()
+	defer nodeStatusChecked.Unlock()
+	var now = time.Now()
+	var since = nodeStatusChecked.since(now)
+	nodes, err := GetAllNodes()
+	if err != nil {
+		return err
+	}
+	var offlineNetworks = make(map[string]bool)
+	for i := range nodes {
+		var node = nodes[i]
+		if node.IsPending == "yes" || node.IsExpired() || node.LastCheckIn == 0 {
+			continue
+		}
+		var lastCheckIn = time.Unix(node.LastCheckIn, 0)
+		var previous = node
+		switch {
+		case inWindow(lastCheckIn.Add(OfflineAfter(&node)), since, now):
+			previous.Status, node.Status = models.NODE_STATUS_STALE, models.NODE_STATUS_OFFLINE
+			offlineNetworks[node.Network] = true
+		case inWindow(lastCheckIn.Add(StaleAfter(&node)), since, now):
+			previous.Status, node.Status = models.NODE_STATUS_ONLINE, models.NODE_STATUS_STALE
+		default:
+			continue
+		}
+		// failing subscribers are logged by the event bus, the node is not published again
+		publishNodeStatus(context.Background(), &previous, &node)
+	}
+	var failures []string
+	if servercfg.IsExcludeOfflinePeers() {
+		for network := range offlineNetworks {
+			if err = SetNetworkNodesLastModified(network); err != nil {
+				failures = append(failures, network+": "+err.Error())
+			}
+		}
+	}
+	if err = nodeStatusChecked.checked(now); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return errors.New("could not update the peers of offline nodes " + strings.Join(failures, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package logic
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/models"
+)
+
+// peerCacheTTL - how long a computed peer list is served, bounds how late writes of other server instances are seen
+const peerCacheTTL = 10 * time.Second
+
+// peerSnapshotTTL - how long the peer list sent to a node is kept for delta requests
+const peerSnapshotTTL = 10 * time.Minute
+
+// peerSnapshotsKept - how many revisions of the peer list sent to a node are kept
+const peerSnapshotsKept = 4
+
+// peerCacheKey - identifies a variant of the peer list of a network
+type peerCacheKey struct {
+	network         string
+	excludeRelayed  bool
+	relayedNodeAddr string
+}
+
+// peerCacheEntry - a computed peer list and the network state it was computed for
+type peerCacheEntry struct {
+	peers             []models.Node
+	nodesLastModified int64
+	computed          time.Time
+}
+
+// peerCache - computed peer lists, generations count the invalidations of each network
+var peerCache = struct {
+	sync.Mutex
+	entries     map[peerCacheKey]peerCacheEntry
+	generations map[string]uint64
+}{
+	entries:     make(map[peerCacheKey]peerCacheEntry),
+	generations: make(map[string]uint64),
+}
+
+// peerSnapshot - the peers sent to a node for a revision, by public key with a hash of their settings
+// a revision is ambiguous when differing peer lists were sent for it
+type peerSnapshot struct {
+	revision  int64
+	peers     map[string]uint64
+	ambiguous bool
+	recorded  time.Time
+}
+
+// peerSnapshots - the latest peer lists sent to each node
+var peerSnapshots = struct {
+	sync.Mutex
+	nodes  map[string][]peerSnapshot
+	pruned time.Time
+}{
+	nodes: make(map[string][]peerSnapshot),
+}
+
+// getCachedPeers - gets a cached peer list, if it is still valid for the network state
+func getCachedPeers(key peerCacheKey, nodesLastModified int64) ([]models.Node, bool) {
+	peerCache.Lock()
+	defer peerCache.Unlock()
+	entry, ok := peerCache.entries[key]
+	if !ok || entry.nodesLastModified != nodesLastModified || time.Since(entry.computed) > peerCacheTTL {
+		return nil, false
+	}
+	return copyPeers(entry.peers), true
+}
+
+// getPeerCacheGeneration - gets the generation of a network before computing its peers
+func getPeerCacheGeneration(network string) uint64 {
+	peerCache.Lock()
+	defer peerCache.Unlock()
+	return peerCache.generations[network]
+}
+
+// storeCachedPeers - caches a peer list unless the network was invalidated while it was computed
+func storeCachedPeers(key peerCacheKey, generation uint64, nodesLastModified int64, peers []models.Node) {
+	peerCache.Lock()
+	defer peerCache.Unlock()
+	if peerCache.generations[key.network] != generation {
+		return
+	}
+	peerCache.entries[key] = peerCacheEntry{
+		peers:             copyPeers(peers),
+		nodesLastModified: nodesLastModified,
+		computed:          time.Now(),
+	}
+}
+
+// invalidatePeerCache - drops the cached peer lists of a network
+func invalidatePeerCache(network string) {
+	peerCache.Lock()
+	defer peerCache.Unlock()
+	peerCache.generations[network]++
+	for key := range peerCache.entries {
+		if key.network == network {
+			delete(peerCache.entries, key)
+		}
+	}
+}
+
+// copyPeers - copies a peer list so callers can not change cached lists, the slices of the peers included
+func copyPeers(peers []models.Node) []models.Node {
+	if peers == nil {
+		return nil
+	}
+	var copied = make([]models.Node, len(peers))
+	copy(copied, peers)
+	for i := range copied {
+		copied[i].AllowedIPs = copyStrings(copied[i].AllowedIPs)
+		copied[i].EgressGatewayRanges = copyStrings(copied[i].EgressGatewayRanges)
+		copied[i].RelayAddrs = copyStrings(copied[i].RelayAddrs)
+	}
+	return copied
+}
+
+// copyStrings - copies a string slice, nil stays nil
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(values)), values...)
+}
+
+// hashPeers - hashes the settings of each peer of a list by its public key
+// timestamps are left out, they change with check ins which do not change how a peer is configured
+func hashPeers(peers []models.Node) map[string]uint64 {
+	var hashes = make(map[string]uint64, len(peers))
+	for i := range peers {
+		var peer = peers[i]
+		peer.LastPeerUpdate, peer.LastCheckIn, peer.LastModified = 0, 0, 0
+		data, _ := json.Marshal(&peer)
+		var hash = fnv.New64a()
+		hash.Write(data)
+		hashes[peers[i].PublicKey] = hash.Sum64()
+	}
+	return hashes
+}
+
+// getPeerSnapshot - gets the peers sent to a node for a revision, false if they are not known
+func getPeerSnapshot(nodeID string, revision int64) (map[string]uint64, bool) {
+	peerSnapshots.Lock()
+	defer peerSnapshots.Unlock()
+	for _, snapshot := range peerSnapshots.nodes[nodeID] {
+		if snapshot.revision == revision {
+			if snapshot.ambiguous || time.Since(snapshot.recorded) > peerSnapshotTTL {
+				return nil, false
+			}
+			return snapshot.peers, true
+		}
+	}
+	return nil, false
+}
+
+// recordPeerSnapshot - records the peers sent to a node for a revision, keeping only its latest revisions
+func recordPeerSnapshot(nodeID string, revision int64, peers map[string]uint64) {
+	peerSnapshots.Lock()
+	defer peerSnapshots.Unlock()
+	var now = time.Now()
+	if now.Sub(peerSnapshots.pruned) > peerSnapshotTTL {
+		prunePeerSnapshots(now)
+	}
+	var snapshots = peerSnapshots.nodes[nodeID]
+	for i := range snapshots {
+		if snapshots[i].revision == revision {
+			snapshots[i].ambiguous = snapshots[i].ambiguous || !peerHashesEqual(snapshots[i].peers, peers)
+			snapshots[i].recorded = now
+			return
+		}
+	}
+	snapshots = append(snapshots, peerSnapshot{revision: revision, peers: peers, recorded: now})
+	if len(snapshots) > peerSnapshotsKept {
+		snapshots = snapshots[len(snapshots)-peerSnapshotsKept:]
+	}
+	peerSnapshots.nodes[nodeID] = snapshots
+}
+
+// prunePeerSnapshots - drops the expired snapshots of all nodes, the caller holds the lock
+func prunePeerSnapshots(now time.Time) {
+	for nodeID, snapshots := range peerSnapshots.nodes {
+		var kept []peerSnapshot
+		for _, snapshot := range snapshots {
+			if now.Sub(snapshot.recorded) <= peerSnapshotTTL {
+				kept = append(kept, snapshot)
+			}
+		}
+		if len(kept) == 0 {
+			delete(peerSnapshots.nodes, nodeID)
+		} else {
+			peerSnapshots.nodes[nodeID] = kept
+		}
+	}
+	peerSnapshots.pruned = now
+}
+
+func peerHashesEqual(a map[string]uint64, b map[string]uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, hash := range a {
+		if other, ok := b[key]; !ok || other != hash {
+			return false
+		}
+	}
+	return true
+}
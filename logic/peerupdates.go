@@ -0,0 +1,43 @@
+package logic
+
+import "sync"
+
+// peerSubscribers - the channels of the peer streams watching each network
+var peerSubscribers = struct {
+	sync.Mutex
+	networks map[string]map[chan struct{}]bool
+}{networks: make(map[string]map[chan struct{}]bool)}
+
+// SubscribePeerUpdates - returns a channel signalled whenever peers of a network may have changed and a func to unsubscribe
+// signals are coalesced, a subscriber that is busy receives a single signal afterwards
+func SubscribePeerUpdates(network string) (<-chan struct{}, func()) {
+	var updates = make(chan struct{}, 1)
+	peerSubscribers.Lock()
+	if peerSubscribers.networks[network] == nil {
+		peerSubscribers.networks[network] = make(map[chan struct{}]bool)
+	}
+	peerSubscribers.networks[network][updates] = true
+	peerSubscribers.Unlock()
+	return updates, func() {
+		peerSubscribers.Lock()
+		delete(peerSubscribers.networks[network], updates)
+		if len(peerSubscribers.networks[network]) == 0 {
+			delete(peerSubscribers.networks, network)
+		}
+		peerSubscribers.Unlock()
+	}
+}
+
+// NotifyPeerUpdate - drops the cached peers of a network and signals its peer streams to recompute their peers
+// called on every write changing peers of a network
+func NotifyPeerUpdate(network string) {
+	invalidatePeerCache(network)
+	peerSubscribers.Lock()
+	defer peerSubscribers.Unlock()
+	for updates := range peerSubscribers.networks[network] {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+	}
+}
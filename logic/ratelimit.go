@@ -0,0 +1,37 @@
+package logic
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter - allows a limited number of requests per key within a fixed window,
+// the counts of all keys are dropped when the window ends
+type RateLimiter struct {
+	sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// NewRateLimiter - creates a limiter allowing limit requests per key and window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, counts: make(map[string]int)}
+}
+
+// Allow - counts a request of a key, false once the key has used up the current window
+func (limiter *RateLimiter) Allow(key string) bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+	var now = time.Now()
+	if now.Sub(limiter.windowStart) >= limiter.window {
+		limiter.windowStart = now
+		limiter.counts = make(map[string]int)
+	}
+	if limiter.counts[key] >= limiter.limit {
+		return false
+	}
+	limiter.counts[key]++
+	return true
+}
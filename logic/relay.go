@@ -0,0 +1,138 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// CreateRelay - creates a relay
+func CreateRelay(relay models.RelayRequest) (models.Node, error) {
+	node, err := GetNetworkNode(relay.NetID, relay.NodeID)
+	if node.OS == "windows" || node.OS == "macos" { // add in darwin later
+		return models.Node{}, errors.New(node.OS + " is unsupported for relay")
+	}
+	if err != nil {
+		return models.Node{}, err
+	}
+	err = ValidateRelay(relay)
+	if err != nil {
+		return models.Node{}, err
+	}
+	node.IsRelay = "yes"
+	node.RelayAddrs = relay.RelayAddrs
+
+	node.SetLastModified()
+	node.SetLastPeerUpdate()
+	node.PullChanges = "yes"
+	nodeData, err := json.Marshal(&node)
+	if err != nil {
+		return node, err
+	}
+	if err = database.Insert(node.ID, string(nodeData), database.NODES_TABLE_NAME); err != nil {
+		return models.Node{}, err
+	}
+	err = SetRelayedNodes("yes", node.Network, node.RelayAddrs)
+	if err != nil {
+		return node, err
+	}
+
+	if err = PublishEvent(models.Event{Type: models.EVENT_GATEWAY_UPDATED, Network: node.Network, Node: &node}); err != nil {
+		return models.Node{}, err
+	}
+	return node, nil
+}
+
+// SetRelayedNodes- set relayed nodes
+func SetRelayedNodes(yesOrno string, networkName string, addrs []string) error {
+
+	collections, err := database.FetchRecords(database.NODES_TABLE_NAME)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range collections {
+
+		var node models.Node
+		err := json.Unmarshal([]byte(value), &node)
+		if err != nil {
+			return err
+		}
+		if node.Network == networkName {
+			for _, addr := range addrs {
+				if addr == node.Address || addr == node.Address6 {
+					node.IsRelayed = yesOrno
+					node.SetLastPeerUpdate()
+					data, err := json.Marshal(&node)
+					if err != nil {
+						return err
+					}
+					database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateRelay - checks if relay is valid
+func ValidateRelay(relay models.RelayRequest) error {
+	var err error
+	//isIp := functions.IsIpCIDR(gateway.RangeString)
+	empty := len(relay.RelayAddrs) == 0
+	if empty {
+		err = errors.New("IP Ranges Cannot Be Empty")
+	}
+	return err
+}
+
+// UpdateRelay - moves the relayed nodes of a relay from its old to its current addresses
+func UpdateRelay(relay *models.Node, oldAddrs []string) {
+	time.Sleep(time.Second / 4)
+	var log = logger.New(logger.SERVER).With("node", relay.ID).With("network", relay.Network)
+	err := SetRelayedNodes("no", relay.Network, oldAddrs)
+	if err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "could not unset the old relayed nodes")
+	}
+	err = SetRelayedNodes("yes", relay.Network, relay.RelayAddrs)
+	if err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "could not set the relayed nodes")
+	}
+	if err = PublishEvent(models.Event{Type: models.EVENT_GATEWAY_UPDATED, Network: relay.Network, Node: relay}); err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "error setting relay updates")
+	}
+}
+
+// DeleteRelay - deletes a relay
+func DeleteRelay(network, nodeid string) (models.Node, error) {
+
+	node, err := GetNetworkNode(network, nodeid)
+	if err != nil {
+		return models.Node{}, err
+	}
+	err = SetRelayedNodes("no", node.Network, node.RelayAddrs)
+	if err != nil {
+		return node, err
+	}
+
+	node.IsRelay = "no"
+	node.RelayAddrs = []string{}
+	node.SetLastModified()
+	node.SetLastPeerUpdate()
+	node.PullChanges = "yes"
+	data, err := json.Marshal(&node)
+	if err != nil {
+		return models.Node{}, err
+	}
+	if err = database.Insert(node.ID, string(data), database.NODES_TABLE_NAME); err != nil {
+		return models.Node{}, err
+	}
+	if err = PublishEvent(models.Event{Type: models.EVENT_GATEWAY_UPDATED, Network: network, Node: &node}); err != nil {
+		return models.Node{}, err
+	}
+	return node, nil
+}
@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gravitl/netmaker/logger"
+)
+
+// requestContextKey - type of the context keys set for requests
+type requestContextKey string
+
+// requestIDKey - context key of the id of a request
+const requestIDKey requestContextKey = "requestid"
+
+// maxRequestIDLength - longest request id accepted from a client
+const maxRequestIDLength = 64
+
+// NewRequestID - generates a random request id
+func NewRequestID() string {
+	var b = make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// IsRequestIDValid - checks if a request id sent by a client can be used in log lines
+func IsRequestIDValid(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, char := range requestID {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '-' || char == '_' || char == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID - returns a context carrying the id of a request
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// GetRequestID - gets the id of the request of a context, empty outside of requests
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// RequestLogger - returns a logger of a subsystem adding the id of the request of a context to every message
+func RequestLogger(ctx context.Context, subsystem string) logger.Logger {
+	return logger.New(subsystem).With("request_id", GetRequestID(ctx))
+}
@@ -0,0 +1,291 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+)
+
+// JOB_TRIGGER_INTERVAL - a job run started by the scheduler
+const JOB_TRIGGER_INTERVAL = "interval"
+
+// JOB_TRIGGER_MANUAL - a job run started through the API
+const JOB_TRIGGER_MANUAL = "manual"
+
+// ErrJobNotFound - no job is registered under the name
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobRunning - the job is running already
+var ErrJobRunning = errors.New("job is running already")
+
+// schedulerTick - how often the scheduler looks for due jobs
+const schedulerTick = time.Second
+
+// jobLeaseDuration - how long a server stays leader without renewing, another server takes over after
+const jobLeaseDuration = time.Minute
+
+// jobLeaseKey - record of the job lease in the jobs table, job names must differ
+const jobLeaseKey = "lease"
+
+// jobHistoryLength - how many runs are kept per job
+const jobHistoryLength = 10
+
+// Job - periodic server work run by the scheduler
+type Job struct {
+	Name        string
+	Description string
+	Interval    func() time.Duration
+	// LeaderOnly - run by only one of the servers sharing a database, for work on shared records
+	LeaderOnly bool
+	Run        func() error
+}
+
+type scheduledJob struct {
+	Job
+	running bool
+	nextRun time.Time
+}
+
+// jobLease - the server running leader only jobs, until the lease expires
+type jobLease struct {
+	Server  string `json:"server"`
+	Expires int64  `json:"expires"`
+}
+
+// jobHistory - the recent runs of a job, latest first
+type jobHistory struct {
+	Name string          `json:"name"`
+	Runs []models.JobRun `json:"runs"`
+}
+
+var scheduler = struct {
+	sync.Mutex
+	jobs map[string]*scheduledJob
+}{jobs: make(map[string]*scheduledJob)}
+
+// RegisterJob - adds a job to the scheduler, replacing a job of the same name, it first runs on the next tick
+func RegisterJob(job Job) {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	scheduler.jobs[job.Name] = &scheduledJob{Job: job, nextRun: time.Now()}
+}
+
+// RunScheduler - runs due jobs until the context is done, then waits for running jobs to finish
+// leader only jobs run on the server holding the job lease
+func RunScheduler(ctx context.Context) {
+	var running sync.WaitGroup
+	var ticker = time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	var serverID = servercfg.GetNodeID()
+	var leader bool
+	var leaseChecked time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			running.Wait()
+			if leader {
+				releaseJobLease(serverID)
+			}
+			return
+		case now := <-ticker.C:
+			if now.Sub(leaseChecked) >= jobLeaseDuration/3 {
+				leader = holdJobLease(serverID)
+				leaseChecked = now
+			}
+			for _, job := range dueJobs(now, leader) {
+				running.Add(1)
+				go func(job *scheduledJob) {
+					defer running.Done()
+					runScheduledJob(job, JOB_TRIGGER_INTERVAL)
+				}(job)
+			}
+		}
+	}
+}
+
+// RunJob - runs a job now, leader only jobs included, and returns the run
+func RunJob(name string) (models.JobRun, error) {
+	scheduler.Lock()
+	job, ok := scheduler.jobs[name]
+	if !ok {
+		scheduler.Unlock()
+		return models.JobRun{}, ErrJobNotFound
+	}
+	if job.running {
+		scheduler.Unlock()
+		return models.JobRun{}, ErrJobRunning
+	}
+	job.running = true
+	scheduler.Unlock()
+	return runScheduledJob(job, JOB_TRIGGER_MANUAL), nil
+}
+
+// GetJobs - gets the registered jobs with their recent runs, sorted by name
+func GetJobs() []models.JobStatus {
+	scheduler.Lock()
+	var jobs = make([]models.JobStatus, 0, len(scheduler.jobs))
+	for _, job := range scheduler.jobs {
+		jobs = append(jobs, models.JobStatus{
+			Name:        job.Name,
+			Description: job.Description,
+			Interval:    int64(job.Interval().Seconds()),
+			LeaderOnly:  job.LeaderOnly,
+			Running:     job.running,
+			NextRun:     job.nextRun.Unix(),
+		})
+	}
+	scheduler.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	for i := range jobs {
+		jobs[i].Runs = fetchJobHistory(jobs[i].Name, jobs[i].LeaderOnly).Runs
+	}
+	return jobs
+}
+
+// dueJobs - marks the jobs due to run as running and returns them, leader only jobs are skipped on other servers
+func dueJobs(now time.Time, leader bool) []*scheduledJob {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+	var due []*scheduledJob
+	for _, job := range scheduler.jobs {
+		if job.running || now.Before(job.nextRun) {
+			continue
+		}
+		if job.LeaderOnly && !leader {
+			job.nextRun = now.Add(job.Interval())
+			continue
+		}
+		job.running = true
+		due = append(due, job)
+	}
+	return due
+}
+
+// runScheduledJob - runs a job marked as running, records the run and schedules the next one
+func runScheduledJob(job *scheduledJob, trigger string) models.JobRun {
+	var started = time.Now()
+	var err = runJobRecovered(job)
+	var run = models.JobRun{
+		Server:   servercfg.GetNodeID(),
+		Trigger:  trigger,
+		Started:  started.Unix(),
+		Duration: time.Since(started).Milliseconds(),
+	}
+	var log = logger.New(logger.SERVER).With("job", job.Name).With("trigger", trigger)
+	if err != nil {
+		run.Error = err.Error()
+		log.Error("job failed", err)
+	} else {
+		log.With("duration", time.Since(started).String()).Log(logger.Debug, "job finished")
+	}
+
+	scheduler.Lock()
+	job.running = false
+	job.nextRun = time.Now().Add(job.Interval())
+	scheduler.Unlock()
+
+	if err = recordJobRun(job.Name, job.LeaderOnly, run); err != nil {
+		log.Error("could not record job run", err)
+	}
+	return run
+}
+
+// runJobRecovered - runs a job, a panic fails the run instead of crashing the server
+func runJobRecovered(job *scheduledJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.New(logger.SERVER).With("job", job.Name).With("stack", string(debug.Stack())).
+				Error("panic running job", fmt.Errorf("%v", r))
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.Run()
+}
+
+// jobHistoryKey - leader only jobs share their history, other jobs run on every server and keep one each
+func jobHistoryKey(name string, leaderOnly bool) string {
+	if leaderOnly {
+		return name
+	}
+	return name + "@" + servercfg.GetNodeID()
+}
+
+func fetchJobHistory(name string, leaderOnly bool) jobHistory {
+	var history = jobHistory{Name: name}
+	if data, err := database.FetchRecord(database.JOBS_TABLE_NAME, jobHistoryKey(name, leaderOnly)); err == nil {
+		json.Unmarshal([]byte(data), &history)
+	}
+	if history.Runs == nil {
+		history.Runs = []models.JobRun{}
+	}
+	return history
+}
+
+func recordJobRun(name string, leaderOnly bool, run models.JobRun) error {
+	var history = fetchJobHistory(name, leaderOnly)
+	history.Runs = append([]models.JobRun{run}, history.Runs...)
+	if len(history.Runs) > jobHistoryLength {
+		history.Runs = history.Runs[:jobHistoryLength]
+	}
+	data, err := json.Marshal(&history)
+	if err != nil {
+		return err
+	}
+	return database.Insert(jobHistoryKey(name, leaderOnly), string(data), database.JOBS_TABLE_NAME)
+}
+
+// holdJobLease - takes or renews the job lease unless another server holds it
+// the lease is written only if it still holds what was read, so of two servers taking it at the same time one wins
+func holdJobLease(serverID string) bool {
+	var now = time.Now()
+	var lease jobLease
+	previous, err := database.FetchRecord(database.JOBS_TABLE_NAME, jobLeaseKey)
+	if err != nil && !database.IsEmptyRecord(err) {
+		logger.New(logger.SERVER).Error("could not read job lease", err)
+		return false
+	}
+	if previous != "" {
+		if err = json.Unmarshal([]byte(previous), &lease); err == nil && lease.Server != serverID && lease.Expires > now.Unix() {
+			return false
+		}
+	}
+	data, err := json.Marshal(&jobLease{Server: serverID, Expires: now.Add(jobLeaseDuration).Unix()})
+	if err != nil {
+		return false
+	}
+	taken, err := database.InsertIf(jobLeaseKey, string(data), previous, database.JOBS_TABLE_NAME)
+	if err != nil {
+		logger.New(logger.SERVER).Error("could not take job lease", err)
+		return false
+	}
+	return taken
+}
+
+// releaseJobLease - gives up the job lease on shutdown so another server takes over without waiting for it to expire
+func releaseJobLease(serverID string) {
+	if lease, err := fetchJobLease(); err == nil && lease.Server == serverID {
+		database.DeleteRecord(database.JOBS_TABLE_NAME, jobLeaseKey)
+	}
+}
+
+func fetchJobLease() (jobLease, error) {
+	var lease jobLease
+	data, err := database.FetchRecord(database.JOBS_TABLE_NAME, jobLeaseKey)
+	if err != nil {
+		return lease, err
+	}
+	err = json.Unmarshal([]byte(data), &lease)
+	return lease, err
+}
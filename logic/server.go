@@ -1,15 +1,17 @@
 package logic
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/servercfg"
@@ -28,6 +30,9 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 	if network == "" {
 		return errors.New("no network provided")
 	}
+	if _, err := GetServerNode(serverID, network); err == nil {
+		return errors.New("server " + serverID + " has already joined network " + network)
+	}
 
 	var err error
 	var node *models.Node // fill this object with server node specifics
@@ -46,8 +51,9 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 		node.MTU = KUBERNETES_SERVER_MTU
 	}
 
+	var log = logger.New(logger.SERVER).With("network", network).With("server", serverID)
 	if node.LocalRange != "" && node.LocalAddress == "" {
-		Log("local vpn, getting local address from range: "+node.LocalRange, 1)
+		log.With("range", node.LocalRange).Log(logger.Verbose, "local vpn, getting local address from range")
 		node.LocalAddress = GetLocalIP(*node)
 	}
 
@@ -58,7 +64,7 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 			node.Endpoint, err = ncutils.GetPublicIP()
 		}
 		if err != nil || node.Endpoint == "" {
-			Log("Error setting server node Endpoint.", 0)
+			log.Error("could not set the endpoint of the server node", err)
 			return err
 		}
 	}
@@ -67,7 +73,7 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 	if privateKey == "" {
 		wgPrivatekey, err := wgtypes.GeneratePrivateKey()
 		if err != nil {
-			Log(err.Error(), 1)
+			log.With("error", err.Error()).Log(logger.Verbose, "could not generate WireGuard key")
 			return err
 		}
 		privateKey = wgPrivatekey.String()
@@ -95,11 +101,12 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 		UDPHolePunch:        node.UDPHolePunch,
 	}
 
-	Log("adding a server instance on network "+postnode.Network, 2)
+	log.Log(logger.Debug, "adding a server instance")
 	*node, err = CreateNode(*postnode, network)
 	if err != nil {
 		return err
 	}
+	log = log.With("node", node.ID)
 	err = SetNetworkNodesLastModified(node.Network)
 	if err != nil {
 		return err
@@ -108,9 +115,9 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 	// get free port based on returned default listen port
 	node.ListenPort, err = ncutils.GetFreePort(node.ListenPort)
 	if err != nil {
-		Log("Error retrieving port: "+err.Error(), 2)
+		log.With("error", err.Error()).Log(logger.Debug, "could not retrieve port")
 	} else {
-		Log("Set client port to "+fmt.Sprintf("%d", node.ListenPort)+" for network "+node.Network, 1)
+		log.With("port", node.ListenPort).Log(logger.Verbose, "set client port")
 	}
 
 	// safety check. If returned node from server is local, but not currently configured as local, set to local addr
@@ -122,7 +129,6 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 		node.Endpoint = node.LocalAddress
 	}
 
-	node.SetID()
 	if err = StorePrivKey(node.ID, privateKey); err != nil {
 		return err
 	}
@@ -130,9 +136,9 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 		return err
 	}
 
-	peers, hasGateway, gateways, err := GetServerPeers(node.MacAddress, network, node.IsDualStack == "yes", node.IsIngressGateway == "yes")
+	peers, hasGateway, gateways, err := GetServerPeers(node.ID, network, node.IsDualStack == "yes", node.IsIngressGateway == "yes")
 	if err != nil && !ncutils.IsEmptyRecord(err) {
-		Log("failed to retrieve peers", 1)
+		log.With("error", err.Error()).Log(logger.Verbose, "failed to retrieve peers")
 		return err
 	}
 
@@ -144,12 +150,17 @@ func ServerJoin(network string, serverID string, privateKey string) error {
 	return nil
 }
 
+// serverCheckinLock - keeps the interval check ins and the ones after peer changes from configuring WireGuard at once
+var serverCheckinLock sync.Mutex
+
 // ServerCheckin - runs pulls and pushes for server
 func ServerCheckin(mac string, network string) error {
+	serverCheckinLock.Lock()
+	defer serverCheckinLock.Unlock()
 	var serverNode models.Node
 	var newNode *models.Node
 	var err error
-	serverNode, err = GetNode(mac, network)
+	serverNode, err = GetServerNode(mac, network)
 	if err != nil {
 		return err
 	}
@@ -187,17 +198,18 @@ func ServerPull(serverNode *models.Node, onErr bool) (*models.Node, error) {
 		// checks if address is in use by another interface
 		oldIfaceName, isIfacePresent = isInterfacePresent(serverNode.Interface, serverNode.Address)
 		if !isIfacePresent {
+			var log = logger.New(logger.SERVER).With("node", serverNode.ID).With("network", serverNode.Network).With("interface", oldIfaceName)
 			if err = deleteInterface(oldIfaceName, serverNode.PostDown); err != nil {
-				Log("could not delete old interface "+oldIfaceName, 1)
+				log.With("error", err.Error()).Log(logger.Verbose, "could not delete old interface")
 			}
-			Log("removed old interface "+oldIfaceName, 1)
+			log.Log(logger.Verbose, "removed old interface")
 		}
 		serverNode.PullChanges = "no"
 		if err = setWGConfig(*serverNode, serverNode.Network, false); err != nil {
 			return serverNode, err
 		}
 		// handle server side update
-		if err = UpdateNode(serverNode, serverNode); err != nil {
+		if err = UpdateNode(context.Background(), serverNode, serverNode); err != nil {
 			return serverNode, err
 		}
 	} else {
@@ -217,7 +229,7 @@ func ServerPull(serverNode *models.Node, onErr bool) (*models.Node, error) {
 func ServerPush(serverNode *models.Node) error {
 	serverNode.OS = runtime.GOOS
 	serverNode.SetLastCheckIn()
-	return UpdateNode(serverNode, serverNode)
+	return UpdateNode(context.Background(), serverNode, serverNode)
 }
 
 // ServerLeave - removes a server node
@@ -225,16 +237,30 @@ func ServerLeave(mac string, network string) error {
 
 	var serverNode models.Node
 	var err error
-	serverNode, err = GetNode(mac, network)
+	serverNode, err = GetServerNode(mac, network)
 	if err != nil {
 		return err
 	}
-	serverNode.SetID()
-	return DeleteNode(&serverNode, true)
+	return DeleteNode(context.Background(), &serverNode, true)
+}
+
+// GetServerNode - gets the node of a server on a network, server nodes carry the server id as mac address
+func GetServerNode(serverID string, network string) (models.Node, error) {
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return models.Node{}, err
+	}
+	for _, node := range nodes {
+		if node.IsServer == "yes" && node.MacAddress == serverID {
+			SetNodeDefaults(&node)
+			return node, nil
+		}
+	}
+	return models.Node{}, errors.New("server " + serverID + " has no node on network " + network)
 }
 
 // GetServerPeers - gets peers of server
-func GetServerPeers(macaddress string, network string, dualstack bool, isIngressGateway bool) ([]wgtypes.PeerConfig, bool, []string, error) {
+func GetServerPeers(nodeid string, network string, dualstack bool, isIngressGateway bool) ([]wgtypes.PeerConfig, bool, []string, error) {
 	hasGateway := false
 	var err error
 	var gateways []string
@@ -242,7 +268,7 @@ func GetServerPeers(macaddress string, network string, dualstack bool, isIngress
 	var nodecfg models.Node
 	var nodes []models.Node // fill above fields from server or client
 
-	nodecfg, err = GetNode(macaddress, network)
+	nodecfg, err = GetNode(nodeid, network)
 	if err != nil {
 		return nil, hasGateway, gateways, err
 	}
@@ -255,14 +281,16 @@ func GetServerPeers(macaddress string, network string, dualstack bool, isIngress
 	keepalivedur, err := time.ParseDuration(strconv.FormatInt(int64(keepalive), 10) + "s")
 	keepaliveserver, err := time.ParseDuration(strconv.FormatInt(int64(5), 10) + "s")
 	if err != nil {
-		Log("Issue with format of keepalive value. Please view server config. "+err.Error(), 1)
+		logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("error", err.Error()).
+			Log(logger.Verbose, "issue with format of keepalive value, please view server config")
 		return nil, hasGateway, gateways, err
 	}
 
 	for _, node := range nodes {
 		pubkey, err := wgtypes.ParseKey(node.PublicKey)
 		if err != nil {
-			Log("error parsing key "+pubkey.String(), 1)
+			logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("peer", node.PublicKey).With("error", err.Error()).
+				Log(logger.Verbose, "error parsing key")
 			return peers, hasGateway, gateways, err
 		}
 
@@ -306,21 +334,25 @@ func GetServerPeers(macaddress string, network string, dualstack bool, isIngress
 			for _, iprange := range ranges { // go through each cidr for egress gateway
 				_, ipnet, err := net.ParseCIDR(iprange) // confirming it's valid cidr
 				if err != nil {
-					Log("could not parse gateway IP range. Not adding "+iprange, 1)
+					logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("range", iprange).
+						Log(logger.Verbose, "could not parse gateway IP range, not adding it")
 					continue // if can't parse CIDR
 				}
 				nodeEndpointArr := strings.Split(node.Endpoint, ":") // getting the public ip of node
 				if ipnet.Contains(net.ParseIP(nodeEndpointArr[0])) { // ensuring egress gateway range does not contain public ip of node
-					Log("egress IP range of "+iprange+" overlaps with "+node.Endpoint+", omitting", 2)
+					logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("range", iprange).With("endpoint", node.Endpoint).
+						Log(logger.Debug, "egress IP range overlaps with endpoint, omitting")
 					continue // skip adding egress range if overlaps with node's ip
 				}
 				if ipnet.Contains(net.ParseIP(nodecfg.LocalAddress)) { // ensuring egress gateway range does not contain public ip of node
-					Log("egress IP range of "+iprange+" overlaps with "+nodecfg.LocalAddress+", omitting", 2)
+					logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("range", iprange).With("local_address", nodecfg.LocalAddress).
+						Log(logger.Debug, "egress IP range overlaps with local address, omitting")
 					continue // skip adding egress range if overlaps with node's local ip
 				}
 				gateways = append(gateways, iprange)
 				if err != nil {
-					Log("ERROR ENCOUNTERED SETTING GATEWAY", 1)
+					logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("error", err.Error()).
+						Log(logger.Verbose, "error encountered setting gateway")
 				} else {
 					allowedips = append(allowedips, *ipnet)
 				}
@@ -365,30 +397,31 @@ func GetServerPeers(macaddress string, network string, dualstack bool, isIngress
 		peers = append(peers, peer)
 	}
 	if isIngressGateway {
-		extPeers, err := GetServerExtPeers(macaddress, network, dualstack)
+		extPeers, err := GetServerExtPeers(nodeid, network, dualstack)
 		if err == nil {
 			peers = append(peers, extPeers...)
 		} else {
-			Log("ERROR RETRIEVING EXTERNAL PEERS ON SERVER", 1)
+			logger.New(logger.SERVER).With("node", nodeid).With("network", network).With("error", err.Error()).
+				Log(logger.Verbose, "could not retrieve external peers on server")
 		}
 	}
 	return peers, hasGateway, gateways, err
 }
 
 // GetServerExtPeers - gets the extpeers for a client
-func GetServerExtPeers(macaddress string, network string, dualstack bool) ([]wgtypes.PeerConfig, error) {
+func GetServerExtPeers(nodeid string, network string, dualstack bool) ([]wgtypes.PeerConfig, error) {
 	var peers []wgtypes.PeerConfig
 	var nodecfg models.Node
 	var extPeers []models.Node
 	var err error
 	// fill above fields from either client or server
 
-	nodecfg, err = GetNode(macaddress, network)
+	nodecfg, err = GetNode(nodeid, network)
 	if err != nil {
 		return nil, err
 	}
 	var tempPeers []models.ExtPeersResponse
-	tempPeers, err = GetExtPeersList(nodecfg.MacAddress, nodecfg.Network)
+	tempPeers, err = GetExtPeersList(context.Background(), nodecfg.ID, nodecfg.Network)
 	if err != nil {
 		return nil, err
 	}
@@ -449,14 +482,16 @@ func checkNodeActions(node *models.Node, networkName string, localNode *models.N
 		node.IsStatic != "yes" {
 		err := setWGKeyConfig(*node)
 		if err != nil {
-			Log("unable to process reset keys request: "+err.Error(), 1)
+			logger.New(logger.SERVER).With("node", node.ID).With("network", networkName).With("error", err.Error()).
+				Log(logger.Verbose, "unable to process reset keys request")
 			return ""
 		}
 	}
 	if node.Action == models.NODE_DELETE || localNode.Action == models.NODE_DELETE {
 		err := ServerLeave(node.MacAddress, networkName)
 		if err != nil {
-			Log("error deleting locally: "+err.Error(), 1)
+			logger.New(logger.SERVER).With("node", node.ID).With("network", networkName).With("error", err.Error()).
+				Log(logger.Verbose, "error deleting locally")
 		}
 		return models.NODE_DELETE
 	}
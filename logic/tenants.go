@@ -0,0 +1,275 @@
+package logic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+)
+
+// GetTenants - gets all tenants
+func GetTenants() ([]models.Tenant, error) {
+	var tenants = []models.Tenant{}
+	collection, err := database.FetchRecords(database.TENANTS_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return tenants, nil
+		}
+		return tenants, err
+	}
+	for _, value := range collection {
+		var tenant models.Tenant
+		if err := json.Unmarshal([]byte(value), &tenant); err != nil {
+			continue
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, nil
+}
+
+// GetTenant - gets a tenant by name
+func GetTenant(name string) (models.Tenant, error) {
+	var tenant models.Tenant
+	record, err := database.FetchRecord(database.TENANTS_TABLE_NAME, name)
+	if err != nil {
+		return tenant, err
+	}
+	if err = json.Unmarshal([]byte(record), &tenant); err != nil {
+		return models.Tenant{}, err
+	}
+	return tenant, nil
+}
+
+// CreateTenant - creates a tenant
+func CreateTenant(tenant models.Tenant) (models.Tenant, error) {
+	if _, err := GetTenant(tenant.Name); err == nil {
+		return models.Tenant{}, errors.New("tenant " + tenant.Name + " exists")
+	}
+	if err := ValidateTenant(&tenant); err != nil {
+		return models.Tenant{}, err
+	}
+	return tenant, saveTenant(&tenant)
+}
+
+// UpdateTenant - updates the display name and limits of a tenant, the name can not change
+func UpdateTenant(tenantchange models.Tenant, tenant models.Tenant) (models.Tenant, error) {
+	if tenantchange.Name != "" && tenantchange.Name != tenant.Name {
+		return models.Tenant{}, errors.New("cannot change the name of tenant " + tenant.Name)
+	}
+	tenant.DisplayName = tenantchange.DisplayName
+	tenant.NetworkLimit = tenantchange.NetworkLimit
+	tenant.NodeLimit = tenantchange.NodeLimit
+	if err := ValidateTenant(&tenant); err != nil {
+		return models.Tenant{}, err
+	}
+	return tenant, saveTenant(&tenant)
+}
+
+// DeleteTenant - deletes a tenant which no longer owns any networks or users
+func DeleteTenant(name string) error {
+	if _, err := GetTenant(name); err != nil {
+		return errors.New("tenant " + name + " does not exist")
+	}
+	networks, err := GetTenantNetworks(name)
+	if err != nil {
+		return err
+	}
+	if len(networks) > 0 {
+		return fmt.Errorf("tenant %s still owns networks %s", name, strings.Join(networks, ", "))
+	}
+	users, err := GetUsers()
+	if err != nil && !database.IsEmptyRecord(err) {
+		return err
+	}
+	for _, user := range users {
+		if user.Tenant == name {
+			return errors.New("tenant " + name + " still has users")
+		}
+	}
+	return database.DeleteRecord(database.TENANTS_TABLE_NAME, name)
+}
+
+// ValidateTenant - validates the fields of a tenant
+func ValidateTenant(tenant *models.Tenant) error {
+	v := validator.New()
+	_ = v.RegisterValidation("tenantname_valid", func(fl validator.FieldLevel) bool {
+		for _, char := range fl.Field().String() {
+			if !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz1234567890-_", char) {
+				return false
+			}
+		}
+		return true
+	})
+	err := v.Struct(tenant)
+	if err != nil {
+		for _, e := range err.(validator.ValidationErrors) {
+			logger.New(logger.SERVER).With("tenant", tenant.Name).Log(logger.Debug, e.Error())
+		}
+	}
+	return err
+}
+
+// GetTenantNetworks - gets the ids of the networks owned by a tenant
+func GetTenantNetworks(name string) ([]string, error) {
+	var netids = []string{}
+	networks, err := GetNetworks()
+	if err != nil && !database.IsEmptyRecord(err) {
+		return netids, err
+	}
+	for _, network := range networks {
+		if network.Tenant == name {
+			netids = append(netids, network.NetID)
+		}
+	}
+	return netids, nil
+}
+
+// GetUserTenant - gets the tenant of a user, empty for users of the whole server
+func GetUserTenant(username string) string {
+	user, err := GetUser(username)
+	if err != nil {
+		return ""
+	}
+	return user.Tenant
+}
+
+// IsTenantAdmin - checks if a user is an admin of a tenant rather than of the server
+func IsTenantAdmin(user *models.User) bool {
+	return user.IsAdmin && user.Tenant != ""
+}
+
+// SetNetworkTenant - moves a network to a tenant, an empty tenant returns it to the server
+func SetNetworkTenant(netid string, tenant string) error {
+	network, err := GetParentNetwork(netid)
+	if err != nil {
+		return err
+	}
+	if network.Tenant == tenant {
+		return nil
+	}
+	if tenant != "" {
+		if err = CheckTenantNetworkLimit(tenant); err != nil {
+			return err
+		}
+	}
+	network.Tenant = tenant
+	data, err := json.Marshal(&network)
+	if err != nil {
+		return err
+	}
+	return database.Insert(network.NetID, string(data), database.NETWORKS_TABLE_NAME)
+}
+
+// SetUserTenant - moves a user to a tenant, networks outside of the tenant are removed from the user
+func SetUserTenant(username string, tenant string) error {
+	user, err := GetUser(username)
+	if err != nil {
+		return err
+	}
+	if tenant != "" {
+		if _, err = GetTenant(tenant); err != nil {
+			return errors.New("tenant " + tenant + " does not exist")
+		}
+		tenantNetworks, err := GetTenantNetworks(tenant)
+		if err != nil {
+			return err
+		}
+		var networks []string
+		for _, network := range user.Networks {
+			if StringSliceContains(tenantNetworks, network) {
+				networks = append(networks, network)
+			}
+		}
+		user.Networks = networks
+	}
+	user.Tenant = tenant
+	data, err := json.Marshal(&user)
+	if err != nil {
+		return err
+	}
+	return database.Insert(user.UserName, string(data), database.USERS_TABLE_NAME)
+}
+
+// ValidateUserTenant - checks that the tenant of a user exists and owns all of the user's networks
+func ValidateUserTenant(user *models.User) error {
+	if user.Tenant == "" {
+		return nil
+	}
+	if _, err := GetTenant(user.Tenant); err != nil {
+		return errors.New("tenant " + user.Tenant + " does not exist")
+	}
+	tenantNetworks, err := GetTenantNetworks(user.Tenant)
+	if err != nil {
+		return err
+	}
+	for _, network := range user.Networks {
+		if !StringSliceContains(tenantNetworks, network) {
+			return errors.New("network " + network + " does not belong to tenant " + user.Tenant)
+		}
+	}
+	return nil
+}
+
+// CheckTenantNetworkLimit - checks if a tenant may own another network
+func CheckTenantNetworkLimit(name string) error {
+	tenant, err := GetTenant(name)
+	if err != nil {
+		return errors.New("tenant " + name + " does not exist")
+	}
+	if tenant.NetworkLimit == 0 {
+		return nil
+	}
+	networks, err := GetTenantNetworks(name)
+	if err != nil {
+		return err
+	}
+	if int32(len(networks)) >= tenant.NetworkLimit {
+		return fmt.Errorf("tenant %s has reached its limit of %d networks", name, tenant.NetworkLimit)
+	}
+	return nil
+}
+
+// checkTenantNodeLimit - checks if the tenant owning a network, if any, may add another node
+func checkTenantNodeLimit(netid string) error {
+	network, err := GetParentNetwork(netid)
+	if err != nil || network.Tenant == "" {
+		return nil
+	}
+	tenant, err := GetTenant(network.Tenant)
+	if err != nil || tenant.NodeLimit == 0 {
+		return nil
+	}
+	networks, err := GetTenantNetworks(tenant.Name)
+	if err != nil {
+		return err
+	}
+	var count int32
+	for _, tenantNetwork := range networks {
+		nodes, err := GetNetworkNodes(tenantNetwork)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if node.IsServer != "yes" {
+				count++
+			}
+		}
+	}
+	if count >= tenant.NodeLimit {
+		return fmt.Errorf("tenant %s has reached its limit of %d nodes", tenant.Name, tenant.NodeLimit)
+	}
+	return nil
+}
+
+func saveTenant(tenant *models.Tenant) error {
+	data, err := json.Marshal(tenant)
+	if err != nil {
+		return err
+	}
+	return database.Insert(tenant.Name, string(data), database.TENANTS_TABLE_NAME)
+}
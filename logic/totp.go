@@ -0,0 +1,294 @@
+package logic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/servercfg"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totp_issuer          = "Netmaker"
+	totp_period          = 30
+	totp_digits          = 6
+	totp_skew            = 1 // steps accepted before and after the current one
+	totp_recovery_codes  = 10
+	totp_max_attempts    = 5
+	totp_lockout_seconds = 300
+	totp_token_minutes   = 5
+	totp_auth_key        = "netmaker_totp"
+)
+
+// IsTOTPEnabled - checks if a user has a confirmed TOTP second factor
+func IsTOTPEnabled(username string) bool {
+	var totp, err = getUserTOTP(username)
+	return err == nil && totp.Enabled
+}
+
+// IsTOTPRequired - checks if a user must enroll a second factor before logging in
+func IsTOTPRequired(user *models.User) bool {
+	return user.IsAdmin && servercfg.IsTOTPRequiredForAdmins()
+}
+
+// EnrollTOTP - generates a new, not yet confirmed, TOTP secret and recovery codes for a user
+func EnrollTOTP(username string) (models.TOTPEnrollment, error) {
+	var enrollment models.TOTPEnrollment
+	if IsTOTPEnabled(username) {
+		return enrollment, errors.New("TOTP is already enabled for user " + username)
+	}
+	var secret = make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return enrollment, err
+	}
+	var recoveryCodes, hashedCodes, err = generateRecoveryCodes()
+	if err != nil {
+		return enrollment, err
+	}
+	var totp = models.UserTOTP{
+		UserName:      username,
+		Secret:        base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret),
+		RecoveryCodes: hashedCodes,
+	}
+	if err = saveUserTOTP(&totp); err != nil {
+		return enrollment, err
+	}
+	enrollment.Secret = totp.Secret
+	enrollment.URL = getTOTPURL(username, totp.Secret)
+	enrollment.RecoveryCodes = recoveryCodes
+	return enrollment, nil
+}
+
+// ConfirmTOTP - enables a pending TOTP enrollment once the user proves they can generate codes
+func ConfirmTOTP(username string, code string) error {
+	var totp, err = getUserTOTP(username)
+	if err != nil {
+		return errors.New("TOTP enrollment was not started for user " + username)
+	}
+	if totp.Enabled {
+		return errors.New("TOTP is already enabled for user " + username)
+	}
+	if err = checkTOTPCode(&totp, code, false); err != nil {
+		return err
+	}
+	totp.Enabled = true
+	return saveUserTOTP(&totp)
+}
+
+// VerifyTOTP - checks a TOTP or unused recovery code of a user with TOTP enabled
+func VerifyTOTP(username string, code string) error {
+	var totp, err = getUserTOTP(username)
+	if err != nil || !totp.Enabled {
+		return errors.New("TOTP is not enabled for user " + username)
+	}
+	return checkTOTPCode(&totp, code, true)
+}
+
+// DisableTOTP - removes the second factor of a user
+func DisableTOTP(username string) error {
+	if _, err := getUserTOTP(username); err != nil {
+		return errors.New("TOTP is not enabled for user " + username)
+	}
+	return database.DeleteRecord(database.USER_TOTP_TABLE_NAME, username)
+}
+
+// RegenerateRecoveryCodes - replaces the recovery codes of a user with TOTP enabled
+func RegenerateRecoveryCodes(username string) ([]string, error) {
+	var totp, err = getUserTOTP(username)
+	if err != nil || !totp.Enabled {
+		return nil, errors.New("TOTP is not enabled for user " + username)
+	}
+	recoveryCodes, hashedCodes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	totp.RecoveryCodes = hashedCodes
+	return recoveryCodes, saveUserTOTP(&totp)
+}
+
+// CreateTOTPToken - creates the short lived token which identifies a user between the password and TOTP steps
+func CreateTOTPToken(username string) (string, error) {
+	claims := &models.TOTPClaims{
+		UserName: username,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(totp_token_minutes * time.Minute).Unix(),
+		},
+	}
+	key, err := getTOTPSecretKey()
+	if err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// VerifyTOTPToken - returns the user of a token created by CreateTOTPToken
+func VerifyTOTPToken(tokenString string) (string, error) {
+	claims := &models.TOTPClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return getTOTPSecretKey()
+	})
+	if err != nil || token == nil || !token.Valid || claims.UserName == "" {
+		return "", errors.New("invalid or expired TOTP token")
+	}
+	return claims.UserName, nil
+}
+
+// GenerateTOTPCode - generates the code of a secret for the given time
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	return generateTOTPCodeForStep(secret, t.Unix()/totp_period)
+}
+
+// == private methods ==
+
+func checkTOTPCode(totp *models.UserTOTP, code string, allowRecovery bool) error {
+	var now = time.Now()
+	if totp.LockedUntil > now.Unix() {
+		return errors.New("too many failed attempts, try again later")
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	var currentStep = now.Unix() / totp_period
+	for step := currentStep - totp_skew; step <= currentStep+totp_skew; step++ {
+		if step <= totp.LastUsedStep { // codes can only be used once
+			continue
+		}
+		expected, err := generateTOTPCodeForStep(totp.Secret, step)
+		if err != nil {
+			return err
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			totp.LastUsedStep = step
+			totp.FailedAttempts = 0
+			return saveUserTOTP(totp)
+		}
+	}
+	if allowRecovery {
+		for i, hashedCode := range totp.RecoveryCodes {
+			if bcrypt.CompareHashAndPassword([]byte(hashedCode), []byte(strings.ToLower(code))) == nil {
+				totp.RecoveryCodes = append(totp.RecoveryCodes[:i], totp.RecoveryCodes[i+1:]...)
+				totp.FailedAttempts = 0
+				logger.New(logger.SERVER).With("user", totp.UserName).With("left", len(totp.RecoveryCodes)).Log(logger.Verbose, "recovery code used")
+				return saveUserTOTP(totp)
+			}
+		}
+	}
+	totp.FailedAttempts++
+	if totp.FailedAttempts >= totp_max_attempts {
+		totp.FailedAttempts = 0
+		totp.LockedUntil = now.Unix() + totp_lockout_seconds
+		logger.New(logger.SERVER).With("user", totp.UserName).Log(logger.Verbose, "too many failed TOTP attempts, locking second factor")
+	}
+	if err := saveUserTOTP(totp); err != nil {
+		return err
+	}
+	return errors.New("invalid TOTP code")
+}
+
+func generateTOTPCodeForStep(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var message = make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(step))
+	var mac = hmac.New(sha1.New, key)
+	mac.Write(message)
+	var sum = mac.Sum(nil)
+	var offset = sum[len(sum)-1] & 0x0f
+	var value = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	var modulus uint32 = 1
+	for i := 0; i < totp_digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", totp_digits, value%modulus), nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	const charset = "abcdefghijkmnpqrstuvwxyz23456789"
+	var codes, hashes []string
+	for i := 0; i < totp_recovery_codes; i++ {
+		var random = make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		for j := range random {
+			random[j] = charset[int(random[j])%len(charset)]
+		}
+		var code = string(random[:5]) + "-" + string(random[5:])
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), 5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+func getTOTPURL(username string, secret string) string {
+	var values = url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totp_issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totp_digits))
+	values.Set("period", fmt.Sprint(totp_period))
+	return "otpauth://totp/" + url.PathEscape(totp_issuer+":"+username) + "?" + values.Encode()
+}
+
+func getUserTOTP(username string) (models.UserTOTP, error) {
+	var totp models.UserTOTP
+	record, err := database.FetchRecord(database.USER_TOTP_TABLE_NAME, username)
+	if err != nil {
+		return totp, err
+	}
+	err = json.Unmarshal([]byte(record), &totp)
+	return totp, err
+}
+
+func saveUserTOTP(totp *models.UserTOTP) error {
+	data, err := json.Marshal(totp)
+	if err != nil {
+		return err
+	}
+	return database.Insert(totp.UserName, string(data), database.USER_TOTP_TABLE_NAME)
+}
+
+// getTOTPSecretKey - the key signing the tokens issued between the password and TOTP steps, never valid as a user jwt,
+// shared by all servers through the database
+func getTOTPSecretKey() ([]byte, error) {
+	type valueHolder struct {
+		Value []byte `json:"value" bson:"value"`
+	}
+	var key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	var data, err = json.Marshal(&valueHolder{Value: key})
+	if err != nil {
+		return nil, err
+	}
+	record, err := FetchAuthSecret(totp_auth_key, string(data))
+	if err != nil {
+		return nil, err
+	}
+	var holder valueHolder
+	if err = json.Unmarshal([]byte(record), &holder); err != nil {
+		return nil, err
+	}
+	return holder.Value, nil
+}
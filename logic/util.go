@@ -2,15 +2,17 @@
 package logic
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"log"
+	"errors"
 	"math/rand"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/servercfg"
@@ -24,6 +26,16 @@ func IsBase64(s string) bool {
 	return err == nil
 }
 
+// StringSliceContains - sees if a string slice contains a string element
+func StringSliceContains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
 // CheckEndpoint - checks if an endpoint is valid
 func CheckEndpoint(endpoint string) bool {
 	endpointarr := strings.Split(endpoint, ":")
@@ -34,25 +46,28 @@ func CheckEndpoint(endpoint string) bool {
 func SetNetworkServerPeers(node *models.Node) {
 	if currentPeersList, err := GetSystemPeers(node); err == nil {
 		if database.SetPeers(currentPeersList, node.Network) {
-			Log("set new peers on network "+node.Network, 1)
+			logger.New(logger.SERVER).With("network", node.Network).Log(logger.Verbose, "set new peers on network")
+			// hole punched endpoints are not tracked per node, peers need the full list again
+			if err = SetNetworkNodesLastModified(node.Network); err != nil {
+				logger.New(logger.SERVER).With("network", node.Network).With("error", err.Error()).Log(logger.Verbose, "could not update network")
+			}
 		}
 	} else {
-		Log("could not set peers on network "+node.Network+"\n"+err.Error(), 1)
+		logger.New(logger.SERVER).With("network", node.Network).With("error", err.Error()).Log(logger.Verbose, "could not set peers on network")
 	}
 }
 
-// DeleteNode - deletes a node from database or moves into delete nodes table
-func DeleteNode(node *models.Node, exterminate bool) error {
+// DeleteNode - deletes a node from database or moves into delete nodes table, ctx carries the id of the request logged with the deletion
+func DeleteNode(ctx context.Context, node *models.Node, exterminate bool) error {
 	var err error
-	node.SetID()
 	var key = node.ID
 	if !exterminate {
-		args := strings.Split(key, "###")
-		node, err := GetNode(args[0], args[1])
+		node, err := GetNodeByID(key)
 		if err != nil {
 			return err
 		}
 		node.Action = models.NODE_DELETE
+		node.SetLastModified() // deleted nodes are purged some time after their deletion
 		nodedata, err := json.Marshal(&node)
 		if err != nil {
 			return err
@@ -63,14 +78,27 @@ func DeleteNode(node *models.Node, exterminate bool) error {
 		}
 	} else {
 		if err := database.DeleteRecord(database.DELETED_NODES_TABLE_NAME, key); err != nil {
-			Log(err.Error(), 2)
+			RequestLogger(ctx, logger.SERVER).With("node", key).With("error", err.Error()).Log(logger.Debug, "could not remove deleted node record")
 		}
 	}
 	if err = database.DeleteRecord(database.NODES_TABLE_NAME, key); err != nil {
 		return err
 	}
-	if servercfg.IsDNSMode() {
-		err = SetDNS()
+	var log = RequestLogger(ctx, logger.SERVER).With("node", node.ID).With("network", node.Network)
+	if err = RevokeNodeCertificate(node); err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "could not revoke certificate of node")
+	}
+	if err = SetNetworkNodesLastModified(node.Network); err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "could not update network")
+	}
+	if err = RemoveEmptyHost(node.HostID); err != nil {
+		log.With("host", node.HostID).With("error", err.Error()).Log(logger.Verbose, "could not remove host")
+	}
+	if err = PublishEvent(models.Event{Type: models.EVENT_NODE_DELETED, Network: node.Network, Node: node, RequestID: GetRequestID(ctx)}); err != nil {
+		log.With("error", err.Error()).Log(logger.Verbose, "could not handle deletion of node")
+	}
+	if node.IsServer != "yes" {
+		return nil
 	}
 	return removeLocalServer(node)
 }
@@ -78,16 +106,29 @@ func DeleteNode(node *models.Node, exterminate bool) error {
 // CreateNode - creates a node in database
 func CreateNode(node models.Node, networkName string) (models.Node, error) {
 
-	//encrypt that password so we never see it
-	hash, err := bcrypt.GenerateFromPassword([]byte(node.Password), 5)
+	if node.Name != models.NODE_SERVER_NAME {
+		if err := checkTenantNodeLimit(networkName); err != nil {
+			return node, err
+		}
+	}
+	var err error
+	// nodes with an identity key may join without a password
+	if node.Password != "" || node.IdentityKey == "" {
+		//encrypt that password so we never see it
+		var hash []byte
+		hash, err = bcrypt.GenerateFromPassword([]byte(node.Password), 5)
 
-	if err != nil {
-		return node, err
+		if err != nil {
+			return node, err
+		}
+		//set password to encrypted password
+		node.Password = string(hash)
 	}
-	//set password to encrypted password
-	node.Password = string(hash)
 
 	node.Network = networkName
+	// ids are assigned by the server, never by the client
+	node.ID = ""
+	node.SetID()
 	if node.Name == models.NODE_SERVER_NAME {
 		node.IsServer = "yes"
 	}
@@ -98,7 +139,12 @@ func CreateNode(node models.Node, networkName string) (models.Node, error) {
 			node.DNSOn = "no"
 		}
 	}
+	// the expiry is set by the server, from the access key or the network default
+	node.ExpirationDateTime = 0
+	// joining counts as a check in
+	node.SetLastCheckIn()
 	SetNodeDefaults(&node)
+	node.Status = ""
 	node.Address, err = UniqueAddress(networkName)
 	if err != nil {
 		return node, err
@@ -108,7 +154,7 @@ func CreateNode(node models.Node, networkName string) (models.Node, error) {
 		return node, err
 	}
 	//Create a JWT for the node
-	tokenString, _ := CreateJWT(node.MacAddress, networkName)
+	tokenString, _ := CreateJWT(node.ID, node.MacAddress, networkName)
 	if tokenString == "" {
 		//returnErrorResponse(w, r, errorResponse)
 		return node, err
@@ -117,15 +163,14 @@ func CreateNode(node models.Node, networkName string) (models.Node, error) {
 	if err != nil {
 		return node, err
 	}
-	key, err := GetRecordKey(node.MacAddress, node.Network)
-	if err != nil {
+	if err = setNodeHost(&node); err != nil {
 		return node, err
 	}
 	nodebytes, err := json.Marshal(&node)
 	if err != nil {
 		return node, err
 	}
-	err = database.Insert(key, string(nodebytes), database.NODES_TABLE_NAME)
+	err = database.Insert(node.ID, string(nodebytes), database.NODES_TABLE_NAME)
 	if err != nil {
 		return node, err
 	}
@@ -133,10 +178,36 @@ func CreateNode(node models.Node, networkName string) (models.Node, error) {
 		DecrimentKey(node.Network, node.AccessKey)
 	}
 	SetNetworkNodesLastModified(node.Network)
-	if servercfg.IsDNSMode() {
-		err = SetDNS()
+	return node, PublishEvent(models.Event{Type: models.EVENT_NODE_CREATED, Network: node.Network, Node: &node})
+}
+
+// NetworkNodesUpdatePullChanges - tells nodes on network to pull
+func NetworkNodesUpdatePullChanges(networkName string) error {
+
+	collections, err := database.FetchRecords(database.NODES_TABLE_NAME)
+	if err != nil {
+		if database.IsEmptyRecord(err) {
+			return nil
+		}
+		return err
 	}
-	return node, err
+
+	for _, value := range collections {
+		var node models.Node
+		err := json.Unmarshal([]byte(value), &node)
+		if err != nil {
+			return err
+		}
+		if node.Network == networkName {
+			node.PullChanges = "yes"
+			data, err := json.Marshal(&node)
+			if err != nil {
+				return err
+			}
+			database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
+		}
+	}
+	return SetNetworkNodesLastModified(networkName)
 }
 
 // SetNetworkNodesLastModified - sets the network nodes last modified
@@ -157,28 +228,33 @@ func SetNetworkNodesLastModified(networkName string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return PublishEvent(models.Event{Type: models.EVENT_PEERS_CHANGED, Network: networkName})
 }
 
-// GetNode - fetches a node from database
-func GetNode(macaddress string, network string) (models.Node, error) {
+// GetNode - fetches a node of a network from database by its id
+func GetNode(nodeid string, network string) (models.Node, error) {
 	var node models.Node
 
-	key, err := GetRecordKey(macaddress, network)
-	if err != nil {
-		return node, err
+	if nodeid == "" || network == "" {
+		return node, errors.New("unable to get record key")
 	}
-	data, err := database.FetchRecord(database.NODES_TABLE_NAME, key)
+	data, err := database.FetchRecord(database.NODES_TABLE_NAME, nodeid)
 	if err != nil {
 		if data == "" {
-			data, err = database.FetchRecord(database.DELETED_NODES_TABLE_NAME, key)
+			data, err = database.FetchRecord(database.DELETED_NODES_TABLE_NAME, nodeid)
 			err = json.Unmarshal([]byte(data), &node)
 		}
+		if err == nil && node.Network != network {
+			return models.Node{}, errors.New("node " + nodeid + " does not belong to network " + network)
+		}
 		return node, err
 	}
 	if err = json.Unmarshal([]byte(data), &node); err != nil {
 		return node, err
 	}
+	if node.Network != network {
+		return models.Node{}, errors.New("node " + nodeid + " does not belong to network " + network)
+	}
 	SetNodeDefaults(&node)
 
 	return node, err
@@ -192,19 +268,19 @@ func GetNodePeers(networkName string, excludeRelayed bool) ([]models.Node, error
 		if database.IsEmptyRecord(err) {
 			return peers, nil
 		}
-		Log(err.Error(), 2)
+		logger.New(logger.SERVER).With("network", networkName).With("error", err.Error()).Log(logger.Debug, "could not fetch nodes")
 		return nil, err
 	}
 	udppeers, errN := database.GetPeers(networkName)
 	if errN != nil {
-		Log(errN.Error(), 2)
+		logger.New(logger.SERVER).With("network", networkName).With("error", errN.Error()).Log(logger.Debug, "could not fetch hole punched endpoints")
 	}
 	for _, value := range collection {
 		var node models.Node
 		var peer models.Node
 		err := json.Unmarshal([]byte(value), &node)
 		if err != nil {
-			Log(err.Error(), 2)
+			logger.New(logger.SERVER).With("network", networkName).With("error", err.Error()).Log(logger.Debug, "could not parse node")
 			continue
 		}
 		if node.IsEgressGateway == "yes" { // handle egress stuff
@@ -213,7 +289,7 @@ func GetNodePeers(networkName string, excludeRelayed bool) ([]models.Node, error
 		}
 		allow := node.IsRelayed != "yes" || !excludeRelayed
 
-		if node.Network == networkName && node.IsPending != "yes" && allow {
+		if node.Network == networkName && !excludedFromPeers(&node) && allow {
 			peer = setPeerInfo(node)
 			if node.UDPHolePunch == "yes" && errN == nil && CheckEndpoint(udppeers[node.PublicKey]) {
 				endpointstring := udppeers[node.PublicKey]
@@ -241,8 +317,27 @@ func GetNodePeers(networkName string, excludeRelayed bool) ([]models.Node, error
 	return peers, err
 }
 
-// GetPeersList - gets the peers of a given network
+// GetPeersList - gets the peers of a given network, computed lists are cached until peers of the network change
 func GetPeersList(networkName string, excludeRelayed bool, relayedNodeAddr string) ([]models.Node, error) {
+	var key = peerCacheKey{network: networkName, excludeRelayed: excludeRelayed, relayedNodeAddr: relayedNodeAddr}
+	network, err := GetNetwork(networkName)
+	if err != nil {
+		return computePeersList(networkName, excludeRelayed, relayedNodeAddr)
+	}
+	if peers, ok := getCachedPeers(key, network.NodesLastModified); ok {
+		return peers, nil
+	}
+	var generation = getPeerCacheGeneration(networkName)
+	peers, err := computePeersList(networkName, excludeRelayed, relayedNodeAddr)
+	if err != nil {
+		return peers, err
+	}
+	storeCachedPeers(key, generation, network.NodesLastModified, peers)
+	return copyPeers(peers), nil
+}
+
+// computePeersList - computes the peers of a given network from the database
+func computePeersList(networkName string, excludeRelayed bool, relayedNodeAddr string) ([]models.Node, error) {
 	var peers []models.Node
 	var relayNode models.Node
 	var err error
@@ -308,29 +403,23 @@ func setPeerInfo(node models.Node) models.Node {
 	peer.IngressGatewayRange = node.IngressGatewayRange
 	peer.IsIngressGateway = node.IsIngressGateway
 	peer.IsPending = node.IsPending
+	peer.LastPeerUpdate = node.LastPeerUpdate
 	return peer
 }
 
-func Log(message string, loglevel int) {
-	log.SetFlags(log.Flags() &^ (log.Llongfile | log.Lshortfile))
-	if int32(loglevel) <= servercfg.GetVerbose() && servercfg.GetVerbose() >= 0 {
-		log.Println("[netmaker] " + message)
-	}
-}
-
 // == Private Methods ==
 
 func setIPForwardingLinux() error {
 	out, err := ncutils.RunCmd("sysctl net.ipv4.ip_forward", true)
 	if err != nil {
-		log.Println("WARNING: Error encountered setting ip forwarding. This can break functionality.")
+		logger.New(logger.SERVER).Error("could not read ip forwarding, this can break functionality", err)
 		return err
 	} else {
 		s := strings.Fields(string(out))
 		if s[2] != "1" {
 			_, err = ncutils.RunCmd("sysctl -w net.ipv4.ip_forward=1", true)
 			if err != nil {
-				log.Println("WARNING: Error encountered setting ip forwarding. You may want to investigate this.")
+				logger.New(logger.SERVER).Error("could not set ip forwarding, you may want to investigate this", err)
 				return err
 			}
 		}
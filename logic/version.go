@@ -0,0 +1,97 @@
+package logic
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/models"
+)
+
+// UNKNOWN_CLIENT_VERSION - the version nodes which never reported theirs are counted under
+const UNKNOWN_CLIENT_VERSION = "unknown"
+
+// CompareVersions - compares two versions like v0.8.5 or 0.9.0-rc1, returns -1, 0 or 1
+// the "v" prefix and pre-release suffixes are ignored, missing parts count as 0
+func CompareVersions(a, b string) int {
+	var partsA, partsB = versionParts(a), versionParts(b)
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var partA, partB int
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+		if partA < partB {
+			return -1
+		} else if partA > partB {
+			return 1
+		}
+	}
+	return 0
+}
+
+// IsVersionValid - checks if a version can be compared
+func IsVersionValid(version string) bool {
+	return versionParts(version) != nil
+}
+
+// IsClientVersionSupported - checks if a netclient version is at least the minimum version, every version is supported without a minimum
+func IsClientVersionSupported(version, minVersion string) bool {
+	if minVersion == "" {
+		return true
+	}
+	return IsVersionValid(version) && CompareVersions(version, minVersion) >= 0
+}
+
+// SetNodeClientVersion - records the netclient version a node reported, without changing anything else on the node
+func SetNodeClientVersion(node *models.Node, version string) error {
+	if version == "" || node.Version == version {
+		return nil
+	}
+	node.Version = version
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return database.Insert(node.ID, string(data), database.NODES_TABLE_NAME)
+}
+
+// GetClientVersions - counts the nodes of a network per netclient version
+func GetClientVersions(network string) (map[string]int, error) {
+	var versions = make(map[string]int)
+	nodes, err := GetNetworkNodes(network)
+	if err != nil {
+		return versions, err
+	}
+	for _, node := range nodes {
+		var version = node.Version
+		if version == "" {
+			version = UNKNOWN_CLIENT_VERSION
+		}
+		versions[version]++
+	}
+	return versions, nil
+}
+
+// versionParts - parses the numeric parts of a version, nil if it is not a version
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return nil
+	}
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil
+		}
+		parts = append(parts, number)
+	}
+	return parts
+}
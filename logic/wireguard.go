@@ -2,15 +2,14 @@ package logic
 
 import (
 	"errors"
-	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"golang.zx2c4.com/wireguard/wgctrl"
@@ -49,8 +48,7 @@ func RemoveConf(iface string, printlog bool) error {
 
 func setWGConfig(node models.Node, network string, peerupdate bool) error {
 
-	node.SetID()
-	peers, hasGateway, gateways, err := GetServerPeers(node.MacAddress, node.Network, node.IsDualStack == "yes", node.IsIngressGateway == "yes")
+	peers, hasGateway, gateways, err := GetServerPeers(node.ID, node.Network, node.IsDualStack == "yes", node.IsIngressGateway == "yes")
 	if err != nil {
 		return err
 	}
@@ -62,10 +60,10 @@ func setWGConfig(node models.Node, network string, peerupdate bool) error {
 		var iface string
 		iface = node.Interface
 		err = setServerPeers(iface, node.PersistentKeepalive, peers)
-		Log("updated peers on server "+node.Name, 2)
+		logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network).Log(logger.Debug, "updated peers on server")
 	} else {
 		err = initWireguard(&node, privkey, peers, hasGateway, gateways)
-		Log("finished setting wg config on server "+node.Name, 3)
+		logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network).Log(logger.Trace, "finished setting wg config on server")
 	}
 	return err
 }
@@ -83,18 +81,20 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 	}
 	defer wgclient.Close()
 
+	var log = logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network)
 	var ifacename string
 	if node.Interface != "" {
 		ifacename = node.Interface
 	} else {
-		Log("no server interface provided to configure", 2)
+		log.Log(logger.Debug, "no server interface provided to configure")
 	}
 	if node.Address == "" {
-		Log("no server address to provided configure", 2)
+		log.Log(logger.Debug, "no server address provided to configure")
 	}
+	log = log.With("interface", ifacename)
 
 	if ncutils.IsKernel() {
-		Log("setting kernel device "+ifacename, 2)
+		log.Log(logger.Debug, "setting kernel device")
 		setKernelDevice(ifacename, node.Address)
 	}
 
@@ -110,10 +110,11 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		var newConf string
 		newConf, _ = ncutils.CreateUserSpaceConf(node.Address, key.String(), strconv.FormatInt(int64(node.ListenPort), 10), node.MTU, node.PersistentKeepalive, peers)
 		confPath := ncutils.GetNetclientPathSpecific() + ifacename + ".conf"
-		Log("writing wg conf file to: "+confPath, 1)
+		log = log.With("path", confPath)
+		log.Log(logger.Verbose, "writing wg conf file")
 		err = ioutil.WriteFile(confPath, []byte(newConf), 0644)
 		if err != nil {
-			Log("error writing wg conf file to "+confPath+": "+err.Error(), 1)
+			log.With("error", err.Error()).Log(logger.Verbose, "could not write wg conf file")
 			return err
 		}
 		// spin up userspace + apply the conf file
@@ -127,7 +128,7 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		time.Sleep(time.Second >> 2)
 		err = applyWGQuickConf(confPath)
 		if err != nil {
-			Log("failed to create wireguard interface", 1)
+			log.With("error", err.Error()).Log(logger.Verbose, "failed to create wireguard interface")
 			return err
 		}
 	} else {
@@ -139,8 +140,7 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		_, err = wgclient.Device(ifacename)
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Println("Device does not exist: ")
-				fmt.Println(err)
+				log.Error("device does not exist", err)
 			} else {
 				return errors.New("Unknown config error: " + err.Error())
 			}
@@ -149,15 +149,14 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		err = wgclient.ConfigureDevice(ifacename, conf)
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Println("Device does not exist: ")
-				fmt.Println(err)
+				log.Error("device does not exist", err)
 			} else {
-				fmt.Printf("This is inconvenient: %v", err)
+				log.Error("could not configure device", err)
 			}
 		}
 
 		if _, err := ncutils.RunCmd(ipExec+" link set down dev "+ifacename, false); err != nil {
-			Log("attempted to remove interface before editing", 2)
+			log.With("error", err.Error()).Log(logger.Debug, "attempted to remove interface before editing")
 			return err
 		}
 
@@ -167,7 +166,7 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		}
 		// set MTU of node interface
 		if _, err := ncutils.RunCmd(ipExec+" link set mtu "+strconv.Itoa(int(node.MTU))+" up dev "+ifacename, true); err != nil {
-			Log("failed to create interface with mtu "+strconv.Itoa(int(node.MTU))+" - "+ifacename, 2)
+			log.With("mtu", node.MTU).With("error", err.Error()).Log(logger.Debug, "failed to create interface with mtu")
 			return err
 		}
 
@@ -181,7 +180,7 @@ func initWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 			}
 		}
 		if node.Address6 != "" && node.IsDualStack == "yes" {
-			log.Println("[netclient] adding address: "+node.Address6, 1)
+			log.With("address6", node.Address6).Log(logger.Verbose, "adding address")
 			_, _ = ncutils.RunCmd(ipExec+" address add dev "+ifacename+" "+node.Address6+"/64", true)
 		}
 	}
@@ -218,20 +217,21 @@ func removeWGQuickConf(confPath string, printlog bool) error {
 
 func setServerPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) error {
 
+	var log = logger.New(logger.SERVER).With("interface", iface)
 	client, err := wgctrl.New()
 	if err != nil {
-		Log("failed to start wgctrl", 0)
+		log.Error("failed to start wgctrl", err)
 		return err
 	}
 
 	device, err := client.Device(iface)
 	if err != nil {
-		Log("failed to parse interface", 0)
+		log.Error("failed to parse interface", err)
 		return err
 	}
 	devicePeers := device.Peers
 	if len(devicePeers) > 1 && len(peers) == 0 {
-		Log("no peers pulled", 1)
+		log.Log(logger.Verbose, "no peers pulled")
 		return err
 	}
 
@@ -242,7 +242,7 @@ func setServerPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) e
 				currentPeer.PublicKey.String() != peer.PublicKey.String() {
 				_, err := ncutils.RunCmd("wg set "+iface+" peer "+currentPeer.PublicKey.String()+" remove", true)
 				if err != nil {
-					log.Println("error removing peer", peer.Endpoint.String())
+					log.With("peer", currentPeer.PublicKey.String()).With("error", err.Error()).Log(logger.Verbose, "error removing peer")
 				}
 			}
 		}
@@ -268,7 +268,7 @@ func setServerPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) e
 				" allowed-ips "+allowedips, true)
 		}
 		if err != nil {
-			Log("error setting peer "+peer.PublicKey.String(), 1)
+			log.With("peer", peer.PublicKey.String()).With("error", err.Error()).Log(logger.Verbose, "error setting peer")
 		}
 	}
 
@@ -282,7 +282,7 @@ func setServerPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) e
 		if shouldDelete {
 			output, err := ncutils.RunCmd("wg set "+iface+" peer "+currentPeer.PublicKey.String()+" remove", true)
 			if err != nil {
-				log.Println(output, "error removing peer", currentPeer.PublicKey.String())
+				log.With("peer", currentPeer.PublicKey.String()).With("output", output).With("error", err.Error()).Log(logger.Verbose, "error removing peer")
 			}
 		}
 	}
@@ -292,7 +292,6 @@ func setServerPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) e
 
 func setWGKeyConfig(node models.Node) error {
 
-	node.SetID()
 	privatekey, err := wgtypes.GeneratePrivateKey()
 	if err != nil {
 		return err
@@ -315,11 +314,12 @@ func setWGKeyConfig(node models.Node) error {
 
 func removeLocalServer(node *models.Node) error {
 	var ifacename = node.Interface
+	var log = logger.New(logger.SERVER).With("node", node.ID).With("network", node.Network).With("interface", ifacename)
 	var err error
 	if ifacename != "" {
 		if !ncutils.IsKernel() {
 			if err = RemoveConf(ifacename, true); err == nil {
-				Log("removed WireGuard interface: "+ifacename, 1)
+				log.Log(logger.Verbose, "removed WireGuard interface")
 			}
 		} else {
 			ipExec, err := exec.LookPath("ip")
@@ -329,8 +329,7 @@ func removeLocalServer(node *models.Node) error {
 			out, err := ncutils.RunCmd(ipExec+" link del "+ifacename, false)
 			dontprint := strings.Contains(out, "does not exist") || strings.Contains(out, "Cannot find device")
 			if err != nil && !dontprint {
-				Log("error running command: "+ipExec+" link del "+ifacename, 1)
-				Log(out, 1)
+				log.With("output", out).With("error", err.Error()).Log(logger.Verbose, "could not delete interface")
 			}
 			if node.PostDown != "" {
 				runcmds := strings.Split(node.PostDown, "; ")
@@ -4,62 +4,129 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gravitl/netmaker/auth"
+	"github.com/gravitl/netmaker/config"
 	controller "github.com/gravitl/netmaker/controllers"
 	"github.com/gravitl/netmaker/database"
 	"github.com/gravitl/netmaker/functions"
 	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"github.com/gravitl/netmaker/servercfg"
 	"github.com/gravitl/netmaker/serverctl"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 )
 
 // Start DB Connection and start API Request Handler
 func main() {
-	fmt.Println(models.RetrieveLogo()) // print the logo
-	initialize()                       // initial db and grpc server
-	defer database.CloseDB()
-	startControllers() // start the grpc or rest endpoints
+	fmt.Println(models.RetrieveLogo())  // print the logo
+	initialize()                        // initial db and grpc server
+	go reloadConfigOnHangup()           // apply config file changes on SIGHUP
+	startControllers(shutdownContext()) // start the grpc or rest endpoints, returns once they have drained
+	database.CloseDB()
+	logger.New(logger.SERVER).Log(logger.Info, "Closed DB connection.")
+}
+
+// grpcShutdownTimeout - how long in-flight GRPC calls may take to finish on shutdown
+const grpcShutdownTimeout = 30 * time.Second
+
+// shutdownContext - returns a context cancelled on SIGINT or SIGTERM, a second signal exits immediately
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		logger.New(logger.SERVER).With("signal", sig.String()).Log(logger.Info, "received signal, shutting down")
+		cancel()
+		<-c
+		logger.New(logger.SERVER).Log(logger.Info, "received second signal, exiting")
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// reloadConfigOnHangup - reloads the config file on every SIGHUP, invalid files are reported and left unapplied
+func reloadConfigOnHangup() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		result, err := servercfg.Reload()
+		if err != nil {
+			logger.New(logger.SERVER).Error("config not reloaded", err)
+			continue
+		}
+		logger.New(logger.SERVER).With("file", config.ConfigFile()).With("changed", strings.Join(result.Applied, ", ")).Log(logger.Info, "config reloaded")
+		if len(result.Overridden) > 0 {
+			logger.New(logger.SERVER).With("ignored", strings.Join(result.Overridden, ", ")).Log(logger.Info, "config changes ignored as they are set by env")
+		}
+		if result.NeedRestart {
+			logger.New(logger.SERVER).Log(logger.Info, "config has other changes which apply after a restart")
+		}
+	}
 }
 
 func initialize() { // Client Mode Prereq Check
 	var err error
 
-	if err = database.InitializeDatabase(); err != nil {
-		logic.Log("Error connecting to database", 0)
+	if err = servercfg.Validate(); err != nil {
 		log.Fatal(err)
 	}
-	logic.Log("database successfully connected", 0)
+	logger.SetFormat(servercfg.GetLogFormat())
+	servercfg.SetLogLevels()
+
+	if err = database.InitializeDatabase(); err != nil {
+		logger.New(logger.SERVER).Error("could not connect to database", err)
+		os.Exit(1)
+	}
+	logger.New(logger.SERVER).Log(logger.Info, "database successfully connected")
+
+	if err = logic.MigrateNodeIDs(); err != nil {
+		logger.New(logger.SERVER).Error("could not migrate nodes to server assigned ids", err)
+		os.Exit(1)
+	}
+
+	if err = logic.MigrateNodeHosts(); err != nil {
+		logger.New(logger.SERVER).Error("could not group nodes into hosts", err)
+		os.Exit(1)
+	}
 
 	var authProvider = auth.InitializeAuthProvider()
 	if authProvider != "" {
-		logic.Log("OAuth provider, "+authProvider+", initialized", 0)
+		logger.New(logger.SERVER).With("provider", authProvider).Log(logger.Info, "OAuth provider initialized")
 	} else {
-		logic.Log("no OAuth provider found or not configured, continuing without OAuth", 0)
+		logger.New(logger.SERVER).Log(logger.Info, "no OAuth provider found or not configured, continuing without OAuth")
 	}
 
 	if servercfg.IsClientMode() != "off" {
 		output, err := ncutils.RunCmd("id -u", true)
 		if err != nil {
-			logic.Log("Error running 'id -u' for prereq check. Please investigate or disable client mode.", 0)
-			log.Fatal(output, err)
+			logger.New(logger.SERVER).With("output", output).Error("could not run 'id -u' for prereq check, investigate or disable client mode", err)
+			os.Exit(1)
 		}
 		uid, err := strconv.Atoi(string(output[:len(output)-1]))
 		if err != nil {
-			logic.Log("Error retrieving uid from 'id -u' for prereq check. Please investigate or disable client mode.", 0)
-			log.Fatal(err)
+			logger.New(logger.SERVER).Error("could not read uid from 'id -u' for prereq check, investigate or disable client mode", err)
+			os.Exit(1)
 		}
 		if uid != 0 {
 			log.Fatal("To run in client mode requires root privileges. Either disable client mode or run with sudo.")
@@ -77,30 +144,40 @@ func initialize() { // Client Mode Prereq Check
 	}
 }
 
-func startControllers() {
+func startControllers(ctx context.Context) {
 	var waitnetwork sync.WaitGroup
 	//Run Agent Server
 	if servercfg.IsAgentBackend() {
 		if !(servercfg.DisableRemoteIPCheck()) && servercfg.GetGRPCHost() == "127.0.0.1" {
 			err := servercfg.SetHost()
 			if err != nil {
-				logic.Log("Unable to Set host. Exiting...", 0)
-				log.Fatal(err)
+				logger.New(logger.SERVER).Error("could not set host, exiting", err)
+				os.Exit(1)
 			}
 		}
 		waitnetwork.Add(1)
-		go runGRPC(&waitnetwork)
+		go runGRPC(ctx, &waitnetwork)
 	}
 
+	// periodic work, the server node check ins included
+	logic.RegisterMaintenanceJobs()
 	if servercfg.IsClientMode() == "on" {
-		waitnetwork.Add(1)
-		go runClient(&waitnetwork)
+		logic.RegisterJob(logic.Job{
+			Name:        "servercheckin",
+			Description: "checks in the node of this server on every network",
+			Interval: func() time.Duration {
+				return time.Duration(servercfg.GetServerCheckinInterval()) * time.Second
+			},
+			Run: serverctl.HandleContainedClient,
+		})
 	}
+	waitnetwork.Add(1)
+	go runScheduler(ctx, &waitnetwork)
 
 	if servercfg.IsDNSMode() {
 		err := logic.SetDNS()
 		if err != nil {
-			logic.Log("error occurred initializing DNS: "+err.Error(), 0)
+			logger.New(logger.SERVER).Error("error occurred initializing DNS", err)
 		}
 	}
 	//Run Rest Server
@@ -108,35 +185,29 @@ func startControllers() {
 		if !servercfg.DisableRemoteIPCheck() && servercfg.GetAPIHost() == "127.0.0.1" {
 			err := servercfg.SetHost()
 			if err != nil {
-				logic.Log("Unable to Set host. Exiting...", 0)
-				log.Fatal(err)
+				logger.New(logger.SERVER).Error("could not set host, exiting", err)
+				os.Exit(1)
 			}
 		}
 		waitnetwork.Add(1)
-		controller.HandleRESTRequests(&waitnetwork)
+		go controller.HandleRESTRequests(ctx, &waitnetwork)
 	}
 	if !servercfg.IsAgentBackend() && !servercfg.IsRestBackend() {
-		logic.Log("No Server Mode selected, so nothing is being served! Set either Agent mode (AGENT_BACKEND) or Rest mode (REST_BACKEND) to 'true'.", 0)
+		logger.New(logger.SERVER).Log(logger.Info, "No Server Mode selected, so nothing is being served! Set either Agent mode (AGENT_BACKEND) or Rest mode (REST_BACKEND) to 'true'.")
 	}
 
 	waitnetwork.Wait()
-	logic.Log("exiting", 0)
+	logger.New(logger.SERVER).Log(logger.Info, "exiting")
 }
 
-func runClient(wg *sync.WaitGroup) {
+// runScheduler - runs the scheduled jobs until shutdown, a job in progress is finished first
+func runScheduler(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
-	go func() {
-		for {
-			if err := serverctl.HandleContainedClient(); err != nil {
-				// PASS
-			}
-			var checkintime = time.Duration(servercfg.GetServerCheckinInterval()) * time.Second
-			time.Sleep(checkintime)
-		}
-	}()
+	logic.RunScheduler(ctx)
+	logger.New(logger.SERVER).Log(logger.Info, "stopped scheduled jobs")
 }
 
-func runGRPC(wg *sync.WaitGroup) {
+func runGRPC(ctx context.Context, wg *sync.WaitGroup) {
 
 	defer wg.Done()
 
@@ -152,14 +223,44 @@ func runGRPC(wg *sync.WaitGroup) {
 		log.Fatalf("[netmaker] Unable to listen on port "+grpcport+", error: %v", err)
 	}
 
-	s := grpc.NewServer(
-		authServerUnaryInterceptor(),
-	)
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(controller.GRPCUnaryInterceptors()...),
+		grpc.ChainStreamInterceptor(controller.GRPCStreamInterceptors()...),
+		// netclients ping their peer streams to keep them open through proxies
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: 20 * time.Second, PermitWithoutStream: true}),
+	}
+	if servercfg.IsGRPCMTLS() {
+		tlsConfig, err := logic.GetGRPCServerTLSConfig()
+		if err != nil {
+			log.Fatalf("[netmaker] Unable to set up mutual TLS for GRPC, error: %v", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		logger.New(logger.SERVER).Log(logger.Info, "GRPC requires client certificates issued to nodes")
+	}
+	s := grpc.NewServer(serverOpts...)
 	// Create NodeService type
 	srv := &controller.NodeServiceServer{}
 
 	// Register the service with the server
 	nodepb.RegisterNodeServiceServer(s, srv)
+	// the typed v2 service is served alongside for netclients which support it
+	nodepbv2.RegisterNodeServiceServer(s, &controller.NodeServiceServerV2{})
+	if minVersion := servercfg.GetMinClientVersion(); minVersion != "" {
+		if !logic.IsVersionValid(minVersion) {
+			logger.New(logger.SERVER).With("version", minVersion).Log(logger.Info, "minimum netclient version is not a version, no netclient will be accepted")
+		} else {
+			logger.New(logger.SERVER).With("version", minVersion).Log(logger.Verbose, "accepting netclients from version")
+		}
+	}
+	// standard health checks for load balancers, reflection for tools like grpcurl
+	healthServer := controller.NewGRPCHealthServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	stopHealthChecks := make(chan struct{})
+	go controller.RunGRPCHealthChecks(healthServer, stopHealthChecks)
+	if servercfg.IsGRPCReflection() {
+		reflection.Register(s)
+		logger.New(logger.SERVER).Log(logger.Info, "gRPC server reflection enabled")
+	}
 
 	// Start the server in a child routine
 	go func() {
@@ -167,32 +268,25 @@ func runGRPC(wg *sync.WaitGroup) {
 			log.Fatalf("Failed to serve: %v", err)
 		}
 	}()
-	logic.Log("Agent Server successfully started on port "+grpcport+" (gRPC)", 0)
-
-	// Right way to stop the server using a SHUTDOWN HOOK
-	// Create a channel to receive OS signals
-	c := make(chan os.Signal)
-
-	// Relay os.Interrupt to our channel (os.Interrupt = CTRL+C)
-	// Ignore other incoming signals
-	signal.Notify(c, os.Interrupt)
-
-	// Block main routine until a signal is received
-	// As long as user doesn't press CTRL+C a message is not passed and our main routine keeps running
-	<-c
-
-	// After receiving CTRL+C Properly stop the server
-	logic.Log("Stopping the Agent server...", 0)
-	s.Stop()
-	listener.Close()
-	logic.Log("Agent server closed..", 0)
-	logic.Log("Closed DB connection.", 0)
-}
+	logger.New(logger.SERVER).With("port", grpcport).Log(logger.Info, "Agent Server successfully started (gRPC)")
 
-func authServerUnaryInterceptor() grpc.ServerOption {
-	return grpc.UnaryInterceptor(controller.AuthServerUnaryInterceptor)
-}
+	// Block until shutdown
+	<-ctx.Done()
 
-// func authServerStreamInterceptor() grpc.ServerOption {
-// 	return grpc.StreamInterceptor(controller.AuthServerStreamInterceptor)
-// }
+	// Report not serving so load balancers drain, end the peer streams, then wait for in-flight calls
+	logger.New(logger.SERVER).Log(logger.Info, "Stopping the Agent server...")
+	close(stopHealthChecks)
+	controller.ClosePeerStreams()
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grpcShutdownTimeout):
+		logger.New(logger.SERVER).Log(logger.Info, "GRPC calls did not finish in time, closing them")
+		s.Stop()
+	}
+	logger.New(logger.SERVER).Log(logger.Info, "Agent server closed..")
+}
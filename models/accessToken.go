@@ -21,6 +21,8 @@ type ServerConfig struct {
 	GRPCHost        string `json:"grpchost"`
 	GRPCPort        string `json:"grpcport"`
 	GRPCSSL         string `json:"grpcssl"`
+	GRPCMTLS        string `json:"grpcmtls"`
+	GRPCCA          string `json:"grpcca"`
 	CheckinInterval string `json:"checkininterval"`
 }
 
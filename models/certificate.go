@@ -0,0 +1,10 @@
+package models
+
+// NodeCertificate - a client certificate issued to a node for mutual TLS on the GRPC endpoint
+type NodeCertificate struct {
+	Serial    string `json:"serial" bson:"serial"`
+	NodeID    string `json:"nodeid" bson:"nodeid"`
+	Network   string `json:"network" bson:"network"`
+	NotAfter  int64  `json:"notafter" bson:"notafter"`
+	RevokedAt int64  `json:"revokedat" bson:"revokedat"` // 0 while the certificate is valid
+}
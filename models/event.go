@@ -0,0 +1,35 @@
+package models
+
+// EventType - kind of state change published on the event bus
+type EventType string
+
+const (
+	// EVENT_NODE_CREATED - a node joined a network
+	EVENT_NODE_CREATED EventType = "node.created"
+	// EVENT_NODE_UPDATED - a node was updated, Previous holds the node before the update
+	EVENT_NODE_UPDATED EventType = "node.updated"
+	// EVENT_NODE_DELETED - a node was removed from a network
+	EVENT_NODE_DELETED EventType = "node.deleted"
+	// EVENT_NODE_STATUS_CHANGED - a node went online, stale or offline, Previous holds the node with its former status
+	EVENT_NODE_STATUS_CHANGED EventType = "node.statuschanged"
+	// EVENT_NODE_EXPIRING - a node expires within a day
+	EVENT_NODE_EXPIRING EventType = "node.expiring"
+	// EVENT_NODE_EXPIRED - a node passed its expiration time and was removed from the peer lists of its network
+	EVENT_NODE_EXPIRED EventType = "node.expired"
+	// EVENT_GATEWAY_UPDATED - a node became or stopped being an egress gateway or relay, nodes of the network need to pull changes
+	EVENT_GATEWAY_UPDATED EventType = "node.gatewayupdated"
+	// EVENT_PEERS_CHANGED - the peers of a network may have changed
+	EVENT_PEERS_CHANGED EventType = "network.peerschanged"
+	// EVENT_DNS_UPDATED - a custom DNS entry was created, updated or deleted
+	EVENT_DNS_UPDATED EventType = "dns.updated"
+)
+
+// Event - a state change, Node is set for node events
+// RequestID is the id of the request which caused the change, empty for changes of scheduled jobs
+type Event struct {
+	Type      EventType
+	Network   string
+	Node      *Node
+	Previous  *Node
+	RequestID string
+}
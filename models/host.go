@@ -0,0 +1,12 @@
+package models
+
+// Host - a machine which has a node in one or more networks
+// the endpoint, os and version of a host are shared by all of its nodes
+type Host struct {
+	ID       string `json:"id" bson:"id"`
+	Name     string `json:"name" bson:"name" validate:"required,max=62,hostname_valid"`
+	Endpoint string `json:"endpoint" bson:"endpoint"`
+	OS       string `json:"os" bson:"os"`
+	Version  string `json:"version" bson:"version"`
+	Secret   string `json:"secret,omitempty" bson:"secret,omitempty"` // hashed, proves a joining node runs on this host
+}
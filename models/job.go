@@ -0,0 +1,21 @@
+package models
+
+// JobRun - a single run of a scheduled job
+type JobRun struct {
+	Server   string `json:"server" bson:"server"`
+	Trigger  string `json:"trigger" bson:"trigger"` // interval or manual
+	Started  int64  `json:"started" bson:"started"`
+	Duration int64  `json:"duration" bson:"duration"` // in milliseconds
+	Error    string `json:"error" bson:"error"`       // empty if the run succeeded
+}
+
+// JobStatus - a scheduled job with its recent runs, latest first
+type JobStatus struct {
+	Name        string   `json:"name" bson:"name"`
+	Description string   `json:"description" bson:"description"`
+	Interval    int64    `json:"interval" bson:"interval"` // in seconds
+	LeaderOnly  bool     `json:"leaderonly" bson:"leaderonly"`
+	Running     bool     `json:"running" bson:"running"`
+	NextRun     int64    `json:"nextrun" bson:"nextrun"`
+	Runs        []JobRun `json:"runs" bson:"runs"`
+}
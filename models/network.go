@@ -32,12 +32,15 @@ type Network struct {
 	IsIPv6              string      `json:"isipv6" bson:"isipv6" validate:"checkyesorno"`
 	IsGRPCHub           string      `json:"isgrpchub" bson:"isgrpchub" validate:"checkyesorno"`
 	LocalRange          string      `json:"localrange" bson:"localrange" validate:"omitempty,cidr"`
+	Tenant              string      `json:"tenant,omitempty" bson:"tenant,omitempty"`
 
 	// checkin interval is depreciated at the network level. Set on server with CHECKIN_INTERVAL
 	DefaultCheckInInterval int32  `json:"checkininterval,omitempty" bson:"checkininterval,omitempty" validate:"omitempty,numeric,min=2,max=100000"`
 	DefaultUDPHolePunch    string `json:"defaultudpholepunch" bson:"defaultudpholepunch" validate:"checkyesorno"`
 	DefaultExtClientDNS    string `json:"defaultextclientdns" bson:"defaultextclientdns"`
 	DefaultMTU             int32  `json:"defaultmtu" bson:"defaultmtu"`
+	// seconds a node may stay in the network after joining, 0 for no expiry
+	DefaultNodeExpiry int64 `json:"defaultnodeexpiry" bson:"defaultnodeexpiry" validate:"omitempty,min=0"`
 }
 
 // SaveData - sensitive fields of a network that should be kept the same
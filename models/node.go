@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,6 +22,24 @@ const NODE_DELETE = "delete"
 const NODE_IS_PENDING = "pending"
 const NODE_NOOP = "noop"
 
+// NODE_VERSION_METADATA - gRPC metadata key netclients send their version in
+const NODE_VERSION_METADATA = "netclient-version"
+
+// NODE_STATUS_ONLINE - the node checked in recently
+const NODE_STATUS_ONLINE = "online"
+
+// NODE_STATUS_STALE - the node missed a few check ins
+const NODE_STATUS_STALE = "stale"
+
+// NODE_STATUS_OFFLINE - the node stopped checking in a while ago
+const NODE_STATUS_OFFLINE = "offline"
+
+// NODE_STATUS_PENDING - the node waits for approval
+const NODE_STATUS_PENDING = "pending"
+
+// NODE_STATUS_EXPIRED - the node passed its expiration time
+const NODE_STATUS_EXPIRED = "expired"
+
 var seededRand *rand.Rand = rand.New(
 	rand.NewSource(time.Now().UnixNano()))
 
@@ -46,10 +65,11 @@ type Node struct {
 	ExpirationDateTime  int64    `json:"expdatetime" bson:"expdatetime" yaml:"expdatetime"`
 	LastPeerUpdate      int64    `json:"lastpeerupdate" bson:"lastpeerupdate" yaml:"lastpeerupdate"`
 	LastCheckIn         int64    `json:"lastcheckin" bson:"lastcheckin" yaml:"lastcheckin"`
-	MacAddress          string   `json:"macaddress" bson:"macaddress" yaml:"macaddress" validate:"required,min=5,macaddress_unique"`
+	MacAddress          string   `json:"macaddress" bson:"macaddress" yaml:"macaddress" validate:"required,min=5"`
 	// checkin interval is depreciated at the network level. Set on server with CHECKIN_INTERVAL
 	CheckInInterval     int32    `json:"checkininterval" bson:"checkininterval" yaml:"checkininterval"`
-	Password            string   `json:"password" bson:"password" yaml:"password" validate:"required,min=6"`
+	Password            string   `json:"password" bson:"password" yaml:"password" validate:"required_without=IdentityKey,omitempty,min=6"`
+	IdentityKey         string   `json:"identitykey" bson:"identitykey" yaml:"identitykey" validate:"omitempty,base64,len=44"`
 	Network             string   `json:"network" bson:"network" yaml:"network" validate:"network_exists"`
 	IsRelayed           string   `json:"isrelayed" bson:"isrelayed" yaml:"isrelayed"`
 	IsPending           string   `json:"ispending" bson:"ispending" yaml:"ispending"`
@@ -71,7 +91,12 @@ type Node struct {
 	Roaming             string   `json:"roaming" bson:"roaming" yaml:"roaming" validate:"checkyesorno"`
 	IPForwarding        string   `json:"ipforwarding" bson:"ipforwarding" yaml:"ipforwarding" validate:"checkyesorno"`
 	OS                  string   `json:"os" bson:"os" yaml:"os"`
+	Version             string   `json:"version" bson:"version" yaml:"version"`
+	HostID              string   `json:"hostid" bson:"hostid" yaml:"hostid"`
+	CertificateSerial   string   `json:"certificateserial" bson:"certificateserial" yaml:"certificateserial"`
+	HostSecret          string   `json:"hostsecret,omitempty" bson:"hostsecret,omitempty" yaml:"-"` // sent by the client, never stored
 	MTU                 int32    `json:"mtu" bson:"mtu" yaml:"mtu"`
+	Status              string   `json:"status,omitempty" bson:"status,omitempty" yaml:"-"` // computed from the last check in, never stored
 }
 
 type NodesArray []Node
@@ -190,14 +215,32 @@ func (node *Node) SetLastPeerUpdate() {
 	node.LastPeerUpdate = time.Now().Unix()
 }
 
+// SetID - assigns a new id to a node which has none, ids are never derived from the mac address
 func (node *Node) SetID() {
-	node.ID = node.MacAddress + "###" + node.Network
+	if node.ID == "" {
+		node.ID = uuid.Must(uuid.NewV4()).String()
+	}
+}
+
+// HasLegacyID - checks if the node still carries the mac address based id of older releases
+func (node *Node) HasLegacyID() bool {
+	return strings.Contains(node.ID, "###")
+}
+
+// GetLegacyID - gets the mac address based id older releases used as record key
+func (node *Node) GetLegacyID() string {
+	return node.MacAddress + "###" + node.Network
 }
 
 func (node *Node) SetExpirationDateTime() {
 	node.ExpirationDateTime = time.Now().Unix() + TEN_YEARS_IN_SECONDS
 }
 
+// IsExpired - checks if the node passed its expiration time
+func (node *Node) IsExpired() bool {
+	return node.ExpirationDateTime > 0 && node.ExpirationDateTime <= time.Now().Unix()
+}
+
 func (node *Node) SetDefaultName() {
 	if node.Name == "" {
 		node.Name = GenerateNodeName()
@@ -284,9 +327,18 @@ func (newNode *Node) Fill(currentNode *Node) {
 	} else {
 		newNode.Password = currentNode.Password
 	}
+	// the identity key is only recorded when a node joins, never by an update
+	newNode.IdentityKey = currentNode.IdentityKey
 	if newNode.Network == "" {
 		newNode.Network = currentNode.Network
 	}
+	// the host of a node is assigned by the server when the node joins
+	newNode.HostID = currentNode.HostID
+	// so is the serial of the client certificate it was issued
+	newNode.CertificateSerial = currentNode.CertificateSerial
+	if newNode.Version == "" {
+		newNode.Version = currentNode.Version
+	}
 	if newNode.IsPending == "" {
 		newNode.IsPending = currentNode.IsPending
 	}
@@ -380,8 +432,8 @@ func (node *Node) NameInNodeCharSet() bool {
 }
 
 func (node *Node) GetID() (string, error) {
-	if node.MacAddress == "" || node.Network == "" {
+	if node.ID == "" {
 		return "", errors.New("unable to get record key")
 	}
-	return node.MacAddress + "###" + node.Network, nil
+	return node.ID, nil
 }
@@ -3,9 +3,24 @@ package models
 import jwt "github.com/golang-jwt/jwt/v4"
 
 // AuthParams - struct for auth params
+// nodes with an identity key authenticate with a signed challenge nonce instead of a password
 type AuthParams struct {
+	ID         string `json:"id,omitempty"`
 	MacAddress string `json:"macaddress"`
 	Password   string `json:"password"`
+	Network    string `json:"network,omitempty"`
+	Nonce      string `json:"nonce,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+}
+
+// NodeChallenge - nonce issued to a node which must be signed with its identity key
+type NodeChallenge struct {
+	Nonce string `json:"nonce"`
+}
+
+// NodeChallengeMessage - the message a node signs with its identity key to log in
+func NodeChallengeMessage(network string, nodeid string, nonce string) []byte {
+	return []byte("netmaker node login\n" + network + "\n" + nodeid + "\n" + nonce)
 }
 
 // User struct - struct for Users
@@ -14,6 +29,7 @@ type User struct {
 	Password string   `json:"password" bson:"password" validate:"required,min=5"`
 	Networks []string `json:"networks" bson:"networks"`
 	IsAdmin  bool     `json:"isadmin" bson:"isadmin"`
+	Tenant   string   `json:"tenant,omitempty" bson:"tenant,omitempty"`
 }
 
 // ReturnUser - return user struct
@@ -21,6 +37,7 @@ type ReturnUser struct {
 	UserName string   `json:"username" bson:"username" validate:"min=3,max=40,regexp=^(([a-zA-Z,\-,\.]*)|([A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,4})){3,40}$"`
 	Networks []string `json:"networks" bson:"networks"`
 	IsAdmin  bool     `json:"isadmin" bson:"isadmin"`
+	Tenant   string   `json:"tenant,omitempty" bson:"tenant,omitempty"`
 }
 
 // UserAuthParams - user auth params struct
@@ -39,13 +56,48 @@ type UserClaims struct {
 
 // SuccessfulUserLoginResponse - successlogin struct
 type SuccessfulUserLoginResponse struct {
-	UserName  string
-	AuthToken string
+	UserName           string
+	AuthToken          string
+	TOTPRequired       bool   `json:",omitempty"`
+	TOTPEnrollRequired bool   `json:",omitempty"`
+	TOTPToken          string `json:",omitempty"`
+}
+
+// UserTOTP - a user's TOTP second factor
+type UserTOTP struct {
+	UserName       string   `json:"username" bson:"username"`
+	Secret         string   `json:"secret" bson:"secret"`
+	Enabled        bool     `json:"enabled" bson:"enabled"`
+	RecoveryCodes  []string `json:"recoverycodes" bson:"recoverycodes"`
+	LastUsedStep   int64    `json:"lastusedstep" bson:"lastusedstep"`
+	FailedAttempts int      `json:"failedattempts" bson:"failedattempts"`
+	LockedUntil    int64    `json:"lockeduntil" bson:"lockeduntil"`
+}
+
+// TOTPEnrollment - returned once when a user enrolls TOTP
+type TOTPEnrollment struct {
+	Secret        string   `json:"secret"`
+	URL           string   `json:"url"`
+	QRCode        []byte   `json:"qrcode"`
+	RecoveryCodes []string `json:"recoverycodes"`
+}
+
+// TOTPAuthParams - second step of a user login
+type TOTPAuthParams struct {
+	TOTPToken string `json:"totptoken"`
+	Code      string `json:"code"`
+}
+
+// TOTPClaims - claims of the short lived token issued between the password and TOTP steps
+type TOTPClaims struct {
+	UserName string
+	jwt.StandardClaims
 }
 
 // Claims is  a struct that will be encoded to a JWT.
 // jwt.StandardClaims is an embedded type to provide expiry time
 type Claims struct {
+	ID         string
 	Network    string
 	MacAddress string
 	jwt.StandardClaims
@@ -53,6 +105,7 @@ type Claims struct {
 
 // SuccessfulLoginResponse is struct to send the request response
 type SuccessfulLoginResponse struct {
+	ID         string
 	MacAddress string
 	AuthToken  string
 }
@@ -83,6 +136,8 @@ type AccessKey struct {
 	Value        string `json:"value" bson:"value" validate:"omitempty,alphanum,max=16"`
 	AccessString string `json:"accessstring" bson:"accessstring"`
 	Uses         int    `json:"uses" bson:"uses"`
+	// seconds the nodes joining with the key may stay in the network, overrides the network default
+	NodeExpiry int64 `json:"nodeexpiry" bson:"nodeexpiry" validate:"omitempty,min=0"`
 }
 
 // DisplayKey - what is displayed for key
@@ -133,6 +188,12 @@ type ExtPeersResponse struct {
 	KeepAlive    int32  `json:"persistentkeepalive" bson:"persistentkeepalive"`
 }
 
+// NodeExpiryRequest - extends the expiry of a node, to a time or by a number of seconds
+type NodeExpiryRequest struct {
+	ExpirationDateTime int64 `json:"expdatetime" bson:"expdatetime"`
+	ExtendBy           int64 `json:"extendby" bson:"extendby"`
+}
+
 // EgressGatewayRequest - egress gateway request
 type EgressGatewayRequest struct {
 	NodeID      string   `json:"nodeid" bson:"nodeid"`
@@ -150,3 +211,12 @@ type RelayRequest struct {
 	NetID      string   `json:"netid" bson:"netid"`
 	RelayAddrs []string `json:"relayaddrs" bson:"relayaddrs"`
 }
+
+// ClientVersions - netclient versions of the nodes of a network, counted per version
+type ClientVersions struct {
+	Network          string         `json:"network" bson:"network"`
+	ServerVersion    string         `json:"serverversion" bson:"serverversion"`
+	MinClientVersion string         `json:"minclientversion" bson:"minclientversion"`
+	Versions         map[string]int `json:"versions" bson:"versions"`
+	Unsupported      int            `json:"unsupported" bson:"unsupported"`
+}
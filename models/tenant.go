@@ -0,0 +1,10 @@
+package models
+
+// Tenant - an organization which owns its own networks and users
+// DNS entries and ext clients belong to the tenant owning their network
+type Tenant struct {
+	Name         string `json:"name" bson:"name" validate:"required,min=1,max=32,tenantname_valid"`
+	DisplayName  string `json:"displayname,omitempty" bson:"displayname,omitempty" validate:"omitempty,max=64"`
+	NetworkLimit int32  `json:"networklimit" bson:"networklimit" validate:"min=0"` // 0 is unlimited
+	NodeLimit    int32  `json:"nodelimit" bson:"nodelimit" validate:"min=0"`       // 0 is unlimited, counts nodes across all networks of the tenant
+}
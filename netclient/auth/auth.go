@@ -1,8 +1,13 @@
 package auth
 
 import (
-	"encoding/json"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/config"
@@ -12,14 +17,14 @@ import (
 	"context"
 	"io/ioutil"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
 // SetJWT func will used to create the JWT while signing in and signing out
-func SetJWT(client nodepb.NodeServiceClient, network string) (context.Context, error) {
+func SetJWT(client nodepbv2.NodeServiceClient, network string) (context.Context, error) {
 	home := ncutils.GetNetclientPathSpecific()
 	tokentext, err := ioutil.ReadFile(home + "nettoken-" + network)
 	if err != nil {
@@ -42,35 +47,56 @@ func SetJWT(client nodepb.NodeServiceClient, network string) (context.Context, e
 }
 
 // AutoLogin - auto logins whenever client needs to request from server
-func AutoLogin(client nodepb.NodeServiceClient, network string) error {
+func AutoLogin(client nodepbv2.NodeServiceClient, network string) error {
 	home := ncutils.GetNetclientPathSpecific()
 	cfg, err := config.ReadConfig(network)
 	if err != nil {
 		return err
 	}
-	pass, err := RetrieveSecret(network)
-	if err != nil {
-		return err
-	}
-	node := models.Node{
-		Password:   pass,
+	login := &nodepbv2.LoginRequest{
 		MacAddress: cfg.Node.MacAddress,
 		Network:    network,
 	}
-	data, err := json.Marshal(&node)
-	if err != nil {
-		return nil
+	if cfg.Node.ID != "" && !cfg.Node.HasLegacyID() {
+		login.Id = cfg.Node.ID
 	}
-
-	login := &nodepb.Object{
-		Data: string(data),
+	if identityKey, err := RetrieveIdentityKey(network); err == nil {
+		// sign a server issued nonce with the identity key recorded at join
+		challenge, err := client.RequestChallenge(context.TODO(), &nodepbv2.ChallengeRequest{
+			Id:         login.Id,
+			MacAddress: login.MacAddress,
+			Network:    network,
+		})
+		if err != nil {
+			return err
+		}
+		login.Nonce = challenge.Nonce
+		login.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(identityKey, models.NodeChallengeMessage(network, login.Id, login.Nonce)))
+	} else {
+		pass, err := RetrieveSecret(network)
+		if err != nil {
+			return err
+		}
+		login.Password = pass
+	}
+	var certificateKey []byte
+	if NeedsCertificate(cfg) {
+		// request a client certificate the server requires, or renew it before it expires
+		if login.CertificateRequest, certificateKey, err = NewCertificateRequest(); err != nil {
+			return err
+		}
 	}
 	// RPC call
 	res, err := client.Login(context.TODO(), login)
 	if err != nil {
 		return err
 	}
-	tokenstring := []byte(res.Data)
+	if certificateKey != nil {
+		if err = StoreCertificate(network, certificateKey, res.Certificate); err != nil {
+			return err
+		}
+	}
+	tokenstring := []byte(res.AccessToken)
 	err = ioutil.WriteFile(home+"nettoken-"+network, tokenstring, 0644)
 	if err != nil {
 		return err
@@ -91,6 +117,50 @@ func RetrieveSecret(network string) (string, error) {
 	return string(dat), err
 }
 
+// RetrieveHostSecret - fetches the secret shared by all nodes of this machine, creates it on first use
+func RetrieveHostSecret() (string, error) {
+	var file = ncutils.GetNetclientPathSpecific() + "hostsecret"
+	dat, err := ioutil.ReadFile(file)
+	if err == nil {
+		return strings.TrimSpace(string(dat)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(secret)
+	return encoded, ioutil.WriteFile(file, []byte(encoded), 0600)
+}
+
+// GenerateIdentityKey - creates and stores the identity key of a node, returns the public key to record on the server
+func GenerateIdentityKey(network string) (string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(ncutils.GetNetclientPathSpecific()+"identity-"+network, []byte(base64.StdEncoding.EncodeToString(privateKey)), 0600)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// RetrieveIdentityKey - fetches the identity key of a node locally
+func RetrieveIdentityKey(network string) (ed25519.PrivateKey, error) {
+	dat, err := ioutil.ReadFile(ncutils.GetNetclientPathSpecific() + "identity-" + network)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(dat)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid identity key for network " + network)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
 // Configuraion - struct for mac and pass
 type Configuration struct {
 	MacAddress string
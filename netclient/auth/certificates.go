@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/netclient/config"
+	"github.com/gravitl/netmaker/netclient/ncutils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// certificateRenewBefore - how long before it expires a client certificate is renewed at login
+const certificateRenewBefore = 30 * 24 * time.Hour
+
+// GRPCRequestOpts - gets the transport of GRPC requests of a network, with the client certificate of the node when the server requires mutual TLS
+func GRPCRequestOpts(cfg *config.ClientConfig) grpc.DialOption {
+	if cfg.Server.GRPCMTLS != "on" {
+		return ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL)
+	}
+	var network = cfg.Network
+	var fingerprint = cfg.Server.GRPCCA
+	return grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		NextProtos: []string{"h2"},
+		// the server certificate is issued by the authority of the server, not a public one, it is verified below instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			return verifyServerCertificate(network, fingerprint, rawCerts)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			certificate, err := tls.LoadX509KeyPair(certificateFile(network), certificateKeyFile(network))
+			if err != nil {
+				// without a certificate the node can still join and log in to request one
+				return &tls.Certificate{}, nil
+			}
+			return &certificate, nil
+		},
+	}))
+}
+
+// NeedsCertificate - checks if a node has to request a client certificate at login, because it has none or it expires soon
+func NeedsCertificate(cfg *config.ClientConfig) bool {
+	if cfg.Server.GRPCMTLS != "on" {
+		return false
+	}
+	data, err := ioutil.ReadFile(certificateFile(cfg.Network))
+	if err != nil {
+		return true
+	}
+	certificate, err := parseCertificatePEM(data)
+	if err != nil {
+		return true
+	}
+	return time.Until(certificate.NotAfter) < certificateRenewBefore
+}
+
+// NewCertificateRequest - generates a key for a client certificate, returns the PEM encoded certificate request and key
+func NewCertificateRequest() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), nil
+}
+
+// StoreCertificate - stores a client certificate issued by the server with its key and the authority of the server
+func StoreCertificate(network string, key []byte, certificate *nodepbv2.Certificate) error {
+	if certificate == nil || len(certificate.Certificate) == 0 {
+		return errors.New("server did not issue a client certificate")
+	}
+	if err := ioutil.WriteFile(certificateKeyFile(network), key, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(certificateFile(network), certificate.Certificate, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(caFile(network), certificate.CaCertificate, 0600)
+}
+
+// CertificateFiles - the files holding the client certificate of a network, removed when leaving it
+func CertificateFiles(network string) []string {
+	return []string{certificateFile(network), certificateKeyFile(network), caFile(network)}
+}
+
+// verifyServerCertificate - verifies the server certificate was issued by the authority stored at join,
+// or before the authority is stored, by an authority matching the fingerprint of the access token
+func verifyServerCertificate(network string, fingerprint string, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server sent no certificate")
+	}
+	var certificates []*x509.Certificate
+	for _, raw := range rawCerts {
+		certificate, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certificates = append(certificates, certificate)
+	}
+	var roots = x509.NewCertPool()
+	if data, err := ioutil.ReadFile(caFile(network)); err == nil {
+		ca, err := parseCertificatePEM(data)
+		if err != nil {
+			return err
+		}
+		roots.AddCert(ca)
+	} else {
+		var pinned bool
+		for _, certificate := range certificates[1:] {
+			var sum = sha256.Sum256(certificate.Raw)
+			if fingerprint != "" && hex.EncodeToString(sum[:]) == fingerprint {
+				roots.AddCert(certificate)
+				pinned = true
+			}
+		}
+		if !pinned {
+			return errors.New("server certificate authority does not match the access token")
+		}
+	}
+	var intermediates = x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
+
+// parseCertificatePEM - parses a PEM encoded certificate
+func parseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("could not decode certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func certificateFile(network string) string {
+	return ncutils.GetNetclientPathSpecific() + "cert-" + network
+}
+
+func certificateKeyFile(network string) string {
+	return ncutils.GetNetclientPathSpecific() + "certkey-" + network
+}
+
+func caFile(network string) string {
+	return ncutils.GetNetclientPathSpecific() + "ca-" + network
+}
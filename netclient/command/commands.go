@@ -1,13 +1,13 @@
 package command
 
 import (
-	"log"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/netclient/daemon"
 	"github.com/gravitl/netmaker/netclient/functions"
@@ -20,7 +20,7 @@ var (
 )
 
 var (
-	wcclient nodepb.NodeServiceClient
+	wcclient nodepbv2.NodeServiceClient
 )
 
 func Join(cfg config.ClientConfig, privateKey string) error {
@@ -29,12 +29,12 @@ func Join(cfg config.ClientConfig, privateKey string) error {
 	err = functions.JoinNetwork(cfg, privateKey)
 	if err != nil && !cfg.DebugJoin {
 		if !strings.Contains(err.Error(), "ALREADY_INSTALLED") {
-			ncutils.PrintLog("error installing: "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("network", cfg.Network).With("error", err.Error()).Log(logger.Verbose, "error installing")
 			err = functions.LeaveNetwork(cfg.Network)
 			if err != nil {
 				err = functions.WipeLocal(cfg.Network)
 				if err != nil {
-					ncutils.PrintLog("error removing artifacts: "+err.Error(), 1)
+					logger.New(logger.NETCLIENT).With("network", cfg.Network).With("error", err.Error()).Log(logger.Verbose, "error removing artifacts")
 				}
 			}
 			if cfg.Daemon != "off" {
@@ -42,15 +42,15 @@ func Join(cfg config.ClientConfig, privateKey string) error {
 					err = daemon.RemoveSystemDServices()
 				}
 				if err != nil {
-					ncutils.PrintLog("error removing services: "+err.Error(), 1)
+					logger.New(logger.NETCLIENT).With("network", cfg.Network).With("error", err.Error()).Log(logger.Verbose, "error removing services")
 				}
 			}
 		} else {
-			ncutils.PrintLog("success", 0)
+			logger.New(logger.NETCLIENT).With("network", cfg.Network).Log(logger.Info, "success")
 		}
 		return err
 	}
-	ncutils.PrintLog("joined "+cfg.Network, 1)
+	logger.New(logger.NETCLIENT).With("network", cfg.Network).Log(logger.Verbose, "joined network")
 	if cfg.Daemon != "off" {
 		err = daemon.InstallDaemon(cfg)
 	}
@@ -81,6 +81,7 @@ func RunUserspaceDaemon() {
 	}
 	interval := getWindowsInterval()
 	dur := time.Duration(interval) * time.Second
+	go Watch(cfg)
 	for {
 		if err := CheckIn(cfg); err != nil {
 			// pass
@@ -93,13 +94,13 @@ func CheckIn(cfg config.ClientConfig) error {
 	var err error
 
 	if cfg.Network == "" {
-		ncutils.PrintLog("required, '-n', exiting", 0)
+		logger.New(logger.NETCLIENT).Log(logger.Info, "network required, '-n', exiting")
 		os.Exit(1)
 	} else if cfg.Network == "all" {
-		ncutils.PrintLog("running checkin for all networks", 1)
+		logger.New(logger.NETCLIENT).Log(logger.Verbose, "running checkin for all networks")
 		networks, err := ncutils.GetSystemNetworks()
 		if err != nil {
-			ncutils.PrintLog("error retrieving networks, exiting", 1)
+			logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "error retrieving networks, exiting")
 			return err
 		}
 		for _, network := range networks {
@@ -109,9 +110,9 @@ func CheckIn(cfg config.ClientConfig) error {
 			}
 			err = functions.CheckConfig(*currConf)
 			if err != nil {
-				ncutils.PrintLog("error checking in for "+network+" network: "+err.Error(), 1)
+				logger.New(logger.NETCLIENT).With("network", network).With("error", err.Error()).Log(logger.Verbose, "error checking in")
 			} else {
-				ncutils.PrintLog("checked in successfully for "+network, 1)
+				logger.New(logger.NETCLIENT).With("network", network).Log(logger.Verbose, "checked in successfully")
 			}
 		}
 		if len(networks) == 0 {
@@ -129,9 +130,9 @@ func CheckIn(cfg config.ClientConfig) error {
 func Leave(cfg config.ClientConfig) error {
 	err := functions.LeaveNetwork(cfg.Network)
 	if err != nil {
-		ncutils.PrintLog("error attempting to leave network "+cfg.Network, 1)
+		logger.New(logger.NETCLIENT).With("network", cfg.Network).With("error", err.Error()).Log(logger.Verbose, "error attempting to leave network")
 	} else {
-		ncutils.PrintLog("success", 0)
+		logger.New(logger.NETCLIENT).With("network", cfg.Network).Log(logger.Info, "success")
 	}
 	return err
 }
@@ -139,62 +140,95 @@ func Leave(cfg config.ClientConfig) error {
 func Push(cfg config.ClientConfig) error {
 	var err error
 	if cfg.Network == "all" || ncutils.IsWindows() {
-		ncutils.PrintLog("pushing config to server for all networks.", 0)
+		logger.New(logger.NETCLIENT).Log(logger.Info, "pushing config to server for all networks")
 		networks, err := ncutils.GetSystemNetworks()
 		if err != nil {
-			ncutils.PrintLog("error retrieving networks, exiting.", 0)
+			logger.New(logger.NETCLIENT).Error("error retrieving networks, exiting", err)
 			return err
 		}
 		for _, network := range networks {
 			err = functions.Push(network)
 			if err != nil {
-				log.Printf("error pushing network configs for "+network+" network: ", err)
+				logger.New(logger.NETCLIENT).With("network", network).Error("error pushing network config", err)
 			} else {
-				ncutils.PrintLog("pushed network config for "+network, 1)
+				logger.New(logger.NETCLIENT).With("network", network).Log(logger.Verbose, "pushed network config")
 			}
 		}
 		err = nil
 	} else {
 		err = functions.Push(cfg.Network)
 	}
-	ncutils.PrintLog("completed pushing network configs to remote server", 1)
-	ncutils.PrintLog("success", 1)
+	logger.New(logger.NETCLIENT).Log(logger.Verbose, "completed pushing network configs to remote server")
+	logger.New(logger.NETCLIENT).Log(logger.Verbose, "success")
 	return err
 }
 
 func Pull(cfg config.ClientConfig) error {
 	var err error
 	if cfg.Network == "all" {
-		ncutils.PrintLog("No network selected. Running Pull for all networks.", 0)
+		logger.New(logger.NETCLIENT).Log(logger.Info, "no network selected, running pull for all networks")
 		networks, err := ncutils.GetSystemNetworks()
 		if err != nil {
-			ncutils.PrintLog("Error retrieving networks. Exiting.", 1)
+			logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "error retrieving networks, exiting")
 			return err
 		}
 		for _, network := range networks {
 			_, err = functions.Pull(network, true)
 			if err != nil {
-				log.Printf("Error pulling network config for "+network+" network: ", err)
+				logger.New(logger.NETCLIENT).With("network", network).Error("error pulling network config", err)
 			} else {
-				ncutils.PrintLog("pulled network config for "+network, 1)
+				logger.New(logger.NETCLIENT).With("network", network).Log(logger.Verbose, "pulled network config")
 			}
 		}
 		err = nil
 	} else {
 		_, err = functions.Pull(cfg.Network, true)
 	}
-	ncutils.PrintLog("reset network and peer configs", 1)
-	ncutils.PrintLog("success", 1)
+	logger.New(logger.NETCLIENT).Log(logger.Verbose, "reset network and peer configs")
+	logger.New(logger.NETCLIENT).Log(logger.Verbose, "success")
 	return err
 }
 
+// watchScanInterval - how often watching all networks looks for newly joined networks
+const watchScanInterval = time.Minute
+
+// Watch - holds peer streams open and applies peer updates as they happen, for all networks picks up networks joined later
+func Watch(cfg config.ClientConfig) error {
+	if cfg.Network != "all" {
+		return functions.WatchPeers(cfg.Network)
+	}
+	var watching = make(map[string]bool)
+	var done = make(chan string)
+	for {
+		networks, err := ncutils.GetSystemNetworks()
+		if err != nil {
+			logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "error retrieving networks")
+		}
+		for _, network := range networks {
+			if !watching[network] {
+				watching[network] = true
+				logger.New(logger.NETCLIENT).With("network", network).Log(logger.Verbose, "watching peers")
+				go func(network string) {
+					functions.WatchPeers(network)
+					done <- network
+				}(network)
+			}
+		}
+		select {
+		case network := <-done:
+			delete(watching, network)
+		case <-time.After(watchScanInterval):
+		}
+	}
+}
+
 func List(cfg config.ClientConfig) error {
 	err := functions.List(cfg.Network)
 	return err
 }
 
 func Uninstall() error {
-	ncutils.PrintLog("uninstalling netclient", 0)
+	logger.New(logger.NETCLIENT).Log(logger.Info, "uninstalling netclient")
 	err := functions.Uninstall()
 	return err
 }
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
@@ -39,6 +40,8 @@ type ServerConfig struct {
 	APIAddress      string `yaml:"apiaddress"`
 	AccessKey       string `yaml:"accesskey"`
 	GRPCSSL         string `yaml:"grpcssl"`
+	GRPCMTLS        string `yaml:"grpcmtls"`
+	GRPCCA          string `yaml:"grpcca"`
 	GRPCWireGuard   string `yaml:"grpcwg"`
 	CheckinInterval string `yaml:"checkininterval"`
 }
@@ -181,9 +184,6 @@ func (config *ClientConfig) ReadConfig() {
 			fmt.Println("no config or invalid")
 			fmt.Println(err)
 			log.Fatal(err)
-		} else {
-			config.Node.SetID()
-			//config = cfg
 		}
 	}
 }
@@ -284,6 +284,8 @@ func GetCLIConfig(c *cli.Context) (ClientConfig, string, error) {
 		cfg.Server.AccessKey = accesstoken.ClientConfig.Key
 		cfg.Node.LocalRange = accesstoken.ClientConfig.LocalRange
 		cfg.Server.GRPCSSL = accesstoken.ServerConfig.GRPCSSL
+		cfg.Server.GRPCMTLS = accesstoken.ServerConfig.GRPCMTLS
+		cfg.Server.GRPCCA = accesstoken.ServerConfig.GRPCCA
 		cfg.Server.CheckinInterval = accesstoken.ServerConfig.CheckinInterval
 		cfg.Server.GRPCWireGuard = accesstoken.WG.GRPCWireGuard
 		cfg.Server.CoreDNSAddr = accesstoken.ServerConfig.CoreDNSAddr
@@ -415,3 +417,26 @@ func GetNode(network string) models.Node {
 
 	return node
 }
+
+// ReadHostID - reads the id of the host grouping the nodes of this machine, empty before the first join
+func ReadHostID() string {
+	dat, err := ioutil.ReadFile(ncutils.GetNetclientPathSpecific() + "hostid")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+// StoreHostID - stores the id of the host assigned by the server
+func StoreHostID(hostid string) error {
+	return ioutil.WriteFile(ncutils.GetNetclientPathSpecific()+"hostid", []byte(hostid), 0644)
+}
+
+// GetRequestID - gets the id a node refers to itself by in server requests
+// nodes joined with older releases use their mac address until they learn their server assigned id
+func GetRequestID(node *models.Node) string {
+	if node.ID == "" || node.HasLegacyID() {
+		return node.GetLegacyID()
+	}
+	return node.ID
+}
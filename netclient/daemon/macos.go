@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"fmt"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"io/ioutil"
 	"log"
@@ -45,7 +46,7 @@ func CleanupMac() {
 		err = os.Remove("/Library/LaunchDaemons/" + MAC_SERVICE_NAME + ".plist")
 	}
 	if err != nil {
-		ncutils.PrintLog(err.Error(), 1)
+		logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "could not remove the netclient daemon")
 	}
 
 	os.RemoveAll(ncutils.GetNetclientPath())
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 )
 
@@ -69,10 +70,25 @@ Unit=netclient.service
 
 [Install]
 WantedBy=timers.target
+`
+
+	watchservice := `[Unit]
+Description=Netclient Peer Updates
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart=/etc/netclient/netclient watch -n all
+Restart=on-failure
+RestartSec=15s
+
+[Install]
+WantedBy=multi-user.target
 `
 
 	servicebytes := []byte(systemservice)
 	timerbytes := []byte(systemtimer)
+	watchbytes := []byte(watchservice)
 
 	if !ncutils.FileExists("/etc/systemd/system/netclient.service") {
 		err = ioutil.WriteFile("/etc/systemd/system/netclient.service", servicebytes, 0644)
@@ -90,17 +106,27 @@ WantedBy=timers.target
 		}
 	}
 
+	if !ncutils.FileExists("/etc/systemd/system/netclient-watch.service") {
+		err = ioutil.WriteFile("/etc/systemd/system/netclient-watch.service", watchbytes, 0644)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+
 	_, _ = ncutils.RunCmd("systemctl enable netclient.service", true)
 	_, _ = ncutils.RunCmd("systemctl daemon-reload", true)
 	_, _ = ncutils.RunCmd("systemctl enable netclient.timer", true)
 	_, _ = ncutils.RunCmd("systemctl start netclient.timer", true)
+	_, _ = ncutils.RunCmd("systemctl enable netclient-watch.service", true)
+	_, _ = ncutils.RunCmd("systemctl start netclient-watch.service", true)
 	return nil
 }
 
 func CleanupLinux() {
 	err := os.RemoveAll(ncutils.GetNetclientPath())
 	if err != nil {
-		ncutils.PrintLog("Removing netclient binary: "+err.Error(), 1)
+		logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "could not remove the netclient directory")
 	}
 }
 
@@ -114,6 +140,8 @@ func RemoveSystemDServices() error {
 		}
 		ncutils.RunCmd("systemctl disable netclient.service", false)
 		ncutils.RunCmd("systemctl disable netclient.timer", false)
+		ncutils.RunCmd("systemctl stop netclient-watch.service", false)
+		ncutils.RunCmd("systemctl disable netclient-watch.service", false)
 		if ncutils.FileExists("/etc/systemd/system/netclient.service") {
 			err = os.Remove("/etc/systemd/system/netclient.service")
 			if err != nil {
@@ -126,6 +154,12 @@ func RemoveSystemDServices() error {
 				ncutils.Log("Error removing /etc/systemd/system/netclient.timer. Please investigate.")
 			}
 		}
+		if ncutils.FileExists("/etc/systemd/system/netclient-watch.service") {
+			err = os.Remove("/etc/systemd/system/netclient-watch.service")
+			if err != nil {
+				ncutils.Log("Error removing /etc/systemd/system/netclient-watch.service. Please investigate.")
+			}
+		}
 		ncutils.RunCmd("systemctl daemon-reload", false)
 		ncutils.RunCmd("systemctl reset-failed", false)
 		ncutils.Log("removed systemd remnants if any existed")
@@ -2,13 +2,12 @@ package functions
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"os"
 	"runtime"
-	"strings"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
@@ -17,50 +16,44 @@ import (
 	"github.com/gravitl/netmaker/netclient/wireguard"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 	//homedir "github.com/mitchellh/go-homedir"
 )
 
 func isDeleteError(err error) bool {
-	return err != nil && strings.Contains(err.Error(), models.NODE_DELETE)
+	return nodepbv2.GetErrorCode(err) == nodepbv2.ErrorCode_ERROR_CODE_NODE_DELETED
 }
 
 func checkIP(node *models.Node, servercfg config.ServerConfig, cliconf config.ClientConfig, network string) bool {
 	ipchange := false
 	var err error
+	var log = logger.New(logger.NETCLIENT).With("node", node.ID).With("network", network)
 	if node.Roaming == "yes" && node.IsStatic != "yes" {
 		if node.IsLocal == "no" {
 			extIP, err := ncutils.GetPublicIP()
 			if err != nil {
-				ncutils.PrintLog("error encountered checking ip addresses: "+err.Error(), 1)
+				log.With("error", err.Error()).Log(logger.Verbose, "error encountered checking ip addresses")
 			}
 			if node.Endpoint != extIP && extIP != "" {
-				ncutils.PrintLog("endpoint has changed from "+
-					node.Endpoint+" to "+extIP, 1)
-				ncutils.PrintLog("updating address", 1)
+				log.With("previous", node.Endpoint).With("endpoint", extIP).Log(logger.Verbose, "endpoint has changed, updating address")
 				node.Endpoint = extIP
 				ipchange = true
 			}
 			intIP, err := getPrivateAddr()
 			if err != nil {
-				ncutils.PrintLog("error encountered checking ip addresses: "+err.Error(), 1)
+				log.With("error", err.Error()).Log(logger.Verbose, "error encountered checking ip addresses")
 			}
 			if node.LocalAddress != intIP && intIP != "" {
-				ncutils.PrintLog("local Address has changed from "+
-					node.LocalAddress+" to "+intIP, 1)
-				ncutils.PrintLog("updating address", 1)
+				log.With("previous", node.LocalAddress).With("local_address", intIP).Log(logger.Verbose, "local address has changed, updating address")
 				node.LocalAddress = intIP
 				ipchange = true
 			}
 		} else {
 			localIP, err := ncutils.GetLocalIP(node.LocalRange)
 			if err != nil {
-				ncutils.PrintLog("error encountered checking ip addresses: "+err.Error(), 1)
+				log.With("error", err.Error()).Log(logger.Verbose, "error encountered checking ip addresses")
 			}
 			if node.Endpoint != localIP && localIP != "" {
-				ncutils.PrintLog("endpoint has changed from "+
-					node.Endpoint+" to "+localIP, 1)
-				ncutils.PrintLog("updating address", 1)
+				log.With("previous", node.Endpoint).With("endpoint", localIP).Log(logger.Verbose, "endpoint has changed, updating address")
 				node.Endpoint = localIP
 				node.LocalAddress = localIP
 				ipchange = true
@@ -70,12 +63,12 @@ func checkIP(node *models.Node, servercfg config.ServerConfig, cliconf config.Cl
 	if ipchange {
 		err = config.ModConfig(node)
 		if err != nil {
-			ncutils.PrintLog("error modifying config file: "+err.Error(), 1)
+			log.With("error", err.Error()).Log(logger.Verbose, "error modifying config file")
 			return false
 		}
 		err = wireguard.SetWGConfig(network, false)
 		if err != nil {
-			ncutils.PrintLog("error setting wireguard config: "+err.Error(), 1)
+			log.With("error", err.Error()).Log(logger.Verbose, "error setting wireguard config")
 			return false
 		}
 	}
@@ -96,14 +89,16 @@ func checkNodeActions(node *models.Node, networkName string, servercfg config.Se
 		node.IsStatic != "yes" {
 		err := wireguard.SetWGKeyConfig(networkName, servercfg.GRPCAddress)
 		if err != nil {
-			ncutils.PrintLog("unable to process reset keys request: "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("node", node.ID).With("network", networkName).With("error", err.Error()).
+				Log(logger.Verbose, "unable to process reset keys request")
 			return ""
 		}
 	}
 	if node.Action == models.NODE_DELETE || localNode.Action == models.NODE_DELETE {
 		err := RemoveLocalInstance(cfg, networkName)
 		if err != nil {
-			ncutils.PrintLog("error deleting locally: "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("node", node.ID).With("network", networkName).With("error", err.Error()).
+				Log(logger.Verbose, "error deleting locally")
 		}
 		return models.NODE_DELETE
 	}
@@ -165,37 +160,44 @@ func Pull(network string, manual bool) (*models.Node, error) {
 	}
 	var resNode models.Node // just need to fill this with either server calls or client calls
 
-	var header metadata.MD
-	var wcclient nodepb.NodeServiceClient
+	var wcclient nodepbv2.NodeServiceClient
 	var ctx context.Context
 
 	if cfg.Node.IsServer != "yes" {
 		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-			ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+			auth.GRPCRequestOpts(cfg),
+			ncutils.GRPCVersionOpts())
 		if err != nil {
-			ncutils.PrintLog("Cant dial GRPC server: "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("network", network).With("server", cfg.Server.GRPCAddress).With("error", err.Error()).
+				Log(logger.Verbose, "could not dial GRPC server")
 			return nil, err
 		}
 		defer conn.Close()
-		wcclient = nodepb.NewNodeServiceClient(conn)
+		wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 		ctx, err = auth.SetJWT(wcclient, network)
 		if err != nil {
-			ncutils.PrintLog("Failed to authenticate: "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("node", cfg.Node.ID).With("network", network).With("error", err.Error()).Log(logger.Verbose, "failed to authenticate")
 			return nil, err
 		}
 
-		req := &nodepb.Object{
-			Data: node.MacAddress + "###" + node.Network,
-			Type: nodepb.STRING_TYPE,
-		}
-
-		readres, err := wcclient.ReadNode(ctx, req, grpc.Header(&header))
+		readres, err := wcclient.ReadNode(ctx, &nodepbv2.NodeRequest{Id: config.GetRequestID(&node)})
 		if err != nil {
 			return nil, err
 		}
-		if err = json.Unmarshal([]byte(readres.Data), &resNode); err != nil {
-			return nil, err
+		resNode = readres.GetNode().ToModel()
+		if resNode.ID != "" && resNode.ID != cfg.Node.ID {
+			// nodes joined with older releases learn their server assigned id here
+			cfg.Node.ID = resNode.ID
+			if err = config.ModConfig(&cfg.Node); err != nil {
+				return nil, err
+			}
+		}
+		if resNode.HostID != "" && config.ReadHostID() == "" {
+			// nodes joined before hosts existed learn the host grouping this machine
+			if err = config.StoreHostID(resNode.HostID); err != nil {
+				return nil, err
+			}
 		}
 	}
 	// ensure that the OS never changes
@@ -204,7 +206,8 @@ func Pull(network string, manual bool) (*models.Node, error) {
 		// check for interface change
 		if cfg.Node.Interface != resNode.Interface {
 			if err = DeleteInterface(cfg.Node.Interface, cfg.Node.PostDown); err != nil {
-				ncutils.PrintLog("could not delete old interface "+cfg.Node.Interface, 1)
+				logger.New(logger.NETCLIENT).With("node", cfg.Node.ID).With("network", network).With("interface", cfg.Node.Interface).With("error", err.Error()).
+					Log(logger.Verbose, "could not delete old interface")
 			}
 		}
 		resNode.PullChanges = "no"
@@ -214,20 +217,11 @@ func Pull(network string, manual bool) (*models.Node, error) {
 		if err = wireguard.SetWGConfig(network, false); err != nil {
 			return nil, err
 		}
-		nodeData, err := json.Marshal(&resNode)
-		if err != nil {
-			return &resNode, err
-		}
 		if resNode.IsServer != "yes" {
 			if wcclient == nil || ctx == nil {
 				return &cfg.Node, errors.New("issue initializing gRPC client")
 			}
-			req := &nodepb.Object{
-				Data:     string(nodeData),
-				Type:     nodepb.NODE_TYPE,
-				Metadata: "",
-			}
-			_, err = wcclient.UpdateNode(ctx, req, grpc.Header(&header))
+			_, err = wcclient.UpdateNode(ctx, &nodepbv2.NodeMessage{Node: nodepbv2.NewNode(&resNode)})
 			if err != nil {
 				return &resNode, err
 			}
@@ -246,7 +240,7 @@ func Pull(network string, manual bool) (*models.Node, error) {
 	}
 	var bkupErr = config.SaveBackup(network)
 	if bkupErr != nil {
-		ncutils.Log("unable to update backup file")
+		logger.New(logger.NETCLIENT).With("network", network).Error("unable to update backup file", bkupErr)
 	}
 
 	return &resNode, err
@@ -260,24 +254,29 @@ func Push(network string) error {
 		return err
 	}
 	postnode := cfg.Node
-	// always set the OS on client
+	// always set the OS and version on client
 	postnode.OS = runtime.GOOS
+	postnode.Version = ncutils.Version
+	if postnode.HostSecret, err = auth.RetrieveHostSecret(); err != nil {
+		logger.New(logger.NETCLIENT).With("node", postnode.ID).With("network", network).With("error", err.Error()).Log(logger.Verbose, "unable to retrieve host secret")
+	}
 	postnode.SetLastCheckIn()
 
-	var header metadata.MD
-	var wcclient nodepb.NodeServiceClient
+	var wcclient nodepbv2.NodeServiceClient
 	conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-		ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+		auth.GRPCRequestOpts(cfg),
+		ncutils.GRPCVersionOpts())
 	if err != nil {
-		ncutils.PrintLog("Cant dial GRPC server: "+err.Error(), 1)
+		logger.New(logger.NETCLIENT).With("network", network).With("server", cfg.Server.GRPCAddress).With("error", err.Error()).
+			Log(logger.Verbose, "could not dial GRPC server")
 		return err
 	}
 	defer conn.Close()
-	wcclient = nodepb.NewNodeServiceClient(conn)
+	wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 	ctx, err := auth.SetJWT(wcclient, network)
 	if err != nil {
-		ncutils.PrintLog("Failed to authenticate with server: "+err.Error(), 1)
+		logger.New(logger.NETCLIENT).With("node", postnode.ID).With("network", network).With("error", err.Error()).Log(logger.Verbose, "failed to authenticate with server")
 		return err
 	}
 	if postnode.IsPending != "yes" {
@@ -293,24 +292,11 @@ func Push(network string) error {
 			postnode.PublicKey = privateKeyWG.PublicKey().String()
 		}
 	}
-	nodeData, err := json.Marshal(&postnode)
-	if err != nil {
-		return err
-	}
-
-	req := &nodepb.Object{
-		Data:     string(nodeData),
-		Type:     nodepb.NODE_TYPE,
-		Metadata: "",
-	}
-	data, err := wcclient.UpdateNode(ctx, req, grpc.Header(&header))
-	if err != nil {
-		return err
-	}
-	err = json.Unmarshal([]byte(data.Data), &postnode)
+	res, err := wcclient.CheckIn(ctx, &nodepbv2.CheckInRequest{Node: nodepbv2.NewNode(&postnode)})
 	if err != nil {
 		return err
 	}
+	postnode = res.GetNode().ToModel()
 	err = config.ModConfig(&postnode)
 	return err
 }
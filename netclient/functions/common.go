@@ -2,7 +2,6 @@ package functions
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -11,7 +10,8 @@ import (
 	"os/exec"
 	"strings"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
@@ -20,11 +20,10 @@ import (
 	"github.com/gravitl/netmaker/netclient/wireguard"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 var (
-	wcclient nodepb.NodeServiceClient
+	wcclient nodepbv2.NodeServiceClient
 )
 
 // ListPorts - lists ports of WireGuard devices
@@ -108,21 +107,12 @@ func getPrivateAddrBackup() (string, error) {
 	return local, err
 }
 
-func needInterfaceUpdate(ctx context.Context, mac string, network string, iface string) (bool, string, error) {
-	var header metadata.MD
-	req := &nodepb.Object{
-		Data: mac + "###" + network,
-		Type: nodepb.STRING_TYPE,
-	}
-	readres, err := wcclient.ReadNode(ctx, req, grpc.Header(&header))
+func needInterfaceUpdate(ctx context.Context, nodeid string, iface string) (bool, string, error) {
+	readres, err := wcclient.ReadNode(ctx, &nodepbv2.NodeRequest{Id: nodeid})
 	if err != nil {
 		return false, "", err
 	}
-	var resNode models.Node
-	if err := json.Unmarshal([]byte(readres.Data), &resNode); err != nil {
-		return false, iface, err
-	}
-	oldiface := resNode.Interface
+	oldiface := readres.GetNode().GetInterface()
 
 	return iface != oldiface, oldiface, err
 }
@@ -142,13 +132,12 @@ func GetNode(network string) models.Node {
 func Uninstall() error {
 	networks, err := ncutils.GetSystemNetworks()
 	if err != nil {
-		ncutils.PrintLog("unable to retrieve networks: "+err.Error(), 1)
-		ncutils.PrintLog("continuing uninstall without leaving networks", 1)
+		logger.New(logger.NETCLIENT).With("error", err.Error()).Log(logger.Verbose, "unable to retrieve networks, continuing uninstall without leaving networks")
 	} else {
 		for _, network := range networks {
 			err = LeaveNetwork(network)
 			if err != nil {
-				ncutils.PrintLog("Encounter issue leaving network "+network+": "+err.Error(), 1)
+				logger.New(logger.NETCLIENT).With("network", network).With("error", err.Error()).Log(logger.Verbose, "encountered issue leaving network")
 			}
 		}
 	}
@@ -160,7 +149,7 @@ func Uninstall() error {
 	} else if ncutils.IsLinux() {
 		daemon.CleanupLinux()
 	} else if !ncutils.IsKernel() {
-		ncutils.PrintLog("manual cleanup required", 1)
+		logger.New(logger.NETCLIENT).Log(logger.Verbose, "manual cleanup required")
 	}
 
 	return err
@@ -174,35 +163,28 @@ func LeaveNetwork(network string) error {
 	}
 	servercfg := cfg.Server
 	node := cfg.Node
+	var log = logger.New(logger.NETCLIENT).With("node", node.ID).With("network", network)
 
 	if node.IsServer != "yes" {
-		var wcclient nodepb.NodeServiceClient
+		var wcclient nodepbv2.NodeServiceClient
 		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-			ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+			auth.GRPCRequestOpts(cfg),
+			ncutils.GRPCVersionOpts())
 		if err != nil {
-			log.Printf("Unable to establish client connection to "+servercfg.GRPCAddress+": %v", err)
+			log.With("server", servercfg.GRPCAddress).Error("unable to establish client connection", err)
 		}
 		defer conn.Close()
-		wcclient = nodepb.NewNodeServiceClient(conn)
+		wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 		ctx, err := auth.SetJWT(wcclient, network)
 		if err != nil {
-			log.Printf("Failed to authenticate: %v", err)
+			log.Error("failed to authenticate", err)
 		} else { // handle client side
-			node.SetID()
-			var header metadata.MD
-			_, err = wcclient.DeleteNode(
-				ctx,
-				&nodepb.Object{
-					Data: node.ID,
-					Type: nodepb.STRING_TYPE,
-				},
-				grpc.Header(&header),
-			)
+			_, err = wcclient.DeleteNode(ctx, &nodepbv2.NodeRequest{Id: config.GetRequestID(&node)})
 			if err != nil {
-				ncutils.PrintLog("encountered error deleting node: "+err.Error(), 1)
+				log.With("error", err.Error()).Log(logger.Verbose, "encountered error deleting node")
 			} else {
-				ncutils.PrintLog("removed machine from "+node.Network+" network on remote server", 1)
+				log.Log(logger.Verbose, "removed machine from network on remote server")
 			}
 		}
 	}
@@ -213,9 +195,9 @@ func LeaveNetwork(network string) error {
 func RemoveLocalInstance(cfg *config.ClientConfig, networkName string) error {
 	err := WipeLocal(networkName)
 	if err != nil {
-		ncutils.PrintLog("unable to wipe local config", 1)
+		logger.New(logger.NETCLIENT).With("network", networkName).With("error", err.Error()).Log(logger.Verbose, "unable to wipe local config")
 	} else {
-		ncutils.PrintLog("removed "+networkName+" network locally", 1)
+		logger.New(logger.NETCLIENT).With("network", networkName).Log(logger.Verbose, "removed network locally")
 	}
 	if cfg.Daemon != "off" {
 		if ncutils.IsWindows() {
@@ -238,7 +220,7 @@ func DeleteInterface(ifacename string, postdown string) error {
 		ipExec, errN := exec.LookPath("ip")
 		err = errN
 		if err != nil {
-			ncutils.PrintLog(err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("interface", ifacename).With("error", err.Error()).Log(logger.Verbose, "could not find ip command")
 		}
 		_, err = ncutils.RunCmd(ipExec+" link del "+ifacename, false)
 		if postdown != "" {
@@ -257,10 +239,11 @@ func WipeLocal(network string) error {
 	}
 	nodecfg := cfg.Node
 	ifacename := nodecfg.Interface
+	var log = logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", network).With("interface", ifacename)
 	if ifacename != "" {
 		if !ncutils.IsKernel() {
 			if err = wireguard.RemoveConf(ifacename, true); err == nil {
-				ncutils.PrintLog("removed WireGuard interface: "+ifacename, 1)
+				log.Log(logger.Verbose, "removed WireGuard interface")
 			}
 		} else {
 			ipExec, err := exec.LookPath("ip")
@@ -270,8 +253,7 @@ func WipeLocal(network string) error {
 			out, err := ncutils.RunCmd(ipExec+" link del "+ifacename, false)
 			dontprint := strings.Contains(out, "does not exist") || strings.Contains(out, "Cannot find device")
 			if err != nil && !dontprint {
-				ncutils.PrintLog("error running command: "+ipExec+" link del "+ifacename, 1)
-				ncutils.PrintLog(out, 1)
+				log.With("output", out).With("error", err.Error()).Log(logger.Verbose, "could not delete interface")
 			}
 			if nodecfg.PostDown != "" {
 				runcmds := strings.Split(nodecfg.PostDown, "; ")
@@ -286,9 +268,20 @@ func WipeLocal(network string) error {
 	if ncutils.FileExists(home + "nettoken-" + network) {
 		_ = os.Remove(home + "nettoken-" + network)
 	}
+	if ncutils.FileExists(home + "peers-" + network) {
+		_ = os.Remove(home + "peers-" + network)
+	}
 	if ncutils.FileExists(home + "secret-" + network) {
 		_ = os.Remove(home + "secret-" + network)
 	}
+	if ncutils.FileExists(home + "identity-" + network) {
+		_ = os.Remove(home + "identity-" + network)
+	}
+	for _, file := range auth.CertificateFiles(network) {
+		if ncutils.FileExists(file) {
+			_ = os.Remove(file)
+		}
+	}
 	if ncutils.FileExists(home + "wgkey-" + network) {
 		_ = os.Remove(home + "wgkey-" + network)
 	}
@@ -2,13 +2,12 @@ package functions
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"os/exec"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
@@ -38,14 +37,19 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 		if err != nil {
 			return err
 		}
-		if cfg.Node.Password == "" {
-			cfg.Node.Password = ncutils.GenPass()
+		// the node logs in with its identity key, a password is only kept if one was given
+		cfg.Node.IdentityKey, err = auth.GenerateIdentityKey(cfg.Node.Network)
+		if err != nil {
+			return err
+		}
+		if cfg.Node.Password != "" {
+			auth.StoreSecret(cfg.Node.Password, cfg.Node.Network)
 		}
-		auth.StoreSecret(cfg.Node.Password, cfg.Node.Network)
 	}
 
+	var joinLog = logger.New(logger.NETCLIENT).With("network", cfg.Network)
 	if cfg.Node.LocalRange != "" && cfg.Node.LocalAddress == "" {
-		log.Println("local vpn, getting local address from range: " + cfg.Node.LocalRange)
+		joinLog.With("range", cfg.Node.LocalRange).Log(logger.Info, "local vpn, getting local address from range")
 		cfg.Node.LocalAddress = getLocalIP(cfg.Node)
 	}
 
@@ -57,7 +61,7 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 			cfg.Node.Endpoint, err = ncutils.GetPublicIP()
 		}
 		if err != nil || cfg.Node.Endpoint == "" {
-			ncutils.Log("Error setting cfg.Node.Endpoint.")
+			joinLog.Error("could not set the endpoint of the node", err)
 			return err
 		}
 	}
@@ -85,16 +89,25 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 	if ncutils.IsLinux() {
 		_, err := exec.LookPath("resolvectl")
 		if err != nil {
-			ncutils.PrintLog("resolvectl not present", 2)
-			ncutils.PrintLog("unable to configure DNS automatically, disabling automated DNS management", 2)
+			joinLog.Log(logger.Debug, "resolvectl not present, disabling automated DNS management")
 			cfg.Node.DNSOn = "no"
 		}
 	}
 
+	// nodes of this machine in other networks share a host, proven by the host secret
+	hostSecret, err := auth.RetrieveHostSecret()
+	if err != nil {
+		return err
+	}
+
 	// differentiate between client/server here
 	var node models.Node // fill this node with appropriate calls
 	postnode := &models.Node{
 		Password:            cfg.Node.Password,
+		IdentityKey:         cfg.Node.IdentityKey,
+		HostID:              config.ReadHostID(),
+		HostSecret:          hostSecret,
+		Version:             ncutils.Version,
 		MacAddress:          cfg.Node.MacAddress,
 		AccessKey:           cfg.Server.AccessKey,
 		Network:             cfg.Network,
@@ -113,48 +126,49 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 	}
 
 	if cfg.Node.IsServer != "yes" {
-		ncutils.Log("joining " + cfg.Network + " at " + cfg.Server.GRPCAddress)
-		var wcclient nodepb.NodeServiceClient
+		joinLog.With("server", cfg.Server.GRPCAddress).Log(logger.Info, "joining network")
+		var wcclient nodepbv2.NodeServiceClient
 
 		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-			ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+			auth.GRPCRequestOpts(&cfg),
+			ncutils.GRPCVersionOpts())
 
 		if err != nil {
 			log.Fatalf("Unable to establish client connection to "+cfg.Server.GRPCAddress+": %v", err)
 		}
 		defer conn.Close()
-		wcclient = nodepb.NewNodeServiceClient(conn)
+		wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 		if err = config.ModConfig(postnode); err != nil {
 			return err
 		}
-		data, err := json.Marshal(postnode)
-		if err != nil {
-			return err
+		var request = &nodepbv2.NodeMessage{Node: nodepbv2.NewNode(postnode)}
+		var certificateKey []byte
+		if cfg.Server.GRPCMTLS == "on" {
+			// the server requires a client certificate on every call after joining
+			if request.CertificateRequest, certificateKey, err = auth.NewCertificateRequest(); err != nil {
+				return err
+			}
 		}
 		// Create node on server
-		res, err := wcclient.CreateNode(
-			context.TODO(),
-			&nodepb.Object{
-				Data: string(data),
-				Type: nodepb.NODE_TYPE,
-			},
-		)
+		res, err := wcclient.CreateNode(context.TODO(), request)
 		if err != nil {
 			return err
 		}
-		ncutils.PrintLog("node created on remote server...updating configs", 1)
-
-		nodeData := res.Data
-		if err = json.Unmarshal([]byte(nodeData), &node); err != nil {
-			return err
+		if certificateKey != nil {
+			if err = auth.StoreCertificate(cfg.Network, certificateKey, res.Certificate); err != nil {
+				return err
+			}
 		}
+		node = res.GetNode().ToModel()
+		joinLog = joinLog.With("node", node.ID)
+		joinLog.Log(logger.Verbose, "node created on remote server, updating configs")
 	}
 
 	// get free port based on returned default listen port
 	node.ListenPort, err = ncutils.GetFreePort(node.ListenPort)
 	if err != nil {
-		fmt.Printf("Error retrieving port: %v", err)
+		joinLog.Error("could not retrieve port", err)
 	}
 
 	// safety check. If returned node from server is local, but not currently configured as local, set to local addr
@@ -170,13 +184,17 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 		if err != nil {
 			return err
 		}
+		if node.HostID != "" && node.HostID != config.ReadHostID() {
+			if err = config.StoreHostID(node.HostID); err != nil {
+				return err
+			}
+		}
 		err = wireguard.StorePrivKey(privateKey, cfg.Network)
 		if err != nil {
 			return err
 		}
 		if node.IsPending == "yes" {
-			ncutils.Log("Node is marked as PENDING.")
-			ncutils.Log("Awaiting approval from Admin before configuring WireGuard.")
+			joinLog.Log(logger.Info, "node is pending, awaiting approval from an admin before configuring WireGuard")
 			if cfg.Daemon != "off" {
 				return daemon.InstallDaemon(cfg)
 			}
@@ -188,18 +206,18 @@ func JoinNetwork(cfg config.ClientConfig, privateKey string) error {
 		}
 		// attempt to make backup
 		if err = config.SaveBackup(node.Network); err != nil {
-			ncutils.Log("failed to make backup, node will not auto restore if config is corrupted")
+			joinLog.Error("failed to make backup, node will not auto restore if config is corrupted", err)
 		}
 	}
 
-	ncutils.Log("retrieving peers")
-	peers, hasGateway, gateways, err := server.GetPeers(node.MacAddress, cfg.Network, cfg.Server.GRPCAddress, node.IsDualStack == "yes", node.IsIngressGateway == "yes", node.IsServer == "yes")
+	joinLog.Log(logger.Info, "retrieving peers")
+	peers, hasGateway, gateways, err := server.GetPeers(config.GetRequestID(&node), cfg.Network, cfg.Server.GRPCAddress, node.IsDualStack == "yes", node.IsIngressGateway == "yes", node.IsServer == "yes")
 	if err != nil && !ncutils.IsEmptyRecord(err) {
-		ncutils.Log("failed to retrieve peers")
+		joinLog.Error("failed to retrieve peers", err)
 		return err
 	}
 
-	ncutils.Log("starting wireguard")
+	joinLog.Log(logger.Info, "starting wireguard")
 	err = wireguard.InitWireguard(&node, privateKey, peers, hasGateway, gateways)
 	if err != nil {
 		return err
@@ -4,13 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
-	"github.com/gravitl/netmaker/models"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
 )
 
 type Peer struct {
@@ -43,7 +42,7 @@ func List(network string) error {
 	for _, network := range networks {
 		net, err := getNetwork(network)
 		if err != nil {
-			ncutils.PrintLog(network+": Could not retrieve network configuration.", 1)
+			logger.New(logger.NETCLIENT).With("network", network).With("error", err.Error()).Log(logger.Verbose, "could not retrieve network configuration")
 			return err
 		}
 		nets = append(nets, net)
@@ -85,40 +84,31 @@ func getPeers(network string) ([]Peer, error) {
 		return []Peer{}, err
 	}
 	nodecfg := cfg.Node
-	var nodes []models.Node
 
-	var wcclient nodepb.NodeServiceClient
+	var wcclient nodepbv2.NodeServiceClient
 	conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-		ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+		auth.GRPCRequestOpts(cfg),
+		ncutils.GRPCVersionOpts())
 
 	if err != nil {
 		return []Peer{}, fmt.Errorf("connecting to %v: %w", cfg.Server.GRPCAddress, err)
 	}
 	defer conn.Close()
 	// Instantiate the BlogServiceClient with our client connection to the server
-	wcclient = nodepb.NewNodeServiceClient(conn)
-
-	req := &nodepb.Object{
-		Data: nodecfg.MacAddress + "###" + nodecfg.Network,
-		Type: nodepb.STRING_TYPE,
-	}
+	wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 	ctx, err := auth.SetJWT(wcclient, network)
 	if err != nil {
 		return []Peer{}, fmt.Errorf("authenticating: %w", err)
 	}
-	var header metadata.MD
 
-	response, err := wcclient.GetPeers(ctx, req, grpc.Header(&header))
+	response, err := wcclient.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: config.GetRequestID(&nodecfg)})
 	if err != nil {
 		return []Peer{}, fmt.Errorf("retrieving peers: %w", err)
 	}
-	if err := json.Unmarshal([]byte(response.GetData()), &nodes); err != nil {
-		return []Peer{}, fmt.Errorf("unmarshaling data for peers: %w", err)
-	}
 
 	peers := []Peer{}
-	for _, node := range nodes {
+	for _, node := range response.GetPeers() {
 		if node.Name != cfg.Node.Name {
 			peers = append(peers, Peer{Name: fmt.Sprintf("%v.%v", node.Name, network), PrivateIPv4: node.Address, PrivateIPv6: node.Address6})
 		}
@@ -0,0 +1,131 @@
+package functions
+
+import (
+	"time"
+
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
+	"github.com/gravitl/netmaker/netclient/auth"
+	"github.com/gravitl/netmaker/netclient/config"
+	"github.com/gravitl/netmaker/netclient/ncutils"
+	"github.com/gravitl/netmaker/netclient/server"
+	"github.com/gravitl/netmaker/netclient/wireguard"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// watchRetryInterval - wait before reopening a closed peer stream, doubled on every failed attempt
+	watchRetryInterval = 5 * time.Second
+	// watchMaxRetryInterval - longest wait before reopening a closed peer stream
+	watchMaxRetryInterval = 2 * time.Minute
+	// watchKeepalive - ping interval keeping idle peer streams open through proxies
+	watchKeepalive = 30 * time.Second
+)
+
+// WatchPeers - holds a peer stream of a network open and applies every update to its WireGuard interface
+// returns once the node is deleted, checkins keep updating peers while the stream is down
+func WatchPeers(network string) error {
+	var peers = make(map[string]*nodepbv2.Peer)
+	var token string
+	var retry = watchRetryInterval
+	for {
+		received, err := watchPeers(network, peers, &token)
+		if isDeleteError(err) {
+			logger.New(logger.NETCLIENT).With("network", network).Log(logger.Verbose, "node was removed, stopping peer updates")
+			return err
+		}
+		if received {
+			retry = watchRetryInterval
+		}
+		if err != nil {
+			logger.New(logger.NETCLIENT).With("network", network).With("retry", retry.String()).With("error", err.Error()).Log(logger.Verbose, "peer stream closed, reopening")
+		}
+		time.Sleep(retry)
+		if retry *= 2; retry > watchMaxRetryInterval {
+			retry = watchMaxRetryInterval
+		}
+	}
+}
+
+// watchPeers - receives peer updates until the stream breaks, reports whether any update was received
+func watchPeers(network string, peers map[string]*nodepbv2.Peer, token *string) (bool, error) {
+	cfg, err := config.ReadConfig(network)
+	if err != nil {
+		return false, err
+	}
+	conn, err := grpc.Dial(cfg.Server.GRPCAddress,
+		auth.GRPCRequestOpts(cfg),
+		ncutils.GRPCVersionOpts(),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: watchKeepalive}))
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	wcclient := nodepbv2.NewNodeServiceClient(conn)
+
+	ctx, err := auth.SetJWT(wcclient, network)
+	if err != nil {
+		return false, err
+	}
+	stream, err := wcclient.WatchPeers(ctx, &nodepbv2.WatchPeersRequest{
+		Id:          config.GetRequestID(&cfg.Node),
+		ResumeToken: *token,
+	})
+	if err != nil {
+		return false, err
+	}
+	var received bool
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			if nodepbv2.GetErrorCode(err) == nodepbv2.ErrorCode_ERROR_CODE_UNAUTHENTICATED {
+				// the stored token is no longer accepted, log in again before reopening
+				if loginErr := auth.AutoLogin(wcclient, network); loginErr != nil {
+					logger.New(logger.NETCLIENT).With("network", network).With("error", loginErr.Error()).Log(logger.Verbose, "could not log in")
+				}
+			}
+			return received, err
+		}
+		received = true
+		update.Apply(peers)
+		*token = update.ResumeToken
+		if err = setWatchedPeers(network, peers); err != nil {
+			logger.New(logger.NETCLIENT).With("network", network).With("error", err.Error()).Log(logger.Verbose, "could not apply peer update")
+		}
+	}
+}
+
+// setWatchedPeers - sets the streamed peers of a network on its WireGuard interface
+func setWatchedPeers(network string, peers map[string]*nodepbv2.Peer) error {
+	cfg, err := config.ReadConfig(network)
+	if err != nil {
+		return err
+	}
+	var nodes, extPeers []models.Node
+	for _, peer := range peers {
+		if peer.IsExtClient {
+			extPeers = append(extPeers, peer.ToModel())
+		} else {
+			nodes = append(nodes, peer.ToModel())
+		}
+	}
+	var dualstack = cfg.Node.IsDualStack == "yes"
+	peerConfigs, _, _, err := server.GetPeerConfigs(&cfg.Node, nodes, dualstack)
+	if err != nil {
+		return err
+	}
+	if cfg.Node.IsIngressGateway == "yes" {
+		extConfigs, err := server.GetExtPeerConfigs(&cfg.Node, extPeers, dualstack)
+		if err != nil {
+			return err
+		}
+		peerConfigs = append(peerConfigs, extConfigs...)
+	}
+	if err = wireguard.SetNodePeers(&cfg.Node, peerConfigs); err != nil {
+		return err
+	}
+	logger.New(logger.NETCLIENT).With("node", cfg.Node.ID).With("network", network).Log(logger.Verbose, "applied peer update")
+	return nil
+}
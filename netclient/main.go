@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"syscall"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/netclient/command"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/netclient/local"
@@ -21,10 +22,12 @@ import (
 )
 
 func main() {
+	ncutils.SetupLogging()
+
 	app := cli.NewApp()
 	app.Name = "Netclient CLI"
 	app.Usage = "Netmaker's netclient agent and CLI. Used to perform interactions with Netmaker server and set local WireGuard config."
-	app.Version = "v0.8.5"
+	app.Version = ncutils.Version
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -266,6 +269,19 @@ func main() {
 				return err
 			},
 		},
+		{
+			Name:  "watch",
+			Usage: "Holds a connection to the server open and applies peer changes as soon as they happen.",
+			Flags: cliFlags,
+			Action: func(c *cli.Context) error {
+				cfg, _, err := config.GetCLIConfig(c)
+				if err != nil {
+					return err
+				}
+				err = command.Watch(cfg)
+				return err
+			},
+		},
 		{
 			Name:  "push",
 			Usage: "Push configuration changes to server.",
@@ -352,7 +368,7 @@ func main() {
 				log.Println(err)
 				log.Fatal("WireGuard not installed. Please install WireGuard (wireguard-tools) and try again.")
 			}
-			ncutils.PrintLog("Running with userspace wireguard: "+uspace, 0)
+			logger.New(logger.NETCLIENT).With("wireguard", uspace).Log(logger.Info, "running with userspace wireguard")
 		} else if uspace != "wg" {
 			log.Println("running userspace WireGuard with " + uspace)
 		}
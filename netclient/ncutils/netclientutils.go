@@ -1,6 +1,7 @@
 package ncutils
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -17,6 +18,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gravitl/netmaker/logger"
+	"github.com/gravitl/netmaker/models"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
@@ -44,6 +47,9 @@ const NETCLIENT_DEFAULT_PORT = 51821
 // DEFAULT_GC_PERCENT - garbage collection percent
 const DEFAULT_GC_PERCENT = 10
 
+// Version - the version of the netclient, shared with the server on checkin
+const Version = "v0.8.5"
+
 // Log - logs a message
 func Log(message string) {
 	log.SetFlags(log.Flags() &^ (log.Llongfile | log.Lshortfile))
@@ -335,6 +341,24 @@ func GRPCRequestOpts(isSecure string) grpc.DialOption {
 	return requestOpts
 }
 
+// GRPCVersionOpts - sends the netclient version with every request, so the server can record and check it
+func GRPCVersionOpts() grpc.DialOption {
+	return grpc.WithPerRPCCredentials(versionCredentials{})
+}
+
+// versionCredentials - per request metadata carrying the netclient version
+type versionCredentials struct{}
+
+// versionCredentials.GetRequestMetadata - returns the version metadata of a request
+func (versionCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{models.NODE_VERSION_METADATA: Version}, nil
+}
+
+// versionCredentials.RequireTransportSecurity - the version is sent over insecure connections as well
+func (versionCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
 // Copy - copies a src file to dest
 func Copy(src, dst string) (int64, error) {
 	sourceFileStat, err := os.Stat(src)
@@ -407,14 +431,20 @@ func FileExists(f string) bool {
 	return !info.IsDir()
 }
 
-// PrintLog - prints log
-func PrintLog(message string, loglevel int) {
-	log.SetFlags(log.Flags() &^ (log.Llongfile | log.Lshortfile))
-	if loglevel < 2 {
-		log.Println("[netclient]", message)
+// SetupLogging - logs netclient messages up to verbose, or up to the netclient level of LOG_LEVELS
+func SetupLogging() {
+	var verbosity = logger.Verbose
+	if levels, err := logger.ParseLevels(os.Getenv("LOG_LEVELS")); err == nil {
+		if level, ok := levels[logger.NETCLIENT]; ok {
+			verbosity = level
+		}
 	}
+	logger.SetVerbosity(func(subsystem string) logger.Level {
+		return verbosity
+	})
 }
 
+
 // GetSystemNetworks - get networks locally
 func GetSystemNetworks() ([]string, error) {
 	var networks []string
@@ -1,40 +1,27 @@
 package server
 
 import (
-	"encoding/json"
+	"io/ioutil"
 	"log"
 	"net"
 	"strconv"
 	"strings"
 	"time"
 
-	nodepb "github.com/gravitl/netmaker/grpc"
+	nodepbv2 "github.com/gravitl/netmaker/grpc/v2"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/auth"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/netclient/ncutils"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
 // RELAY_KEEPALIVE_MARKER - sets the relay keepalive marker
 const RELAY_KEEPALIVE_MARKER = "20007ms"
 
-func getGrpcClient(cfg *config.ClientConfig) (nodepb.NodeServiceClient, error) {
-	var wcclient nodepb.NodeServiceClient
-	// == GRPC SETUP ==
-	conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-		ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
-
-	if err != nil {
-		return nil, err
-	}
-	defer conn.Close()
-	wcclient = nodepb.NewNodeServiceClient(conn)
-	return wcclient, nil
-}
-
 // CheckIn - checkin for node on a network
 func CheckIn(network string) (*models.Node, error) {
 	cfg, err := config.ReadConfig(network)
@@ -43,37 +30,32 @@ func CheckIn(network string) (*models.Node, error) {
 	}
 	node := cfg.Node
 	if cfg.Node.IsServer != "yes" {
-		wcclient, err := getGrpcClient(cfg)
+		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
+			auth.GRPCRequestOpts(cfg),
+			ncutils.GRPCVersionOpts())
 		if err != nil {
 			return nil, err
 		}
+		defer conn.Close()
+		wcclient := nodepbv2.NewNodeServiceClient(conn)
 		// == run client action ==
-		var header metadata.MD
 		ctx, err := auth.SetJWT(wcclient, network)
-		nodeData, err := json.Marshal(&node)
 		if err != nil {
 			return nil, err
 		}
-		response, err := wcclient.ReadNode(
-			ctx,
-			&nodepb.Object{
-				Data: string(nodeData),
-				Type: nodepb.NODE_TYPE,
-			},
-			grpc.Header(&header),
-		)
+		response, err := wcclient.CheckIn(ctx, &nodepbv2.CheckInRequest{Node: nodepbv2.NewNode(&node)})
 		if err != nil {
-			log.Printf("Encountered error checking in node: %v", err)
-		}
-		if err = json.Unmarshal([]byte(response.GetData()), &node); err != nil {
+			logger.New(logger.NETCLIENT).With("node", node.ID).With("network", network).
+				Error("could not check in node", err)
 			return nil, err
 		}
+		node = response.GetNode().ToModel()
 	}
 	return &node, err
 }
 
 // GetPeers - gets the peers for a node
-func GetPeers(macaddress string, network string, server string, dualstack bool, isIngressGateway bool, isServer bool) ([]wgtypes.PeerConfig, bool, []string, error) {
+func GetPeers(nodeid string, network string, server string, dualstack bool, isIngressGateway bool, isServer bool) ([]wgtypes.PeerConfig, bool, []string, error) {
 	hasGateway := false
 	var err error
 	var gateways []string
@@ -87,40 +69,100 @@ func GetPeers(macaddress string, network string, server string, dualstack bool,
 			log.Fatalf("Issue retrieving config for network: "+network+". Please investigate: %v", err)
 		}
 		nodecfg = cfg.Node
-		var wcclient nodepb.NodeServiceClient
+		var wcclient nodepbv2.NodeServiceClient
 		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-			ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+			auth.GRPCRequestOpts(cfg),
+			ncutils.GRPCVersionOpts())
 
 		if err != nil {
 			log.Fatalf("Unable to establish client connection to localhost:50051: %v", err)
 		}
 		defer conn.Close()
 		// Instantiate the BlogServiceClient with our client connection to the server
-		wcclient = nodepb.NewNodeServiceClient(conn)
-
-		req := &nodepb.Object{
-			Data: macaddress + "###" + network,
-			Type: nodepb.STRING_TYPE,
-		}
+		wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 		ctx, err := auth.SetJWT(wcclient, network)
 		if err != nil {
-			log.Println("Failed to authenticate.")
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).Error("failed to authenticate", err)
 			return peers, hasGateway, gateways, err
 		}
-		var header metadata.MD
 
-		response, err := wcclient.GetPeers(ctx, req, grpc.Header(&header))
+		var cached = readPeerCache(network)
+		response, err := wcclient.GetPeers(ctx, &nodepbv2.GetPeersRequest{Id: nodeid, Revision: cached.GetRevision()})
 		if err != nil {
-			log.Println("Error retrieving peers")
-			log.Println(err)
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).Error("error retrieving peers", err)
 			return nil, hasGateway, gateways, err
 		}
-		if err := json.Unmarshal([]byte(response.GetData()), &nodes); err != nil {
-			log.Println("Error unmarshaling data for peers")
-			return nil, hasGateway, gateways, err
+		var current = mergePeers(cached, response)
+		if err = storePeerCache(network, current); err != nil {
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).With("error", err.Error()).Log(logger.Verbose, "could not store peers")
+		}
+		for _, peer := range current.GetPeers() {
+			nodes = append(nodes, peer.ToModel())
+		}
+	}
+
+	peers, hasGateway, gateways, err = GetPeerConfigs(&nodecfg, nodes, dualstack)
+	if err != nil {
+		return peers, hasGateway, gateways, err
+	}
+	if isIngressGateway {
+		extPeers, err := GetExtPeers(nodeid, network, server, dualstack)
+		if err == nil {
+			peers = append(peers, extPeers...)
+		} else {
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).Error("error retrieving external peers", err)
 		}
 	}
+	return peers, hasGateway, gateways, err
+}
+
+// mergePeers - applies a peer list received from the server to the cached one
+func mergePeers(cached *nodepbv2.PeersResponse, response *nodepbv2.PeersResponse) *nodepbv2.PeersResponse {
+	if !response.Delta || cached == nil {
+		return &nodepbv2.PeersResponse{Peers: response.Peers, Revision: response.Revision}
+	}
+	var peers = nodepbv2.PeerMap(cached.Peers)
+	for _, peer := range response.Peers {
+		peers[peer.PublicKey] = peer
+	}
+	for _, publicKey := range response.RemovedPublicKeys {
+		delete(peers, publicKey)
+	}
+	var merged = &nodepbv2.PeersResponse{Revision: response.Revision}
+	for _, peer := range peers {
+		merged.Peers = append(merged.Peers, peer)
+	}
+	return merged
+}
+
+// readPeerCache - reads the last peer list received for a network, nil if there is none
+func readPeerCache(network string) *nodepbv2.PeersResponse {
+	data, err := ioutil.ReadFile(ncutils.GetNetclientPathSpecific() + "peers-" + network)
+	if err != nil {
+		return nil
+	}
+	var cached nodepbv2.PeersResponse
+	if err = proto.Unmarshal(data, &cached); err != nil {
+		return nil
+	}
+	return &cached
+}
+
+// storePeerCache - stores the peer list of a network so later requests only receive changes
+func storePeerCache(network string, peers *nodepbv2.PeersResponse) error {
+	data, err := proto.Marshal(peers)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ncutils.GetNetclientPathSpecific()+"peers-"+network, data, 0600)
+}
+
+// GetPeerConfigs - converts the peers of a node to WireGuard peer configs
+func GetPeerConfigs(nodecfg *models.Node, nodes []models.Node, dualstack bool) ([]wgtypes.PeerConfig, bool, []string, error) {
+	hasGateway := false
+	var gateways []string
+	var peers []wgtypes.PeerConfig
 
 	keepalive := nodecfg.PersistentKeepalive
 	keepalivedur, err := time.ParseDuration(strconv.FormatInt(int64(keepalive), 10) + "s")
@@ -132,7 +174,8 @@ func GetPeers(macaddress string, network string, server string, dualstack bool,
 	for _, node := range nodes {
 		pubkey, err := wgtypes.ParseKey(node.PublicKey)
 		if err != nil {
-			log.Println("error parsing key")
+			logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).With("peer", node.PublicKey).
+				Error("error parsing key", err)
 			return peers, hasGateway, gateways, err
 		}
 
@@ -176,21 +219,25 @@ func GetPeers(macaddress string, network string, server string, dualstack bool,
 			for _, iprange := range ranges { // go through each cidr for egress gateway
 				_, ipnet, err := net.ParseCIDR(iprange) // confirming it's valid cidr
 				if err != nil {
-					ncutils.PrintLog("could not parse gateway IP range. Not adding "+iprange, 1)
+					logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).With("range", iprange).
+						Log(logger.Verbose, "could not parse gateway IP range, not adding it")
 					continue // if can't parse CIDR
 				}
 				nodeEndpointArr := strings.Split(node.Endpoint, ":") // getting the public ip of node
 				if ipnet.Contains(net.ParseIP(nodeEndpointArr[0])) { // ensuring egress gateway range does not contain public ip of node
-					ncutils.PrintLog("egress IP range of "+iprange+" overlaps with "+node.Endpoint+", omitting", 2)
+					logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).With("range", iprange).With("endpoint", node.Endpoint).
+						Log(logger.Debug, "egress IP range overlaps with endpoint, omitting")
 					continue // skip adding egress range if overlaps with node's ip
 				}
 				if ipnet.Contains(net.ParseIP(nodecfg.LocalAddress)) { // ensuring egress gateway range does not contain public ip of node
-					ncutils.PrintLog("egress IP range of "+iprange+" overlaps with "+nodecfg.LocalAddress+", omitting", 2)
+					logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).With("range", iprange).With("local_address", nodecfg.LocalAddress).
+						Log(logger.Debug, "egress IP range overlaps with local address, omitting")
 					continue // skip adding egress range if overlaps with node's local ip
 				}
 				gateways = append(gateways, iprange)
 				if err != nil {
-					log.Println("ERROR ENCOUNTERED SETTING GATEWAY")
+					logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).
+						Error("error encountered setting gateway", err)
 				} else {
 					allowedips = append(allowedips, *ipnet)
 				}
@@ -234,19 +281,11 @@ func GetPeers(macaddress string, network string, server string, dualstack bool,
 		}
 		peers = append(peers, peer)
 	}
-	if isIngressGateway {
-		extPeers, err := GetExtPeers(macaddress, network, server, dualstack)
-		if err == nil {
-			peers = append(peers, extPeers...)
-		} else {
-			log.Println("ERROR RETRIEVING EXTERNAL PEERS", err)
-		}
-	}
-	return peers, hasGateway, gateways, err
+	return peers, hasGateway, gateways, nil
 }
 
 // GetExtPeers - gets the extpeers for a client
-func GetExtPeers(macaddress string, network string, server string, dualstack bool) ([]wgtypes.PeerConfig, error) {
+func GetExtPeers(nodeid string, network string, server string, dualstack bool) ([]wgtypes.PeerConfig, error) {
 	var peers []wgtypes.PeerConfig
 	var nodecfg models.Node
 	var extPeers []models.Node
@@ -260,43 +299,44 @@ func GetExtPeers(macaddress string, network string, server string, dualstack boo
 			log.Fatalf("Issue retrieving config for network: "+network+". Please investigate: %v", err)
 		}
 		nodecfg = cfg.Node
-		var wcclient nodepb.NodeServiceClient
+		var wcclient nodepbv2.NodeServiceClient
 
 		conn, err := grpc.Dial(cfg.Server.GRPCAddress,
-			ncutils.GRPCRequestOpts(cfg.Server.GRPCSSL))
+			auth.GRPCRequestOpts(cfg),
+			ncutils.GRPCVersionOpts())
 		if err != nil {
 			log.Fatalf("Unable to establish client connection to localhost:50051: %v", err)
 		}
 		defer conn.Close()
 		// Instantiate the BlogServiceClient with our client connection to the server
-		wcclient = nodepb.NewNodeServiceClient(conn)
-
-		req := &nodepb.Object{
-			Data: macaddress + "###" + network,
-			Type: nodepb.STRING_TYPE,
-		}
+		wcclient = nodepbv2.NewNodeServiceClient(conn)
 
 		ctx, err := auth.SetJWT(wcclient, network)
 		if err != nil {
-			log.Println("Failed to authenticate.")
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).Error("failed to authenticate", err)
 			return peers, err
 		}
-		var header metadata.MD
 
-		responseObject, err := wcclient.GetExtPeers(ctx, req, grpc.Header(&header))
+		response, err := wcclient.GetExtPeers(ctx, &nodepbv2.NodeRequest{Id: nodeid})
 		if err != nil {
-			log.Println("Error retrieving peers")
-			log.Println(err)
+			logger.New(logger.NETCLIENT).With("node", nodeid).With("network", network).Error("error retrieving peers", err)
 			return nil, err
 		}
-		if err = json.Unmarshal([]byte(responseObject.Data), &extPeers); err != nil {
-			return nil, err
+		for _, extPeer := range response.GetPeers() {
+			extPeers = append(extPeers, extPeer.ToModel())
 		}
 	}
+	return GetExtPeerConfigs(&nodecfg, extPeers, dualstack)
+}
+
+// GetExtPeerConfigs - converts the ext clients of an ingress gateway to WireGuard peer configs
+func GetExtPeerConfigs(nodecfg *models.Node, extPeers []models.Node, dualstack bool) ([]wgtypes.PeerConfig, error) {
+	var peers []wgtypes.PeerConfig
 	for _, extPeer := range extPeers {
 		pubkey, err := wgtypes.ParseKey(extPeer.PublicKey)
 		if err != nil {
-			log.Println("error parsing key")
+			logger.New(logger.NETCLIENT).With("node", nodecfg.ID).With("network", nodecfg.Network).With("peer", extPeer.PublicKey).
+				Error("error parsing key", err)
 			return peers, err
 		}
 
@@ -326,5 +366,5 @@ func GetExtPeers(macaddress string, network string, server string, dualstack boo
 		}
 		peers = append(peers, peer)
 	}
-	return peers, err
+	return peers, nil
 }
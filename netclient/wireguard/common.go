@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/config"
 	"github.com/gravitl/netmaker/netclient/local"
@@ -25,18 +26,18 @@ func SetPeers(iface string, keepalive int32, peers []wgtypes.PeerConfig) error {
 
 	client, err := wgctrl.New()
 	if err != nil {
-		ncutils.PrintLog("failed to start wgctrl", 0)
+		logger.New(logger.NETCLIENT).With("interface", iface).Error("failed to start wgctrl", err)
 		return err
 	}
 
 	device, err := client.Device(iface)
 	if err != nil {
-		ncutils.PrintLog("failed to parse interface", 0)
+		logger.New(logger.NETCLIENT).With("interface", iface).Error("failed to parse interface", err)
 		return err
 	}
 	devicePeers := device.Peers
 	if len(devicePeers) > 1 && len(peers) == 0 {
-		ncutils.PrintLog("no peers pulled", 1)
+		logger.New(logger.NETCLIENT).With("interface", iface).Log(logger.Verbose, "no peers pulled")
 		return err
 	}
 
@@ -172,10 +173,11 @@ func InitWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 			newConf, _ = ncutils.CreateUserSpaceConf(node.Address, key.String(), "", node.MTU, node.PersistentKeepalive, peers)
 		}
 		confPath := ncutils.GetNetclientPathSpecific() + ifacename + ".conf"
-		ncutils.PrintLog("writing wg conf file to: "+confPath, 1)
+		logger.New(logger.NETCLIENT).With("node", node.ID).With("network", node.Network).With("path", confPath).Log(logger.Verbose, "writing wg conf file")
 		err = ioutil.WriteFile(confPath, []byte(newConf), 0644)
 		if err != nil {
-			ncutils.PrintLog("error writing wg conf file to "+confPath+": "+err.Error(), 1)
+			logger.New(logger.NETCLIENT).With("node", node.ID).With("network", node.Network).With("path", confPath).With("error", err.Error()).
+				Log(logger.Verbose, "error writing wg conf file")
 			return err
 		}
 		// spin up userspace / windows interface + apply the conf file
@@ -194,7 +196,8 @@ func InitWireguard(node *models.Node, privkey string, peers []wgtypes.PeerConfig
 		}
 		err = ApplyConf(confPath)
 		if err != nil {
-			ncutils.PrintLog("failed to create wireguard interface", 1)
+			logger.New(logger.NETCLIENT).With("node", node.ID).With("network", node.Network).With("interface", ifacename).With("error", err.Error()).
+				Log(logger.Verbose, "failed to create wireguard interface")
 			return err
 		}
 	} else {
@@ -271,7 +274,7 @@ func SetWGConfig(network string, peerupdate bool) error {
 	servercfg := cfg.Server
 	nodecfg := cfg.Node
 
-	peers, hasGateway, gateways, err := server.GetPeers(nodecfg.MacAddress, nodecfg.Network, servercfg.GRPCAddress, nodecfg.IsDualStack == "yes", nodecfg.IsIngressGateway == "yes", nodecfg.IsServer == "yes")
+	peers, hasGateway, gateways, err := server.GetPeers(config.GetRequestID(&nodecfg), nodecfg.Network, servercfg.GRPCAddress, nodecfg.IsDualStack == "yes", nodecfg.IsIngressGateway == "yes", nodecfg.IsServer == "yes")
 	if err != nil {
 		return err
 	}
@@ -280,21 +283,26 @@ func SetWGConfig(network string, peerupdate bool) error {
 		return err
 	}
 	if peerupdate {
-		var iface string
-		iface = nodecfg.Interface
-		if ncutils.IsMac() {
-			iface, err = local.GetMacIface(nodecfg.Address)
-			if err != nil {
-				return err
-			}
-		}
-		err = SetPeers(iface, nodecfg.PersistentKeepalive, peers)
+		err = SetNodePeers(&nodecfg, peers)
 	} else {
 		err = InitWireguard(&nodecfg, privkey, peers, hasGateway, gateways)
 	}
 	return err
 }
 
+// SetNodePeers - sets peers on the WireGuard interface of a node
+func SetNodePeers(nodecfg *models.Node, peers []wgtypes.PeerConfig) error {
+	var iface = nodecfg.Interface
+	if ncutils.IsMac() {
+		var err error
+		iface, err = local.GetMacIface(nodecfg.Address)
+		if err != nil {
+			return err
+		}
+	}
+	return SetPeers(iface, nodecfg.PersistentKeepalive, peers)
+}
+
 // RemoveConf - removes a configuration for a given WireGuard interface
 func RemoveConf(iface string, printlog bool) error {
 	os := runtime.GOOS
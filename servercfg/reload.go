@@ -0,0 +1,84 @@
+package servercfg
+
+import (
+	"os"
+	"reflect"
+
+	"github.com/gravitl/netmaker/config"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// ReloadResult - what a config reload changed
+type ReloadResult struct {
+	// Applied - the settings that changed and are in use now
+	Applied []string
+	// Overridden - the settings that changed in the file but are set by env, which wins
+	Overridden []string
+	// NeedRestart - true when other settings changed, those only apply after a restart
+	NeedRestart bool
+}
+
+// Reload - re-reads the config file and applies the settings which are safe to change while running:
+// verbosity, loglevels, checkininterval, servercheckininterval and allowedorigin
+func Reload() (ReloadResult, error) {
+	var result ReloadResult
+	loaded, err := config.Load(config.ConfigFile())
+	if err != nil {
+		return result, err
+	}
+	if err = validateVerbosity(loaded.Server.Verbosity); err != nil {
+		return result, err
+	}
+	if _, err = logger.ParseLevels(loaded.Server.LogLevels); err != nil {
+		return result, err
+	}
+	if loaded.Server.CheckinInterval != "" {
+		if err = validateCheckinInterval(loaded.Server.CheckinInterval); err != nil {
+			return result, err
+		}
+	}
+	if err = validateServerCheckinInterval(loaded.Server.ServerCheckinInterval); err != nil {
+		return result, err
+	}
+	if loaded.Server.AllowedOrigin != "" {
+		if err = validateAllowedOrigin(loaded.Server.AllowedOrigin); err != nil {
+			return result, err
+		}
+	}
+
+	var current = config.Get()
+	var next = *current
+	var apply = func(setting, env string, changed bool) {
+		if !changed {
+			return
+		}
+		if os.Getenv(env) != "" {
+			result.Overridden = append(result.Overridden, setting)
+		} else {
+			result.Applied = append(result.Applied, setting)
+		}
+	}
+	apply("verbosity", "VERBOSITY", loaded.Server.Verbosity != current.Server.Verbosity)
+	apply("loglevels", "LOG_LEVELS", loaded.Server.LogLevels != current.Server.LogLevels)
+	apply("checkininterval", "CHECKIN_INTERVAL", loaded.Server.CheckinInterval != current.Server.CheckinInterval)
+	apply("servercheckininterval", "SERVER_CHECKIN_INTERVAL", loaded.Server.ServerCheckinInterval != current.Server.ServerCheckinInterval)
+	apply("allowedorigin", "CORS_ALLOWED_ORIGIN", loaded.Server.AllowedOrigin != current.Server.AllowedOrigin)
+	next.Server.Verbosity = loaded.Server.Verbosity
+	next.Server.LogLevels = loaded.Server.LogLevels
+	next.Server.CheckinInterval = loaded.Server.CheckinInterval
+	next.Server.ServerCheckinInterval = loaded.Server.ServerCheckinInterval
+	next.Server.AllowedOrigin = loaded.Server.AllowedOrigin
+
+	// whatever else differs from the running config still needs a restart
+	var rest = *loaded
+	rest.Server.Verbosity = current.Server.Verbosity
+	rest.Server.LogLevels = current.Server.LogLevels
+	rest.Server.CheckinInterval = current.Server.CheckinInterval
+	rest.Server.ServerCheckinInterval = current.Server.ServerCheckinInterval
+	rest.Server.AllowedOrigin = current.Server.AllowedOrigin
+	result.NeedRestart = !reflect.DeepEqual(rest, *current)
+
+	config.Set(&next)
+	SetLogLevels()
+	return result, nil
+}
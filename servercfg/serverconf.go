@@ -1,6 +1,7 @@
 package servercfg
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/gravitl/netmaker/config"
+	"github.com/gravitl/netmaker/logger"
 )
 
 // SetHost - sets the host ip
@@ -69,13 +71,53 @@ func GetServerConfig() config.ServerConfig {
 	cfg.Database = GetDB()
 	cfg.Platform = GetPlatform()
 	cfg.Version = GetVersion()
+	cfg.MinClientVersion = GetMinClientVersion()
+	cfg.LogFormat = GetLogFormat()
+	cfg.LogLevels = GetLogLevels()
 
 	// == auth config ==
 	var authInfo = GetAuthProviderInfo()
 	cfg.AuthProvider = authInfo[0]
 	cfg.ClientID = authInfo[1]
-	cfg.ClientSecret = authInfo[2]
+	if authInfo[2] != "" {
+		cfg.ClientSecret = "(hidden)"
+	}
 	cfg.FrontendURL = GetFrontendURL()
+	cfg.OIDCIssuer = GetOIDCIssuer()
+	cfg.OIDCScopes = strings.Join(GetOIDCScopes(), " ")
+	cfg.OIDCUsernameClaim = GetOIDCUsernameClaim()
+	cfg.OIDCGroupsClaim = GetOIDCGroupsClaim()
+	cfg.GroupMappings = GetGroupMappings()
+	cfg.LDAPURL = GetLDAPURL()
+	cfg.LDAPBindDN = GetLDAPBindDN()
+	cfg.LDAPBindPassword = "(hidden)"
+	cfg.LDAPBaseDN = GetLDAPBaseDN()
+	cfg.LDAPUserFilter = GetLDAPUserFilter()
+	cfg.LDAPGroupAttribute = GetLDAPGroupAttribute()
+	cfg.LDAPStartTLS = "off"
+	if IsLDAPStartTLS() {
+		cfg.LDAPStartTLS = "on"
+	}
+	cfg.TOTPRequiredForAdmins = "off"
+	if IsTOTPRequiredForAdmins() {
+		cfg.TOTPRequiredForAdmins = "on"
+	}
+	cfg.RESTTLSCert = GetRESTTLSCert()
+	cfg.RESTTLSKey = GetRESTTLSKey()
+	cfg.RESTTLSClientCA = GetRESTTLSClientCA()
+	cfg.RESTRedirectPort = GetRESTRedirectPort()
+	cfg.GRPCMTLS = "off"
+	if IsGRPCMTLS() {
+		cfg.GRPCMTLS = "on"
+	}
+	cfg.GRPCReflection = "off"
+	if IsGRPCReflection() {
+		cfg.GRPCReflection = "on"
+	}
+	cfg.ExcludeOfflinePeers = "off"
+	if IsExcludeOfflinePeers() {
+		cfg.ExcludeOfflinePeers = "on"
+	}
 
 	return cfg
 }
@@ -85,8 +127,8 @@ func GetFrontendURL() string {
 	var frontend = ""
 	if os.Getenv("FRONTEND_URL") != "" {
 		frontend = os.Getenv("FRONTEND_URL")
-	} else if config.Config.Server.FrontendURL != "" {
-		frontend = config.Config.Server.FrontendURL
+	} else if config.Get().Server.FrontendURL != "" {
+		frontend = config.Get().Server.FrontendURL
 	}
 	return frontend
 }
@@ -96,8 +138,8 @@ func GetAPIConnString() string {
 	conn := ""
 	if os.Getenv("SERVER_API_CONN_STRING") != "" {
 		conn = os.Getenv("SERVER_API_CONN_STRING")
-	} else if config.Config.Server.APIConnString != "" {
-		conn = config.Config.Server.APIConnString
+	} else if config.Get().Server.APIConnString != "" {
+		conn = config.Get().Server.APIConnString
 	}
 	return conn
 }
@@ -105,8 +147,19 @@ func GetAPIConnString() string {
 // GetVersion - version of netmaker
 func GetVersion() string {
 	version := "0.8.5"
-	if config.Config.Server.Version != "" {
-		version = config.Config.Server.Version
+	if config.Get().Server.Version != "" {
+		version = config.Get().Server.Version
+	}
+	return version
+}
+
+// GetMinClientVersion - oldest netclient version allowed to connect, any version is allowed by default
+func GetMinClientVersion() string {
+	version := ""
+	if os.Getenv("MIN_CLIENT_VERSION") != "" {
+		version = os.Getenv("MIN_CLIENT_VERSION")
+	} else if config.Get().Server.MinClientVersion != "" {
+		version = config.Get().Server.MinClientVersion
 	}
 	return version
 }
@@ -116,8 +169,8 @@ func GetDB() string {
 	database := "sqlite"
 	if os.Getenv("DATABASE") != "" {
 		database = os.Getenv("DATABASE")
-	} else if config.Config.Server.Database != "" {
-		database = config.Config.Server.Database
+	} else if config.Get().Server.Database != "" {
+		database = config.Get().Server.Database
 	}
 	return database
 }
@@ -128,8 +181,8 @@ func GetAPIHost() string {
 	remoteip, _ := GetPublicIP()
 	if os.Getenv("SERVER_HTTP_HOST") != "" {
 		serverhost = os.Getenv("SERVER_HTTP_HOST")
-	} else if config.Config.Server.APIHost != "" {
-		serverhost = config.Config.Server.APIHost
+	} else if config.Get().Server.APIHost != "" {
+		serverhost = config.Get().Server.APIHost
 	} else if os.Getenv("SERVER_HOST") != "" {
 		serverhost = os.Getenv("SERVER_HOST")
 	} else {
@@ -154,19 +207,68 @@ func GetAPIPort() string {
 	apiport := "8081"
 	if os.Getenv("API_PORT") != "" {
 		apiport = os.Getenv("API_PORT")
-	} else if config.Config.Server.APIPort != "" {
-		apiport = config.Config.Server.APIPort
+	} else if config.Get().Server.APIPort != "" {
+		apiport = config.Get().Server.APIPort
 	}
 	return apiport
 }
 
+// IsRESTTLS - checks if the API serves TLS itself, on when a certificate and key are set
+func IsRESTTLS() bool {
+	return GetRESTTLSCert() != "" && GetRESTTLSKey() != ""
+}
+
+// GetRESTTLSCert - gets the path of the certificate the API serves TLS with
+func GetRESTTLSCert() string {
+	cert := ""
+	if os.Getenv("REST_TLS_CERT") != "" {
+		cert = os.Getenv("REST_TLS_CERT")
+	} else if config.Get().Server.RESTTLSCert != "" {
+		cert = config.Get().Server.RESTTLSCert
+	}
+	return cert
+}
+
+// GetRESTTLSKey - gets the path of the private key of the API certificate
+func GetRESTTLSKey() string {
+	key := ""
+	if os.Getenv("REST_TLS_KEY") != "" {
+		key = os.Getenv("REST_TLS_KEY")
+	} else if config.Get().Server.RESTTLSKey != "" {
+		key = config.Get().Server.RESTTLSKey
+	}
+	return key
+}
+
+// GetRESTTLSClientCA - gets the path of the authority whose client certificates authenticate admins on the API, off when empty
+func GetRESTTLSClientCA() string {
+	ca := ""
+	if os.Getenv("REST_TLS_CLIENT_CA") != "" {
+		ca = os.Getenv("REST_TLS_CLIENT_CA")
+	} else if config.Get().Server.RESTTLSClientCA != "" {
+		ca = config.Get().Server.RESTTLSClientCA
+	}
+	return ca
+}
+
+// GetRESTRedirectPort - gets the port plain HTTP requests are redirected to the TLS API from, off when empty
+func GetRESTRedirectPort() string {
+	port := ""
+	if os.Getenv("REST_REDIRECT_PORT") != "" {
+		port = os.Getenv("REST_REDIRECT_PORT")
+	} else if config.Get().Server.RESTRedirectPort != "" {
+		port = config.Get().Server.RESTRedirectPort
+	}
+	return port
+}
+
 // GetCheckinInterval - get check in interval for nodes
 func GetCheckinInterval() string {
 	seconds := "15"
 	if os.Getenv("CHECKIN_INTERVAL") != "" {
 		seconds = os.Getenv("CHECKIN_INTERVAL")
-	} else if config.Config.Server.CheckinInterval != "" {
-		seconds = config.Config.Server.CheckinInterval
+	} else if config.Get().Server.CheckinInterval != "" {
+		seconds = config.Get().Server.CheckinInterval
 	}
 	return seconds
 }
@@ -178,8 +280,8 @@ func GetDefaultNodeLimit() int32 {
 	envlimit, err := strconv.Atoi(os.Getenv("DEFAULT_NODE_LIMIT"))
 	if err == nil && envlimit != 0 {
 		limit = int32(envlimit)
-	} else if config.Config.Server.DefaultNodeLimit != 0 {
-		limit = config.Config.Server.DefaultNodeLimit
+	} else if config.Get().Server.DefaultNodeLimit != 0 {
+		limit = config.Get().Server.DefaultNodeLimit
 	}
 	return limit
 }
@@ -189,8 +291,8 @@ func GetGRPCConnString() string {
 	conn := ""
 	if os.Getenv("SERVER_GRPC_CONN_STRING") != "" {
 		conn = os.Getenv("SERVER_GRPC_CONN_STRING")
-	} else if config.Config.Server.GRPCConnString != "" {
-		conn = config.Config.Server.GRPCConnString
+	} else if config.Get().Server.GRPCConnString != "" {
+		conn = config.Get().Server.GRPCConnString
 	}
 	return conn
 }
@@ -200,8 +302,8 @@ func GetCoreDNSAddr() string {
 	addr, _ := GetPublicIP()
 	if os.Getenv("COREDNS_ADDR") != "" {
 		addr = os.Getenv("COREDNS_ADDR")
-	} else if config.Config.Server.CoreDNSAddr != "" {
-		addr = config.Config.Server.GRPCConnString
+	} else if config.Get().Server.CoreDNSAddr != "" {
+		addr = config.Get().Server.GRPCConnString
 	}
 	return addr
 }
@@ -212,8 +314,8 @@ func GetGRPCHost() string {
 	remoteip, _ := GetPublicIP()
 	if os.Getenv("SERVER_GRPC_HOST") != "" {
 		serverhost = os.Getenv("SERVER_GRPC_HOST")
-	} else if config.Config.Server.GRPCHost != "" {
-		serverhost = config.Config.Server.GRPCHost
+	} else if config.Get().Server.GRPCHost != "" {
+		serverhost = config.Get().Server.GRPCHost
 	} else if os.Getenv("SERVER_HOST") != "" {
 		serverhost = os.Getenv("SERVER_HOST")
 	} else {
@@ -229,8 +331,8 @@ func GetGRPCPort() string {
 	grpcport := "50051"
 	if os.Getenv("GRPC_PORT") != "" {
 		grpcport = os.Getenv("GRPC_PORT")
-	} else if config.Config.Server.GRPCPort != "" {
-		grpcport = config.Config.Server.GRPCPort
+	} else if config.Get().Server.GRPCPort != "" {
+		grpcport = config.Get().Server.GRPCPort
 	}
 	return grpcport
 }
@@ -240,8 +342,8 @@ func GetMasterKey() string {
 	key := "secretkey"
 	if os.Getenv("MASTER_KEY") != "" {
 		key = os.Getenv("MASTER_KEY")
-	} else if config.Config.Server.MasterKey != "" {
-		key = config.Config.Server.MasterKey
+	} else if config.Get().Server.MasterKey != "" {
+		key = config.Get().Server.MasterKey
 	}
 	return key
 }
@@ -251,8 +353,8 @@ func GetAllowedOrigin() string {
 	allowedorigin := "*"
 	if os.Getenv("CORS_ALLOWED_ORIGIN") != "" {
 		allowedorigin = os.Getenv("CORS_ALLOWED_ORIGIN")
-	} else if config.Config.Server.AllowedOrigin != "" {
-		allowedorigin = config.Config.Server.AllowedOrigin
+	} else if config.Get().Server.AllowedOrigin != "" {
+		allowedorigin = config.Get().Server.AllowedOrigin
 	}
 	return allowedorigin
 }
@@ -264,8 +366,8 @@ func IsRestBackend() bool {
 		if os.Getenv("REST_BACKEND") == "off" {
 			isrest = false
 		}
-	} else if config.Config.Server.RestBackend != "" {
-		if config.Config.Server.RestBackend == "off" {
+	} else if config.Get().Server.RestBackend != "" {
+		if config.Get().Server.RestBackend == "off" {
 			isrest = false
 		}
 	}
@@ -279,8 +381,8 @@ func IsAgentBackend() bool {
 		if os.Getenv("AGENT_BACKEND") == "off" {
 			isagent = false
 		}
-	} else if config.Config.Server.AgentBackend != "" {
-		if config.Config.Server.AgentBackend == "off" {
+	} else if config.Get().Server.AgentBackend != "" {
+		if config.Get().Server.AgentBackend == "off" {
 			isagent = false
 		}
 	}
@@ -297,11 +399,11 @@ func IsClientMode() string {
 		if os.Getenv("CLIENT_MODE") == "contained" {
 			isclient = "contained"
 		}
-	} else if config.Config.Server.ClientMode != "" {
-		if config.Config.Server.ClientMode == "off" {
+	} else if config.Get().Server.ClientMode != "" {
+		if config.Get().Server.ClientMode == "off" {
 			isclient = "off"
 		}
-		if config.Config.Server.ClientMode == "contained" {
+		if config.Get().Server.ClientMode == "contained" {
 			isclient = "contained"
 		}
 	}
@@ -315,8 +417,8 @@ func IsDNSMode() bool {
 		if os.Getenv("DNS_MODE") == "off" {
 			isdns = false
 		}
-	} else if config.Config.Server.DNSMode != "" {
-		if config.Config.Server.DNSMode == "off" {
+	} else if config.Get().Server.DNSMode != "" {
+		if config.Get().Server.DNSMode == "off" {
 			isdns = false
 		}
 	}
@@ -330,8 +432,8 @@ func IsGRPCSSL() bool {
 		if os.Getenv("GRPC_SSL") == "on" {
 			isssl = true
 		}
-	} else if config.Config.Server.DNSMode != "" {
-		if config.Config.Server.DNSMode == "on" {
+	} else if config.Get().Server.DNSMode != "" {
+		if config.Get().Server.DNSMode == "on" {
 			isssl = true
 		}
 	}
@@ -345,8 +447,8 @@ func DisableRemoteIPCheck() bool {
 		if os.Getenv("DISABLE_REMOTE_IP_CHECK") == "on" {
 			disabled = true
 		}
-	} else if config.Config.Server.DisableRemoteIPCheck != "" {
-		if config.Config.Server.DisableRemoteIPCheck == "on" {
+	} else if config.Get().Server.DisableRemoteIPCheck != "" {
+		if config.Get().Server.DisableRemoteIPCheck == "on" {
 			disabled = true
 		}
 	}
@@ -360,8 +462,8 @@ func DisableDefaultNet() bool {
 		if os.Getenv("DISABLE_DEFAULT_NET") == "on" {
 			disabled = true
 		}
-	} else if config.Config.Server.DisableDefaultNet != "" {
-		if config.Config.Server.DisableDefaultNet == "on" {
+	} else if config.Get().Server.DisableDefaultNet != "" {
+		if config.Get().Server.DisableDefaultNet == "on" {
 			disabled = true
 		}
 	}
@@ -399,7 +501,10 @@ func GetPublicIP() (string, error) {
 // GetVerbose - get the verbosity of server
 func GetVerbose() int32 {
 	level, err := strconv.Atoi(os.Getenv("VERBOSITY"))
-	if err != nil || level < 0 {
+	if err != nil {
+		level = int(config.Get().Server.Verbosity)
+	}
+	if level < 0 {
 		level = 0
 	}
 	if level > 3 {
@@ -408,13 +513,50 @@ func GetVerbose() int32 {
 	return int32(level)
 }
 
+// GetLogFormat - gets the format of log lines, logfmt or json
+func GetLogFormat() string {
+	format := logger.FORMAT_LOGFMT
+	if os.Getenv("LOG_FORMAT") != "" {
+		format = os.Getenv("LOG_FORMAT")
+	} else if config.Get().Server.LogFormat != "" {
+		format = config.Get().Server.LogFormat
+	}
+	return format
+}
+
+// GetLogLevels - gets the verbosities of single subsystems, like "grpc=3,api=1"
+func GetLogLevels() string {
+	levels := ""
+	if os.Getenv("LOG_LEVELS") != "" {
+		levels = os.Getenv("LOG_LEVELS")
+	} else if config.Get().Server.LogLevels != "" {
+		levels = config.Get().Server.LogLevels
+	}
+	return levels
+}
+
+// SetLogLevels - applies VERBOSITY and the log levels to the logger, they are parsed here once instead of on every message
+func SetLogLevels() {
+	var verbosity = logger.Level(GetVerbose())
+	levels, err := logger.ParseLevels(GetLogLevels())
+	if err != nil {
+		levels = nil
+	}
+	logger.SetVerbosity(func(subsystem string) logger.Level {
+		if level, ok := levels[subsystem]; ok {
+			return level
+		}
+		return verbosity
+	})
+}
+
 // GetPlatform - get the system type of server
 func GetPlatform() string {
 	platform := "linux"
 	if os.Getenv("PLATFORM") != "" {
 		platform = os.Getenv("PLATFORM")
-	} else if config.Config.Server.Platform != "" {
-		platform = config.Config.Server.SQLConn
+	} else if config.Get().Server.Platform != "" {
+		platform = config.Get().Server.Platform
 	}
 	return platform
 }
@@ -424,8 +566,8 @@ func GetSQLConn() string {
 	sqlconn := "http://"
 	if os.Getenv("SQL_CONN") != "" {
 		sqlconn = os.Getenv("SQL_CONN")
-	} else if config.Config.Server.SQLConn != "" {
-		sqlconn = config.Config.Server.SQLConn
+	} else if config.Get().Server.SQLConn != "" {
+		sqlconn = config.Get().Server.SQLConn
 	}
 	return sqlconn
 }
@@ -435,7 +577,7 @@ func IsSplitDNS() bool {
 	issplit := false
 	if os.Getenv("IS_SPLIT_DNS") == "yes" {
 		issplit = true
-	} else if config.Config.Server.SplitDNS == "yes" {
+	} else if config.Get().Server.SplitDNS == "yes" {
 		issplit = true
 	}
 	return issplit
@@ -447,8 +589,8 @@ func GetNodeID() string {
 	id = getMacAddr()
 	if os.Getenv("NODE_ID") != "" {
 		id = os.Getenv("NODE_ID")
-	} else if config.Config.Server.NodeID != "" {
-		id = config.Config.Server.NodeID
+	} else if config.Get().Server.NodeID != "" {
+		id = config.Get().Server.NodeID
 	}
 	return id
 }
@@ -459,8 +601,8 @@ func GetServerCheckinInterval() int64 {
 	var envt, _ = strconv.Atoi(os.Getenv("SERVER_CHECKIN_INTERVAL"))
 	if envt > 0 {
 		t = int64(envt)
-	} else if config.Config.Server.ServerCheckinInterval > 0 {
-		t = config.Config.Server.ServerCheckinInterval
+	} else if config.Get().Server.ServerCheckinInterval > 0 {
+		t = config.Get().Server.ServerCheckinInterval
 	}
 	return t
 }
@@ -470,20 +612,208 @@ func GetAuthProviderInfo() []string {
 	var authProvider = ""
 	if os.Getenv("AUTH_PROVIDER") != "" && os.Getenv("CLIENT_ID") != "" && os.Getenv("CLIENT_SECRET") != "" {
 		authProvider = strings.ToLower(os.Getenv("AUTH_PROVIDER"))
-		if authProvider == "google" || authProvider == "azure-ad" || authProvider == "github" {
+		if authProvider == "google" || authProvider == "azure-ad" || authProvider == "github" || authProvider == "oidc" {
 			return []string{authProvider, os.Getenv("CLIENT_ID"), os.Getenv("CLIENT_SECRET")}
 		} else {
 			authProvider = ""
 		}
-	} else if config.Config.Server.AuthProvider != "" && config.Config.Server.ClientID != "" && config.Config.Server.ClientSecret != "" {
-		authProvider = strings.ToLower(config.Config.Server.AuthProvider)
-		if authProvider == "google" || authProvider == "azure-ad" || authProvider == "github" {
-			return []string{authProvider, config.Config.Server.ClientID, config.Config.Server.ClientSecret}
+	} else if config.Get().Server.AuthProvider != "" && config.Get().Server.ClientID != "" && config.Get().Server.ClientSecret != "" {
+		authProvider = strings.ToLower(config.Get().Server.AuthProvider)
+		if authProvider == "google" || authProvider == "azure-ad" || authProvider == "github" || authProvider == "oidc" {
+			return []string{authProvider, config.Get().Server.ClientID, config.Get().Server.ClientSecret}
 		}
 	}
 	return []string{"", "", ""}
 }
 
+// GetOIDCIssuer - gets the issuer url of the OpenID Connect provider
+func GetOIDCIssuer() string {
+	var issuer = ""
+	if os.Getenv("OIDC_ISSUER") != "" {
+		issuer = os.Getenv("OIDC_ISSUER")
+	} else if config.Get().Server.OIDCIssuer != "" {
+		issuer = config.Get().Server.OIDCIssuer
+	}
+	return issuer
+}
+
+// GetOIDCScopes - gets the scopes requested from the OpenID Connect provider, always includes openid
+func GetOIDCScopes() []string {
+	var scopes = "openid email profile"
+	if os.Getenv("OIDC_SCOPES") != "" {
+		scopes = os.Getenv("OIDC_SCOPES")
+	} else if config.Get().Server.OIDCScopes != "" {
+		scopes = config.Get().Server.OIDCScopes
+	}
+	var result = []string{"openid"}
+	for _, scope := range strings.FieldsFunc(scopes, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if scope != "openid" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// GetOIDCUsernameClaim - gets the ID token claim used as the netmaker username
+func GetOIDCUsernameClaim() string {
+	var claim = "email"
+	if os.Getenv("OIDC_USERNAME_CLAIM") != "" {
+		claim = os.Getenv("OIDC_USERNAME_CLAIM")
+	} else if config.Get().Server.OIDCUsernameClaim != "" {
+		claim = config.Get().Server.OIDCUsernameClaim
+	}
+	return claim
+}
+
+// GetOIDCGroupsClaim - gets the ID token claim holding the user's groups
+func GetOIDCGroupsClaim() string {
+	var claim = "groups"
+	if os.Getenv("OIDC_GROUPS_CLAIM") != "" {
+		claim = os.Getenv("OIDC_GROUPS_CLAIM")
+	} else if config.Get().Server.OIDCGroupsClaim != "" {
+		claim = config.Get().Server.OIDCGroupsClaim
+	}
+	return claim
+}
+
+// GetGroupMappings - gets the rules mapping identity provider groups to networks and admin,
+// GROUP_MAPPINGS is expected to hold a json list of mappings
+func GetGroupMappings() []config.GroupMapping {
+	var mappings []config.GroupMapping
+	if os.Getenv("GROUP_MAPPINGS") != "" {
+		if err := json.Unmarshal([]byte(os.Getenv("GROUP_MAPPINGS")), &mappings); err == nil {
+			return mappings
+		}
+	}
+	return config.Get().Server.GroupMappings
+}
+
+// GetLDAPURL - gets the url of the LDAP server used to authenticate users, ldap is disabled when empty
+func GetLDAPURL() string {
+	var url = ""
+	if os.Getenv("LDAP_URL") != "" {
+		url = os.Getenv("LDAP_URL")
+	} else if config.Get().Server.LDAPURL != "" {
+		url = config.Get().Server.LDAPURL
+	}
+	return url
+}
+
+// IsLDAPEnabled - checks if users may authenticate against an LDAP server
+func IsLDAPEnabled() bool {
+	return GetLDAPURL() != ""
+}
+
+// GetLDAPBindDN - gets the DN of the service account used to search for users
+func GetLDAPBindDN() string {
+	var dn = ""
+	if os.Getenv("LDAP_BIND_DN") != "" {
+		dn = os.Getenv("LDAP_BIND_DN")
+	} else if config.Get().Server.LDAPBindDN != "" {
+		dn = config.Get().Server.LDAPBindDN
+	}
+	return dn
+}
+
+// GetLDAPBindPassword - gets the password of the LDAP service account
+func GetLDAPBindPassword() string {
+	var password = ""
+	if os.Getenv("LDAP_BIND_PASSWORD") != "" {
+		password = os.Getenv("LDAP_BIND_PASSWORD")
+	} else if config.Get().Server.LDAPBindPassword != "" {
+		password = config.Get().Server.LDAPBindPassword
+	}
+	return password
+}
+
+// GetLDAPBaseDN - gets the DN users are searched under
+func GetLDAPBaseDN() string {
+	var dn = ""
+	if os.Getenv("LDAP_BASE_DN") != "" {
+		dn = os.Getenv("LDAP_BASE_DN")
+	} else if config.Get().Server.LDAPBaseDN != "" {
+		dn = config.Get().Server.LDAPBaseDN
+	}
+	return dn
+}
+
+// GetLDAPUserFilter - gets the filter used to find a user, %s is replaced with the username
+func GetLDAPUserFilter() string {
+	var filter = "(uid=%s)"
+	if os.Getenv("LDAP_USER_FILTER") != "" {
+		filter = os.Getenv("LDAP_USER_FILTER")
+	} else if config.Get().Server.LDAPUserFilter != "" {
+		filter = config.Get().Server.LDAPUserFilter
+	}
+	return filter
+}
+
+// GetLDAPGroupAttribute - gets the user attribute listing the user's groups
+func GetLDAPGroupAttribute() string {
+	var attribute = "memberOf"
+	if os.Getenv("LDAP_GROUP_ATTRIBUTE") != "" {
+		attribute = os.Getenv("LDAP_GROUP_ATTRIBUTE")
+	} else if config.Get().Server.LDAPGroupAttribute != "" {
+		attribute = config.Get().Server.LDAPGroupAttribute
+	}
+	return attribute
+}
+
+// IsLDAPStartTLS - checks if the LDAP connection should be upgraded with StartTLS
+func IsLDAPStartTLS() bool {
+	var starttls = false
+	if os.Getenv("LDAP_STARTTLS") != "" {
+		starttls = os.Getenv("LDAP_STARTTLS") == "on"
+	} else if config.Get().Server.LDAPStartTLS != "" {
+		starttls = config.Get().Server.LDAPStartTLS == "on"
+	}
+	return starttls
+}
+
+// IsTOTPRequiredForAdmins - checks if admins must use a second factor to log in
+func IsTOTPRequiredForAdmins() bool {
+	var required = false
+	if os.Getenv("TOTP_REQUIRED_FOR_ADMINS") != "" {
+		required = os.Getenv("TOTP_REQUIRED_FOR_ADMINS") == "on"
+	} else if config.Get().Server.TOTPRequiredForAdmins != "" {
+		required = config.Get().Server.TOTPRequiredForAdmins == "on"
+	}
+	return required
+}
+
+// IsGRPCMTLS - checks if the GRPC listener serves TLS and requires client certificates issued to nodes, off by default
+func IsGRPCMTLS() bool {
+	var enabled = false
+	if os.Getenv("GRPC_MTLS") != "" {
+		enabled = os.Getenv("GRPC_MTLS") == "on"
+	} else if config.Get().Server.GRPCMTLS != "" {
+		enabled = config.Get().Server.GRPCMTLS == "on"
+	}
+	return enabled
+}
+
+// IsGRPCReflection - checks if gRPC server reflection is served, off by default
+func IsGRPCReflection() bool {
+	var enabled = false
+	if os.Getenv("GRPC_REFLECTION") != "" {
+		enabled = os.Getenv("GRPC_REFLECTION") == "on"
+	} else if config.Get().Server.GRPCReflection != "" {
+		enabled = config.Get().Server.GRPCReflection == "on"
+	}
+	return enabled
+}
+
+// IsExcludeOfflinePeers - checks if offline nodes are left out of the peer lists of their networks, off by default
+func IsExcludeOfflinePeers() bool {
+	var enabled = false
+	if os.Getenv("EXCLUDE_OFFLINE_PEERS") != "" {
+		enabled = os.Getenv("EXCLUDE_OFFLINE_PEERS") == "on"
+	} else if config.Get().Server.ExcludeOfflinePeers != "" {
+		enabled = config.Get().Server.ExcludeOfflinePeers == "on"
+	}
+	return enabled
+}
+
 // GetMacAddr - get's mac address
 func getMacAddr() string {
 	ifas, err := net.Interfaces()
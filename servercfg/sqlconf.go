@@ -20,8 +20,8 @@ func GetSQLHost() string {
 	host := "localhost"
 	if os.Getenv("SQL_HOST") != "" {
 		host = os.Getenv("SQL_HOST")
-	} else if config.Config.SQL.Host != "" {
-		host = config.Config.SQL.Host
+	} else if config.Get().SQL.Host != "" {
+		host = config.Get().SQL.Host
 	}
 	return host
 }
@@ -30,8 +30,8 @@ func GetSQLPort() int32 {
 	envport, err := strconv.Atoi(os.Getenv("SQL_PORT"))
 	if err == nil && envport != 0 {
 		port = int32(envport)
-	} else if config.Config.SQL.Port != 0 {
-		port = config.Config.SQL.Port
+	} else if config.Get().SQL.Port != 0 {
+		port = config.Get().SQL.Port
 	}
 	return port
 }
@@ -39,8 +39,8 @@ func GetSQLUser() string {
 	user := "posgres"
 	if os.Getenv("SQL_USER") != "" {
 		user = os.Getenv("SQL_USER")
-	} else if config.Config.SQL.Username != "" {
-		user = config.Config.SQL.Username
+	} else if config.Get().SQL.Username != "" {
+		user = config.Get().SQL.Username
 	}
 	return user
 }
@@ -48,8 +48,8 @@ func GetSQLPass() string {
 	pass := "nopass"
 	if os.Getenv("SQL_PASS") != "" {
 		pass = os.Getenv("SQL_PASS")
-	} else if config.Config.SQL.Password != "" {
-		pass = config.Config.SQL.Password
+	} else if config.Get().SQL.Password != "" {
+		pass = config.Get().SQL.Password
 	}
 	return pass
 }
@@ -57,8 +57,8 @@ func GetSQLDB() string {
 	db := "netmaker"
 	if os.Getenv("SQL_DB") != "" {
 		db = os.Getenv("SQL_DB")
-	} else if config.Config.SQL.DB != "" {
-		db = config.Config.SQL.DB
+	} else if config.Get().SQL.DB != "" {
+		db = config.Get().SQL.DB
 	}
 	return db
 }
@@ -66,8 +66,8 @@ func GetSQLSSLMode() string {
 	sslmode := "disable"
 	if os.Getenv("SQL_SSL_MODE") != "" {
 		sslmode = os.Getenv("SQL_SSL_MODE")
-	} else if config.Config.SQL.SSLMode != "" {
-		sslmode = config.Config.SQL.SSLMode
+	} else if config.Get().SQL.SSLMode != "" {
+		sslmode = config.Get().SQL.SSLMode
 	}
 	return sslmode
 }
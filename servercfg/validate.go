@@ -0,0 +1,177 @@
+package servercfg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gravitl/netmaker/config"
+	"github.com/gravitl/netmaker/logger"
+)
+
+// versionFormat - versions like v0.8.5 or 0.9.0-rc1, as compared by the netclient version checks
+var versionFormat = regexp.MustCompile(`^v?\d+(\.\d+)*(-.*)?$`)
+
+// Validate - checks the effective server config, env overrides included, and reports every invalid setting at once
+func Validate() error {
+	var problems []string
+	var check = func(setting string, err error) {
+		if err != nil {
+			problems = append(problems, setting+": "+err.Error())
+		}
+	}
+	var server = config.Get().Server
+
+	check("API_PORT", validatePort(GetAPIPort()))
+	check("GRPC_PORT", validatePort(GetGRPCPort()))
+	if IsRestBackend() && IsAgentBackend() && GetAPIPort() == GetGRPCPort() {
+		problems = append(problems, "GRPC_PORT: must differ from API_PORT")
+	}
+	if GetRESTRedirectPort() != "" {
+		check("REST_REDIRECT_PORT", validatePort(GetRESTRedirectPort()))
+		if !IsRESTTLS() {
+			problems = append(problems, "REST_REDIRECT_PORT: only used with REST_TLS_CERT and REST_TLS_KEY")
+		}
+	}
+	if (GetRESTTLSCert() == "") != (GetRESTTLSKey() == "") {
+		problems = append(problems, "REST_TLS_CERT, REST_TLS_KEY: must be set together")
+	}
+	check("REST_TLS_CERT", validateFile(GetRESTTLSCert()))
+	check("REST_TLS_KEY", validateFile(GetRESTTLSKey()))
+	check("REST_TLS_CLIENT_CA", validateFile(GetRESTTLSClientCA()))
+	if GetRESTTLSClientCA() != "" && !IsRESTTLS() {
+		problems = append(problems, "REST_TLS_CLIENT_CA: only used with REST_TLS_CERT and REST_TLS_KEY")
+	}
+
+	if os.Getenv("VERBOSITY") != "" {
+		level, err := strconv.Atoi(os.Getenv("VERBOSITY"))
+		if err != nil {
+			problems = append(problems, "VERBOSITY: must be a number")
+		} else {
+			check("VERBOSITY", validateVerbosity(int32(level)))
+		}
+	} else {
+		check("verbosity", validateVerbosity(server.Verbosity))
+	}
+	check("LOG_FORMAT", logger.ValidateFormat(GetLogFormat()))
+	_, err := logger.ParseLevels(GetLogLevels())
+	check("LOG_LEVELS", err)
+	check("CHECKIN_INTERVAL", validateCheckinInterval(GetCheckinInterval()))
+	if os.Getenv("SERVER_CHECKIN_INTERVAL") != "" {
+		check("SERVER_CHECKIN_INTERVAL", validateCheckinInterval(os.Getenv("SERVER_CHECKIN_INTERVAL")))
+	} else {
+		check("servercheckininterval", validateServerCheckinInterval(server.ServerCheckinInterval))
+	}
+	if os.Getenv("DEFAULT_NODE_LIMIT") != "" {
+		if limit, err := strconv.Atoi(os.Getenv("DEFAULT_NODE_LIMIT")); err != nil || limit < 1 {
+			problems = append(problems, "DEFAULT_NODE_LIMIT: must be a positive number")
+		}
+	} else if server.DefaultNodeLimit < 0 {
+		problems = append(problems, "defaultnodelimit: must be a positive number")
+	}
+	check("CORS_ALLOWED_ORIGIN", validateAllowedOrigin(GetAllowedOrigin()))
+
+	switch GetDB() {
+	case "sqlite", "rqlite", "postgres":
+	default:
+		problems = append(problems, "DATABASE: must be one of sqlite, rqlite or postgres")
+	}
+	if version := GetMinClientVersion(); version != "" && !versionFormat.MatchString(version) {
+		problems = append(problems, "MIN_CLIENT_VERSION: must be a version like v0.8.5")
+	}
+
+	var provider = os.Getenv("AUTH_PROVIDER")
+	if provider == "" {
+		provider = server.AuthProvider
+	}
+	switch strings.ToLower(provider) {
+	case "":
+	case "google", "azure-ad", "github", "oidc":
+		if GetAuthProviderInfo()[0] == "" {
+			problems = append(problems, "AUTH_PROVIDER: needs CLIENT_ID and CLIENT_SECRET")
+		}
+		if strings.ToLower(provider) == "oidc" && GetOIDCIssuer() == "" {
+			problems = append(problems, "AUTH_PROVIDER: oidc needs OIDC_ISSUER")
+		}
+	default:
+		problems = append(problems, "AUTH_PROVIDER: must be one of google, azure-ad, github or oidc")
+	}
+	if IsLDAPEnabled() {
+		if ldapURL, err := url.Parse(GetLDAPURL()); err != nil || (ldapURL.Scheme != "ldap" && ldapURL.Scheme != "ldaps") {
+			problems = append(problems, "LDAP_URL: must be an ldap:// or ldaps:// url")
+		}
+		if GetLDAPBaseDN() == "" {
+			problems = append(problems, "LDAP_BASE_DN: needed with LDAP_URL")
+		}
+	}
+	if os.Getenv("GROUP_MAPPINGS") != "" {
+		var mappings []config.GroupMapping
+		if err := json.Unmarshal([]byte(os.Getenv("GROUP_MAPPINGS")), &mappings); err != nil {
+			problems = append(problems, "GROUP_MAPPINGS: must be a json list of group mappings")
+		}
+	}
+	for i, mapping := range GetGroupMappings() {
+		if mapping.Group == "" {
+			problems = append(problems, fmt.Sprintf("groupmappings[%d]: group is empty", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid server config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validatePort(port string) error {
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("%q is not a port between 1 and 65535", port)
+	}
+	return nil
+}
+
+func validateFile(file string) error {
+	if file == "" {
+		return nil
+	}
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("cannot read %s", file)
+	}
+	return nil
+}
+
+func validateVerbosity(level int32) error {
+	if level < 0 || level > 3 {
+		return fmt.Errorf("%d is not between 0 and 3", level)
+	}
+	return nil
+}
+
+func validateCheckinInterval(seconds string) error {
+	if number, err := strconv.Atoi(seconds); err != nil || number < 1 {
+		return fmt.Errorf("%q is not a positive number of seconds", seconds)
+	}
+	return nil
+}
+
+// validateServerCheckinInterval - 0 in the config file means the default
+func validateServerCheckinInterval(seconds int64) error {
+	if seconds < 0 {
+		return fmt.Errorf("%d is not a positive number of seconds", seconds)
+	}
+	return nil
+}
+
+func validateAllowedOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if originURL, err := url.Parse(origin); err != nil || originURL.Scheme == "" || originURL.Host == "" {
+		return fmt.Errorf("%q is neither * nor an origin like https://dashboard.example.com", origin)
+	}
+	return nil
+}
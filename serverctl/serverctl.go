@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/gravitl/netmaker/database"
+	"github.com/gravitl/netmaker/logger"
 	"github.com/gravitl/netmaker/logic"
 	"github.com/gravitl/netmaker/models"
 	"github.com/gravitl/netmaker/netclient/ncutils"
@@ -65,7 +66,7 @@ func copy(src, dst string) (int64, error) {
 	nBytes, err := io.Copy(destination, source)
 	err = os.Chmod(dst, 0755)
 	if err != nil {
-		logic.Log(err.Error(), 1)
+		logger.New(logger.SERVER).With("path", dst).With("error", err.Error()).Log(logger.Verbose, "could not make the file executable")
 	}
 	return nBytes, err
 }
@@ -83,7 +84,7 @@ func InitServerNetclient() error {
 	if os.IsNotExist(err) {
 		os.MkdirAll(netclientDir+"/config", 744)
 	} else if err != nil {
-		logic.Log("[netmaker] could not find or create "+netclientDir, 1)
+		logger.New(logger.SERVER).With("path", netclientDir).With("error", err.Error()).Log(logger.Verbose, "could not find or create the netclient directory")
 		return err
 	}
 	return nil
@@ -102,16 +103,15 @@ func HandleContainedClient() error {
 		for _, serverNet := range servernets {
 			err = logic.ServerCheckin(servercfg.GetNodeID(), serverNet.NetID)
 			if err != nil {
-				logic.Log("error occurred during server checkin: "+err.Error(), 1)
+				logger.New(logger.SERVER).With("network", serverNet.NetID).With("error", err.Error()).Log(logger.Verbose, "error occurred during server checkin")
 			} else {
-				logic.Log("completed peers check of network "+serverNet.NetID, 3)
+				logger.New(logger.SERVER).With("network", serverNet.NetID).Log(logger.Trace, "completed peers check of network")
 			}
 		}
 		err := SyncNetworks(servernets)
 		if err != nil {
-			logic.Log("error syncing networks: "+err.Error(), 1)
+			logger.New(logger.SERVER).With("error", err.Error()).Log(logger.Verbose, "error syncing networks")
 		}
-		// logic.Log("completed a checkin call", 3)
 	}
 	return nil
 }
@@ -138,7 +138,7 @@ func SyncNetworks(servernets []models.Network) error {
 					err = errors.New("network add failed for " + servernet.NetID)
 				}
 				if servercfg.GetVerbose() >= 1 {
-					if !strings.Contains(err.Error(), "macaddress_unique") { // ignore macaddress unique error throws
+					if !strings.Contains(err.Error(), "has already joined network") { // ignore networks the server is part of already
 						log.Printf("[netmaker] error adding network %s during sync %s \n", servernet.NetID, err)
 					}
 				}